@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// 合并短时间内发送的通知
+type batcher struct {
+	conn   *Conn
+	window time.Duration
+	max    int
+
+	mux   sync.Mutex
+	queue []interface{}
+	stop  func() // 取消定时器，为空表示没有定时器。
+}
+
+// AutoBatch 自动合并通知
+//
+// 启用之后，由 [Conn.Notify] 发送的通知不再立即发送，
+// 而是在 window 之后将这段时间内的所有通知合并为一个批量请求发送，
+// 适用于遥测数据等短时间内大量发送通知的场景，需要对方支持批量请求。
+// 积累的通知达到 max 条时会立即发送，为 0 表示不限制数量。
+//
+// 由定时器触发的发送，其错误只能通过 errlog 输出；
+// 可以通过 [Conn.Flush] 立即发送积累的通知。
+// window 小于等于 0 表示取消自动合并，已经积累的通知会立即发送。
+//
+// NOTE: 需要在使用 Conn 之前调用。
+func (conn *Conn) AutoBatch(window time.Duration, max int) error {
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+
+	if window <= 0 {
+		conn.batcher = nil
+		return nil
+	}
+
+	conn.batcher = &batcher{
+		conn:   conn,
+		window: window,
+		max:    max,
+	}
+	return nil
+}
+
+// Flush 立即发送由 [Conn.AutoBatch] 积累的通知
+func (conn *Conn) Flush() error {
+	if conn.batcher == nil {
+		return nil
+	}
+	return conn.batcher.flush()
+}
+
+func (b *batcher) add(v interface{}) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.queue = append(b.queue, v)
+	if b.max > 0 && len(b.queue) >= b.max {
+		return b.write()
+	}
+
+	if b.stop == nil {
+		b.stop = afterFunc(b.conn.server.clock, b.window, func() {
+			if err := b.flush(); err != nil {
+				b.conn.printErr(err)
+			}
+		})
+	}
+	return nil
+}
+
+func (b *batcher) flush() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.write()
+}
+
+// 发送积累的通知，调用方需要持有锁。
+func (b *batcher) write() error {
+	if b.stop != nil {
+		b.stop()
+		b.stop = nil
+	}
+
+	q := b.queue
+	b.queue = nil
+
+	switch len(q) {
+	case 0:
+		return nil
+	case 1: // 只有一条时，无需以批量请求的方式发送。
+		return b.conn.writeNotify(nil, q[0], q)
+	default:
+		return b.conn.writeNotify(nil, q, q)
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_AutoBatch(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	out := &syncBuffer{}
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out, nil), nil)
+	a.NotError(conn.AutoBatch(50*time.Millisecond, 0))
+
+	a.NotError(conn.Notify("f1", nil)).
+		NotError(conn.Notify("f2", nil)).
+		NotError(conn.Notify("f3", nil))
+	a.Equal(out.String(), "")
+
+	time.Sleep(200 * time.Millisecond)
+	list := make([]*body, 0, 3)
+	a.NotError(json.Unmarshal([]byte(out.String()), &list)).
+		Length(list, 3).
+		Equal(list[0].Method, "f1").
+		Equal(list[2].Method, "f3")
+
+	// 单条通知不以批量请求的方式发送
+	out.Reset()
+	a.NotError(conn.Notify("f1", nil))
+	a.NotError(conn.Flush())
+	req := &body{}
+	a.NotError(json.Unmarshal([]byte(out.String()), req)).Equal(req.Method, "f1")
+
+	// 达到数量限制
+	out.Reset()
+	a.NotError(conn.AutoBatch(time.Hour, 2))
+	a.NotError(conn.Notify("f1", nil)).Equal(out.String(), "")
+	a.NotError(conn.Notify("f2", nil))
+	list = make([]*body, 0, 2)
+	a.NotError(json.Unmarshal([]byte(out.String()), &list)).Length(list, 2)
+
+	// 取消之后，积累的通知会立即发送。
+	out.Reset()
+	a.NotError(conn.Notify("f1", nil)).Equal(out.String(), "")
+	a.NotError(conn.AutoBatch(0, 0))
+	a.NotEqual(out.String(), "")
+
+	out.Reset()
+	a.NotError(conn.Notify("f2", nil))
+	req = &body{}
+	a.NotError(json.Unmarshal([]byte(out.String()), req)).Equal(req.Method, "f2")
+
+	// 统计数据和写入错误
+	conn = srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failWriter{}, nil), nil)
+	conn.CollectStats(false)
+	events := conn.Events()
+	a.NotError(conn.AutoBatch(time.Hour, 0))
+	a.NotError(conn.Notify("f1", nil)).
+		NotError(conn.Notify("f2", nil)).
+		Error(conn.Flush())
+	a.Equal((<-events).Type, EventWriteError).
+		Equal(conn.Stats().Calls["f1"].Calls, 1).
+		Equal(conn.Stats().Calls["f2"].Calls, 1)
+}
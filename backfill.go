@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// 分组通知中表示游标的扩展字段
+const cursorField = "cursor"
+
+// ErrCursorExpired 游标之后的部分通知已经不在缓存中
+//
+// 由 [Conn.JoinSince] 返回，此时依然会加入分组并补发缓存中的所有通知，
+// 调用方可以据此判断是否需要通过其它方式同步完整的状态。
+var ErrCursorExpired = errors.New("jsonrpc: 游标已经过期")
+
+// 分组的通知
+type groupEvent struct {
+	cursor uint64
+	method string
+	params json.RawMessage
+}
+
+// 保存分组最近通知的环形缓存
+type ringBuffer struct {
+	events []groupEvent
+	next   int    // 下一条通知写入的位置
+	full   bool   // 是否已经写满
+	cursor uint64 // 最后一条通知的游标
+}
+
+// GroupBuffer 为分组 name 缓存最近的 size 条通知
+//
+// 缓存之后，由 [Server.NotifyGroup] 发送的通知都会带有递增的游标，
+// 以 cursor 字段附加在通知的顶层，对方需要通过 [Server.KeepExtensions] 才能读取；
+// 连接在加入（或是重新加入）分组时，可以通过 [Conn.JoinSince] 或 [Conn.JoinLast]
+// 补发断开期间错过的通知。
+//
+// 缓存与分组的成员无关，即使分组中没有任何连接，通知依然会被缓存。
+// 仅缓存服务名和参数，补发时不会包含发送时指定的 [CallOption]。
+// size 小于等于 0 表示取消缓存，重新指定 size 会清空已有的缓存。
+func (s *Server) GroupBuffer(name string, size int) {
+	g := &s.groups
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	if size <= 0 {
+		delete(g.buffers, name)
+		return
+	}
+
+	if g.buffers == nil {
+		g.buffers = make(map[string]*ringBuffer, 10)
+	}
+	var cursor uint64
+	if b, found := g.buffers[name]; found {
+		cursor = b.cursor
+	}
+	g.buffers[name] = &ringBuffer{events: make([]groupEvent, size), cursor: cursor}
+}
+
+// GroupCursor 分组 name 最后一条通知的游标
+//
+// 如果未通过 [Server.GroupBuffer] 指定缓存，则始终返回 0。
+func (s *Server) GroupCursor(name string) uint64 {
+	s.groups.mux.RLock()
+	defer s.groups.mux.RUnlock()
+	if b, found := s.groups.buffers[name]; found {
+		return b.cursor
+	}
+	return 0
+}
+
+// JoinSince 加入分组 name 并补发游标 cursor 之后的通知
+//
+// cursor 一般为客户端最后收到的通知中的 cursor 字段，为 0 表示补发缓存中的所有通知。
+// 如果 cursor 之后的部分通知已经不在缓存中，则返回 [ErrCursorExpired]。
+//
+// NOTE: 补发的通知可能与加入之后新产生的通知交错到达，对方可以根据游标进行排序和去重。
+func (conn *Conn) JoinSince(name string, cursor uint64) error {
+	events, expired := conn.joinBuffered(name, func(b *ringBuffer) ([]groupEvent, bool) {
+		return b.since(cursor)
+	})
+	if err := conn.backfill(events); err != nil {
+		return err
+	}
+	if expired {
+		return ErrCursorExpired
+	}
+	return nil
+}
+
+// JoinLast 加入分组 name 并补发最近的 n 条通知
+//
+// 缓存中的通知不足 n 条时，补发所有通知。其它与 [Conn.JoinSince] 相同。
+func (conn *Conn) JoinLast(name string, n int) error {
+	events, _ := conn.joinBuffered(name, func(b *ringBuffer) ([]groupEvent, bool) {
+		return b.last(n), false
+	})
+	return conn.backfill(events)
+}
+
+// 加入分组并在同一个锁内获取需要补发的通知，保证两者之间不会有遗漏。
+func (conn *Conn) joinBuffered(name string, f func(*ringBuffer) ([]groupEvent, bool)) ([]groupEvent, bool) {
+	g := &conn.server.groups
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	g.join(conn, name)
+	if b, found := g.buffers[name]; found {
+		return f(b)
+	}
+	return nil, false
+}
+
+func (conn *Conn) backfill(events []groupEvent) error {
+	for _, e := range events {
+		var in interface{}
+		if e.params != nil {
+			in = encodedParams(e.params)
+		}
+		if err := conn.Notify(e.method, in, withCursor(e.cursor)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 在用户指定的元数据之外附加游标
+//
+// 需要放在所有选项的最后。
+func withCursor(cursor uint64) CallOption {
+	return func(o *callOptions) {
+		md := make(map[string]json.RawMessage, len(o.metadata)+1)
+		for k, v := range o.metadata {
+			md[k] = v
+		}
+		md[cursorField] = json.RawMessage(strconv.FormatUint(cursor, 10))
+		o.metadata = md
+	}
+}
+
+// 添加一条通知并返回其游标
+func (b *ringBuffer) add(method string, params json.RawMessage) uint64 {
+	b.cursor++
+	b.events[b.next] = groupEvent{cursor: b.cursor, method: method, params: params}
+	b.next++
+	if b.next == len(b.events) {
+		b.next = 0
+		b.full = true
+	}
+	return b.cursor
+}
+
+// 按时间顺序返回缓存的所有通知
+func (b *ringBuffer) all() []groupEvent {
+	if !b.full {
+		return append([]groupEvent(nil), b.events[:b.next]...)
+	}
+	events := make([]groupEvent, 0, len(b.events))
+	events = append(events, b.events[b.next:]...)
+	return append(events, b.events[:b.next]...)
+}
+
+func (b *ringBuffer) last(n int) []groupEvent {
+	events := b.all()
+	if n < len(events) {
+		events = events[len(events)-n:]
+	}
+	return events
+}
+
+// 返回游标 cursor 之后的通知，以及是否有通知已经不在缓存中。
+func (b *ringBuffer) since(cursor uint64) ([]groupEvent, bool) {
+	events := b.all()
+	if len(events) == 0 {
+		return nil, cursor < b.cursor
+	}
+
+	expired := events[0].cursor > cursor+1
+	for i, e := range events {
+		if e.cursor > cursor {
+			return events[i:], expired
+		}
+	}
+	return nil, expired
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestRingBuffer(t *testing.T) {
+	a := assert.New(t, false)
+
+	b := &ringBuffer{events: make([]groupEvent, 3)}
+	a.Empty(b.all()).Empty(b.last(2))
+	events, expired := b.since(0)
+	a.Empty(events).False(expired)
+
+	for i := 0; i < 5; i++ {
+		b.add("m", nil)
+	}
+	a.Equal(b.cursor, 5)
+	cursors := func(events []groupEvent) []uint64 {
+		c := make([]uint64, 0, len(events))
+		for _, e := range events {
+			c = append(c, e.cursor)
+		}
+		return c
+	}
+	a.Equal(cursors(b.all()), []uint64{3, 4, 5}).
+		Equal(cursors(b.last(2)), []uint64{4, 5}).
+		Equal(cursors(b.last(10)), []uint64{3, 4, 5})
+
+	events, expired = b.since(3)
+	a.Equal(cursors(events), []uint64{4, 5}).False(expired)
+	events, expired = b.since(2)
+	a.Equal(cursors(events), []uint64{3, 4, 5}).False(expired)
+	events, expired = b.since(1)
+	a.Equal(cursors(events), []uint64{3, 4, 5}).True(expired)
+	events, expired = b.since(5)
+	a.Empty(events).False(expired)
+}
+
+func TestConn_JoinSince(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srv.GroupBuffer("room", 2)
+
+	// 没有成员时依然缓存
+	a.NotError(srv.NotifyGroup("room", "f1", &inType{Age: 1})).
+		NotError(srv.NotifyGroup("room", "f1", &inType{Age: 2})).
+		NotError(srv.NotifyGroup("room", "f1", nil, WithMetadata(map[string]json.RawMessage{"trace": json.RawMessage(`1`)}))).
+		Equal(srv.GroupCursor("room"), 3).
+		Equal(srv.GroupCursor("not-exists"), 0)
+
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out, nil), nil)
+	a.Equal(conn.JoinSince("room", 1), nil)
+	a.Equal(strings.Count(out.String(), `"jsonrpc"`), 2).
+		Contains(out.String(), `"params":{"last":"","first":"","Age":2},"cursor":2`).
+		Contains(out.String(), `"cursor":3`).NotContains(out.String(), `"trace"`)
+
+	// 新的通知附加游标
+	out.Reset()
+	a.NotError(srv.NotifyGroup("room", "f1", &inType{Age: 4}))
+	a.Contains(out.String(), `"cursor":4`).Contains(out.String(), `"Age":4`)
+
+	// 游标过期
+	out.Reset()
+	conn.Leave("room")
+	a.Equal(conn.JoinSince("room", 0), ErrCursorExpired)
+	a.Contains(out.String(), `"cursor":3`).Contains(out.String(), `"cursor":4`).
+		Equal(srv.GroupSize("room"), 1)
+
+	out.Reset()
+	a.NotError(conn.JoinLast("room", 1))
+	a.Contains(out.String(), `"cursor":4`).NotContains(out.String(), `"cursor":3`)
+
+	// 重新指定缓存，游标继续递增。
+	srv.GroupBuffer("room", 5)
+	out.Reset()
+	a.NotError(conn.JoinLast("room", 3)).Empty(out.String())
+	a.NotError(srv.NotifyGroup("room", "f1", nil))
+	a.Contains(out.String(), `"cursor":5`)
+
+	// 未缓存的分组
+	srv.GroupBuffer("room", 0)
+	out.Reset()
+	a.NotError(conn.JoinSince("room", 0)).Empty(out.String())
+	a.NotError(srv.NotifyGroup("room", "f1", nil))
+	a.NotContains(out.String(), `"cursor"`)
+}
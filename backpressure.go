@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBackpressure 等待返回数据的请求数量超过了 [Conn.MaxOutstanding] 的限制
+var ErrBackpressure = errors.New("等待返回数据的请求过多")
+
+type outstanding struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// MaxOutstanding 限制等待返回数据的请求数量
+//
+// 对方处理缓慢时，等待返回数据的请求会不断累积，导致内存无限增长。
+// 指定之后，等待返回数据的请求达到 n 时，[Conn.Send] 和 [Conn.SendContext]
+// 最多等待 wait，之后返回 [ErrBackpressure]，wait 为 0 表示立即返回；
+// 在等待期间，ctx 被取消也会返回 ctx 的错误。
+// 收到返回数据（包括错误信息）之后，请求即不再占用名额。
+//
+// n 小于等于 0 表示不作限制。通知不需要等待返回数据，不受此限制。
+//
+// NOTE: 需要在 [Conn.Send] 之前调用。
+func (conn *Conn) MaxOutstanding(n int, wait time.Duration) {
+	if n <= 0 {
+		conn.outstanding = nil
+		return
+	}
+	conn.outstanding = &outstanding{slots: make(chan struct{}, n), wait: wait}
+}
+
+// 为 p 获取一个名额
+func (conn *Conn) acquire(ctx context.Context, p *pending) error {
+	o := conn.outstanding
+	if o == nil {
+		return nil
+	}
+
+	select {
+	case o.slots <- struct{}{}:
+		p.slots = o.slots
+		return nil
+	default:
+		if o.wait <= 0 {
+			return ErrBackpressure
+		}
+	}
+
+	c, stop := conn.server.clock.NewTimer(o.wait)
+	defer stop()
+	select {
+	case o.slots <- struct{}{}:
+		p.slots = o.slots
+		return nil
+	case <-c:
+		return ErrBackpressure
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 释放 p 占用的名额，可以多次调用。
+func release(p *pending) {
+	if p.slots != nil && atomic.CompareAndSwapInt32(&p.freed, 0, 1) {
+		<-p.slots
+	}
+}
+
+// 删除 id 对应的等待中的请求，并释放其占用的名额。
+func (conn *Conn) deletePending(id *ID) {
+	if v, found := conn.callbacks.Load(id); found {
+		if p, ok := v.(*pending); ok {
+			release(p)
+		}
+	}
+	conn.callbacks.Delete(id)
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_MaxOutstanding(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	conn := srv.NewConn(NewStreamTransport(true, new(bytes.Buffer), new(bytes.Buffer), nil), nil)
+	cb := func(*outType) error { return nil }
+	result := json.RawMessage(`{}`)
+
+	conn.MaxOutstanding(2, 0)
+	a.NotError(conn.Send("f1", &inType{Age: 1}, cb)).
+		NotError(conn.Send("f1", &inType{Age: 2}, cb)).
+		Equal(conn.Send("f1", &inType{Age: 3}, cb), ErrBackpressure).
+		NotError(conn.Notify("f1", &inType{Age: 3}))
+
+	ids := make([]*ID, 0, 2)
+	conn.callbacks.Range(func(v interface{}) bool {
+		ids = append(ids, v.(*pending).id)
+		return true
+	})
+	a.Length(ids, 2)
+
+	// 收到返回数据之后释放名额
+	conn.serve(&body{Version: Version, ID: ids[0], Result: &result}, 0)
+	a.NotError(conn.Send("f1", &inType{Age: 3}, cb)).
+		Equal(conn.Send("f1", &inType{Age: 4}, cb), ErrBackpressure)
+
+	// 错误信息也会释放名额
+	conn.serve(&body{Version: Version, ID: ids[1], Error: NewError(CodeInternalError, "error")}, 0)
+	a.NotError(conn.Send("f1", &inType{Age: 4}, cb))
+
+	// 等待名额
+	conn.MaxOutstanding(1, 500*time.Millisecond)
+	a.NotError(conn.Send("f1", &inType{Age: 5}, cb))
+	start := time.Now()
+	a.Equal(conn.Send("f1", &inType{Age: 6}, cb), ErrBackpressure).
+		True(time.Since(start) >= 500*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	a.Equal(conn.SendContext(ctx, "f1", &inType{Age: 6}, cb), context.DeadlineExceeded)
+
+	var id *ID
+	conn.callbacks.Range(func(v interface{}) bool {
+		if p := v.(*pending); cap(p.slots) == 1 {
+			id = p.id
+		}
+		return true
+	})
+	a.NotNil(id)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.serve(&body{Version: Version, ID: id, Result: &result}, 0)
+	}()
+	a.NotError(conn.Send("f1", &inType{Age: 6}, cb))
+
+	// 取消限制
+	conn.MaxOutstanding(0, 0)
+	a.NotError(conn.Send("f1", &inType{Age: 7}, cb))
+}
@@ -0,0 +1,427 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// Call 批量请求中的单个请求
+type Call struct {
+	// 请求的服务名
+	Method string
+
+	// 请求的参数，可以为空。
+	Params interface{}
+
+	// 是否为通知类型的请求
+	Notify bool
+}
+
+// 批量请求的默认限制，参考 [Server.BatchLimits]。
+const (
+	defaultBatchSize    = 1000
+	defaultBatchWorkers = 16
+)
+
+// Notification 批量发送的通知
+type Notification struct {
+	// 通知的服务名
+	Method string
+
+	// 通知的参数，可以为空。
+	Params interface{}
+}
+
+// NotifyBatch 以批量请求的方式发送多个通知
+//
+// ns 会被编码为一个 JSON 数组，在同一帧中发送，需要对方支持批量请求。
+// ns 为空时不发送任何内容。
+func (conn *Conn) NotifyBatch(ns []Notification) error {
+	if len(ns) == 0 {
+		return nil
+	}
+
+	reqs := make([]interface{}, 0, len(ns))
+	for _, n := range ns {
+		req, err := conn.server.newRequest(true, n.Method, n.Params)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+	return conn.writeNotify(nil, reqs, reqs)
+}
+
+// Batch 批量请求的构建器
+//
+// 由 [Conn.Batch] 创建，通过 Send 和 Notify 添加请求，
+// 最后由 Flush 将所有请求编码为一个 JSON 数组，在同一帧中发送。
+// 返回数据由 [Conn.Serve] 读取，并交由各自的回调函数处理，需要对方支持批量请求。
+//
+// 添加请求时发生的错误会被保存，并由 Flush 返回，之后添加的请求都会被忽略。
+// 不能在多个协程中同时使用。
+type Batch struct {
+	conn    *Conn
+	values  []interface{}
+	methods []string
+	ids     []*ID // 非通知请求的 ID
+	err     error
+}
+
+// Batch 创建批量请求的构建器
+func (conn *Conn) Batch() *Batch { return &Batch{conn: conn} }
+
+// Send 添加请求
+//
+// 参数与 [Conn.Send] 相同。回调函数在添加时即已保存，
+// 如果最终未能发送，会由 Flush 删除。
+func (b *Batch) Send(method string, in, callback interface{}, opts ...CallOption) *Batch {
+	return b.SendContext(context.Background(), method, in, callback, opts...)
+}
+
+// SendContext 添加请求
+//
+// 参数与 [Conn.SendContext] 相同。
+func (b *Batch) SendContext(ctx context.Context, method string, in, callback interface{}, opts ...CallOption) *Batch {
+	return b.send(ctx, method, in, &pending{cb: newCallback(callback)}, opts)
+}
+
+// 添加请求，p 为等待返回数据的对象。
+func (b *Batch) send(ctx context.Context, method string, in interface{}, p *pending, opts []CallOption) *Batch {
+	if b.err != nil {
+		return b
+	}
+
+	req, v, _, err := b.conn.register(ctx, method, in, p, opts)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.values = append(b.values, v)
+	b.methods = append(b.methods, method)
+	b.ids = append(b.ids, req.ID)
+	return b
+}
+
+// Notify 添加通知
+//
+// 参数与 [Conn.Notify] 相同。
+func (b *Batch) Notify(method string, in interface{}, opts ...CallOption) *Batch {
+	if b.err != nil {
+		return b
+	}
+
+	req, err := b.conn.server.newRequest(true, method, in)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.values = append(b.values, newCallOptions(opts).apply(context.Background(), req, b.conn.server.clock))
+	b.methods = append(b.methods, method)
+	return b
+}
+
+// Len 已经添加的请求数量
+func (b *Batch) Len() int { return len(b.values) }
+
+// Flush 发送所有请求
+//
+// 如果添加请求时发生了错误或是发送失败，则不会发送任何请求，
+// 且已经保存的回调函数都会被删除。
+// 不论成功与否，调用之后都会清空已经添加的请求，可以继续用于下一次的批量请求。
+// 未添加任何请求时不发送任何内容。
+func (b *Batch) Flush() (err error) {
+	defer func() {
+		if err != nil {
+			for _, id := range b.ids {
+				b.conn.deletePending(id)
+			}
+		}
+		b.values, b.methods, b.ids, b.err = nil, nil, nil, nil
+	}()
+
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.values) == 0 {
+		return nil
+	}
+
+	err = transportError(b.conn.transport.Write(b.values))
+	if b.conn.stats != nil {
+		for _, method := range b.methods {
+			b.conn.stats.sent(method, 0)
+		}
+	}
+	if err != nil {
+		b.conn.emit(EventWriteError, err, nil)
+	}
+	return err
+}
+
+// 以批量请求的方式发送 calls 并等待所有的返回数据
+//
+// 返回值与 calls 的顺序一一对应，通知类型的请求对应的元素为 nil。
+// 返回数据由 [Conn.Serve] 读取。
+func (conn *Conn) batch(ctx context.Context, calls []*Call) ([]*body, error) {
+	b := conn.Batch()
+	ps := make([]*pending, len(calls))
+	for i, c := range calls {
+		if c.Notify {
+			b.Notify(c.Method, c.Params)
+			continue
+		}
+		ps[i] = &pending{result: make(chan *body, 1)}
+		b.send(ctx, c.Method, c.Params, ps[i], nil)
+	}
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+
+	resps := make([]*body, len(calls))
+	for i, p := range ps {
+		if p == nil {
+			continue
+		}
+
+		select {
+		case resp := <-p.result:
+			if resp == nil {
+				return nil, transportError(errConnClosed)
+			}
+			resps[i] = resp
+		case <-ctx.Done():
+			for _, p := range ps[i:] {
+				if p != nil {
+					conn.deletePending(p.id)
+				}
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return resps, nil
+}
+
+// 作为客户端向服务端发送批量请求
+//
+// 返回的请求对象与 calls 的顺序一一对应。
+func (s *Server) batchRequest(t Transport, calls []*Call) ([]*body, error) {
+	reqs := make([]*body, 0, len(calls))
+	for _, c := range calls {
+		req, err := s.newRequest(c.Notify, c.Method, c.Params)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+
+	if err := t.Write(reqs); err != nil {
+		return nil, transportError(err)
+	}
+	return reqs, nil
+}
+
+// 从 t 中读取批量请求的返回结果，并按 reqs 的顺序排列。
+//
+// 通知类型的请求，对应的元素为 nil。
+// 如果服务端返回的是单个错误对象，则直接返回该错误。
+func readBatchResponse(t Transport, reqs []*body) ([]*body, error) {
+	resps := make([]*body, len(reqs))
+
+	var hasID bool
+	for _, req := range reqs {
+		if req.ID != nil {
+			hasID = true
+			break
+		}
+	}
+	if !hasID { // 全是通知，服务端不会返回任何数据。
+		return resps, nil
+	}
+
+	var raw json.RawMessage
+	if err := t.Read(&raw); err != nil {
+		return nil, readError(err)
+	}
+
+	if raw = bytes.TrimSpace(raw); len(raw) == 0 || raw[0] != '[' {
+		resp := &body{}
+		if err := json.Unmarshal(raw, resp); err != nil {
+			return nil, protocolError(err)
+		}
+		if resp.Error != nil {
+			return nil, remoteError(resp.Error)
+		}
+		return nil, protocolError(errors.New("无效的批量请求返回数据"))
+	}
+
+	list := make([]*body, 0, len(reqs))
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, protocolError(err)
+	}
+
+	for _, resp := range list {
+		if resp.ID == nil {
+			continue
+		}
+		for i, req := range reqs {
+			if req.ID != nil && req.ID.Equal(resp.ID) {
+				resps[i] = resp
+				break
+			}
+		}
+	}
+
+	for i, req := range reqs {
+		if req.ID != nil && resps[i] == nil {
+			resps[i] = &body{
+				Version: Version,
+				ID:      req.ID,
+				Error:   NewError(CodeInternalError, "服务端未返回该请求的结果"),
+			}
+		}
+	}
+
+	return resps, nil
+}
+
+// 以批量请求的方式访问服务端
+func (h *HTTPConn) batch(calls []*Call) ([]*body, error) {
+	if h.url == "" {
+		panic("初始化时未声明 url 参数，无法作为客户端使用")
+	}
+
+	t := h.newClientTransport(context.Background())
+	defer func() {
+		if err := t.Close(); err != nil {
+			h.printErr(err)
+		}
+	}()
+
+	reqs, err := h.server.batchRequest(t, calls)
+	if err != nil {
+		return nil, err
+	}
+	return readBatchResponse(t, reqs)
+}
+
+// 可同时读取单个对象和批量请求的对象
+//
+// 如果数据为 JSON 数组，则将各个元素保存至 body.batch，否则按 v 进行解码。
+type batchBody struct {
+	v    interface{} // *body、*extBody 或是 *rawBody
+	body *body
+}
+
+func (b *batchBody) UnmarshalJSON(data []byte) error {
+	if d := bytes.TrimLeft(data, " \t\r\n"); len(d) > 0 && d[0] == '[' {
+		return json.Unmarshal(d, &b.body.batch)
+	}
+	return json.Unmarshal(data, b.v)
+}
+
+// 收集批量请求中单个请求的返回数据
+type batchTransport struct {
+	Transport
+	v interface{}
+}
+
+func (t *batchTransport) Write(v interface{}) error {
+	t.v = v
+	return nil
+}
+
+func (t *batchTransport) Peer() string { return peerOf(t.Transport) }
+
+// 处理批量请求 batch
+//
+// 各个请求并行处理，返回数据按请求的顺序以 JSON 数组的形式一次性写入 t，
+// 通知不会有返回数据，如果全部都是通知，则不输出任何内容。
+// 元素中如果包含对方返回的数据，则交由 response 处理，response 为空则忽略。
+// BatchLimits 限制服务端处理的批量请求
+//
+// size 为单个批量请求最多可包含的请求数量，超出的批量请求会被整个拒绝，
+// 并向对方返回 [CodeInvalidRequest] 错误；
+// workers 为同一批量请求中同时执行的请求数量，其余的请求需要等待。
+// 小于等于 0 表示采用默认值，分别为 1000 和 16。
+func (s *Server) BatchLimits(size, workers int) {
+	s.batchSize = size
+	s.batchWorkers = workers
+}
+
+func (s *Server) maxBatchSize() int {
+	if s.batchSize <= 0 {
+		return defaultBatchSize
+	}
+	return s.batchSize
+}
+
+func (s *Server) responseBatch(t Transport, batch *body, response func(*body)) error {
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	sem := make(chan struct{}, workers)
+
+	results := make([]*batchTransport, len(batch.batch))
+	wg := &sync.WaitGroup{}
+	for i, item := range batch.batch {
+		results[i] = &batchTransport{Transport: t}
+
+		req, v := s.newBody()
+		if err := json.Unmarshal(item, v); err != nil || req.isEmptyRequest() {
+			if err == nil {
+				err = errors.New("无效的请求内容")
+			}
+			s.handleUnrouted(req, err)
+			_ = s.writeError(results[i], nil, CodeInvalidRequest, err, nil)
+			continue
+		}
+
+		if !req.isRequest() {
+			if response != nil {
+				response(req)
+			}
+			continue
+		}
+
+		if req.TraceParent != "" && !validTraceParent(req.TraceParent) {
+			req.TraceParent = ""
+		}
+		req.deadline = batch.deadline
+		req.identity = batch.identity
+		req.via = batch.via
+		req.conn = batch.conn
+		req.ctx = batch.ctx
+		req.received = batch.received
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(t Transport) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			_ = s.response(t, req) // 写入 batchTransport 不会出错
+		}(results[i])
+	}
+	wg.Wait()
+
+	resps := make([]interface{}, 0, len(results))
+	for _, r := range results {
+		if r.v != nil {
+			resps = append(resps, r.v)
+		}
+	}
+	if len(resps) == 0 {
+		return nil
+	}
+	return s.write(t, resps)
+}
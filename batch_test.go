@@ -0,0 +1,286 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_batchRequest(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	out := new(bytes.Buffer)
+	reqs, err := srv.batchRequest(NewStreamTransport(false, new(bytes.Buffer), out, nil), []*Call{
+		{Method: "f1", Params: &inType{Age: 1}},
+		{Method: "f2", Notify: true},
+	})
+	a.NotError(err).Length(reqs, 2).
+		NotNil(reqs[0].ID).
+		Nil(reqs[1].ID)
+
+	list := make([]*body, 0, 2)
+	a.NotError(json.Unmarshal(out.Bytes(), &list)).
+		Length(list, 2).
+		Equal(list[0].Method, "f1").
+		Equal(list[1].Method, "f2")
+}
+
+func TestReadBatchResponse(t *testing.T) {
+	a := assert.New(t, false)
+
+	id1, id2 := &ID{alpha: "1"}, &ID{isNumber: true, number: 2}
+	reqs := []*body{{ID: id1}, {}, {ID: id2}}
+
+	// 乱序返回
+	in := bytes.NewBufferString(`[{"jsonrpc":"2.0","id":2,"result":2},{"jsonrpc":"2.0","id":"1","error":{"code":-32601,"message":"m"}}]`)
+	resps, err := readBatchResponse(NewStreamTransport(false, in, nil, nil), reqs)
+	a.NotError(err).Length(resps, 3).
+		Equal(resps[0].Error.Code, CodeMethodNotFound).
+		Nil(resps[1]).
+		Equal(string(*resps[2].Result), "2")
+
+	// 缺少返回值
+	in = bytes.NewBufferString(`[{"jsonrpc":"2.0","id":2,"result":2}]`)
+	resps, err = readBatchResponse(NewStreamTransport(false, in, nil, nil), reqs)
+	a.NotError(err).Length(resps, 3).
+		Equal(resps[0].Error.Code, CodeInternalError)
+
+	// 单个错误对象
+	in = bytes.NewBufferString(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"m"}}`)
+	resps, err = readBatchResponse(NewStreamTransport(false, in, nil, nil), reqs)
+	var pe *ProtocolError
+	a.Nil(resps).True(errors.As(err, &pe)).Equal(pe.Err.(*Error).Code, CodeParseError)
+
+	// 全是通知，不读取数据
+	resps, err = readBatchResponse(NewStreamTransport(false, new(bytes.Buffer), nil, nil), []*body{{}, {}})
+	a.NotError(err).Equal(resps, []*body{nil, nil})
+}
+
+func TestConn_NotifyBatch(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out, nil), nil)
+	conn.CollectStats(false)
+
+	a.NotError(conn.NotifyBatch(nil)).Equal(out.Len(), 0)
+
+	a.NotError(conn.NotifyBatch([]Notification{
+		{Method: "f1", Params: &inType{Age: 1}},
+		{Method: "f2"},
+	}))
+	list := make([]*body, 0, 2)
+	a.NotError(json.Unmarshal(out.Bytes(), &list)).
+		Length(list, 2).
+		Equal(list[0].Method, "f1").Nil(list[0].ID).
+		Equal(list[1].Method, "f2").Nil(list[1].ID)
+	a.Equal(conn.Stats().Calls["f1"].Calls, 1).
+		Equal(conn.Stats().Calls["f2"].Calls, 1)
+
+	a.Error(conn.NotifyBatch([]Notification{{Method: "f1", Params: func() {}}}))
+
+	// 写入错误
+	d := &memoryDeadLetter{}
+	conn = srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failWriter{}, nil), nil)
+	conn.DeadLetter(d)
+	events := conn.Events()
+	a.Error(conn.NotifyBatch([]Notification{{Method: "f1"}, {Method: "f2"}}))
+	a.Equal((<-events).Type, EventWriteError)
+	a.Length(d.reqs, 2).
+		Equal(d.reqs[0].Method, "f1").
+		Equal(d.reqs[1].Method, "f2")
+}
+
+func TestServer_responseBatch(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	serve := func(data string) []*body {
+		out.Reset()
+		in.WriteString(data)
+		req, err := srv.read(conn.transport)
+		a.NotError(err)
+		if req != nil {
+			conn.serve(req, 0)
+		}
+		if out.Len() == 0 {
+			return nil
+		}
+
+		resps := make([]*body, 0, 5)
+		a.NotError(json.Unmarshal(out.Bytes(), &resps), out.String())
+		return resps
+	}
+
+	resps := serve(`[
+		{"jsonrpc":"2.0","id":1,"method":"f1","params":{"Age":1}},
+		{"jsonrpc":"2.0","method":"f1","params":{"Age":2}},
+		{"jsonrpc":"2.0","id":"2","method":"f2","params":{}},
+		1,
+		{"jsonrpc":"2.0","id":3,"method":"f1","params":{"Age":3}}
+	]`)
+	a.Length(resps, 4).
+		Equal(resps[0].ID, &ID{isNumber: true, number: 1}).
+		Equal(string(*resps[0].Result), `{"name":"","age":1}`).
+		Equal(resps[1].ID, &ID{alpha: "2"}).
+		Equal(resps[1].Error.Code, CodeInvalidParams).
+		Nil(resps[2].ID).
+		Equal(resps[2].Error.Code, CodeInvalidRequest).
+		Equal(resps[3].ID, &ID{isNumber: true, number: 3})
+
+	// 全部是通知
+	a.Nil(serve(`[{"jsonrpc":"2.0","method":"f1"},{"jsonrpc":"2.0","method":"f3"}]`))
+
+	// 空的批量请求
+	out.Reset()
+	in.WriteString(`[]`)
+	req, err := srv.read(conn.transport)
+	a.NotError(err).Nil(req).
+		Contains(out.String(), `"code":-32600`).
+		NotContains(out.String(), `[`)
+
+	// 包含对方返回的数据
+	var result *outType
+	out.Reset()
+	a.NotError(conn.Send("f1", &inType{Age: 5}, func(o *outType) error {
+		result = o
+		return nil
+	}))
+	sent := &body{}
+	a.NotError(json.Unmarshal(out.Bytes(), sent))
+	a.Nil(serve(`[{"jsonrpc":"2.0","id":"`+sent.ID.String()+`","result":{"name":"n","age":5}}]`)).
+		Equal(result, &outType{Name: "n", Age: 5})
+}
+
+func TestServer_BatchLimits(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srv.BatchLimits(4, 2)
+
+	var running, max int32
+	a.True(srv.Register("count", func(notify bool, in *inType, out *outType) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}))
+
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	batch := func(n int) string {
+		items := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			items = append(items, `{"jsonrpc":"2.0","id":`+string(rune('1'+i))+`,"method":"count","params":{}}`)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+
+	// 超过数量限制
+	in.WriteString(batch(5))
+	req, err := srv.read(conn.transport)
+	a.NotError(err).Nil(req).
+		Contains(out.String(), `"code":-32600`)
+	a.Equal(max, 0)
+
+	// 限制同时执行的数量
+	out.Reset()
+	in.WriteString(batch(4))
+	req, err = srv.read(conn.transport)
+	a.NotError(err).NotNil(req)
+	conn.serve(req, 0)
+	resps := make([]*body, 0, 4)
+	a.NotError(json.Unmarshal(out.Bytes(), &resps)).Length(resps, 4).
+		Equal(atomic.LoadInt32(&max), 2)
+}
+
+func TestConn_Batch(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	errs := make(chan *Error, 1)
+	srv.ErrHandler(func(err *Error) { errs <- err })
+
+	c1, c2 := net.Pipe()
+	server := srv.NewConn(NewSocketTransport(true, c1, 0), nil)
+	client := srv.NewConn(NewSocketTransport(true, c2, 0), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	results := make(chan *outType, 2)
+	b := client.Batch().
+		Send("f1", &inType{First: "f", Age: 1}, func(o *outType) error {
+			results <- o
+			return nil
+		}).
+		Notify("f1", &inType{Age: 2}).
+		Send("f2", &inType{}, func(o *outType) error { return nil }).
+		Send("f1", &inType{Last: "l", Age: 3}, func(o *outType) error {
+			results <- o
+			return nil
+		})
+	a.Equal(b.Len(), 4).NotError(b.Flush()).Equal(b.Len(), 0)
+
+	got := map[int]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case o := <-results:
+			got[o.Age] = o.Name
+		case <-time.After(time.Second):
+			a.TB().Fatal("未收到返回数据")
+		}
+	}
+	a.Equal(got, map[int]string{1: "f", 3: "l"})
+	select {
+	case err := <-errs:
+		a.Equal(err.Code, CodeInvalidParams)
+	case <-time.After(time.Second):
+		a.TB().Fatal("未收到错误信息")
+	}
+
+	// 添加时出错，不发送任何内容，且删除已保存的回调函数。
+	b = client.Batch().
+		Send("f1", &inType{}, func(o *outType) error { return nil })
+	id := b.ids[0]
+	b.Notify("f1", make(chan int)).
+		Send("f1", &inType{}, func(o *outType) error { return nil })
+	a.Equal(b.Len(), 1).Error(b.Flush())
+	_, found := client.callbacks.Load(id)
+	a.False(found).NotError(b.Flush())
+
+	cancel()
+	c1.Close()
+	c2.Close()
+	<-exit
+	<-exit
+}
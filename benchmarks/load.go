@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package benchmarks 性能测试以及负载生成工具
+//
+// 包中的测试用例提供了各个传输层的端到端吞吐量和延迟测试：
+//
+//	go test -bench=. ./benchmarks
+//
+// [Run] 则可以用于对用户自己的服务进行压力测试。
+package benchmarks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/issue9/jsonrpc"
+)
+
+// Options 负载生成的参数
+type Options struct {
+	// 创建连接到目标服务的传输层
+	//
+	// 每个并发的客户端都会调用一次，以创建各自独立的连接。
+	// 与 URL 只能二选一。
+	Dial func() (jsonrpc.Transport, error)
+
+	// HTTP 服务的地址，与 Dial 只能二选一。
+	URL string
+
+	// 调用的服务名以及参数
+	Method string
+	Params interface{}
+
+	// 并发的客户端数量，小于等于 0 时为 1。
+	Concurrency int
+
+	// 发送的请求总数
+	//
+	// 与 Duration 同时为 0 时，表示只发送一次请求。
+	Requests int
+
+	// 发送请求的时长，为 0 表示以 Requests 为准。
+	//
+	// 如果同时指定了 Requests，以先达到的为准。
+	Duration time.Duration
+
+	// 单个请求等待返回的超时时间，为 0 时为 5 秒。
+	Timeout time.Duration
+}
+
+// Report 负载测试的结果
+type Report struct {
+	Requests int64         // 完成的请求数量，包括出错的请求。
+	Errors   int64         // 出错的请求数量
+	Duration time.Duration // 总的用时
+
+	// 请求的延迟，不包含出错的请求。
+	P50, P90, P99, Max time.Duration
+}
+
+// 向目标服务发送请求的客户端
+type client interface {
+	// 发送请求并等待返回
+	call(ctx context.Context) error
+	close() error
+}
+
+// Throughput 每秒处理的请求数量
+func (r *Report) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("requests: %d, errors: %d, duration: %s, throughput: %.2f/s, p50: %s, p90: %s, p99: %s, max: %s",
+		r.Requests, r.Errors, r.Duration, r.Throughput(), r.P50, r.P90, r.P99, r.Max)
+}
+
+// Run 按 opt 向目标服务发送请求并统计结果
+//
+// ctx 可用于提前结束测试，此时依然会返回已经完成的请求的统计结果。
+func Run(ctx context.Context, opt *Options) (*Report, error) {
+	if (opt.Dial == nil) == (opt.URL == "") {
+		return nil, errors.New("必须且只能指定 Dial 和 URL 中的一个")
+	}
+	if opt.Method == "" {
+		return nil, errors.New("未指定参数 Method")
+	}
+
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	timeout := opt.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	requests := int64(opt.Requests)
+	if requests <= 0 && opt.Duration <= 0 {
+		requests = 1
+	}
+
+	if opt.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Duration)
+		defer cancel()
+	}
+
+	clients := make([]client, 0, concurrency)
+	defer func() {
+		for _, c := range clients {
+			c.close()
+		}
+	}()
+	for i := 0; i < concurrency; i++ {
+		c, err := newClient(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+
+	var sent, errCount int64
+	latencies := make([][]time.Duration, concurrency)
+	wg := &sync.WaitGroup{}
+	start := time.Now()
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c client) {
+			defer wg.Done()
+			for ctx.Err() == nil && (requests <= 0 || atomic.AddInt64(&sent, 1) <= requests) {
+				callCtx, cancel := context.WithTimeout(ctx, timeout)
+				begin := time.Now()
+				err := c.call(callCtx)
+				cancel()
+
+				if err != nil {
+					if errors.Is(err, context.Canceled) || (opt.Duration > 0 && ctx.Err() != nil) {
+						return // 测试结束时被中断的请求不作统计
+					}
+					atomic.AddInt64(&errCount, 1)
+					continue
+				}
+				latencies[i] = append(latencies[i], time.Since(begin))
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	return newReport(time.Since(start), errCount, latencies), nil
+}
+
+func newReport(dur time.Duration, errs int64, latencies [][]time.Duration) *Report {
+	all := make([]time.Duration, 0, 100)
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	r := &Report{
+		Requests: int64(len(all)) + errs,
+		Errors:   errs,
+		Duration: dur,
+	}
+	if len(all) > 0 {
+		r.P50 = percentile(all, 50)
+		r.P90 = percentile(all, 90)
+		r.P99 = percentile(all, 99)
+		r.Max = all[len(all)-1]
+	}
+	return r
+}
+
+// 计算已排序的 sorted 中第 p 个百分位的值
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+func newClient(ctx context.Context, opt *Options) (client, error) {
+	var id int64
+	srv := jsonrpc.NewServer(func() string { return strconv.FormatInt(atomic.AddInt64(&id, 1), 10) })
+
+	if opt.URL != "" {
+		return &httpClient{conn: srv.NewHTTPConn(opt.URL, nil), method: opt.Method, params: opt.Params}, nil
+	}
+
+	t, err := opt.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &connClient{
+		conn:   srv.NewConn(t, nil),
+		method: opt.Method,
+		params: opt.Params,
+		t:      t,
+	}
+	srv.ErrHandler(func(err *jsonrpc.Error) { c.finish(c.current(), err) })
+
+	serveCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.conn.Serve(serveCtx)
+	return c, nil
+}
+
+type connClient struct {
+	conn   *jsonrpc.Conn
+	t      jsonrpc.Transport
+	cancel context.CancelFunc
+	method string
+	params interface{}
+
+	// 当前请求的结果，每次只会有一个请求在等待返回。
+	// 超时的请求在之后返回时，其结果会写入已经废弃的通道，不会影响之后的请求。
+	mux  sync.Mutex
+	done chan error
+}
+
+func (c *connClient) current() chan error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.done
+}
+
+func (c *connClient) finish(done chan error, err error) {
+	select {
+	case done <- err:
+	default:
+	}
+}
+
+func (c *connClient) call(ctx context.Context) error {
+	done := make(chan error, 1)
+	c.mux.Lock()
+	c.done = done
+	c.mux.Unlock()
+
+	err := c.conn.Send(c.method, c.params, func(*interface{}) error {
+		c.finish(done, nil)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *connClient) close() error {
+	c.cancel()
+	return c.t.Close()
+}
+
+type httpClient struct {
+	conn   *jsonrpc.HTTPConn
+	method string
+	params interface{}
+}
+
+func (c *httpClient) call(context.Context) error {
+	return c.conn.Send(c.method, c.params, func(*interface{}) error { return nil })
+}
+
+func (c *httpClient) close() error { return nil }
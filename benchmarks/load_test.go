@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package benchmarks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/issue9/assert/v4"
+
+	"github.com/issue9/jsonrpc"
+)
+
+type params struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newServer() *jsonrpc.Server {
+	var id int64
+	srv := jsonrpc.NewServer(func() string { return strconv.FormatInt(atomic.AddInt64(&id, 1), 10) })
+	srv.Register("echo", func(notify bool, in, out *params) error {
+		*out = *in
+		return nil
+	})
+	srv.Register("fail", func(notify bool, in, out *params) error {
+		return jsonrpc.NewError(-32000, "fail")
+	})
+	srv.Register("slow", func(notify bool, in, out *params) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	return srv
+}
+
+// 返回基于 net.Pipe 的 Dial 函数
+func pipeDial(ctx context.Context, srv *jsonrpc.Server) func() (jsonrpc.Transport, error) {
+	return func() (jsonrpc.Transport, error) {
+		s, c := net.Pipe()
+		go srv.NewConn(jsonrpc.NewSocketTransport(true, s, time.Second), nil).Serve(ctx)
+		return jsonrpc.NewSocketTransport(true, c, time.Second), nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	a := assert.New(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := newServer()
+
+	_, err := Run(ctx, &Options{Method: "echo"})
+	a.Error(err)
+	_, err = Run(ctx, &Options{URL: "http://localhost", Dial: pipeDial(ctx, srv), Method: "echo"})
+	a.Error(err)
+	_, err = Run(ctx, &Options{Dial: pipeDial(ctx, srv)})
+	a.Error(err)
+
+	r, err := Run(ctx, &Options{Dial: pipeDial(ctx, srv), Method: "echo", Params: &params{Name: "n"}, Concurrency: 4, Requests: 100})
+	a.NotError(err).
+		Equal(r.Requests, 100).
+		Equal(r.Errors, 0).
+		True(r.P50 > 0).
+		True(r.P50 <= r.P90).
+		True(r.P90 <= r.P99).
+		True(r.P99 <= r.Max).
+		True(r.Throughput() > 0).
+		Contains(r.String(), "requests: 100")
+
+	r, err = Run(ctx, &Options{Dial: pipeDial(ctx, srv), Method: "fail", Requests: 10})
+	a.NotError(err).Equal(r.Requests, 10).Equal(r.Errors, 10).Equal(r.Max, 0)
+
+	r, err = Run(ctx, &Options{Dial: pipeDial(ctx, srv), Method: "slow", Requests: 2, Timeout: 100 * time.Millisecond})
+	a.NotError(err).Equal(r.Requests, 2).Equal(r.Errors, 2)
+
+	r, err = Run(ctx, &Options{Dial: pipeDial(ctx, srv), Method: "echo", Duration: 200 * time.Millisecond, Concurrency: 2})
+	a.NotError(err).True(r.Requests > 0).Equal(r.Errors, 0)
+
+	h := httptest.NewServer(srv.NewHTTPConn("", nil))
+	defer h.Close()
+	r, err = Run(ctx, &Options{URL: h.URL, Method: "echo", Requests: 10, Concurrency: 2})
+	a.NotError(err).Equal(r.Requests, 10).Equal(r.Errors, 0)
+}
+
+func TestPercentile(t *testing.T) {
+	a := assert.New(t, false)
+
+	sorted := make([]time.Duration, 0, 100)
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	a.Equal(percentile(sorted, 50), 50).
+		Equal(percentile(sorted, 99), 99).
+		Equal(percentile(sorted[:1], 50), 1)
+}
+
+func bench(b *testing.B, opt *Options) {
+	opt.Method = "echo"
+	opt.Params = &params{Name: "name", Age: 18}
+	opt.Requests = b.N
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	r, err := Run(context.Background(), opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if r.Errors > 0 {
+		b.Fatalf("%d 个请求出错", r.Errors)
+	}
+	b.ReportMetric(float64(r.P50.Microseconds()), "p50-µs")
+	b.ReportMetric(float64(r.P99.Microseconds()), "p99-µs")
+}
+
+func BenchmarkPipe(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bench(b, &Options{Dial: pipeDial(ctx, newServer())})
+}
+
+func BenchmarkPipe_concurrency(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bench(b, &Options{Dial: pipeDial(ctx, newServer()), Concurrency: 8})
+}
+
+func BenchmarkTCP(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	opt := &jsonrpc.ListenOptions{Header: true, Timeout: time.Second}
+	go newServer().ServeListeners(ctx, []net.Listener{l}, opt)
+
+	bench(b, &Options{
+		Dial: func() (jsonrpc.Transport, error) {
+			return jsonrpc.NewTCPClientTransport(true, l.Addr().String(), time.Second, nil)
+		},
+		Concurrency: 8,
+	})
+}
+
+func BenchmarkUDP(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	go newServer().NewConn(jsonrpc.NewUDPTransport(true, l, false, time.Second), nil).Serve(ctx)
+
+	// UDP 的服务端只能回复最后一个发送数据的客户端，所以只能有一个客户端。
+	bench(b, &Options{
+		Dial: func() (jsonrpc.Transport, error) {
+			return jsonrpc.NewUDPClientTransport(true, l.LocalAddr().String(), "", time.Second)
+		},
+	})
+}
+
+func BenchmarkWebsocket(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newServer()
+	upgrader := websocket.Upgrader{}
+	h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		srv.NewConn(jsonrpc.NewWebsocketTransport(conn), nil).Serve(ctx)
+	}))
+	defer h.Close()
+
+	bench(b, &Options{
+		Dial: func() (jsonrpc.Transport, error) {
+			conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(h.URL, "http", "ws", 1), nil)
+			if err != nil {
+				return nil, err
+			}
+			return jsonrpc.NewWebsocketTransport(conn), nil
+		},
+		Concurrency: 8,
+	})
+}
+
+func BenchmarkHTTP(b *testing.B) {
+	h := httptest.NewServer(newServer().NewHTTPConn("", nil))
+	defer h.Close()
+	bench(b, &Options{URL: h.URL, Concurrency: 8})
+}
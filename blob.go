@@ -0,0 +1,429 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BlobMethod 传输数据块时使用的服务名
+//
+// 以 rpc. 开头的服务名是预留给扩展使用的，不会与用户的服务名冲突。
+const BlobMethod = "rpc.blob"
+
+// 默认的数据块大小
+const defaultBlobChunkSize = 32 * 1024
+
+// [BlobLimits] 的默认值
+const (
+	defaultBlobTransfers = 64
+	defaultBlobBuffered  = 8 << 20
+	defaultBlobGap       = 1 << 20
+	defaultBlobIdle      = 5 * time.Minute
+)
+
+var (
+	errBlobClosed   = errors.New("数据块的接收已经关闭")
+	errBlobTooMany  = errors.New("同时进行的传输过多")
+	errBlobOverflow = errors.New("未读取的数据超过了限制")
+	errBlobExpired  = errors.New("传输长时间没有活动，已经被清除")
+)
+
+// BlobLimits [BlobReceiver] 的资源限制
+//
+// 各字段小于等于 0 时采用默认值。
+type BlobLimits struct {
+	// 同时进行的传输数量，默认为 64。
+	//
+	// 超过此值时，[BlobReceiver.Open] 返回的对象在读取时会返回错误。
+	Transfers int
+
+	// 单个传输中已经接收但还未被读取的字节数，默认为 8M。
+	//
+	// 超过此值时，该传输会被中止，读取时返回错误。
+	Buffered int64
+
+	// 数据块的偏移量与已经连续接收的位置之间的最大距离，默认为 1M。
+	//
+	// 超过此值的数据块会被丢弃，发送方可以根据 [BlobReceiver.Offset] 重新发送。
+	Gap int64
+
+	// 传输在没有读写操作时被清除的时间，默认为 5 分钟。
+	//
+	// 由 [Server.Clock] 的定时器检测，被清除的传输在读取时返回错误，
+	// 正在阻塞等待数据的读取操作也会返回。
+	Idle time.Duration
+}
+
+// 单个数据块
+type blobChunk struct {
+	// 传输 ID，用于将多个数据块关联在一起。
+	ID string `json:"id"`
+
+	// 当前数据块在整个数据中的偏移量
+	Offset int64 `json:"offset"`
+
+	// 数据块的内容，JSON 中以 base64 编码表示。
+	Data []byte `json:"data,omitempty"`
+
+	// Data 的 CRC32 (IEEE) 校验值
+	Checksum uint32 `json:"checksum"`
+
+	// 是否为最后一个数据块
+	EOF bool `json:"eof,omitempty"`
+}
+
+// BlobReceiver 接收由 [Conn.SendBlob] 发送的数据块
+//
+// 数据块以通知的形式发送，每个数据块都带有传输 ID、偏移量和校验值，
+// BlobReceiver 会按偏移量将数据块重新组装，并以 [io.Reader] 的形式提供给用户。
+//
+// BlobReceiver 与 [Server] 绑定，而不是与 [Conn]，所以在连接断开之后，
+// 可以通过 [BlobReceiver.Offset] 获取已经接收的数据长度，
+// 并在新的连接上从该位置继续发送，以实现断点续传。
+type BlobReceiver struct {
+	s         *Server
+	limits    BlobLimits
+	mux       sync.Mutex
+	transfers map[string]*blobTransfer
+}
+
+// 单次传输的状态
+type blobTransfer struct {
+	r    *BlobReceiver
+	id   string
+	mux  sync.Mutex
+	cond *sync.Cond
+
+	next     int64            // 下一个需要写入 buf 的偏移量
+	pending  map[int64][]byte // 已经接收但还不能写入 buf 的数据块
+	buffered int64            // buf 和 pending 中数据的总长度
+	eof      int64            // 最后一个数据块的结束位置，-1 表示还未收到。
+	buf      []byte
+	err      error
+
+	active int64  // 最后一次读写的时间，以 UnixNano 表示，需要原子操作。
+	stop   func() // 取消空闲检测的定时器
+}
+
+// NewBlobReceiver 声明 [BlobReceiver] 对象
+//
+// 会在 s 上注册名为 [BlobMethod] 的服务用于接收数据块，
+// 如果该服务已经存在，则会 panic。
+// 资源限制采用 [BlobLimits] 的默认值，可以通过 [BlobReceiver.Limits] 修改。
+func (s *Server) NewBlobReceiver() *BlobReceiver {
+	r := &BlobReceiver{s: s, transfers: make(map[string]*blobTransfer, 10)}
+	r.Limits(nil)
+	if !s.Register(BlobMethod, r.receive) {
+		panic("已经存在相同的方法：" + BlobMethod)
+	}
+	return r
+}
+
+// Limits 指定资源限制
+//
+// l 为空表示全部采用默认值。
+//
+// NOTE: 需要在接收数据之前调用。
+func (r *BlobReceiver) Limits(l *BlobLimits) {
+	var limits BlobLimits
+	if l != nil {
+		limits = *l
+	}
+	if limits.Transfers <= 0 {
+		limits.Transfers = defaultBlobTransfers
+	}
+	if limits.Buffered <= 0 {
+		limits.Buffered = defaultBlobBuffered
+	}
+	if limits.Gap <= 0 {
+		limits.Gap = defaultBlobGap
+	}
+	if limits.Idle <= 0 {
+		limits.Idle = defaultBlobIdle
+	}
+	r.limits = limits
+}
+
+// 获取已经通过 Open 声明的传输，不存在时返回 nil。
+func (r *BlobReceiver) get(id string) *blobTransfer {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.transfers[id]
+}
+
+func (r *BlobReceiver) receive(notify bool, chunk *blobChunk, _ *struct{}) error {
+	if chunk.ID == "" {
+		return NewError(CodeInvalidParams, "缺少传输 ID")
+	}
+
+	if crc32.ChecksumIEEE(chunk.Data) != chunk.Checksum {
+		return NewError(CodeInvalidParams, fmt.Sprintf("数据块 %s@%d 校验失败", chunk.ID, chunk.Offset))
+	}
+
+	t := r.get(chunk.ID)
+	if t == nil {
+		return NewError(CodeInvalidParams, fmt.Sprintf("未知的传输 %s", chunk.ID))
+	}
+	return t.write(chunk)
+}
+
+// Open 打开传输 ID 为 id 的数据
+//
+// 只有通过 Open 声明过的传输才会接收数据块，其它的数据块都会被丢弃，
+// 所以需要在发送方开始发送之前调用，读取操作会阻塞直到有数据到达或是传输结束。
+// 在读取完所有数据或是调用 Close 之后，该传输的状态会被清除。
+//
+// 如果 id 已经打开，返回同一个对象。
+func (r *BlobReceiver) Open(id string) io.ReadCloser {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if t, found := r.transfers[id]; found {
+		t.touch()
+		return t
+	}
+
+	t := &blobTransfer{
+		r:       r,
+		id:      id,
+		pending: make(map[int64][]byte, 10),
+		eof:     -1,
+	}
+	t.cond = sync.NewCond(&t.mux)
+	if len(r.transfers) >= r.limits.Transfers {
+		t.err = errBlobTooMany
+		return t
+	}
+	t.touch()
+	t.stop = afterFunc(r.s.clock, r.limits.Idle, t.expire)
+	r.transfers[id] = t
+	return t
+}
+
+// Offset 返回传输 ID 为 id 的数据已经连续接收的字节数
+//
+// 发送方可以从该位置继续发送数据。
+func (r *BlobReceiver) Offset(id string) int64 {
+	r.mux.Lock()
+	t, found := r.transfers[id]
+	r.mux.Unlock()
+	if !found {
+		return 0
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.next
+}
+
+func (t *blobTransfer) write(chunk *blobChunk) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	t.touch()
+
+	limits := &t.r.limits
+	if chunk.Offset-t.next > limits.Gap {
+		return NewError(CodeInvalidParams, fmt.Sprintf("数据块 %s@%d 超过了接收的范围", chunk.ID, chunk.Offset))
+	}
+
+	// 与已经接收的数据重叠时，只保留之后的部分，完全重叠的则直接忽略。
+	offset, data, dup := chunk.Offset, chunk.Data, false
+	if offset < t.next {
+		if skip := t.next - offset; skip < int64(len(data)) {
+			offset, data = t.next, data[skip:]
+		} else {
+			dup = true
+		}
+	}
+
+	if old, found := t.pending[offset]; !dup && (!found || len(old) < len(data)) {
+		size := int64(len(data) - len(old))
+		if t.buffered+size > limits.Buffered {
+			t.fail(errBlobOverflow)
+			t.remove()
+			return t.err
+		}
+		t.pending[offset] = data
+		t.buffered += size
+	}
+
+	if chunk.EOF {
+		t.eof = chunk.Offset + int64(len(chunk.Data))
+	}
+
+	for {
+		data, found := t.take()
+		if !found {
+			break
+		}
+		t.buf = append(t.buf, data...)
+		t.buffered += int64(len(data))
+		t.next += int64(len(data))
+
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	t.cond.Broadcast()
+	return nil
+}
+
+// 从 pending 中取出从 next 开始的数据
+//
+// 起始位置在 next 之前的数据块都会被删除，其中超过 next 的部分会参与选择，
+// 返回其中最长的一段。只能在 t.mux 的保护下调用。
+func (t *blobTransfer) take() (data []byte, found bool) {
+	for offset, d := range t.pending {
+		if offset > t.next {
+			continue
+		}
+		delete(t.pending, offset)
+		t.buffered -= int64(len(d))
+
+		if skip := t.next - offset; skip < int64(len(d)) || offset == t.next {
+			if d = d[skip:]; !found || len(d) > len(data) {
+				data, found = d, true
+			}
+		}
+	}
+	return data, found
+}
+
+// 空闲检测的定时器触发
+//
+// 如果在此期间有过读写，则以最后一次读写的时间重新计时。
+func (t *blobTransfer) expire() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.err != nil {
+		return
+	}
+
+	idle := t.r.s.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&t.active)))
+	if idle < t.r.limits.Idle {
+		t.stop = afterFunc(t.r.s.clock, t.r.limits.Idle-idle, t.expire)
+		return
+	}
+
+	t.fail(errBlobExpired)
+	t.remove()
+}
+
+func (t *blobTransfer) touch() {
+	atomic.StoreInt64(&t.active, t.r.s.clock.Now().UnixNano())
+}
+
+// 以 err 中止传输并释放缓存的数据
+//
+// 只能在 t.mux 的保护下调用。
+func (t *blobTransfer) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+	t.buf = nil
+	t.pending = nil
+	t.buffered = 0
+	t.cond.Broadcast()
+}
+
+func (t *blobTransfer) Read(p []byte) (int, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for len(t.buf) == 0 && t.err == nil && (t.eof < 0 || t.next < t.eof) {
+		t.cond.Wait()
+	}
+
+	if len(t.buf) > 0 {
+		n := copy(p, t.buf)
+		t.buf = t.buf[n:]
+		t.buffered -= int64(n)
+		t.touch()
+		return n, nil
+	}
+
+	if t.err != nil {
+		return 0, t.err
+	}
+
+	t.remove()
+	return 0, io.EOF
+}
+
+func (t *blobTransfer) Close() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.fail(errBlobClosed)
+	t.remove()
+	return nil
+}
+
+// 将 t 从 BlobReceiver 中删除并停止空闲检测
+//
+// 只能在 t.mux 的保护下调用。
+func (t *blobTransfer) remove() {
+	if t.stop != nil {
+		t.stop()
+		t.stop = nil
+	}
+
+	t.r.mux.Lock()
+	defer t.r.mux.Unlock()
+
+	if t.r.transfers[t.id] == t {
+		delete(t.r.transfers, t.id)
+	}
+}
+
+// SendBlob 以数据块的形式将 r 中的内容发送给对方
+//
+// 对方需要通过 [Server.NewBlobReceiver] 接收数据，并在发送之前调用 [BlobReceiver.Open]。
+// id 为传输 ID，由双方约定；offset 表示 r 中的第一个字节在整个数据中的位置，
+// 在断点续传时，可以将 r 定位到对方的 [BlobReceiver.Offset] 并以该值作为 offset；
+// chunkSize 为单个数据块的大小，小于等于 0 时使用默认值。
+func (conn *Conn) SendBlob(id string, r io.Reader, offset int64, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = defaultBlobChunkSize
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		chunk := &blobChunk{
+			ID:       id,
+			Offset:   offset,
+			Data:     buf[:n],
+			Checksum: crc32.ChecksumIEEE(buf[:n]),
+			EOF:      eof,
+		}
+		if err := conn.Notify(BlobMethod, chunk); err != nil {
+			return err
+		}
+
+		if eof {
+			return nil
+		}
+		offset += int64(n)
+	}
+}
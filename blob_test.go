@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_SendBlob(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return <-uniqueID })
+	receiver := srv.NewBlobReceiver()
+	a.Panic(func() {
+		srv.NewBlobReceiver()
+	})
+
+	srvConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		srv.NewConn(NewSocketTransport(true, srvConn, 0), log.New(ioutil.Discard, "", 0)).Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	r := receiver.Open("t1")
+	client := NewServer(func() string { return <-uniqueID }).NewConn(NewSocketTransport(true, clientConn, 0), nil)
+	go func() {
+		a.NotError(client.SendBlob("t1", bytes.NewReader(data), 0, 1000))
+	}()
+
+	received, err := io.ReadAll(r)
+	a.NotError(err).Equal(received, data).
+		NotError(r.Close())
+
+	cancel()
+	a.NotError(clientConn.Close())
+	<-exit
+}
+
+func TestBlobReceiver(t *testing.T) {
+	a := assert.New(t, false)
+	receiver := NewServer(func() string { return <-uniqueID }).NewBlobReceiver()
+
+	chunk := func(offset int64, data string, eof bool) *blobChunk {
+		return &blobChunk{
+			ID:       "t1",
+			Offset:   offset,
+			Data:     []byte(data),
+			Checksum: crc32.ChecksumIEEE([]byte(data)),
+			EOF:      eof,
+		}
+	}
+
+	a.Equal(receiver.Offset("t1"), 0)
+
+	// 未通过 Open 声明
+	a.Error(receiver.receive(true, chunk(0, "123", false), nil))
+	a.Equal(receiver.Offset("t1"), 0)
+
+	r := receiver.Open("t1")
+
+	// 乱序到达
+	a.NotError(receiver.receive(true, chunk(3, "456", false), nil))
+	a.Equal(receiver.Offset("t1"), 0)
+	a.NotError(receiver.receive(true, chunk(0, "123", false), nil))
+	a.Equal(receiver.Offset("t1"), 6)
+
+	// 校验失败
+	c := chunk(6, "789", true)
+	c.Checksum++
+	a.Error(receiver.receive(true, c, nil))
+	a.Equal(receiver.Offset("t1"), 6)
+
+	// 缺少 ID
+	c = chunk(6, "789", true)
+	c.ID = ""
+	a.Error(receiver.receive(true, c, nil))
+
+	// 续传，包含了重复的数据块。
+	a.NotError(receiver.receive(true, chunk(3, "456", false), nil))
+	a.NotError(receiver.receive(true, chunk(6, "789", true), nil))
+	a.Equal(receiver.Offset("t1"), 9)
+
+	data, err := io.ReadAll(r)
+	a.NotError(err).Equal(string(data), "123456789")
+	a.Equal(receiver.Offset("t1"), 0) // 读取完之后被清除
+
+	// 关闭之后读取
+	r = receiver.Open("t2")
+	a.NotError(r.Close())
+	_, err = r.Read(make([]byte, 10))
+	a.Equal(err, errBlobClosed)
+
+	// 空数据
+	r = receiver.Open("t3")
+	a.NotError(receiver.receive(true, &blobChunk{ID: "t3", EOF: true}, nil))
+	data, err = io.ReadAll(r)
+	a.NotError(err).Empty(data)
+
+	// 关闭之后到达的数据块
+	a.Error(receiver.receive(true, &blobChunk{ID: "t2", EOF: true}, nil))
+	a.Equal(receiver.Offset("t2"), 0)
+
+	// 与已接收数据部分重叠的数据块
+	r = receiver.Open("t4")
+	for _, c := range []*blobChunk{chunk(3, "45", false), chunk(0, "1234", false), chunk(2, "3456", true)} {
+		c.ID = "t4"
+		a.NotError(receiver.receive(true, c, nil))
+	}
+	data, err = io.ReadAll(r)
+	a.NotError(err).Equal(string(data), "123456")
+}
+
+func TestBlobReceiver_Limits(t *testing.T) {
+	a := assert.New(t, false)
+	clock := NewManualClock(time.Now())
+	srv := NewServer(func() string { return <-uniqueID })
+	srv.Clock(clock)
+	receiver := srv.NewBlobReceiver()
+	receiver.Limits(&BlobLimits{Transfers: 2, Buffered: 5, Gap: 3, Idle: time.Minute})
+
+	chunk := func(id string, offset int64, data string) *blobChunk {
+		return &blobChunk{ID: id, Offset: offset, Data: []byte(data), Checksum: crc32.ChecksumIEEE([]byte(data))}
+	}
+
+	// Transfers
+	r1 := receiver.Open("t1")
+	r2 := receiver.Open("t2")
+	r3 := receiver.Open("t3")
+	_, err := r3.Read(make([]byte, 10))
+	a.Equal(err, errBlobTooMany)
+	a.Error(receiver.receive(true, chunk("t3", 0, "1"), nil))
+	a.Equal(receiver.Open("t1"), r1) // 重复打开
+
+	// Gap
+	a.Error(receiver.receive(true, chunk("t1", 4, "5"), nil))
+	a.NotError(receiver.receive(true, chunk("t1", 3, "4"), nil))
+	a.Equal(receiver.Offset("t1"), 0)
+
+	// Buffered
+	a.NotError(receiver.receive(true, chunk("t1", 0, "123"), nil))
+	a.Equal(receiver.Offset("t1"), 4)
+	p := make([]byte, 2)
+	n, err := r1.Read(p)
+	a.NotError(err).Equal(n, 2)
+	a.NotError(receiver.receive(true, chunk("t1", 4, "567"), nil))
+	a.Error(receiver.receive(true, chunk("t1", 7, "8"), nil))
+	_, err = r1.Read(p)
+	a.Equal(err, errBlobOverflow)
+	a.Equal(receiver.Offset("t1"), 0)
+
+	// Idle，阻塞中的读取也会返回。
+	clock.Advance(30 * time.Second)
+	r4 := receiver.Open("t4")
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r2.Read(make([]byte, 2))
+		errs <- err
+	}()
+	clock.Advance(31 * time.Second)
+	a.Equal(<-errs, errBlobExpired)
+	a.Error(receiver.receive(true, chunk("t2", 0, "1"), nil))
+	a.NotError(receiver.receive(true, chunk("t4", 0, "1"), nil))
+
+	// 定时器触发时 t4 有过活动，重新计时。
+	clock.Advance(30 * time.Second)
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	n, err = r4.Read(p)
+	a.NotError(err).Equal(n, 1)
+}
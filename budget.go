@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"time"
+)
+
+// 截止时间提前了的 context.Context
+//
+// 仅用于计算下游请求的截止时间，不会改变原有 ctx 的取消行为。
+type marginContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (ctx *marginContext) Deadline() (time.Time, bool) { return ctx.deadline, true }
+
+// DeadlineMargin 指定传递截止时间时预留的时间
+//
+// 在处理上游请求的过程中调用 [Conn.SendContext] 时，如果 ctx 带有截止时间，
+// 会以剩余的时间减去 d 作为下游请求的截止时间，并通过 X-Timeout 报头告知对方，
+// 为当前服务处理返回数据以及网络传输预留时间，类似于 gRPC 的截止时间传递。
+// 如果剩余的时间已经不足 d，则不再发送请求，直接返回 [context.DeadlineExceeded]。
+//
+// d 小于等于 0 表示不预留时间，原样使用 ctx 的截止时间。
+//
+// NOTE: 需要在 [Conn.Send] 之前调用。
+func (conn *Conn) DeadlineMargin(d time.Duration) { conn.deadlineMargin = d }
+
+// DeadlineMargin 指定传递截止时间时预留的时间
+//
+// 作用与 [Conn.DeadlineMargin] 相同。
+func (h *HTTPConn) DeadlineMargin(d time.Duration) { h.deadlineMargin = d }
+
+// 从 ctx 的截止时间中扣除 margin
+//
+// clock 用于判断剩余的时间是否已经不足 margin。
+func withDeadlineMargin(ctx context.Context, margin time.Duration, clock Clock) (context.Context, error) {
+	if margin <= 0 {
+		return ctx, nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx, nil
+	}
+	if d, _ := ctxDeadline(ctx, clock); !clock.Now().Before(d.Add(-margin)) {
+		return nil, context.DeadlineExceeded
+	}
+	return &marginContext{Context: ctx, deadline: deadline.Add(-margin)}, nil
+}
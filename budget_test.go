@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestWithDeadlineMargin(t *testing.T) {
+	a := assert.New(t, false)
+
+	ctx := context.Background()
+	c, err := withDeadlineMargin(ctx, time.Second, systemClock{})
+	a.NotError(err).Equal(c, ctx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	c, err = withDeadlineMargin(ctx, 0, systemClock{})
+	a.NotError(err).Equal(c, ctx)
+
+	c, err = withDeadlineMargin(ctx, time.Second, systemClock{})
+	a.NotError(err).NotNil(c)
+	d, ok := c.Deadline()
+	a.True(ok).Equal(d, deadline.Add(-time.Second))
+
+	// 取消操作依然由原来的 ctx 决定
+	cancel()
+	<-c.Done()
+	a.Equal(c.Err(), context.Canceled)
+
+	// 剩余时间不足
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err = withDeadlineMargin(ctx, 2*time.Second, systemClock{})
+	a.Equal(err, context.DeadlineExceeded).Nil(c)
+}
+
+func TestConn_DeadlineMargin(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(true, new(bytes.Buffer), out, nil), nil)
+	conn.DeadlineMargin(time.Minute)
+	cb := func(*outType) error { return nil }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	a.NotError(conn.SendContext(ctx, "f1", &inType{Age: 1}, cb))
+
+	h, err := textproto.NewReader(bufio.NewReader(out)).ReadMIMEHeader()
+	a.NotError(err)
+	timeout, err := strconv.ParseInt(h.Get(timeoutHeader), 10, 64)
+	a.NotError(err).
+		True(timeout <= time.Minute.Milliseconds()).
+		True(timeout > (time.Minute - time.Second).Milliseconds())
+
+	// 剩余时间不足，不发送请求。
+	out.Reset()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	a.Equal(conn.SendContext(ctx, "f1", &inType{Age: 1}, cb), context.DeadlineExceeded).
+		Equal(out.Len(), 0)
+	size := 0
+	conn.callbacks.Range(func(interface{}) bool {
+		size++
+		return true
+	})
+	a.Equal(size, 1)
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Call 发送请求并等待返回数据
+//
+// 与 [Conn.SendContext] 不同，Call 会阻塞直到 [Conn.Serve] 读取到对应的返回数据，
+// 所以需要在其它 goroutine 中运行 [Conn.Serve]；
+// 在不方便运行 [Conn.Serve] 的场景下，可以使用 [Conn.CallInline]。
+//
+// out 为返回数据的解码对象，为空表示忽略返回数据；如果对方返回了错误，
+// 则返回包装了该 *[Error] 的 [ProtocolError] 或是 [ApplicationError]，写入失败时返回 [TransportError]。
+// ctx 取消或是超时时，会放弃等待并返回 ctx.Err()，之后到达的返回数据会被忽略；
+// 如果在收到返回数据之前 [Conn.Serve] 已经退出，也会返回错误。
+// opts 与 [Conn.Send] 中的含义相同。
+//
+// 对方返回的错误不会再交由 [Server.ErrHandler] 处理。
+func (conn *Conn) Call(ctx context.Context, method string, in, out interface{}, opts ...CallOption) error {
+	p := &pending{result: make(chan *body, 1)}
+	id, err := conn.send(ctx, method, in, p, opts)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-p.result:
+		if resp == nil {
+			return transportError(errConnClosed)
+		}
+		if resp.Error != nil {
+			return remoteError(resp.Error)
+		}
+		if out == nil || resp.Result == nil {
+			return nil
+		}
+		return protocolError(unmarshal(*resp.Result, out))
+	case <-ctx.Done():
+		conn.deletePending(id)
+		return ctx.Err()
+	}
+}
+
+// 如果 resp 是由 [Conn.Call] 等待的返回数据，则将其交给 [Conn.Call] 并返回 true。
+func (conn *Conn) finishCall(resp *body) bool {
+	v, found := conn.callbacks.Load(resp.ID)
+	if !found {
+		return false
+	}
+	p := v.(*pending)
+	if p.result == nil {
+		return false
+	}
+
+	conn.deletePending(resp.ID)
+	p.finish(resp)
+	return true
+}
+
+// 通知所有正在等待的 [Conn.Call] 连接已经关闭
+func (conn *Conn) abortCalls() {
+	ps := make([]*pending, 0, 10)
+	conn.callbacks.Range(func(v interface{}) bool {
+		if p, ok := v.(*pending); ok && p.result != nil {
+			ps = append(ps, p)
+		}
+		return true
+	})
+
+	for _, p := range ps {
+		conn.deletePending(p.id)
+		p.finish(nil)
+	}
+}
+
+// 向 p.result 发送返回数据，仅第一次调用有效，resp 为 nil 表示连接已经关闭。
+func (p *pending) finish(resp *body) {
+	if atomic.CompareAndSwapInt32(&p.finished, 0, 1) {
+		p.result <- resp
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_Call(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	var errHandled bool
+	srv.ErrHandler(func(*Error) { errHandled = true })
+	block := make(chan struct{})
+	a.True(srv.Register("block", func(notify bool, in *inType, out *outType) error {
+		<-block
+		return nil
+	}))
+
+	c1, c2 := net.Pipe()
+	server := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	client := srv.NewConn(NewSocketTransport(false, c2, 0), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serverExit, clientExit := make(chan struct{}, 1), make(chan struct{}, 1)
+	go func() {
+		server.Serve(ctx)
+		serverExit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(context.Background())
+		clientExit <- struct{}{}
+	}()
+
+	out := &outType{}
+	a.NotError(client.Call(context.Background(), "f1", &inType{First: "f", Last: "l", Age: 5}, out)).
+		Equal(out, &outType{Name: "fl", Age: 5})
+
+	// 忽略返回数据
+	a.NotError(client.Call(context.Background(), "f1", &inType{}, nil))
+
+	// 返回错误
+	err := client.Call(context.Background(), "f2", &inType{}, out)
+	var e *Error
+	a.True(errors.As(err, &e)).Equal(e.Code, CodeInvalidParams).False(errHandled)
+
+	// 超时，不带报头，所以对方不知道截止时间。
+	tctx, tcancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer tcancel()
+	a.Equal(client.Call(tctx, "block", &inType{}, out), context.DeadlineExceeded)
+	close(block)
+
+	// 连接关闭
+	block2 := make(chan struct{})
+	a.True(srv.Register("block2", func(notify bool, in *inType, out *outType) error {
+		<-block2
+		return nil
+	}))
+	ret := make(chan error, 1)
+	go func() { ret <- client.Call(context.Background(), "block2", &inType{}, out) }()
+	time.Sleep(50 * time.Millisecond)
+	c2.Close()
+	select {
+	case err := <-ret:
+		var te *TransportError
+		a.ErrorIs(err, errConnClosed).True(errors.As(err, &te))
+	case <-time.After(time.Second):
+		a.TB().Fatal("Call 未返回")
+	}
+	<-clientExit
+
+	close(block2)
+	cancel()
+	c1.Close()
+	<-serverExit
+}
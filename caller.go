@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoCaller ctx 中不包含可以发送通知的连接
+//
+// ctx 不是由服务函数传递的，或是请求来自 HTTP 等无法主动推送数据的传输层。
+var ErrNoCaller = errors.New("jsonrpc: 无法向请求方发送通知")
+
+type callerKey struct{}
+
+// 服务函数的 context.Context 参数
+//
+// 在 req.ctx 的基础上附加请求所在的连接、[Conn.Values] 以及 traceparent 等信息。
+func handlerContext(req *body) context.Context {
+	ctx := req.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if req.conn != nil {
+		ctx = context.WithValue(ctx, callerKey{}, req.conn)
+		ctx = context.WithValue(ctx, valuesKey{}, &req.conn.values)
+	}
+	if req.TraceParent != "" {
+		ctx = WithTraceParent(ctx, req.TraceParent)
+	}
+	return ctx
+}
+
+// NotifyCaller 在服务执行过程中向请求方发送通知
+//
+// ctx 为服务函数的 context.Context 参数，通知通过请求所在的连接发送，
+// 与返回数据共用同一个传输层，可以与返回数据交替输出，适用于汇报进度等交互式的场景。
+// 其它参数与 [Conn.Notify] 相同。
+//
+// 如果 ctx 不包含请求所在的连接，返回 [ErrNoCaller]。
+func NotifyCaller(ctx context.Context, method string, in interface{}, opts ...CallOption) error {
+	conn, ok := ctx.Value(callerKey{}).(*Conn)
+	if !ok {
+		return ErrNoCaller
+	}
+	return conn.Notify(method, in, opts...)
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestNotifyCaller(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.Equal(NotifyCaller(context.Background(), "progress", 1), ErrNoCaller)
+
+	var notifyErr error
+	a.True(srv.Register("job", func(ctx context.Context, notify bool, in *inType, out *outType) error {
+		for i := 1; i <= 2; i++ {
+			if notifyErr = NotifyCaller(ctx, "progress", i*50); notifyErr != nil {
+				return notifyErr
+			}
+		}
+		out.Name = in.First
+		return nil
+	}))
+
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	req, err := srv.newRequest(false, "job", &inType{First: "f"})
+	a.NotError(err)
+	a.NotError(json.NewEncoder(in).Encode(req))
+	body, err := srv.read(conn.transport)
+	a.NotError(err).NotNil(body)
+	conn.serve(body, 0)
+
+	a.NotError(notifyErr)
+	s := out.String()
+	first, second, result := strings.Index(s, `"params":50`), strings.Index(s, `"params":100`), strings.Index(s, `"result"`)
+	a.True(first >= 0).True(second > first).True(result > second).
+		Contains(s, `"method":"progress"`)
+
+	// 非连接的请求
+	out.Reset()
+	a.NotError(srv.response(NewStreamTransport(false, new(bytes.Buffer), out, nil), req))
+	a.Equal(notifyErr, ErrNoCaller).Contains(out.String(), `"error"`)
+}
+
+func TestHandlerContext(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	type result struct {
+		deadline bool
+		values   bool
+		trace    string
+		err      error
+	}
+	results := make(chan result, 1)
+	started := make(chan struct{}, 1)
+	a.True(srv.RegisterWith("wait", func(ctx context.Context, notify bool, in *inType, out *outType) error {
+		_, deadline := ctx.Deadline()
+		r := result{deadline: deadline, values: ConnValues(ctx) != nil, trace: TraceParent(ctx)}
+		if in.Age > 0 { // 等待取消
+			started <- struct{}{}
+			<-ctx.Done()
+			r.err = ctx.Err()
+		}
+		results <- r
+		return nil
+	}, WithTimeout(time.Hour)))
+
+	// 超时时间和连接相关的值
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	tp := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	conn.serve(&body{Version: Version, ID: srv.id(), Method: "wait", Params: &json.RawMessage{'{', '}'}, TraceParent: tp}, 0)
+	r := <-results
+	a.True(r.deadline).True(r.values).Equal(r.trace, tp).NotError(r.err)
+
+	// Conn.Serve 退出时取消
+	c1, c2 := net.Pipe()
+	server := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewSocketTransport(false, c2, 0)
+	req, err := srv.newRequest(true, "wait", &inType{Age: 1})
+	a.NotError(err).NotError(client.Write(req))
+	<-started
+	cancel()
+	c2.Close()
+
+	select {
+	case r = <-results:
+		a.Equal(r.err, context.Canceled).True(r.values)
+	case <-time.After(time.Second):
+		a.TB().Fatal("服务函数未被取消")
+	}
+	<-exit
+}
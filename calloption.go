@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CallOption 发送请求时的选项
+//
+// 用于 [Conn.Send]、[Conn.Notify] 以及 [HTTPConn] 中的同名方法，
+// 可以针对单次请求调整其行为，而无需创建新的连接。
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout     time.Duration
+	retry       int
+	backoff     time.Duration
+	metadata    map[string]json.RawMessage
+	priority    Priority
+	hasPriority bool
+	noCompress  bool
+	version     int
+	ttl         time.Duration
+	nonce       bool
+	retried     int // 最近一次 write 的重试次数
+}
+
+// WithCallTimeout 指定请求的超时时间
+//
+// 通过 X-Timeout 报头告知对方，对方在超时之后会返回 [CodeTimeout] 错误。
+// 如果同时在 ctx 中指定了截止时间，则以较早的为准。
+// 仅对带报头的流以及 HTTP 有效。
+func WithCallTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// WithRetry 指定写入请求失败时的重试次数
+//
+// n 为最大的重试次数，backoff 为每次重试之前的等待时间。
+// 仅在向传输层写入失败时才会重试，对方返回的错误信息不会触发重试。
+func WithRetry(n int, backoff time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.retry = n
+		o.backoff = backoff
+	}
+}
+
+// WithMetadata 为请求附加额外的顶层字段
+//
+// 对方需要通过 [Server.KeepExtensions] 才能读取这些字段。
+// 与规范定义的字段同名的会被忽略。
+func WithMetadata(md map[string]json.RawMessage) CallOption {
+	return func(o *callOptions) { o.metadata = md }
+}
+
+// WithPriority 指定请求的优先级
+//
+// 仅在传输层由 [NewPriorityTransport] 创建时有效，
+// 优先于 [NewPriorityTransport] 的 priority 参数。
+func WithPriority(p Priority) CallOption {
+	return func(o *callOptions) {
+		o.priority = p
+		o.hasPriority = true
+	}
+}
+
+// WithoutCompression 不压缩当前请求
+//
+// 仅对 [NewStreamTransportWithCompression] 等启用了压缩的传输层有效。
+func WithoutCompression() CallOption {
+	return func(o *callOptions) { o.noCompress = true }
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	if len(opts) == 0 {
+		return nil
+	}
+
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// 将 o 应用到 req，返回需要写入传输层的对象。
+func (o *callOptions) apply(ctx context.Context, req *body, clock Clock) interface{} {
+	if deadline, ok := ctxDeadline(ctx, clock); ok {
+		req.deadline = deadline
+	}
+	req.TraceParent = TraceParent(ctx)
+
+	if o == nil {
+		return req
+	}
+
+	req.opts = o
+	if o.version > 0 {
+		req.Method = versionedName(req.Method, o.version)
+	}
+	if o.timeout > 0 {
+		if deadline := clock.Now().Add(o.timeout); req.deadline.IsZero() || deadline.Before(req.deadline) {
+			req.deadline = deadline
+		}
+	}
+
+	ext := o.metadata
+	if o.ttl > 0 {
+		ext = withTTL(ext, clock.Now(), o.ttl)
+	}
+	if o.nonce {
+		ext = withNonce(ext, clock.Now())
+	}
+	if len(ext) > 0 {
+		req.extensions = ext
+		return &extBody{body: req}
+	}
+	return req
+}
+
+// 向 t 写入 v，失败时按 o 的设置进行重试。
+func (o *callOptions) write(t Transport, v interface{}, clock Clock) error {
+	err := t.Write(v)
+	if o == nil {
+		return err
+	}
+
+	o.retried = 0
+	for ; err != nil && o.retried < o.retry; o.retried++ {
+		if o.backoff > 0 {
+			sleep(clock, o.backoff)
+		}
+		err = t.Write(v)
+	}
+	return err
+}
+
+func (o *callOptions) retries() int {
+	if o == nil {
+		return 0
+	}
+	return o.retried
+}
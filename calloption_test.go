@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 前 fails 次写入都返回错误
+type failTransport struct {
+	Transport
+	fails  int
+	writes int
+}
+
+func (t *failTransport) Write(v interface{}) error {
+	t.writes++
+	if t.writes <= t.fails {
+		return errors.New("write error")
+	}
+	return t.Transport.Write(v)
+}
+
+func TestNewCallOptions(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Nil(newCallOptions(nil))
+
+	o := newCallOptions([]CallOption{
+		WithCallTimeout(time.Second),
+		WithRetry(2, time.Millisecond),
+		WithPriority(PriorityHigh),
+		WithoutCompression(),
+	})
+	a.Equal(o.timeout, time.Second).
+		Equal(o.retry, 2).
+		Equal(o.backoff, time.Millisecond).
+		Equal(o.priority, PriorityHigh).
+		True(o.hasPriority).
+		True(o.noCompress)
+}
+
+func TestCallOptions_apply(t *testing.T) {
+	a := assert.New(t, false)
+
+	// nil
+	var o *callOptions
+	req := &body{}
+	a.Equal(o.apply(context.Background(), req, systemClock{}), req).True(req.deadline.IsZero())
+
+	// 以较早的截止时间为准
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	o = newCallOptions([]CallOption{WithCallTimeout(time.Second)})
+	req = &body{}
+	a.Equal(o.apply(ctx, req, systemClock{}), req).
+		True(time.Until(req.deadline) <= time.Second).
+		Equal(req.opts, o)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	o = newCallOptions([]CallOption{WithCallTimeout(time.Hour)})
+	req = &body{}
+	o.apply(ctx, req, systemClock{})
+	a.True(time.Until(req.deadline) <= time.Millisecond)
+
+	// metadata
+	o = newCallOptions([]CallOption{WithMetadata(map[string]json.RawMessage{"trace": json.RawMessage(`"t1"`)})})
+	req = &body{Version: Version, Method: "m"}
+	v := o.apply(context.Background(), req, systemClock{})
+	data, err := json.Marshal(v)
+	a.NotError(err).Equal(string(data), `{"jsonrpc":"2.0","method":"m","trace":"t1"}`)
+}
+
+func TestCallOptions_write(t *testing.T) {
+	a := assert.New(t, false)
+
+	buf := new(bytes.Buffer)
+	ft := &failTransport{Transport: NewStreamTransport(false, buf, buf, nil), fails: 2}
+	o := newCallOptions([]CallOption{WithRetry(2, time.Millisecond)})
+	a.NotError(o.write(ft, &body{Version: Version}, systemClock{})).Equal(ft.writes, 3).Equal(o.retries(), 2)
+
+	ft = &failTransport{Transport: NewStreamTransport(false, buf, buf, nil), fails: 3}
+	a.Error(o.write(ft, &body{Version: Version}, systemClock{})).Equal(ft.writes, 3).Equal(o.retries(), 2)
+
+	// 未指定重试
+	ft = &failTransport{Transport: NewStreamTransport(false, buf, buf, nil), fails: 1}
+	a.Error((*callOptions)(nil).write(ft, &body{Version: Version}, systemClock{})).Equal(ft.writes, 1)
+}
+
+func TestConn_Send_options(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return <-uniqueID })
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(true, new(bytes.Buffer), out, nil), nil)
+
+	a.NotError(conn.Notify("n", nil, WithCallTimeout(time.Second), WithMetadata(map[string]json.RawMessage{"trace": json.RawMessage(`1`)})))
+	a.Contains(out.String(), "X-Timeout: ").
+		Contains(out.String(), `"trace":1`)
+
+	// 写入失败时重试
+	ft := &failTransport{Transport: NewStreamTransport(true, new(bytes.Buffer), out, nil), fails: 1}
+	conn = srv.NewConn(ft, nil)
+	conn.CollectStats(false)
+	a.NotError(conn.Send("m", nil, func(*int) error { return nil }, WithRetry(1, 0)))
+	a.Equal(ft.writes, 2).Equal(conn.Stats().Calls["m"].Retries, 1)
+}
+
+func TestWithoutCompression(t *testing.T) {
+	a := assert.New(t, false)
+
+	in := new(bytes.Buffer)
+	in.WriteString("Accept-Encoding: gzip\r\nContent-Length: 2\r\n\r\n{}")
+	buf := new(bytes.Buffer)
+	w := NewStreamTransportWithCompression(in, buf, nil, 10)
+	a.NotError(w.Read(&body{}))
+
+	srv := NewServer(func() string { return <-uniqueID })
+	conn := srv.NewConn(w, nil)
+	params := strings.Repeat("p", 100)
+
+	a.NotError(conn.Notify("m", params))
+	a.Contains(buf.String(), "Content-Encoding: gzip")
+
+	buf.Reset()
+	a.NotError(conn.Notify("m", params, WithoutCompression()))
+	a.NotContains(buf.String(), "Content-Encoding").
+		Contains(buf.String(), params)
+}
+
+func TestWithPriority(t *testing.T) {
+	a := assert.New(t, false)
+
+	pt := &priorityTransport{priority: DefaultPriority}
+	req := &body{Method: "m"}
+	a.Equal(pt.getPriority(req), PriorityNormal)
+
+	newCallOptions([]CallOption{WithPriority(PriorityHigh)}).apply(context.Background(), req, systemClock{})
+	a.Equal(pt.getPriority(req), PriorityHigh)
+
+	// 超出范围
+	newCallOptions([]CallOption{WithPriority(PriorityLow - 1)}).apply(context.Background(), req, systemClock{})
+	a.Equal(pt.getPriority(req), PriorityLow)
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// 仅支持 UTF-8 编码，UTF-16 等编码的内容需要由对方转换之后再发送。
+var errUnsupportedCharset = errors.New("不支持 UTF-16 或 UTF-32 编码的内容，请使用 UTF-8")
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// 验证 Content-Type 中 charset 参数的值 v
+func validCharset(v string) error {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if l := len(v); l >= 2 && v[0] == '"' && v[l-1] == '"' {
+		v = strings.TrimSpace(v[1 : l-1])
+	}
+
+	switch {
+	case v == charset:
+		return nil
+	case strings.HasPrefix(v, "utf-16"), strings.HasPrefix(v, "utf-32"), v == "ucs-2":
+		return errUnsupportedCharset
+	default:
+		return errInvalidContentType
+	}
+}
+
+// 去掉 data 开头的 UTF-8 BOM
+//
+// 如果 data 是 UTF-16 或 UTF-32 编码的内容，返回 [errUnsupportedCharset]。
+// 由于 JSON 的首个字符必然是 ASCII 字符，即使没有 BOM，
+// 也可以根据前两个字节中是否包含 NUL 判断是否为 UTF-16 或 UTF-32。
+func trimBOM(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):], nil
+	case len(data) < 2:
+		return data, nil
+	case data[0] == 0xfe && data[1] == 0xff, data[0] == 0xff && data[1] == 0xfe:
+		return nil, errUnsupportedCharset
+	case data[0] == 0 || data[1] == 0:
+		return nil, errUnsupportedCharset
+	default:
+		return data, nil
+	}
+}
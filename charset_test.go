@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestTrimBOM(t *testing.T) {
+	a := assert.New(t, false)
+
+	data, err := trimBOM([]byte("\xef\xbb\xbf{}"))
+	a.NotError(err).Equal(string(data), "{}")
+
+	data, err = trimBOM([]byte("{}"))
+	a.NotError(err).Equal(string(data), "{}")
+
+	data, err = trimBOM([]byte("1"))
+	a.NotError(err).Equal(string(data), "1")
+
+	data, err = trimBOM(nil)
+	a.NotError(err).Empty(data)
+
+	_, err = trimBOM([]byte("\xfe\xff\x00{\x00}"))
+	a.ErrorIs(err, errUnsupportedCharset)
+
+	_, err = trimBOM([]byte("\xff\xfe{\x00}\x00"))
+	a.ErrorIs(err, errUnsupportedCharset)
+
+	_, err = trimBOM([]byte("{\x00}\x00")) // 无 BOM 的 UTF-16LE
+	a.ErrorIs(err, errUnsupportedCharset)
+
+	_, err = trimBOM([]byte("\x00\x00\x00{")) // UTF-32BE
+	a.ErrorIs(err, errUnsupportedCharset)
+}
+
+func TestReadError_charset(t *testing.T) {
+	a := assert.New(t, false)
+
+	var pe *ProtocolError
+	a.True(errors.As(readError(errUnsupportedCharset), &pe))
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时间源
+//
+// 服务的超时、请求的截止时间、TTL、调用统计以及重试的等待时间等都通过 Clock 获取时间，
+// 包括 X-Timeout 报头的换算、限流、事件和数据帧的时间等；
+// context.Context 的截止时间则以其剩余的时长换算为 Clock 中的时间。
+// 测试时可以采用 [ManualClock] 推进虚拟的时间，而不需要真正地等待。
+type Clock interface {
+	// Now 返回当前时间
+	Now() time.Time
+
+	// NewTimer 创建定时器
+	//
+	// 在 d 之后向 c 发送当时的时间，在此之前调用 stop 可以取消定时器，
+	// stop 的返回值与 [time.Timer.Stop] 相同。
+	NewTimer(d time.Duration) (c <-chan time.Time, stop func() bool)
+}
+
+type systemClock struct{}
+
+// 需要时间源的传输层
+//
+// 由 [Server.NewConn] 传入 [Server.Clock] 指定的时间源，用于计算 X-Timeout 等报头。
+type clockSetter interface {
+	setClock(Clock)
+}
+
+// ManualClock 手动推进时间的 [Clock] 实现
+//
+// 时间只在调用 [ManualClock.Advance] 时才会改变，一般用于测试。
+type ManualClock struct {
+	mux    sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// Clock 指定时间源
+//
+// c 为空表示采用系统时间。
+//
+// NOTE: 需要在 [Server.NewConn] 和处理请求之前调用。
+func (s *Server) Clock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	s.clock = c
+}
+
+// NewManualClock 声明 [ManualClock]
+//
+// now 为初始的时间。
+func NewManualClock(now time.Time) *ManualClock { return &ManualClock{now: now} }
+
+func (c *ManualClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	t := &manualTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+	c.timers = append(c.timers, t)
+
+	return t.c, func() bool {
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		for i, timer := range c.timers {
+			if timer == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Advance 将时间推进 d
+//
+// 到期的定时器会按到期时间依次触发。
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+
+	var i int
+	for ; i < len(c.timers) && !c.timers[i].at.After(c.now); i++ {
+		c.timers[i].c <- c.now
+	}
+	c.timers = c.timers[i:]
+}
+
+// Timers 尚未触发的定时器数量
+//
+// 在调用 [ManualClock.Advance] 之前，可以据此判断是否已经有代码在等待定时器。
+func (c *ManualClock) Timers() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.timers)
+}
+
+// 返回 ctx 的截止时间在 clock 中对应的时间
+//
+// ctx 的截止时间总是基于系统时间的，对于其它的时间源，需要以剩余的时长进行换算。
+func ctxDeadline(ctx context.Context, clock Clock) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Time{}, false
+	}
+	if _, sys := clock.(systemClock); sys {
+		return deadline, true
+	}
+	return clock.Now().Add(time.Until(deadline)), true
+}
+
+// 与 [time.AfterFunc] 相同，但是采用 clock 的定时器
+//
+// 返回的函数用于取消定时器，可以多次调用。
+func afterFunc(clock Clock, d time.Duration, f func()) (stop func()) {
+	c, cancel := clock.NewTimer(d)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c:
+			f()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			close(done)
+		})
+	}
+}
+
+// 等待 d 或是直到 clock 的定时器触发
+func sleep(clock Clock, d time.Duration) {
+	c, _ := clock.NewTimer(d)
+	<-c
+}
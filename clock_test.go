@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+var (
+	_ Clock = systemClock{}
+	_ Clock = &ManualClock{}
+)
+
+func TestManualClock(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(now)
+	a.Equal(c.Now(), now)
+
+	c1, _ := c.NewTimer(2 * time.Second)
+	c2, _ := c.NewTimer(time.Second)
+	c3, stop := c.NewTimer(time.Second)
+	a.Equal(c.Timers(), 3).True(stop()).False(stop()).Equal(c.Timers(), 2)
+
+	c.Advance(time.Second)
+	a.Equal(c.Now(), now.Add(time.Second)).
+		Equal(<-c2, now.Add(time.Second)).
+		Length(c1, 0).
+		Length(c3, 0).
+		Equal(c.Timers(), 1)
+
+	c.Advance(time.Minute)
+	a.Equal(<-c1, now.Add(time.Minute+time.Second)).Equal(c.Timers(), 0)
+
+	// 立即触发
+	c4, stop := c.NewTimer(0)
+	a.Equal(<-c4, c.Now()).False(stop()).Equal(c.Timers(), 0)
+}
+
+func TestServer_Clock(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	clock := NewManualClock(time.Now())
+	srv.Clock(clock)
+
+	exit := make(chan struct{})
+	a.True(srv.RegisterWith("block", func(bool, *inType, *outType) error {
+		<-exit
+		return nil
+	}, WithTimeout(time.Minute)))
+	defer close(exit)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	call := func(data string) *Error {
+		out.Reset()
+		in.WriteString(data)
+		req, err := srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		conn.serve(req, 0)
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp.Error
+	}
+
+	// 超时
+	done := make(chan *Error, 1)
+	go func() { done <- call(`{"jsonrpc":"2.0","id":"1","method":"block","params":{}}`) }()
+	for clock.Timers() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Minute)
+	a.Equal((<-done).Code, CodeTimeout)
+
+	// TTL
+	srv.KeepExtensions(true)
+	ts, err := json.Marshal(clock.Now().UnixMilli())
+	a.NotError(err)
+	req := `{"jsonrpc":"2.0","id":"2","method":"f1","params":{},"timestamp":` + string(ts) + `,"ttl":1000}`
+	a.Nil(call(req))
+	clock.Advance(2 * time.Second)
+	a.Equal(call(req).Code, CodeStale)
+
+	srv.Clock(nil)
+	a.Equal(srv.clock, systemClock{})
+}
+
+func TestServer_Clock_deadline(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	now := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(now)
+	srv.Clock(clock)
+
+	// 读取时的 X-Timeout
+	in := bytes.NewBufferString("X-Timeout:1000\r\nContent-Length:44\r\n\r\n" + `{"jsonrpc":"2.0","id":"1","method":"f1"}    `)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(true, in, out, nil), nil)
+	req, err := srv.read(conn.transport)
+	a.NotError(err).NotNil(req).Equal(req.deadline, now.Add(time.Second))
+
+	// 写入时的 X-Timeout
+	a.NotError(conn.Send("f1", &inType{}, func(*outType) error { return nil }, WithCallTimeout(2*time.Second)))
+	a.Contains(out.String(), "X-Timeout: 2000\r\n")
+
+	// ctx 的截止时间以剩余的时长换算
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	deadline, ok := ctxDeadline(ctx, clock)
+	a.True(ok).True(deadline.After(now.Add(59 * time.Minute))).False(deadline.After(now.Add(time.Hour)))
+	deadline, ok = ctxDeadline(ctx, systemClock{})
+	a.True(ok).True(deadline.After(time.Now()))
+	_, ok = ctxDeadline(context.Background(), clock)
+	a.False(ok)
+
+	// afterFunc
+	fired := make(chan struct{}, 1)
+	afterFunc(clock, time.Second, func() { fired <- struct{}{} })
+	stop := afterFunc(clock, time.Second, func() { fired <- struct{}{} })
+	stop()
+	stop()
+	clock.Advance(time.Second)
+	<-fired
+	time.Sleep(10 * time.Millisecond)
+	a.Length(fired, 0)
+}
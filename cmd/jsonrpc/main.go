@@ -0,0 +1,323 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// jsonrpc 用于调试 JSON RPC 服务的命令行工具
+//
+// 用法：
+//
+//	jsonrpc [options] url method [params]
+//
+// url 支持以下格式：
+//   - tcp://host:port
+//   - unix:///path/to/socket
+//   - udp://host:port
+//   - ws://host:port/path 或是 wss://host:port/path
+//   - http://host:port/path 或是 https://host:port/path
+//
+// params 为 JSON 格式的参数，如果为 - 则从标准输入读取。
+// 指定了 -batch 参数时，会忽略 method 和 params，改为从文件中读取请求列表，
+// 文件内容为一个 JSON 数组，每个元素的格式如下：
+//
+//	{"method": "m1", "params": {...}, "notify": false}
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/issue9/jsonrpc"
+)
+
+// 表示一次需要发送的请求
+type call struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Notify bool            `json:"notify,omitempty"`
+}
+
+// 向服务端发送请求的客户端
+type client interface {
+	Notify(method string, in interface{}, opts ...jsonrpc.CallOption) error
+	Send(method string, in, callback interface{}, opts ...jsonrpc.CallOption) error
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("jsonrpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	header := fs.Bool("header", false, "流式传输层是否带 Content-Length 等报头")
+	notify := fs.Bool("notify", false, "以通知的形式发送请求，不等待返回")
+	batch := fs.String("batch", "", "从文件中读取请求列表，- 表示从标准输入读取")
+	timeout := fs.Duration("timeout", 10*time.Second, "等待服务端返回的超时时间")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法：jsonrpc [options] url method [params]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var calls []*call
+	switch {
+	case *batch != "":
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return errors.New("缺少 url 参数")
+		}
+		data, err := readFile(*batch, stdin)
+		if err != nil {
+			return err
+		}
+		if calls, err = parseBatch(data); err != nil {
+			return err
+		}
+	default:
+		if fs.NArg() < 2 {
+			fs.Usage()
+			return errors.New("缺少 url 或 method 参数")
+		}
+		c := &call{Method: fs.Arg(1), Notify: *notify}
+		if fs.NArg() > 2 {
+			data, err := readParams(fs.Arg(2), stdin)
+			if err != nil {
+				return err
+			}
+			c.Params = data
+		}
+		calls = []*call{c}
+	}
+
+	return dial(fs.Arg(0), *header, *timeout, calls, stdout, stderr)
+}
+
+func readFile(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func readParams(p string, stdin io.Reader) (json.RawMessage, error) {
+	data := []byte(p)
+	if p == "-" {
+		var err error
+		if data, err = io.ReadAll(stdin); err != nil {
+			return nil, err
+		}
+	}
+
+	data = bytes.TrimSpace(data)
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("无效的参数 %s", string(data))
+	}
+	return data, nil
+}
+
+func parseBatch(data []byte) ([]*call, error) {
+	calls := make([]*call, 0, 10)
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, err
+	}
+
+	for i, c := range calls {
+		if c.Method == "" {
+			return nil, fmt.Errorf("第 %d 个请求缺少 method", i)
+		}
+	}
+	return calls, nil
+}
+
+func dial(addr string, header bool, timeout time.Duration, calls []*call, stdout, stderr io.Writer) error {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	srv := jsonrpc.NewServer(func() string { return strconv.FormatInt(atomic.AddInt64(&id, 1), 10) })
+
+	var t jsonrpc.Transport
+	switch u.Scheme {
+	case "http", "https":
+		return send(srv.NewHTTPConn(addr, nil), calls, stdout, stderr)
+	case "ws", "wss":
+		conn, _, err := websocket.DefaultDialer.Dial(addr, nil)
+		if err != nil {
+			return err
+		}
+		t = jsonrpc.NewWebsocketTransport(conn)
+	default: // tcp、unix 和 udp 等由 jsonrpc.Dial 处理
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		t, err = jsonrpc.Dial(ctx, addr, header, time.Second)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	defer t.Close()
+
+	return serve(srv, t, timeout, calls, stdout, stderr)
+}
+
+// 运行长连接的服务，并等待所有的请求返回。
+func serve(srv *jsonrpc.Server, t jsonrpc.Transport, timeout time.Duration, calls []*call, stdout, stderr io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := srv.NewConn(t, nil)
+	wc := &waitClient{conn: conn, ctx: ctx, stderr: stderr}
+
+	// 能与请求对应的错误由 waitClient 处理，此处只有无法对应的错误，比如缺少 id 的返回数据。
+	srv.ErrHandler(func(err *jsonrpc.Error) { wc.fail(err) })
+	go conn.Serve(ctx)
+
+	if err := send(wc, calls, stdout, stderr); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		return errors.New("等待返回数据超时")
+	}
+
+	if atomic.LoadInt32(&wc.failed) == 1 {
+		return errors.New("服务端返回了错误信息")
+	}
+	return nil
+}
+
+// 以 [jsonrpc.Conn.Call] 发送请求的客户端
+//
+// 每个请求都根据其 ID 等待对应的返回数据，在返回之后调用 wg.Done，
+// 这样无法与请求对应的错误不会影响计数。
+type waitClient struct {
+	conn   *jsonrpc.Conn
+	ctx    context.Context
+	wg     sync.WaitGroup
+	mux    sync.Mutex // 回调函数和错误输出的锁
+	stderr io.Writer
+	failed int32
+}
+
+func (c *waitClient) Notify(method string, in interface{}, opts ...jsonrpc.CallOption) error {
+	return c.conn.Notify(method, in, opts...)
+}
+
+func (c *waitClient) Send(method string, in, callback interface{}, opts ...jsonrpc.CallOption) error {
+	f := callback.(func(*json.RawMessage) error)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		result := json.RawMessage{}
+		err := c.conn.Call(c.ctx, method, in, &result, opts...)
+
+		var err2 *jsonrpc.Error
+		switch {
+		case errors.As(err, &err2):
+			c.fail(err2)
+			return
+		case err != nil:
+			c.fail(&jsonrpc.Error{Code: jsonrpc.CodeInternalError, Message: err.Error()})
+			return
+		}
+
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		if err := f(&result); err != nil {
+			fmt.Fprintln(c.stderr, err)
+		}
+	}()
+	return nil
+}
+
+func (c *waitClient) fail(err *jsonrpc.Error) {
+	atomic.StoreInt32(&c.failed, 1)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	printError(c.stderr, err)
+}
+
+func send(c client, calls []*call, stdout, stderr io.Writer) error {
+	var failed bool
+	for _, item := range calls {
+		var in interface{}
+		if len(item.Params) > 0 {
+			in = item.Params
+		}
+
+		if item.Notify {
+			if err := c.Notify(item.Method, in); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := c.Send(item.Method, in, func(result *json.RawMessage) error {
+			return printResult(stdout, *result)
+		})
+		var err2 *jsonrpc.Error
+		if errors.As(err, &err2) {
+			failed = true
+			printError(stderr, err2)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return errors.New("服务端返回了错误信息")
+	}
+	return nil
+}
+
+func printResult(w io.Writer, data []byte) error {
+	if len(data) == 0 {
+		data = []byte("null")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, data, "", "    "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func printError(w io.Writer, err *jsonrpc.Error) {
+	data, e := json.MarshalIndent(err, "", "    ")
+	if e != nil {
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+
+	"github.com/issue9/jsonrpc"
+)
+
+type params struct {
+	Name string `json:"name"`
+}
+
+func newServer() *jsonrpc.Server {
+	var id int64
+	srv := jsonrpc.NewServer(func() string { return strconv.FormatInt(atomic.AddInt64(&id, 1), 10) })
+	srv.Register("echo", func(notify bool, in, out *params) error {
+		out.Name = in.Name
+		return nil
+	})
+	srv.Register("fail", func(notify bool, in, out *params) error {
+		return jsonrpc.NewError(-32000, "fail")
+	})
+	return srv
+}
+
+func TestParseBatch(t *testing.T) {
+	a := assert.New(t, false)
+
+	calls, err := parseBatch([]byte(`[{"method":"m1","params":{"name":"n"}},{"method":"m2","notify":true}]`))
+	a.NotError(err).Length(calls, 2).
+		Equal(calls[0].Method, "m1").
+		Equal(string(calls[0].Params), `{"name":"n"}`).
+		True(calls[1].Notify)
+
+	calls, err = parseBatch([]byte(`[{"params":{}}]`))
+	a.Error(err).Nil(calls)
+
+	calls, err = parseBatch([]byte(`{}`))
+	a.Error(err).Nil(calls)
+}
+
+func TestReadParams(t *testing.T) {
+	a := assert.New(t, false)
+
+	data, err := readParams(`{"name":"n"}`, nil)
+	a.NotError(err).Equal(string(data), `{"name":"n"}`)
+
+	data, err = readParams("-", strings.NewReader(" [1,2]\n"))
+	a.NotError(err).Equal(string(data), `[1,2]`)
+
+	data, err = readParams(`{"name"`, nil)
+	a.Error(err).Nil(data)
+}
+
+func TestRun_HTTP(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := httptest.NewServer(newServer().NewHTTPConn("", nil))
+	defer srv.Close()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	a.NotError(run([]string{srv.URL, "echo", `{"name":"n"}`}, nil, stdout, stderr))
+	a.Equal(stdout.String(), "{\n    \"name\": \"n\"\n}\n").Empty(stderr.String())
+
+	stdout.Reset()
+	stderr.Reset()
+	a.Error(run([]string{srv.URL, "fail", `{}`}, nil, stdout, stderr))
+	a.Empty(stdout.String()).Contains(stderr.String(), "-32000")
+
+	stdout.Reset()
+	stderr.Reset()
+	a.NotError(run([]string{"-notify", srv.URL, "echo", `{}`}, nil, stdout, stderr))
+	a.Empty(stdout.String()).Empty(stderr.String())
+
+	a.Error(run([]string{"ftp://localhost", "echo"}, nil, stdout, stderr))
+	a.Error(run([]string{srv.URL}, nil, stdout, stderr))
+}
+
+func TestRun_TCP(t *testing.T) {
+	a := assert.New(t, false)
+	srv := newServer()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		srv.NewConn(jsonrpc.NewSocketTransport(true, c, time.Second), nil).Serve(ctx)
+	}()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	batch := `[{"method":"echo","params":{"name":"n"}},{"method":"echo","notify":true},{"method":"fail"}]`
+	err = run([]string{"-header", "-batch", "-", "tcp://" + l.Addr().String()}, strings.NewReader(batch), stdout, stderr)
+	a.Error(err).
+		Equal(stdout.String(), "{\n    \"name\": \"n\"\n}\n").
+		Contains(stderr.String(), "-32000")
+}
+
+// 无法与请求对应的错误不应该影响等待的计数
+func TestRun_unmatchedError(t *testing.T) {
+	a := assert.New(t, false)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		req := struct {
+			ID json.RawMessage `json:"id"`
+		}{}
+		if err := json.NewDecoder(c).Decode(&req); err != nil {
+			return
+		}
+		c.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse"}}`))
+		time.Sleep(50 * time.Millisecond)
+		c.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":1}`))
+		time.Sleep(time.Second)
+	}()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	err = run([]string{"tcp://" + l.Addr().String(), "echo"}, nil, stdout, stderr)
+	a.Error(err).
+		Equal(stdout.String(), "1\n").
+		Contains(stderr.String(), "-32700")
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// openrpcgen 根据 OpenRPC 文档生成服务端和客户端的 Go 代码
+//
+// 用法：
+//
+//	openrpcgen [options] openrpc.json
+//
+// 文件为 - 时从标准输入读取，生成的代码说明可参考 github.com/issue9/jsonrpc/openrpc。
+// 可以配合 go:generate 使用：
+//
+//	//go:generate openrpcgen -pkg=petstore -o=petstore.go petstore.json
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/issue9/jsonrpc/openrpc"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("openrpcgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pkg := fs.String("pkg", "main", "生成代码的包名")
+	output := fs.String("o", "", "输出的文件，为空表示输出到标准输出")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法：openrpcgen [options] openrpc.json")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("需要指定 OpenRPC 文档")
+	}
+
+	var data []byte
+	var err error
+	if path := fs.Arg(0); path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	doc, err := openrpc.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := openrpc.Generate(buf, *pkg, doc); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0o644)
+}
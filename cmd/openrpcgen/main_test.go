@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+const doc = `{"openrpc":"1.2.6","methods":[{"name":"echo","params":[{"name":"name","schema":{"type":"string"}}],"result":{"name":"r","schema":{"type":"string"}}}]}`
+
+func TestRun(t *testing.T) {
+	a := assert.New(t, false)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	a.NotError(run([]string{"-pkg=echo", "-"}, strings.NewReader(doc), stdout, stderr))
+	a.Contains(stdout.String(), "package echo").
+		Contains(stdout.String(), "func (c *Client) Echo(").
+		Empty(stderr.String())
+
+	path := filepath.Join(t.TempDir(), "echo.go")
+	a.NotError(run([]string{"-o", path, "-"}, strings.NewReader(doc), stdout, stderr))
+	data, err := os.ReadFile(path)
+	a.NotError(err).Contains(string(data), "package main")
+
+	a.Error(run(nil, nil, stdout, stderr))
+	a.Error(run([]string{"not-exists.json"}, nil, stdout, stderr))
+	a.Error(run([]string{"-"}, strings.NewReader("{"), stdout, stderr))
+	a.Error(run([]string{"-"}, strings.NewReader(`{"openrpc":"1.2.6","methods":[{"name":"m","paramStructure":"by-position"}]}`), stdout, stderr))
+}
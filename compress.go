@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 支持的压缩方式，按优先级排列。
+var encodings = []string{"gzip", "deflate"}
+
+// 解压之后内容的最大长度，防止压缩炸弹。
+const maxDecompressSize = 32 << 20
+
+// 自适应压缩的参数
+const (
+	compressSamples  = 16  // 每统计这么多次压缩，判断一次压缩效果。
+	compressMaxRatio = 0.9 // 压缩后与压缩前的比值超过此值，表示压缩效果不佳。
+	compressPause    = 256 // 压缩效果不佳时，暂停压缩的消息数量，之后重新尝试。
+)
+
+// CompressionStats 连接上的压缩统计
+type CompressionStats struct {
+	Compressed int64 // 压缩之后发送的消息数量
+	Skipped    int64 // 因为压缩效果不佳而未压缩的消息数量
+	BytesIn    int64 // 尝试压缩的内容在压缩之前的字节数
+	BytesOut   int64 // 尝试压缩的内容在压缩之后的字节数
+
+	// 是否因为压缩效果不佳而暂停了压缩
+	Disabled bool
+}
+
+// 根据压缩效果决定是否压缩
+//
+// 对于已经压缩过的图片等内容，再次压缩并不能减少数据量，反而浪费 CPU，
+// 所以在最近的压缩效果不佳时，会暂停一段时间的压缩。
+type adaptiveCompression struct {
+	mux       sync.Mutex
+	s         CompressionStats
+	samples   int
+	sampleIn  int64
+	sampleOut int64
+	paused    int // 剩余暂停压缩的消息数量
+}
+
+// 可以提供压缩统计的传输层
+type compressionStater interface {
+	CompressionStats() *CompressionStats
+}
+
+// 根据 Accept-Encoding 报头选择压缩方式
+//
+// 返回 encodings 中第一个被对方接受的值，如果都不接受，则返回空值。
+// * 仅匹配未在报头中明确列出的压缩方式，所以 gzip;q=0, * 不会选择 gzip。
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool, 2) // 值为 false 表示被 q=0 拒绝
+	for _, item := range strings.Split(header, ",") {
+		name := item
+		q := ""
+		if index := strings.IndexByte(item, ';'); index >= 0 {
+			name = item[:index]
+			q = strings.TrimSpace(item[index+1:])
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		refused := false
+		if strings.HasPrefix(q, "q=") {
+			if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+				refused = true
+			}
+		}
+		accepted[name] = !refused
+	}
+
+	for _, enc := range encodings {
+		if ok, listed := accepted[enc]; listed {
+			if ok {
+				return enc
+			}
+			continue
+		}
+		if accepted["*"] {
+			return enc
+		}
+	}
+	return ""
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		fw, err := flate.NewWriter(buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = fw
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(encoding string, data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	switch encoding {
+	case "identity":
+		return data, nil
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(data))
+	default:
+		return nil, errUnsupportedEncoding
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressSize {
+		return nil, fmt.Errorf("解压之后的内容超过了 %d", maxDecompressSize)
+	}
+	return data, nil
+}
+
+// NewStreamTransportWithCompression 返回支持压缩的基于流的 Transport 实例
+//
+// 压缩依赖报头，所以返回的对象始终是带报头的。
+// 输出的每条数据都会带上 Accept-Encoding 报头，告知对方本端支持的压缩方式；
+// 在从对方的报头中得知其支持的压缩方式之后，长度达到 threshold 的内容才会被压缩，
+// 并以 Content-Encoding 报头标明压缩方式，较小的内容则不压缩，以节省 CPU。
+// threshold 小于等于 0 时与 NewStreamTransport(true, in, out, close) 相同。
+//
+// 无论是否启用压缩，带报头的 Transport 都能读取带 Content-Encoding 的内容。
+func NewStreamTransportWithCompression(in io.Reader, out io.Writer, close func() error, threshold int) Transport {
+	t := NewStreamTransport(true, in, out, close).(*streamTransport)
+	t.threshold = threshold
+	return t
+}
+
+// Ratio 压缩之后与压缩之前的字节数之比
+//
+// 值越小表示压缩效果越好，未压缩过任何内容时返回 0。
+func (s *CompressionStats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 0
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+// CompressionStats 返回连接上的压缩统计
+//
+// 仅在 [Server.NewConn] 的传输层由 [NewStreamTransportWithCompression]
+// 或是指定了 [SocketOptions.CompressThreshold] 的 [NewSocketTransportWithOptions] 创建时才有值，
+// 否则返回 nil。
+func (conn *Conn) CompressionStats() *CompressionStats {
+	if conn.compression == nil {
+		return nil
+	}
+	return conn.compression.CompressionStats()
+}
+
+// 是否压缩当前的消息
+func (c *adaptiveCompression) allow() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.paused <= 0 {
+		return true
+	}
+
+	c.s.Skipped++
+	if c.paused--; c.paused == 0 {
+		c.s.Disabled = false
+	}
+	return false
+}
+
+// 记录一次压缩的结果，返回是否采用压缩后的内容。
+func (c *adaptiveCompression) record(in, out int) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.s.BytesIn += int64(in)
+	c.s.BytesOut += int64(out)
+	c.sampleIn += int64(in)
+	c.sampleOut += int64(out)
+	if c.samples++; c.samples >= compressSamples {
+		if float64(c.sampleOut) > float64(c.sampleIn)*compressMaxRatio {
+			c.paused = compressPause
+			c.s.Disabled = true
+		}
+		c.samples = 0
+		c.sampleIn = 0
+		c.sampleOut = 0
+	}
+
+	if out >= in {
+		c.s.Skipped++
+		return false
+	}
+	c.s.Compressed++
+	return true
+}
+
+func (c *adaptiveCompression) stats() *CompressionStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	s := c.s
+	return &s
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Equal(negotiateEncoding("gzip, deflate"), "gzip").
+		Equal(negotiateEncoding("deflate, gzip"), "gzip").
+		Equal(negotiateEncoding("deflate"), "deflate").
+		Equal(negotiateEncoding("GZIP"), "gzip").
+		Equal(negotiateEncoding("gzip;q=0, deflate;q=0.5"), "deflate").
+		Equal(negotiateEncoding("*"), "gzip").
+		Equal(negotiateEncoding("gzip;q=0, *"), "deflate").
+		Equal(negotiateEncoding("*, gzip;q=0, deflate;q=0"), "").
+		Equal(negotiateEncoding("*;q=0"), "").
+		Equal(negotiateEncoding("*;q=0, deflate"), "deflate").
+		Equal(negotiateEncoding("br"), "").
+		Equal(negotiateEncoding(""), "")
+}
+
+func TestCompress(t *testing.T) {
+	a := assert.New(t, false)
+	data := []byte(strings.Repeat("data", 100))
+
+	for _, enc := range encodings {
+		c, err := compress(enc, data)
+		a.NotError(err).NotEqual(c, data)
+		d, err := decompress(enc, c)
+		a.NotError(err).Equal(d, data)
+	}
+
+	_, err := compress("br", data)
+	a.Equal(err, errUnsupportedEncoding)
+	_, err = decompress("br", data)
+	a.Equal(err, errUnsupportedEncoding)
+
+	_, err = decompress("gzip", data)
+	a.Error(err)
+}
+
+func TestStreamTransport_compression(t *testing.T) {
+	a := assert.New(t, false)
+
+	buf := new(bytes.Buffer)
+	w := NewStreamTransportWithCompression(new(bytes.Buffer), buf, nil, 100)
+	r := NewStreamTransport(true, buf, nil, nil)
+
+	// 未得知对方支持的压缩方式，不压缩。
+	large := &body{Version: Version, Method: strings.Repeat("m", 200)}
+	a.NotError(w.Write(large))
+	a.Contains(buf.String(), "Accept-Encoding: gzip, deflate").
+		NotContains(buf.String(), "Content-Encoding")
+	req := &body{}
+	a.NotError(r.Read(req)).Equal(req.Method, large.Method)
+
+	// 对方声明支持 gzip
+	in := new(bytes.Buffer)
+	in.WriteString("Accept-Encoding: gzip\r\nContent-Length: 2\r\n\r\n{}")
+	w = NewStreamTransportWithCompression(in, buf, nil, 100)
+	a.NotError(w.Read(&body{}))
+
+	a.NotError(w.Write(large))
+	a.Contains(buf.String(), "Content-Encoding: gzip")
+	req = &body{}
+	a.NotError(r.Read(req)).Equal(req.Method, large.Method)
+
+	// 小于阈值，不压缩。
+	a.NotError(w.Write(&body{Version: Version, Method: "m"}))
+	a.NotContains(buf.String(), "Content-Encoding")
+	req = &body{}
+	a.NotError(r.Read(req)).Equal(req.Method, "m")
+
+	// 不支持的压缩方式
+	buf.WriteString("Content-Encoding: br\r\nContent-Length: 2\r\n\r\n{}")
+	a.Equal(r.Read(&body{}), errUnsupportedEncoding)
+}
+
+func TestAdaptiveCompression(t *testing.T) {
+	a := assert.New(t, false)
+	c := &adaptiveCompression{}
+
+	// 压缩效果良好
+	for i := 0; i < compressSamples; i++ {
+		a.True(c.allow()).True(c.record(100, 20))
+	}
+	s := c.stats()
+	a.Equal(s.Compressed, compressSamples).
+		Equal(s.Skipped, 0).
+		Equal(s.Ratio(), 0.2).
+		False(s.Disabled)
+
+	// 压缩之后反而变大，采用原始内容。
+	a.True(c.allow()).False(c.record(100, 101))
+	for i := 1; i < compressSamples; i++ {
+		a.True(c.allow()).True(c.record(100, 95))
+	}
+	s = c.stats()
+	a.True(s.Disabled).Equal(s.Skipped, 1)
+
+	// 暂停压缩之后重新尝试
+	for i := 0; i < compressPause; i++ {
+		a.False(c.allow())
+	}
+	s = c.stats()
+	a.False(s.Disabled).Equal(s.Skipped, 1+compressPause)
+	a.True(c.allow())
+
+	a.Equal((&CompressionStats{}).Ratio(), 0)
+}
+
+func TestConn_CompressionStats(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	conn := srv.NewConn(NewStreamTransport(true, new(bytes.Buffer), new(bytes.Buffer), nil), nil)
+	a.Nil(conn.CompressionStats())
+
+	in := new(bytes.Buffer)
+	in.WriteString("Accept-Encoding: gzip\r\nContent-Length: 2\r\n\r\n{}")
+	tr := NewStreamTransportWithCompression(in, new(bytes.Buffer), nil, 100)
+	a.NotError(tr.Read(&body{}))
+	conn = srv.NewConn(tr, nil)
+	a.NotNil(conn.CompressionStats()).Equal(conn.CompressionStats().Compressed, 0)
+
+	a.NotError(tr.Write(&body{Version: Version, Method: strings.Repeat("m", 200)}))
+	s := conn.CompressionStats()
+	a.Equal(s.Compressed, 1).Equal(s.BytesIn > s.BytesOut, true)
+}
@@ -6,9 +6,14 @@ package jsonrpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Conn JSON RPC 连接对象
@@ -17,10 +22,51 @@ import (
 //
 // 如果需要使用 HTTP 的通讯模式，请使用 HTTPConn 对象。
 type Conn struct {
-	server    *Server
-	errlog    *log.Logger
-	transport Transport
-	callbacks sync.Map
+	server      *Server
+	errlog      *log.Logger
+	transport   Transport
+	callbacks   Correlator
+	seq         *sequencer
+	memory      *memory
+	maxSize     int64
+	strict      bool
+	stats       *stats
+	batcher     *batcher
+	journal     Journal
+	deadLetter  DeadLetter
+	identity    atomic.Value // *identity
+	values      sync.Map
+	frameHooks  *frameHooks
+	compression compressionStater
+	outstanding *outstanding
+	via         Exposure
+
+	deadlineMargin time.Duration
+	events         events
+	sweeper        *sweeper
+	ctx            atomic.Value // serveContext
+}
+
+// 包装 [Conn.Serve] 的 ctx 参数，atomic.Value 要求每次存储的类型相同。
+type serveContext struct {
+	ctx context.Context
+}
+
+// 等待服务端返回数据的请求
+type pending struct {
+	ctx    context.Context
+	method string
+	cb     *callback
+	id     *ID
+	req    interface{}   // 发送的请求，可能为空。
+	sent   time.Time     // 发送的时间，仅在 [Conn.CollectStats] 之后才有值。
+	slots  chan struct{} // 占用的 [Conn.MaxOutstanding] 名额
+	freed  int32         // 是否已经释放了名额
+	expire time.Time     // 截止时间，仅在 [Conn.Sweep] 之后才有值。
+
+	// 由 [Conn.Call] 等待的返回数据，与 cb 只能二选一。
+	result   chan *body
+	finished int32 // 是否已经向 result 发送了数据
 }
 
 // NewConn 创建长链接的 JSON RPC 实例
@@ -28,19 +74,61 @@ type Conn struct {
 // t 表示传输层的操作实例；
 // errlog 表示在 serveHTTP 和 Serve 中部分不会中断执行的错误输出。
 // 如果为空，则不会输出这些错误。
+//
+// 如果通过 [Server.Install] 安装了 [ConnModule]，会将新的连接传递给这些模块。
 func (s *Server) NewConn(t Transport, errlog *log.Logger) *Conn {
-	return &Conn{
+	conn := &Conn{
 		server:    s,
 		transport: t,
 		errlog:    errlog,
+		callbacks: &mapCorrelator{},
+	}
+	if c, ok := t.(compressionStater); ok {
+		conn.compression = c
 	}
+	if c, ok := t.(clockSetter); ok {
+		c.setClock(s.clock)
+	}
+	conn.via = exposureOf(t)
+	s.attach(conn)
+	return conn
 }
 
 // Notify 发送通知信息
 //
 // 仅发送 in 至服务端，会忽略服务端返回的信息。
-func (conn *Conn) Notify(method string, in interface{}) error {
-	_, err := conn.server.request(conn.transport, true, method, in)
+// opts 可以对本次请求作一些额外的设置。
+func (conn *Conn) Notify(method string, in interface{}, opts ...CallOption) error {
+	req, err := conn.server.newRequest(true, method, in)
+	if err != nil {
+		return err
+	}
+
+	o := newCallOptions(opts)
+	v := o.apply(context.Background(), req, conn.server.clock)
+	if conn.batcher != nil {
+		return conn.batcher.add(v)
+	}
+	return conn.writeNotify(o, v, []interface{}{v})
+}
+
+// 发送通知
+//
+// v 为需要写入的数据，可以是单个通知或是由多个通知组成的批量请求，ns 为其包含的通知。
+// 发送之后会更新统计数据，失败时触发 [EventWriteError] 并保存至死信。
+func (conn *Conn) writeNotify(o *callOptions, v interface{}, ns []interface{}) error {
+	err := transportError(o.write(conn.transport, v, conn.server.clock))
+	if conn.stats != nil {
+		for _, n := range ns {
+			conn.stats.sent(bodyOf(n).Method, o.retries())
+		}
+	}
+	if err != nil {
+		conn.emit(EventWriteError, err, nil)
+		for _, n := range ns {
+			storeDeadLetter(conn.deadLetter, nil, bodyOf(n).Method, n, err)
+		}
+	}
 	return err
 }
 
@@ -50,18 +138,131 @@ func (conn *Conn) Notify(method string, in interface{}) error {
 // callback 的原型如下：
 //
 //	func(result interface{}) error
+//	func(ctx context.Context, result interface{}) error
 //
 // 参数 result 必须为一个指针，表示返回的数据对象；且函数返回一个 error。
-func (conn *Conn) Send(method string, in, callback interface{}) error {
-	req, err := conn.server.request(conn.transport, false, method, in)
+// 如果 callback 带有 ctx 参数，其值为 [context.Background]，
+// 需要传递其它值，可以使用 [Conn.SendContext]。
+// opts 可以对本次请求作一些额外的设置。
+func (conn *Conn) Send(method string, in, callback interface{}, opts ...CallOption) error {
+	return conn.SendContext(context.Background(), method, in, callback, opts...)
+}
+
+// SendContext 发送请求内容
+//
+// 与 [Conn.Send] 相同，但是可以通过 ctx 附加与当前请求相关的值，
+// 比如发起此次请求的上游请求 ID 等，ctx 会原样传递给 callback 以及
+// [Server.RegisterCallbackBefore] 注册的函数。
+//
+// 如果 ctx 带有截止时间，且传输层为带报头的流，则会通过 X-Timeout 报头告知对方，
+// 对方在超时之后会返回 [CodeTimeout] 错误，可以通过 [Conn.DeadlineMargin] 为其预留时间。
+//
+// NOTE: ctx 的取消操作并不会中断当前的请求。
+func (conn *Conn) SendContext(ctx context.Context, method string, in, callback interface{}, opts ...CallOption) error {
+	_, err := conn.send(ctx, method, in, &pending{cb: newCallback(callback)}, opts)
+	return err
+}
+
+// 发送请求，p 为等待返回数据的对象，其它字段由此方法填充。
+func (conn *Conn) send(ctx context.Context, method string, in interface{}, p *pending, opts []CallOption) (*ID, error) {
+	req, v, o, err := conn.register(ctx, method, in, p, opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	cb := newCallback(callback)
-	conn.callbacks.Store(req.ID.String(), cb)
+	err = transportError(o.write(conn.transport, v, conn.server.clock))
+	if conn.stats != nil {
+		conn.stats.sent(method, o.retries())
+	}
+	if err != nil {
+		conn.emit(EventWriteError, err, nil)
+		conn.deletePending(req.ID)
+		storeDeadLetter(conn.deadLetter, req.ID, method, v, err)
+		return nil, err
+	}
 
-	return nil
+	return req.ID, nil
+}
+
+// 生成请求并保存等待返回数据的对象 p
+//
+// 返回请求对象、需要写入传输层的对象以及请求的选项。
+func (conn *Conn) register(ctx context.Context, method string, in interface{}, p *pending, opts []CallOption) (*body, interface{}, *callOptions, error) {
+	req, err := conn.server.newRequest(false, method, in)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mctx, err := withDeadlineMargin(ctx, conn.deadlineMargin, conn.server.clock)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	o := newCallOptions(opts)
+	v := o.apply(mctx, req, conn.server.clock)
+
+	// 先保存回调函数再发送请求，防止返回数据先于 Store 到达。
+	p.ctx = context.WithValue(ctx, valuesKey{}, &conn.values)
+	p.method = method
+	p.id = req.ID
+	p.req = v
+	if conn.stats != nil {
+		p.sent = conn.server.clock.Now()
+	}
+	p.expire = conn.expireAt(ctx)
+	if err := conn.acquire(ctx, p); err != nil {
+		return nil, nil, nil, err
+	}
+	if !conn.callbacks.Store(req.ID, p) {
+		release(p)
+		return nil, nil, nil, ErrIDCollision
+	}
+	if conn.journal != nil {
+		if err := conn.appendJournal(req, v); err != nil {
+			conn.deletePending(req.ID)
+			return nil, nil, nil, err
+		}
+	}
+	return req, v, o, nil
+}
+
+// Ordered 是否按请求的到达顺序输出返回数据
+//
+// 默认情况下，各个请求是并行处理的，返回数据的顺序与请求的顺序可能并不相同。
+// 如果对方要求返回数据的顺序与请求顺序一致，可以将 v 设置为 true，
+// 此时先完成的请求会被缓存，直到其之前的请求都已经输出。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用。
+func (conn *Conn) Ordered(v bool) {
+	if v {
+		conn.seq = &sequencer{done: make(map[uint64][]interface{}, 10)}
+	} else {
+		conn.seq = nil
+	}
+}
+
+// MemoryLimit 限制正在处理的数据所占用的内存大小
+//
+// size 为所有正在处理中的请求和返回数据中 params 和 result 字段的字节数之和，
+// 超过此值时，会暂停读取新的请求，直到有请求处理完成并释放了足够的空间；
+// 单条请求的大小如果超过了 size，则直接向对方返回 [CodeTooLarge] 错误。
+// 小于等于 0 表示不作限制。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用。
+func (conn *Conn) MemoryLimit(size int64) {
+	if size > 0 {
+		conn.memory = newMemory(size)
+	} else {
+		conn.memory = nil
+	}
+}
+
+// InFlight 正在处理中的数据所占用的字节数
+//
+// 仅在调用 [Conn.MemoryLimit] 设置了限制之后才会统计，否则始终返回 0。
+func (conn *Conn) InFlight() int64 {
+	if conn.memory == nil {
+		return 0
+	}
+	return conn.memory.inFlight()
 }
 
 // Serve 运行服务
@@ -73,59 +274,334 @@ func (conn *Conn) Send(method string, in, callback interface{}) error {
 // 作为客户端需要下一次的服务端数据下发才能退出，
 // 而作为服务端需下一次的客户端请求才会真正退出。
 // 用户可以自行实现在阻塞时返回 os.ErrDeadlineExceeded 解决此问题。
+//
+// 当对方关闭了写入端（[Transport.Read] 返回 io.EOF）时，
+// 会等待已经读取的请求处理完成并输出返回数据之后再关闭传输层，并返回 io.EOF，
+// 调用方可以据此区分正常的关闭和其它原因导致的退出；
+// 如果读取时连接已经中断，比如数据不完整（io.ErrUnexpectedEOF）或是连接已经被关闭，
+// 则直接关闭传输层并返回该错误。
 func (conn *Conn) Serve(ctx context.Context) (err error) {
+	conn.emit(EventConnected, nil, nil)
+	defer func() { conn.emit(EventClosed, err, nil) }()
+
+	if conn.stats != nil && conn.stats.log {
+		defer func() { conn.printErr("连接统计：" + conn.Stats().String()) }()
+	}
+
+	defer conn.clearValues()
+	defer conn.leaveGroups()
+	defer conn.drainPending()
+	defer conn.abortCalls()
+
 	wg := &sync.WaitGroup{}
 	defer wg.Wait()
 
+	// 在等待 wg 之前取消，以通知正在执行的服务函数。
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	conn.ctx.Store(serveContext{ctx: ctx})
+
+	if conn.sweeper != nil {
+		done := make(chan struct{})
+		go func() {
+			conn.runSweeper(ctx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
+			conn.emit(EventClosing, ctx.Err(), nil)
+			if err := conn.Flush(); err != nil {
+				conn.printErr(err)
+			}
 			if err := conn.transport.Close(); err != nil {
 				return err
 			}
 			return ctx.Err()
 		default:
 			body, err := conn.server.read(conn.transport)
+			if errors.Is(err, io.EOF) {
+				wg.Wait()
+				return conn.close(io.EOF)
+			}
+			if isClosed(err) {
+				conn.emit(EventReadError, readError(err), nil)
+				return conn.close(err)
+			}
 			if err != nil {
+				conn.emit(EventReadError, readError(err), nil)
 				conn.printErr(err)
 				continue
 			}
-			if body == nil {
+			if body == nil || conn.tooLarge(body) {
 				continue
 			}
+			if conn.frameHooks != nil {
+				body.received = conn.server.clock.Now()
+				if conn.frameHooks.read != nil {
+					conn.frameHooks.read(newFrameTiming(body))
+				}
+			}
+
+			var size int64
+			if conn.memory != nil {
+				size = body.size()
+				// 返回数据可能正是某个请求所等待的，所以不能阻塞。
+				if !conn.memory.acquire(size, body.isRequest()) {
+					conn.rejectOversize(body)
+					continue
+				}
+			}
+
+			var seq uint64
+			if conn.seq != nil && body.isRequest() {
+				seq = conn.seq.add()
+			}
 
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				conn.serve(body)
+				if conn.memory != nil {
+					defer conn.memory.release(size)
+				}
+				conn.serve(body, seq)
 			}()
 		}
 	}
 }
 
-func (conn *Conn) serve(body *body) {
+// 输出缓存的数据并关闭传输层，返回 err 或是关闭时的错误。
+func (conn *Conn) close(err error) error {
+	conn.emit(EventClosing, err, nil)
+	if err := conn.Flush(); err != nil {
+		conn.printErr(err)
+	}
+	if err2 := conn.transport.Close(); err2 != nil {
+		conn.printErr(err2)
+	}
+	return err
+}
+
+// err 是否表示连接已经断开
+//
+// io.EOF 表示对方正常关闭了写入端，其它的则表示连接异常中断。
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+func (conn *Conn) serve(body *body, seq uint64) {
+	var timing *FrameTiming
+	if h := conn.frameHooks; h != nil {
+		timing = newFrameTiming(body)
+		timing.Dispatch = conn.server.clock.Now()
+		if h.dispatch != nil {
+			h.dispatch(timing)
+		}
+	}
+
 	if !body.isRequest() {
+		conn.handleResponse(body)
+		return
+	}
+
+	if id, ok := conn.identity.Load().(*identity); ok {
+		body.identity = id.v
+	}
+	body.via = conn.via
+	body.conn = conn
+	body.ctx = conn.context()
+
+	if conn.seq == nil {
+		if err := conn.respond(conn.withTiming(conn.transport, timing), body); err != nil {
+			conn.writeErr(err)
+		}
+	} else {
+		ot := &orderedTransport{Transport: conn.transport}
+		if err := conn.respond(conn.withTiming(ot, timing), body); err != nil {
+			conn.writeErr(err)
+		}
+		if err := conn.seq.finish(conn.write, seq, ot.values); err != nil {
+			conn.writeErr(err)
+		}
+	}
+}
+
+// 向 t 输出请求 body 的返回数据
+func (conn *Conn) respond(t Transport, body *body) error {
+	if body.batch != nil {
+		return conn.server.responseBatch(t, body, conn.handleResponse)
+	}
+	return conn.server.response(t, body)
+}
+
+// 处理对方返回的数据
+func (conn *Conn) handleResponse(body *body) {
+	if body.ID == nil { // 无法与任何请求对应
 		if body.Error != nil {
 			if conn.server.errHandler != nil {
 				conn.server.errHandler(body.Error)
 			}
-		} else if f, found := conn.callbacks.Load(body.ID.String()); found {
-			if err := f.(*callback).call(body); err != nil {
-				conn.printErr(err)
-			}
-			conn.callbacks.Delete(body.ID.String())
-		} else {
-			conn.printErr(fmt.Sprintf("未找到 %s 的回调函数,%+v\n", body.ID, body))
+			return
 		}
-	} else {
-		if err := conn.server.response(conn.transport, body); err != nil {
+
+		err := errors.New("返回数据缺少 id")
+		conn.emit(EventUnmatched, err, nil)
+		if !conn.server.handleUnrouted(body, err) {
+			conn.printErr(fmt.Sprintf("%s,%+v\n", err, body))
+		}
+		return
+	}
+
+	conn.doneJournal(body)
+	conn.receivedStats(body)
+	if conn.finishCall(body) {
+		return
+	}
+	if body.Error != nil {
+		conn.deletePending(body.ID)
+		if conn.server.errHandler != nil {
+			conn.server.errHandler(body.Error)
+		}
+	} else if f, found := conn.callbacks.Load(body.ID); found {
+		if err := conn.server.callback(f.(*pending), body); err != nil {
 			conn.printErr(err)
 		}
+		conn.deletePending(body.ID)
+	} else {
+		err := fmt.Errorf("未找到 %s 的回调函数", body.ID)
+		conn.emit(EventUnmatched, err, body.ID)
+		if !conn.server.handleUnrouted(body, err) {
+			conn.printErr(fmt.Sprintf("%s,%+v\n", err, body))
+		}
 	}
 }
 
+func (conn *Conn) rejectOversize(body *body) {
+	err := &tooLargeError{size: body.size(), limit: conn.memory.limit}
+	if !body.isRequest() || (body.ID == nil && body.batch == nil) { // 返回数据和通知都不需要回复
+		conn.printErr(err)
+		return
+	}
+
+	if err := conn.server.writeError(conn.transport, body.ID, CodeTooLarge, err, err.data()); err != nil {
+		conn.writeErr(err)
+	}
+}
+
+func (conn *Conn) writeErr(err error) {
+	conn.emit(EventWriteError, transportError(err), nil)
+	conn.printErr(err)
+}
+
+func (conn *Conn) write(v interface{}) error { return conn.server.write(conn.transport, v) }
+
 func (conn *Conn) printErr(v interface{}) {
 	if conn.errlog != nil {
 		conn.errlog.Println(v)
 	}
 }
+
+// 用于保证返回数据按请求顺序输出
+type sequencer struct {
+	mux  sync.Mutex
+	seq  uint64                   // 下一个分配的序号
+	next uint64                   // 下一个需要输出的序号
+	done map[uint64][]interface{} // 已经完成但还未输出的数据
+}
+
+// 缓存写入的数据，由 sequencer 决定何时真正写入。
+type orderedTransport struct {
+	Transport
+	values []interface{}
+}
+
+func (t *orderedTransport) Write(v interface{}) error {
+	t.values = append(t.values, v)
+	return nil
+}
+
+func (s *sequencer) add() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	seq := s.seq
+	s.seq++
+	return seq
+}
+
+// 标记序号为 seq 的请求已经完成，并输出所有已经可以输出的数据。
+func (s *sequencer) finish(write func(interface{}) error, seq uint64, values []interface{}) (err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.done[seq] = values
+	for {
+		values, found := s.done[s.next]
+		if !found {
+			return err
+		}
+		delete(s.done, s.next)
+		s.next++
+
+		for _, v := range values {
+			if err2 := write(v); err2 != nil && err == nil {
+				err = err2
+			}
+		}
+	}
+}
+
+// 统计正在处理中的数据所占用的内存
+type memory struct {
+	mux   sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemory(limit int64) *memory {
+	m := &memory{limit: limit}
+	m.cond = sync.NewCond(&m.mux)
+	return m
+}
+
+// 申请 size 大小的空间
+//
+// 如果 size 超过了限制，返回 false；
+// wait 表示在空间不足时是否等待其它数据释放空间，否则直接占用。
+func (m *memory) acquire(size int64, wait bool) bool {
+	if size > m.limit {
+		return false
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for wait && m.used+size > m.limit {
+		m.cond.Wait()
+	}
+	m.used += size
+	return true
+}
+
+func (m *memory) release(size int64) {
+	m.mux.Lock()
+	m.used -= size
+	m.mux.Unlock()
+	m.cond.Broadcast()
+}
+
+func (m *memory) inFlight() int64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.used
+}
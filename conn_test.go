@@ -6,9 +6,11 @@ package jsonrpc
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
+	"strconv"
 	"testing"
 	"time"
 
@@ -63,3 +65,169 @@ func TestConn_Serve(t *testing.T) {
 	<-srvExit
 	<-clientExit
 }
+
+func TestConn_Ordered(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return <-uniqueID })
+	a.True(srv.Register("sleep", func(notify bool, in *int, out *int) error {
+		time.Sleep(time.Duration(*in) * time.Millisecond)
+		*out = *in
+		return nil
+	}))
+
+	srvConn, clientConn := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, srvConn, 0), log.New(ioutil.Discard, "", 0))
+	conn.Ordered(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewStreamTransport(false, clientConn, clientConn, nil)
+	durations := []int{300, 200, 0, 100}
+	for _, d := range durations {
+		req, err := srv.newRequest(false, "sleep", d)
+		a.NotError(err)
+		a.NotError(client.Write(req))
+	}
+
+	for _, d := range durations {
+		resp := &body{}
+		a.NotError(client.Read(resp))
+		a.Equal(string(*resp.Result), strconv.Itoa(d))
+	}
+
+	cancel()
+	a.NotError(clientConn.Close())
+	<-exit
+}
+
+func TestMemory(t *testing.T) {
+	a := assert.New(t, false)
+
+	m := newMemory(10)
+	a.False(m.acquire(11, true)).
+		True(m.acquire(6, true)).
+		True(m.acquire(6, false)). // 不等待，直接占用
+		Equal(m.inFlight(), 12)
+
+	acquired := make(chan struct{}, 1)
+	go func() {
+		m.acquire(5, true)
+		acquired <- struct{}{}
+	}()
+
+	m.release(6)
+	select {
+	case <-acquired:
+		a.TB().Fatal("空间不足时未等待")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	m.release(6)
+	<-acquired
+	a.Equal(m.inFlight(), 5)
+}
+
+func TestConn_MemoryLimit(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	srvConn, clientConn := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, srvConn, 0), log.New(ioutil.Discard, "", 0))
+	a.Equal(conn.InFlight(), 0)
+	conn.MemoryLimit(30)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewStreamTransport(false, clientConn, clientConn, nil)
+
+	// 超过大小
+	req, err := srv.newRequest(false, "f1", &inType{Age: 1, Last: "0123456789"})
+	a.NotError(err).NotError(client.Write(req))
+	resp := &body{}
+	a.NotError(client.Read(resp)).
+		Equal(resp.Error.Code, CodeTooLarge).
+		True(resp.ID.Equal(req.ID))
+
+	// 超过大小的通知不返回错误
+	req, err = srv.newRequest(true, "f1", &inType{Age: 1, Last: "0123456789"})
+	a.NotError(err).NotError(client.Write(req))
+
+	req, err = srv.newRequest(false, "f1", &inType{Age: 1})
+	a.NotError(err).NotError(client.Write(req))
+	resp = &body{}
+	a.NotError(client.Read(resp)).
+		Nil(resp.Error).
+		True(resp.ID.Equal(req.ID))
+
+	cancel()
+	a.NotError(clientConn.Close())
+	<-exit
+	a.Equal(conn.InFlight(), 0)
+}
+
+func TestConn_Serve_halfClose(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return <-uniqueID })
+	a.True(srv.Register("sleep", func(notify bool, in *int, out *int) error {
+		time.Sleep(time.Duration(*in) * time.Millisecond)
+		*out = *in
+		return nil
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err).NotNil(l)
+	defer l.Close()
+
+	exit := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			exit <- err
+			return
+		}
+		exit <- srv.NewConn(NewSocketTransport(false, c, 0), nil).Serve(context.Background())
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	a.NotError(err).NotNil(c)
+	defer c.Close()
+
+	_, err = c.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"sleep","params":200}`))
+	a.NotError(err)
+	a.NotError(c.(*net.TCPConn).CloseWrite())
+
+	// 关闭写入端之后，依然可以读取到之前请求的返回数据。
+	data, err := io.ReadAll(c)
+	a.NotError(err).Equal(string(data), `{"jsonrpc":"2.0","id":1,"result":200}`)
+	a.Equal(<-exit, io.EOF)
+}
+
+func TestConn_Serve_unexpectedEOF(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srvConn, clientConn := net.Pipe()
+
+	exit := make(chan error, 1)
+	go func() {
+		exit <- srv.NewConn(NewSocketTransport(false, srvConn, 0), nil).Serve(context.Background())
+	}()
+
+	_, err := clientConn.Write([]byte(`{"jsonrpc":"2.0","id":1,`))
+	a.NotError(err)
+	a.NotError(clientConn.Close())
+
+	err = <-exit
+	a.ErrorIs(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrIDCollision 新请求的 ID 与等待返回的请求重复
+//
+// 一般是由于 [NewServer] 的 idgen 参数生成了重复的 ID，
+// 此时请求不会被发送，以免返回数据被关联到错误的回调函数。
+var ErrIDCollision = errors.New("请求的 ID 与等待返回的请求重复")
+
+// Correlator 关联请求与返回数据
+//
+// 客户端在发送请求之前通过 Store 保存等待返回的数据，
+// 在收到返回数据时通过 Load 查找对应的数据，处理完之后调用 Delete 删除。
+// 默认以 [ID.Key] 为键名保存在 [sync.Map] 中，
+// 如果 ID 都是数值等情况，可以提供更高效的实现。
+//
+// 所有的方法都可能被并发调用。
+type Correlator interface {
+	// Store 保存 id 对应的数据 v
+	//
+	// 如果 id 已经存在，返回 false 且不能覆盖原有的数据。
+	Store(id *ID, v interface{}) bool
+
+	// Load 返回 id 对应的数据
+	Load(id *ID) (interface{}, bool)
+
+	// Delete 删除 id 对应的数据
+	Delete(id *ID)
+
+	// Range 依次对所有的数据调用 f，f 返回 false 时中止。
+	Range(f func(v interface{}) bool)
+}
+
+type mapCorrelator struct {
+	m sync.Map
+}
+
+// Correlate 指定关联请求与返回数据的方式
+//
+// c 为空表示采用默认的方式。
+//
+// NOTE: 需要在 [Conn.Send] 和 [Conn.Serve] 之前调用。
+func (conn *Conn) Correlate(c Correlator) {
+	if c == nil {
+		c = &mapCorrelator{}
+	}
+	conn.callbacks = c
+}
+
+func (c *mapCorrelator) Store(id *ID, v interface{}) bool {
+	_, loaded := c.m.LoadOrStore(id.Key(), v)
+	return !loaded
+}
+
+func (c *mapCorrelator) Load(id *ID) (interface{}, bool) { return c.m.Load(id.Key()) }
+
+func (c *mapCorrelator) Delete(id *ID) { c.m.Delete(id.Key()) }
+
+func (c *mapCorrelator) Range(f func(v interface{}) bool) {
+	c.m.Range(func(_, v interface{}) bool { return f(v) })
+}
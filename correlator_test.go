@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Correlator = &mapCorrelator{}
+
+// 以数值为键名的实现
+type intCorrelator struct {
+	mux sync.Mutex
+	m   map[int64]interface{}
+}
+
+func (c *intCorrelator) key(id *ID) int64 {
+	k, err := strconv.ParseInt(id.String(), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func (c *intCorrelator) Store(id *ID, v interface{}) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, found := c.m[c.key(id)]; found {
+		return false
+	}
+	c.m[c.key(id)] = v
+	return true
+}
+
+func (c *intCorrelator) Load(id *ID) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	v, found := c.m[c.key(id)]
+	return v, found
+}
+
+func (c *intCorrelator) Delete(id *ID) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.m, c.key(id))
+}
+
+func (c *intCorrelator) Range(f func(v interface{}) bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, v := range c.m {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+func TestMapCorrelator(t *testing.T) {
+	a := assert.New(t, false)
+
+	c := &mapCorrelator{}
+	a.True(c.Store(NewStringID("1"), 1)).
+		False(c.Store(NewStringID("1"), 2))
+	v, found := c.Load(NewStringID("1"))
+	a.True(found).Equal(v, 1)
+
+	a.True(c.Store(NewStringID("2"), 2))
+	var sum int
+	c.Range(func(v interface{}) bool {
+		sum += v.(int)
+		return true
+	})
+	a.Equal(sum, 3)
+
+	c.Delete(NewStringID("1"))
+	_, found = c.Load(NewStringID("1"))
+	a.False(found)
+
+	// 数值 1 与字符串 "1" 是不同的 ID
+	a.True(c.Store(NewNumberID(1), 3)).
+		True(c.Store(NewStringID("1"), 4))
+	v, found = c.Load(NewNumberID(1))
+	a.True(found).Equal(v, 3)
+	c.Delete(NewStringID("1"))
+	_, found = c.Load(NewNumberID(1))
+	a.True(found)
+}
+
+func TestConn_Correlate(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return "1" })
+	in := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, new(bytes.Buffer), nil), nil)
+	c := &intCorrelator{m: map[int64]interface{}{}}
+	conn.Correlate(c)
+
+	var result int
+	a.NotError(conn.Send("m", nil, func(v *int) error {
+		result = *v
+		return nil
+	}))
+	a.Length(c.m, 1)
+
+	// 生成了重复的 ID
+	a.Equal(conn.Send("m", nil, func(*int) error { return nil }), ErrIDCollision)
+	a.Length(c.m, 1)
+
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","result":5}`)
+	resp, err := srv.read(conn.transport)
+	a.NotError(err).NotNil(resp)
+	conn.serve(resp, 0)
+	a.Equal(result, 5).Length(c.m, 0)
+
+	// 恢复默认
+	conn.Correlate(nil)
+	a.NotError(conn.Send("m", nil, func(*int) error { return nil }))
+	a.Equal(conn.Send("m", nil, func(*int) error { return nil }), ErrIDCollision)
+}
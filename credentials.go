@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnauthorized 对方拒绝了客户端提供的凭证
+//
+// [HTTPConn] 在收到 401 之后，会通过 [Credentials.Invalidate] 重新获取凭证并重试一次，
+// 依然被拒绝时返回此错误。
+var ErrUnauthorized = errors.New("身份验证失败")
+
+var authorization = http.CanonicalHeaderKey("authorization")
+
+// Credentials 客户端的身份凭证
+//
+// [HTTPConn] 在每次请求时获取，基于连接的传输层则在建立连接时通过 [AuthorizationHeader] 获取，
+// 比如作为 websocket.Dialer 握手时的报头。
+// 双向 TLS 的客户端证书可参考 [ClientCertificate]。
+//
+// 需要保证并发安全。
+type Credentials interface {
+	// Token 返回 Authorization 报头的值，比如 Bearer xxx
+	//
+	// 返回空值表示不需要验证。
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate 通知 token 已经被对方拒绝
+	//
+	// 之后调用 Token 时应该返回新的值。
+	Invalidate(token string)
+}
+
+type staticToken string
+
+// tokenSource 自动刷新的令牌
+type tokenSource struct {
+	fetch func(context.Context) (string, time.Time, error)
+	early time.Duration
+
+	mux    sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// StaticToken 固定的令牌
+//
+// scheme 为验证的方式，比如 Bearer、Basic 等。
+func StaticToken(scheme, token string) Credentials { return staticToken(scheme + " " + token) }
+
+func (t staticToken) Token(context.Context) (string, error) { return string(t), nil }
+
+func (t staticToken) Invalidate(string) {}
+
+// NewTokenSource 声明自动刷新的令牌
+//
+// fetch 用于获取新的令牌及其过期时间，比如通过 OAuth2 的 client credentials 流程，
+// 过期时间为零值表示不会过期。
+// 在令牌过期前的 early 时间内，或是令牌被对方拒绝之后，会调用 fetch 重新获取，
+// 在此之间的调用都返回缓存的令牌。
+// 返回的 [Credentials] 以 Bearer 作为验证方式。
+//
+// 对于 golang.org/x/oauth2 的 TokenSource，可以按以下方式转换：
+//
+//	NewTokenSource(func(context.Context) (string, time.Time, error) {
+//	    t, err := ts.Token()
+//	    if err != nil {
+//	        return "", time.Time{}, err
+//	    }
+//	    return t.AccessToken, t.Expiry, nil
+//	}, 10*time.Second)
+func NewTokenSource(fetch func(context.Context) (token string, expiry time.Time, err error), early time.Duration) Credentials {
+	return &tokenSource{fetch: fetch, early: early}
+}
+
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(s.early).Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	token, expiry, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expiry = "Bearer "+token, expiry
+	return s.token, nil
+}
+
+func (s *tokenSource) Invalidate(token string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.token == token { // 可能已经被其它请求刷新
+		s.token = ""
+	}
+}
+
+// AuthorizationHeader 根据 c 生成包含 Authorization 的报头
+//
+// 可用于 websocket.Dialer 等在建立连接时需要报头的场景。
+func AuthorizationHeader(ctx context.Context, c Credentials) (http.Header, error) {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h := http.Header{}
+	if token != "" {
+		h.Set(authorization, token)
+	}
+	return h, nil
+}
+
+// ClientCertificate 返回用于 [tls.Config.GetClientCertificate] 的函数
+//
+// 在 TLS 握手时会调用 load 加载双向 TLS 的客户端证书，比如 tls.LoadX509KeyPair，
+// 之后的握手会复用该证书，直到距离证书过期不足 early 时才重新加载，
+// 这样证书的轮换对于长期运行的客户端也会生效。
+func ClientCertificate(load func() (*tls.Certificate, error), early time.Duration) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	var mux sync.Mutex
+	var cert *tls.Certificate
+	var expiry time.Time
+
+	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		if cert != nil && time.Now().Add(early).Before(expiry) {
+			return cert, nil
+		}
+
+		c, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		leaf := c.Leaf
+		if leaf == nil && len(c.Certificate) > 0 {
+			if leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+				return nil, err
+			}
+		}
+		if leaf != nil {
+			cert, expiry = c, leaf.NotAfter
+		}
+		return c, nil
+	}
+}
+
+// Credentials 指定作为客户端时的身份凭证
+//
+// 每次请求时都会调用 [Credentials.Token] 获取 Authorization 报头，
+// 如果服务端返回 401，则调用 [Credentials.Invalidate] 之后重新获取并重试一次。
+// 为空表示不需要验证。
+func (h *HTTPConn) Credentials(c Credentials) { h.credentials = c }
+
+// Client 指定作为客户端时使用的 [http.Client]
+//
+// 比如需要双向 TLS 验证时，可以在 [http.Transport] 的 TLSClientConfig 中指定 [ClientCertificate]。
+// 为空表示采用 [http.DefaultClient]。
+func (h *HTTPConn) Client(c *http.Client) { h.client = c }
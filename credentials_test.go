@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestStaticToken(t *testing.T) {
+	a := assert.New(t, false)
+
+	c := StaticToken("Bearer", "abc")
+	token, err := c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer abc")
+	c.Invalidate(token)
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer abc")
+
+	h, err := AuthorizationHeader(context.Background(), c)
+	a.NotError(err).Equal(h.Get("Authorization"), "Bearer abc")
+}
+
+func TestNewTokenSource(t *testing.T) {
+	a := assert.New(t, false)
+
+	var count int
+	expiry := time.Now().Add(time.Hour)
+	c := NewTokenSource(func(context.Context) (string, time.Time, error) {
+		count++
+		return strconv.Itoa(count), expiry, nil
+	}, time.Minute)
+
+	token, err := c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 1")
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 1").Equal(count, 1)
+
+	// 不是当前的令牌
+	c.Invalidate("Bearer 0")
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 1")
+
+	c.Invalidate("Bearer 1")
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 2")
+
+	// 即将过期
+	expiry = time.Now().Add(time.Second)
+	c.Invalidate(token)
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 3")
+	token, err = c.Token(context.Background())
+	a.NotError(err).Equal(token, "Bearer 4")
+
+	// 出错
+	c = NewTokenSource(func(context.Context) (string, time.Time, error) {
+		return "", time.Time{}, errors.New("fetch")
+	}, 0)
+	_, err = c.Token(context.Background())
+	a.Equal(err.Error(), "fetch")
+	_, err = AuthorizationHeader(context.Background(), c)
+	a.Error(err)
+}
+
+func newTestCertificate(a *assert.Assertion, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NotError(err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	a.NotError(err)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertificate(t *testing.T) {
+	a := assert.New(t, false)
+
+	var count int
+	notAfter := time.Now().Add(time.Hour)
+	get := ClientCertificate(func() (*tls.Certificate, error) {
+		count++
+		return newTestCertificate(a, notAfter), nil
+	}, time.Minute)
+
+	c1, err := get(nil)
+	a.NotError(err).NotNil(c1)
+	c2, err := get(nil)
+	a.NotError(err).Equal(c1, c2).Equal(count, 1)
+
+	// 即将过期的证书每次都重新加载
+	notAfter = time.Now().Add(time.Second)
+	get = ClientCertificate(func() (*tls.Certificate, error) {
+		count++
+		return newTestCertificate(a, notAfter), nil
+	}, time.Minute)
+	_, err = get(nil)
+	a.NotError(err)
+	_, err = get(nil)
+	a.NotError(err).Equal(count, 3)
+
+	get = ClientCertificate(func() (*tls.Certificate, error) { return nil, errors.New("load") }, 0)
+	_, err = get(nil)
+	a.Equal(err.Error(), "load")
+}
+
+func TestHTTPConn_Credentials(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	var valid string
+	conn := s.NewHTTPConn("", nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var count int
+	client := s.NewHTTPConn(srv.URL, nil)
+	client.Client(srv.Client())
+	client.Credentials(NewTokenSource(func(context.Context) (string, time.Time, error) {
+		count++
+		return strconv.Itoa(count), time.Time{}, nil
+	}, 0))
+
+	// 第一个令牌被拒绝之后，重新获取令牌并重试。
+	valid = "Bearer 2"
+	a.NotError(client.Send("f1", &inType{Age: 18, First: "f", Last: "l"}, func(out *outType) error {
+		a.Equal(out.Age, 18).Equal(out.Name, "fl")
+		return nil
+	}))
+	a.Equal(count, 2)
+
+	// 复用已有的令牌
+	a.NotError(client.Notify("f1", &inType{Age: 18}))
+	a.Equal(count, 2)
+
+	// 重试之后依然被拒绝
+	valid = "Bearer 100"
+	err := client.Send("f1", &inType{Age: 18}, func(out *outType) error { return nil })
+	a.ErrorIs(err, ErrUnauthorized).Equal(count, 3)
+
+	// 未指定凭证
+	client = s.NewHTTPConn(srv.URL, nil)
+	valid = ""
+	a.NotError(client.Notify("f1", &inType{Age: 18}))
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// systemd 相关的环境变量
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUSecEnv = "WATCHDOG_USEC"
+	watchdogPIDEnv  = "WATCHDOG_PID"
+	listenPIDEnv    = "LISTEN_PID"
+	listenFDsEnv    = "LISTEN_FDS"
+	listenNamesEnv  = "LISTEN_FDNAMES"
+)
+
+// SdNotify 向 systemd 发送状态通知
+//
+// state 为 sd_notify 协议的内容，比如 READY=1、STOPPING=1 和 WATCHDOG=1 等，
+// 多个状态以换行符分隔。
+// 如果未设置 NOTIFY_SOCKET 环境变量，即当前进程并不是由 systemd 以 Type=notify 启动的，
+// 返回 false 且不作任何操作。
+func SdNotify(state string) (bool, error) {
+	addr := os.Getenv(notifySocketEnv)
+	if addr == "" {
+		return false, nil
+	}
+
+	// 以 @ 开头的抽象地址由 net 包自行处理
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 由 systemd 的 WatchdogSec 指定的看门狗时间
+//
+// 未启用或是不针对当前进程时返回 0。
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv(watchdogPIDEnv); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv(watchdogUSecEnv), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// 由 systemd 的 socket 激活传递过来的监听
+//
+// 如果当前进程不是由 socket 激活启动的，返回空值。
+// 调用之后会清除相关的环境变量，以免被子进程误用。
+func activatedListeners() ([]net.Listener, error) {
+	pid, fds := os.Getenv(listenPIDEnv), os.Getenv(listenFDsEnv)
+	if pid != strconv.Itoa(os.Getpid()) || fds == "" {
+		return nil, nil
+	}
+	for _, env := range []string{listenPIDEnv, listenFDsEnv, listenNamesEnv} {
+		if err := os.Unsetenv(env); err != nil {
+			return nil, err
+		}
+	}
+
+	// 格式与 Handoff 相同
+	if err := os.Setenv(ListenFDsEnv, fds); err != nil {
+		return nil, err
+	}
+	return InheritedListeners()
+}
+
+// RunDaemon 以守护进程的方式运行服务
+//
+// 在 [Server.ServeListeners] 的基础上接入 systemd 的服务管理：
+//   - 监听依次从 [InheritedListeners]、systemd 的 socket 激活中获取，都没有时才监听 addr；
+//   - 开始服务之后发送 READY=1，并在启用了 WatchdogSec 时以其一半的时间间隔发送 WATCHDOG=1；
+//   - 收到 SIGINT 或 SIGTERM 时发送 STOPPING=1，并按 opt.DrainTimeout 平滑地关闭服务；
+//
+// 未由 systemd 启动时，仅处理信号和监听，可以直接在前台运行。
+// 通知 systemd 时的错误会输出到 opt.ErrLog。
+//
+// 在 windows 下由服务管理器启动时，则以服务的方式运行：
+// 开始服务之后报告 SERVICE_RUNNING 状态，收到停止或是关机的控制命令时报告 SERVICE_STOP_PENDING，
+// 并按 opt.DrainTimeout 平滑地关闭服务，服务的注册和安装需要由 sc.exe 等工具完成。
+func (s *Server) RunDaemon(ctx context.Context, network, addr string, opt *ListenOptions) error {
+	if opt == nil {
+		opt = &ListenOptions{}
+	}
+
+	isService, err := runService(ctx, func(ctx context.Context, notify func(string)) error {
+		return s.runDaemon(ctx, network, addr, opt, notify)
+	})
+	if isService {
+		return err
+	}
+
+	return s.runDaemon(ctx, network, addr, opt, func(state string) {
+		if _, err := SdNotify(state); err != nil && opt.ErrLog != nil {
+			opt.ErrLog.Println(err)
+		}
+	})
+}
+
+// notify 用于报告 sd_notify 协议格式的状态
+func (s *Server) runDaemon(ctx context.Context, network, addr string, opt *ListenOptions, notify func(string)) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ls, err := InheritedListeners()
+	if err == nil && ls == nil {
+		ls, err = activatedListeners()
+	}
+	if err == nil && ls == nil {
+		ls, err = listen(ctx, network, addr, opt.ReusePort)
+	}
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if d := watchdogInterval(); d > 0 {
+		go s.watchdog(d/2, done, notify)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			notify("STOPPING=1")
+		case <-done:
+		}
+	}()
+
+	notify("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid()))
+	return s.ServeListeners(ctx, ls, opt)
+}
+
+// 每隔 d 向 systemd 发送一次 WATCHDOG=1，直到 done 被关闭。
+func (s *Server) watchdog(d time.Duration, done <-chan struct{}, notify func(string)) {
+	for {
+		c, cancel := s.clock.NewTimer(d)
+		select {
+		case <-c:
+			notify("WATCHDOG=1")
+		case <-done:
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows
+
+package jsonrpc
+
+import "context"
+
+// 仅 windows 下有服务管理器，始终返回 false。
+func runService(context.Context, func(context.Context, func(string)) error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows && !plan9 && !js
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 模拟 systemd 的 NOTIFY_SOCKET
+func newNotifySocket(a *assert.Assertion, t *testing.T) *net.UnixConn {
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	a.NotError(err).NotNil(c)
+	t.Setenv(notifySocketEnv, addr)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func readNotify(a *assert.Assertion, c *net.UnixConn) string {
+	a.NotError(c.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1024)
+	n, err := c.Read(buf)
+	a.NotError(err)
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	a := assert.New(t, false)
+
+	t.Setenv(notifySocketEnv, "")
+	ok, err := SdNotify("READY=1")
+	a.NotError(err).False(ok)
+
+	c := newNotifySocket(a, t)
+	ok, err = SdNotify("READY=1")
+	a.NotError(err).True(ok)
+	a.Equal(readNotify(a, c), "READY=1")
+
+	t.Setenv(notifySocketEnv, filepath.Join(t.TempDir(), "not-exists.sock"))
+	ok, err = SdNotify("READY=1")
+	a.Error(err).False(ok)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	a := assert.New(t, false)
+
+	t.Setenv(watchdogUSecEnv, "")
+	t.Setenv(watchdogPIDEnv, "")
+	a.Equal(watchdogInterval(), 0)
+
+	t.Setenv(watchdogUSecEnv, "2000000")
+	a.Equal(watchdogInterval(), 2*time.Second)
+
+	t.Setenv(watchdogPIDEnv, strconv.Itoa(os.Getpid()))
+	a.Equal(watchdogInterval(), 2*time.Second)
+
+	t.Setenv(watchdogPIDEnv, strconv.Itoa(os.Getpid()+1))
+	a.Equal(watchdogInterval(), 0)
+
+	t.Setenv(watchdogPIDEnv, "")
+	t.Setenv(watchdogUSecEnv, "-1")
+	a.Equal(watchdogInterval(), 0)
+}
+
+func TestActivatedListeners(t *testing.T) {
+	a := assert.New(t, false)
+
+	t.Setenv(listenPIDEnv, "")
+	t.Setenv(listenFDsEnv, "")
+	ls, err := activatedListeners()
+	a.NotError(err).Nil(ls)
+
+	// 不是传递给当前进程的
+	t.Setenv(listenPIDEnv, strconv.Itoa(os.Getpid()+1))
+	t.Setenv(listenFDsEnv, "1")
+	ls, err = activatedListeners()
+	a.NotError(err).Nil(ls)
+	a.Equal(os.Getenv(listenFDsEnv), "1")
+}
+
+func TestServer_RunDaemon(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	clock := NewManualClock(time.Now())
+	srv.Clock(clock)
+
+	c := newNotifySocket(a, t)
+	t.Setenv(ListenFDsEnv, "")
+	t.Setenv(listenPIDEnv, "")
+	t.Setenv(watchdogPIDEnv, "")
+	t.Setenv(watchdogUSecEnv, "2000000")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan error, 1)
+	go func() {
+		exit <- srv.RunDaemon(ctx, "tcp", "127.0.0.1:0", nil)
+	}()
+
+	a.Equal(readNotify(a, c), "READY=1\nMAINPID="+strconv.Itoa(os.Getpid()))
+
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	a.Equal(readNotify(a, c), "WATCHDOG=1")
+
+	cancel()
+	a.Equal(readNotify(a, c), "STOPPING=1")
+	a.ErrorIs(<-exit, context.Canceled)
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package jsonrpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// windows 服务相关的常量，参考 winsvc.h。
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	errorCallNotImplemented             = 120
+	errorServiceSpecificError           = 1066
+	errorFailedServiceControllerConnect = 1063
+
+	servicePendingWait = 30 * time.Second
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+
+	// 回调函数的数量有上限且无法释放，所以只创建一次。
+	serviceCallbacks struct {
+		once    sync.Once
+		main    uintptr
+		handler uintptr
+	}
+
+	// 当前正在运行的服务，一个进程只能有一个。
+	currentService *windowsService
+)
+
+// SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// SERVICE_STATUS
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+type windowsService struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	run    func(context.Context, func(string)) error
+	err    error
+
+	mux        sync.Mutex
+	handle     uintptr
+	checkPoint uint32
+}
+
+// 如果当前进程由服务管理器启动，则以服务的方式执行 run 并返回 true
+//
+// run 的 notify 参数为 sd_notify 协议格式的状态，会被转换为相应的服务状态。
+// 在服务停止之前不会返回。
+func runService(ctx context.Context, run func(context.Context, func(string)) error) (bool, error) {
+	if err := procStartServiceCtrlDispatcherW.Find(); err != nil {
+		return false, nil
+	}
+
+	serviceCallbacks.once.Do(func() {
+		serviceCallbacks.main = syscall.NewCallback(serviceMain)
+		serviceCallbacks.handler = syscall.NewCallback(serviceHandler)
+	})
+
+	svc := &windowsService{run: run}
+	svc.ctx, svc.cancel = context.WithCancel(ctx)
+	defer svc.cancel()
+	currentService = svc
+
+	// SERVICE_WIN32_OWN_PROCESS 会忽略服务名，但是不能为 NULL。
+	name, err := syscall.UTF16PtrFromString("")
+	if err != nil {
+		return false, err
+	}
+	table := []serviceTableEntry{{name: name, proc: serviceCallbacks.main}, {}}
+
+	// 由服务管理器调用 serviceMain，直到服务停止才会返回。
+	r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if r == 0 {
+		if err == syscall.Errno(errorFailedServiceControllerConnect) { // 不是由服务管理器启动的
+			return false, nil
+		}
+		return true, err
+	}
+	return true, svc.err
+}
+
+// ServiceMain 回调函数
+func serviceMain(argc, argv uintptr) uintptr {
+	svc := currentService
+
+	name, err := syscall.UTF16PtrFromString("")
+	if err != nil {
+		svc.err = err
+		return 0
+	}
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(name)), serviceCallbacks.handler, 0)
+	if h == 0 {
+		svc.err = err
+		return 0
+	}
+	svc.handle = h
+
+	svc.setStatus(serviceStartPending, nil)
+	svc.err = svc.run(svc.ctx, svc.notify)
+	svc.setStatus(serviceStopped, svc.err)
+	return 0
+}
+
+// HandlerEx 回调函数
+func serviceHandler(control, eventType, eventData, data uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		currentService.cancel()
+		return 0
+	case serviceControlInterrogate:
+		return 0
+	default:
+		return errorCallNotImplemented
+	}
+}
+
+// 将 sd_notify 格式的状态转换为服务状态
+func (svc *windowsService) notify(state string) {
+	for _, line := range strings.Split(state, "\n") {
+		switch line {
+		case "READY=1":
+			svc.setStatus(serviceRunning, nil)
+		case "STOPPING=1":
+			svc.setStatus(serviceStopPending, nil)
+		}
+	}
+}
+
+func (svc *windowsService) setStatus(state uint32, err error) {
+	svc.mux.Lock()
+	defer svc.mux.Unlock()
+
+	s := &serviceStatus{serviceType: serviceWin32OwnProcess, currentState: state}
+	switch state {
+	case serviceRunning:
+		s.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	case serviceStartPending, serviceStopPending:
+		svc.checkPoint++
+		s.checkPoint = svc.checkPoint
+		s.waitHint = uint32(servicePendingWait / time.Millisecond)
+	case serviceStopped:
+		if err != nil {
+			s.win32ExitCode = errorServiceSpecificError
+			s.serviceSpecificExitCode = 1
+		}
+	}
+
+	procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(s)))
+}
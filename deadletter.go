@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var errConnClosed = errors.New("连接已经关闭，未收到返回数据")
+
+// FailedRequest 最终未能送达的请求
+type FailedRequest struct {
+	// 请求的 ID，通知为 nil。
+	ID *ID
+
+	// 请求的服务名
+	Method string
+
+	// 请求的完整内容，可以直接用于重新发送。
+	//
+	// 如果请求无法编码为 JSON，则为空。
+	Data json.RawMessage
+}
+
+// DeadLetter 保存最终未能送达的请求
+//
+// 与日志中的文本不同，这些请求可以在之后进行检查或是重新发送。
+// Store 的 err 为请求失败的原因，可能的情况有：
+//   - 向传输层写入请求失败，如果指定了 [WithRetry]，则为重试之后的错误；
+//   - 在收到返回数据之前 [Conn.Serve] 已经退出；
+//
+// Store 可能被并发调用。
+type DeadLetter interface {
+	Store(req *FailedRequest, err error)
+}
+
+// DeadLetter 指定保存未能送达的请求的对象
+//
+// NOTE: 需要在 [Conn.Send] 和 [Conn.Serve] 之前调用。
+func (conn *Conn) DeadLetter(d DeadLetter) { conn.deadLetter = d }
+
+// DeadLetter 指定保存未能送达的请求的对象
+//
+// 对于 HTTP，仅在发送请求失败时才会调用。
+func (h *HTTPConn) DeadLetter(d DeadLetter) { h.deadLetter = d }
+
+// 将请求 v 交由 d 保存，d 为空时不作任何操作。
+func storeDeadLetter(d DeadLetter, id *ID, method string, v interface{}, err error) {
+	if d == nil {
+		return
+	}
+
+	req := &FailedRequest{ID: id, Method: method}
+	if data, err := json.Marshal(v); err == nil {
+		req.Data = data
+	}
+	d.Store(req, err)
+}
+
+// 将所有等待返回数据的请求交由 DeadLetter 保存
+func (conn *Conn) drainPending() {
+	if conn.deadLetter == nil {
+		return
+	}
+
+	ps := make([]*pending, 0, 10)
+	conn.callbacks.Range(func(v interface{}) bool {
+		if p, ok := v.(*pending); ok && p.req != nil {
+			ps = append(ps, p)
+		}
+		return true
+	})
+
+	for _, p := range ps {
+		conn.deletePending(p.id)
+		storeDeadLetter(conn.deadLetter, p.id, p.method, p.req, errConnClosed)
+	}
+}
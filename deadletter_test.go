@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+type memoryDeadLetter struct {
+	mux  sync.Mutex
+	reqs []*FailedRequest
+	errs []error
+}
+
+func (d *memoryDeadLetter) Store(req *FailedRequest, err error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.reqs = append(d.reqs, req)
+	d.errs = append(d.errs, err)
+}
+
+func TestConn_DeadLetter(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	d := &memoryDeadLetter{}
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failedWriter{}, nil), nil)
+	conn.DeadLetter(d)
+
+	a.Error(conn.Notify("n1", &inType{Age: 1}))
+	a.Error(conn.Send("f1", &inType{Age: 2}, func(*outType) error { return nil }, WithRetry(1, 0)))
+	a.Length(d.reqs, 2).
+		Nil(d.reqs[0].ID).
+		Equal(d.reqs[0].Method, "n1").
+		Contains(string(d.reqs[0].Data), `"method":"n1"`).
+		Equal(d.errs[0].Error(), "failed").
+		NotNil(d.reqs[1].ID).
+		Equal(d.reqs[1].Method, "f1").
+		Contains(string(d.reqs[1].Data), `"Age":2`)
+
+	// 自动合并的通知
+	a.NotError(conn.AutoBatch(time.Hour, 2))
+	a.NotError(conn.Notify("n2", nil))
+	a.Error(conn.Notify("n3", nil))
+	a.Length(d.reqs, 4).
+		Equal(d.reqs[2].Method, "n2").
+		Equal(d.reqs[3].Method, "n3")
+}
+
+func TestConn_DeadLetter_pending(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() { // 只读取，不返回数据。
+		buf := make([]byte, 1024)
+		for {
+			if _, err := c2.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	d := &memoryDeadLetter{}
+	conn := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	conn.DeadLetter(d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	a.NotError(conn.Send("f1", &inType{Age: 1}, func(*outType) error { return nil }))
+	cancel()
+	c2.Close()
+	<-exit
+
+	a.Length(d.reqs, 1).
+		Equal(d.reqs[0].Method, "f1").
+		Equal(d.errs[0], errConnClosed)
+}
+
+func TestHTTPConn_DeadLetter(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	srv := httptest.NewServer(s.NewHTTPConn("", nil))
+	url := srv.URL
+	srv.Close() // 关闭之后请求必然失败
+
+	d := &memoryDeadLetter{}
+	conn := s.NewHTTPConn(url, nil)
+	conn.DeadLetter(d)
+	a.Error(conn.Send("f1", &inType{Age: 1}, func(*outType) error { return nil }))
+	a.Length(d.reqs, 1).Equal(d.reqs[0].Method, "f1").NotNil(d.reqs[0].ID)
+}
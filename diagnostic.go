@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 诊断服务的服务名
+const (
+	EchoMethod  = "rpc.echo"
+	BenchMethod = "rpc.bench"
+)
+
+// rpc.bench 返回数据的最大长度
+const maxBenchSize = 16 << 20
+
+// BenchParams rpc.bench 的参数
+type BenchParams struct {
+	// 要求返回的数据长度
+	Size int `json:"size,omitempty"`
+
+	// 发送给服务端的数据，服务端仅统计其长度。
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// BenchResult rpc.bench 的返回数据
+type BenchResult struct {
+	// 服务端收到的 Payload 字节数
+	Received int `json:"received"`
+
+	// 长度为 [BenchParams.Size] 的数据
+	Payload string `json:"payload,omitempty"`
+
+	// 服务端开始处理请求时的时间
+	Time time.Time `json:"time"`
+
+	// 服务端处理请求的耗时，单位为纳秒。
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// RegisterDiagnostics 注册用于诊断的服务
+//
+// 包含以下服务：
+//   - rpc.echo 原样返回参数，可用于测量往返的延迟；
+//   - rpc.bench 参数和返回值分别为 [BenchParams] 和 [BenchResult]，
+//     可用于测试不同大小的数据对性能的影响；
+//
+// 这些服务仅用于调试，不建议在生产环境中对外公开，
+// 可以通过 [Server.Visibility] 限制其访问。
+// 如果已经存在同名的服务，返回 false。
+func (s *Server) RegisterDiagnostics() bool {
+	if s.Exists(EchoMethod) || s.Exists(BenchMethod) {
+		return false
+	}
+
+	s.Registers(map[string]interface{}{
+		EchoMethod:  echo,
+		BenchMethod: bench,
+	})
+	return true
+}
+
+func echo(notify bool, in, out *json.RawMessage) error {
+	*out = *in
+	return nil
+}
+
+func bench(notify bool, in *BenchParams, out *BenchResult) error {
+	start := time.Now()
+	if in.Size < 0 || in.Size > maxBenchSize {
+		return NewError(CodeInvalidParams, fmt.Sprintf("size 必须介于 [0, %d]", maxBenchSize))
+	}
+
+	out.Time = start
+	out.Received = len(in.Payload)
+	out.Payload = strings.Repeat("x", in.Size)
+	out.Elapsed = time.Since(start)
+	return nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_RegisterDiagnostics(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.True(srv.RegisterDiagnostics()).
+		False(srv.RegisterDiagnostics()).
+		True(srv.Exists(EchoMethod)).
+		True(srv.Exists(BenchMethod))
+
+	call := func(method, params string) *body {
+		p := json.RawMessage(params)
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, new(bytes.Buffer), out, nil)
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: method, Params: &p}))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Equal(string(*call(EchoMethod, `{"a":[1,2]}`).Result), `{"a":[1,2]}`)
+
+	resp := call(BenchMethod, `{"size":10,"payload":"12345"}`)
+	a.Nil(resp.Error)
+	result := &BenchResult{}
+	a.NotError(json.Unmarshal(*resp.Result, result)).
+		Equal(result.Received, 7).
+		Equal(result.Payload, "xxxxxxxxxx").
+		False(result.Time.IsZero())
+
+	a.Equal(call(BenchMethod, `{"size":-1}`).Error.Code, CodeInvalidParams)
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	dialers   = map[string]func(context.Context, string) (io.ReadWriteCloser, error){}
+	dialerMux sync.RWMutex
+)
+
+func init() {
+	for _, network := range []string{"tcp", "tcp4", "tcp6", "unix", "udp", "udp4", "udp6", "unixgram"} {
+		RegisterDialer(network, netDialer(network))
+	}
+}
+
+// RegisterDialer 注册 [Dial] 中 scheme 对应的连接函数
+//
+// 可用于接入蓝牙 RFCOMM、virtio-serial 或是自定义隧道等标准库不支持的连接方式，
+// 而不需要为其单独实现 [Transport]。
+// d 的参数 addr 为地址中 scheme:// 之后的部分，返回的连接如果是 net.Conn，
+// 则按 [NewSocketTransport] 处理，否则按 [NewStreamTransport] 处理。
+//
+// 默认已经注册了 tcp、tcp4、tcp6、unix、udp、udp4、udp6 和 unixgram。
+// 如果 scheme 已经存在，则返回 false。
+func RegisterDialer(scheme string, d func(ctx context.Context, addr string) (io.ReadWriteCloser, error)) bool {
+	dialerMux.Lock()
+	defer dialerMux.Unlock()
+
+	if _, found := dialers[scheme]; found {
+		return false
+	}
+	dialers[scheme] = d
+	return true
+}
+
+// Dial 根据 url 创建作为客户端使用的 [Transport]
+//
+// url 的格式为 scheme://addr，比如 tcp://localhost:8080 和 unix:///tmp/rpc.sock 等，
+// scheme 需要已经通过 [RegisterDialer] 注册；
+// header 和 timeout 的含义与 [NewSocketTransport] 相同，timeout 仅对 net.Conn 有效。
+func Dial(ctx context.Context, url string, header bool, timeout time.Duration) (Transport, error) {
+	index := strings.Index(url, "://")
+	if index <= 0 {
+		return nil, fmt.Errorf("无效的地址 %s", url)
+	}
+	scheme, addr := url[:index], url[index+3:]
+
+	dialerMux.RLock()
+	d, found := dialers[scheme]
+	dialerMux.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("不支持的协议 %s", scheme)
+	}
+
+	rwc, err := d(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := rwc.(type) {
+	case *net.UDPConn:
+		return NewUDPTransport(header, c, true, timeout), nil
+	case *net.UnixConn:
+		if ra := c.RemoteAddr(); ra != nil && ra.Network() == "unixgram" {
+			return NewUnixgramTransport(header, c, true, timeout), nil
+		}
+		return NewSocketTransport(header, c, timeout), nil
+	case net.Conn:
+		return NewSocketTransport(header, c, timeout), nil
+	default:
+		return NewStreamTransport(header, rwc, rwc, rwc.Close), nil
+	}
+}
+
+func netDialer(network string) func(context.Context, string) (io.ReadWriteCloser, error) {
+	return func(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 非 net.Conn 的连接
+type rwc struct {
+	io.Reader
+	io.Writer
+	closed bool
+}
+
+func (c *rwc) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRegisterDialer(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.False(RegisterDialer("tcp", netDialer("tcp")))
+
+	c := &rwc{}
+	var dialAddr string
+	a.True(RegisterDialer("test-rfcomm", func(_ context.Context, addr string) (io.ReadWriteCloser, error) {
+		dialAddr = addr
+		return c, nil
+	}))
+	tr, err := Dial(context.Background(), "test-rfcomm://00:11:22:33:44:55/1", false, 0)
+	a.NotError(err).NotNil(tr).
+		Equal(dialAddr, "00:11:22:33:44:55/1")
+	_, ok := tr.(*streamTransport)
+	a.True(ok).NotError(tr.Close()).True(c.closed)
+}
+
+func TestDial(t *testing.T) {
+	a := assert.New(t, false)
+	ctx := context.Background()
+
+	tr, err := Dial(ctx, "localhost:8080", false, 0)
+	a.Error(err).Nil(tr)
+
+	tr, err = Dial(ctx, "not-exists://localhost:8080", false, 0)
+	a.Error(err).Nil(tr)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	tr, err = Dial(ctx, "tcp://"+l.Addr().String(), true, time.Second)
+	a.NotError(err).NotNil(tr).
+		Equal(tr.(*streamTransport).peer, l.Addr().String()).
+		NotError(tr.Close())
+
+	tr, err = Dial(ctx, "udp://127.0.0.1:8090", true, time.Second)
+	a.NotError(err).NotNil(tr)
+	_, ok := tr.(*streamTransport).out.(*datagram)
+	a.True(ok).NotError(tr.Close())
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/issue9/jsonrpc/openrpc"
+)
+
+// DiscoverMethod 自省服务的服务名
+const DiscoverMethod = "rpc.discover"
+
+// rpc.discover 返回的 OpenRPC 文档版本
+const openrpcVersion = "1.2.6"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type requestKey struct{}
+
+// 请求方的信息
+type requestInfo struct {
+	peer Peer
+	via  Exposure
+}
+
+// RegisterDiscover 注册自省服务 rpc.discover
+//
+// rpc.discover 会忽略参数，返回 OpenRPC 格式的文档，即 [openrpc.Document]。
+// 文档中包含了通过 Register 系列方法注册的服务，以及根据参数和返回值类型生成的 JSON Schema，
+// 通过 [WithDescription] 指定的内容会作为服务的描述，可供 cmd/openrpcgen 等工具使用。
+// 请求方不可见的服务（参考 [Server.Visibility] 和 [WithExposure]）不会出现在文档中；
+// 通过 RegisterMatcher 注册的服务由于无法列举，也不包含在内。
+//
+// title 和 version 为文档的标题和版本。
+// 如果已经存在同名的服务，返回 false。
+func (s *Server) RegisterDiscover(title, version string) bool {
+	return s.RegisterWith(DiscoverMethod, func(ctx context.Context, notify bool, in *json.RawMessage, out *openrpc.Document) error {
+		s.discover(ctx, out)
+		out.Info = openrpc.Info{Title: title, Version: version}
+		return nil
+	}, func(h *handler) { h.request = true })
+}
+
+// 生成请求方可见的服务文档
+func (s *Server) discover(ctx context.Context, doc *openrpc.Document) {
+	info, _ := ctx.Value(requestKey{}).(*requestInfo)
+
+	t := s.methods().load()
+	names := make([]string, 0, len(t.servers))
+	for name := range t.servers {
+		if name != DiscoverMethod {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	doc.OpenRPC = openrpcVersion
+	doc.Methods = make([]*openrpc.Method, 0, len(names))
+	for _, name := range names {
+		h := t.servers[name]
+		if info != nil && (!h.exposedTo(info.via) || (s.visible != nil && !s.visible(info.peer, name))) {
+			continue
+		}
+		doc.Methods = append(doc.Methods, h.describe(name))
+	}
+}
+
+// 生成服务的描述信息
+func (h *handler) describe(name string) *openrpc.Method {
+	m := &openrpc.Method{
+		Name:        name,
+		Description: h.desc,
+		Result:      &openrpc.ContentDescriptor{Name: "result", Schema: schemaOf(h.out, nil)},
+	}
+
+	if h.stream != nil {
+		m.Params = []*openrpc.ContentDescriptor{{Name: "params", Schema: &openrpc.Schema{}}}
+		return m
+	}
+
+	params := schemaOf(h.in, nil)
+	if len(params.Properties) == 0 {
+		m.Params = []*openrpc.ContentDescriptor{{Name: "params", Schema: params}}
+		return m
+	}
+
+	required := make(map[string]bool, len(params.Required))
+	for _, r := range params.Required {
+		required[r] = true
+	}
+	m.ParamStructure = "by-name"
+	m.Params = make([]*openrpc.ContentDescriptor, 0, len(params.Properties))
+	for name, p := range params.Properties {
+		m.Params = append(m.Params, &openrpc.ContentDescriptor{Name: name, Required: required[name], Schema: p})
+	}
+	sort.Slice(m.Params, func(i, j int) bool { return m.Params[i].Name < m.Params[j].Name })
+	return m
+}
+
+// 根据类型 t 生成 JSON Schema
+//
+// seen 为正在生成的结构体，用于避免循环引用。
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *openrpc.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &openrpc.Schema{Type: openrpc.Types{"string"}, Format: "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return &openrpc.Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &openrpc.Schema{Type: openrpc.Types{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openrpc.Schema{Type: openrpc.Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &openrpc.Schema{Type: openrpc.Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &openrpc.Schema{Type: openrpc.Types{"number"}}
+	case reflect.String:
+		return &openrpc.Schema{Type: openrpc.Types{"string"}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 { // encoding/json 将 []byte 编码为 base64
+			return &openrpc.Schema{Type: openrpc.Types{"string"}, Format: "byte"}
+		}
+		return &openrpc.Schema{Type: openrpc.Types{"array"}, Items: schemaOf(t.Elem(), seen)}
+	case reflect.Array:
+		return &openrpc.Schema{Type: openrpc.Types{"array"}, Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		s := &openrpc.Schema{Type: openrpc.Types{"object"}}
+		if data, err := json.Marshal(schemaOf(t.Elem(), seen)); err == nil {
+			s.AdditionalProperties = data
+		}
+		return s
+	case reflect.Struct:
+		s := &openrpc.Schema{Type: openrpc.Types{"object"}}
+		if seen[t] {
+			return s
+		}
+		if seen == nil {
+			seen = make(map[reflect.Type]bool, 5)
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s.Properties = make(map[string]*openrpc.Schema, t.NumField())
+		fields(t, s, seen)
+		return s
+	default:
+		return &openrpc.Schema{}
+	}
+}
+
+// 将结构体 t 的字段添加到 s 中，规则与 encoding/json 相同。
+func fields(t reflect.Type, s *openrpc.Schema, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if index := strings.IndexByte(tag, ','); index >= 0 {
+			name, opts = tag[:index], tag[index+1:]
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields(ft, s, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = schemaOf(f.Type, seen)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
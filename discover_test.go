@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+
+	"github.com/issue9/jsonrpc/openrpc"
+)
+
+type discoverEmbedded struct {
+	Tag string `json:"tag,omitempty"`
+}
+
+type discoverNode struct {
+	discoverEmbedded
+	Name     string          `json:"name"`
+	Children []*discoverNode `json:"children,omitempty"`
+	Data     []byte          `json:"data,omitempty"`
+	Created  time.Time       `json:"created"`
+	Extra    json.RawMessage `json:"extra,omitempty"`
+	Meta     map[string]int  `json:"meta,omitempty"`
+	Ignored  string          `json:"-"`
+	hidden   string
+}
+
+func TestServer_RegisterDiscover(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.RegisterWith("internal", f1, WithExposure(ExposeInternal)))
+	a.True(srv.RegisterWith("hidden", f1, WithDescription("hidden")))
+	a.True(srv.RegisterWith("desc", f1, WithDescription("desc")))
+	srv.Visibility(func(_ Peer, method string) bool { return method != "hidden" })
+
+	a.True(srv.RegisterDiscover("test", "1.0.0"))
+	a.False(srv.RegisterDiscover("test", "1.0.0"))
+
+	in := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`)
+	out := new(bytes.Buffer)
+	tr := NewStreamTransport(false, in, out, nil)
+	req, err := srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+
+	resp := &struct {
+		Result *openrpc.Document `json:"result"`
+	}{}
+	a.NotError(json.Unmarshal(out.Bytes(), resp))
+	doc := resp.Result
+	a.Equal(doc.OpenRPC, openrpcVersion).
+		Equal(doc.Info, openrpc.Info{Title: "test", Version: "1.0.0"})
+
+	names := make([]string, 0, len(doc.Methods))
+	for _, m := range doc.Methods {
+		names = append(names, m.Name)
+	}
+	a.Equal(names, []string{"desc", "f1", "f2", "f3"})
+
+	m := doc.Methods[0]
+	a.Equal(m.Description, "desc").
+		Equal(m.ParamStructure, "by-name").
+		Length(m.Params, 3).
+		Equal(m.Params[0].Name, "Age").True(m.Params[0].Required).
+		Equal(m.Params[0].Schema.Type, openrpc.Types{"integer"}).
+		Equal(m.Params[1].Name, "first").
+		Equal(m.Result.Schema.Properties["name"].Type, openrpc.Types{"string"})
+
+	// 不经过 Server.call 时无法判断请求方，不作过滤。
+	h, _ := srv.lookup(DiscoverMethod)
+	ret, err := h.exec(context.Background(), &body{Version: Version, ID: NewNumberID(1)}, nil)
+	a.NotError(err).Length(ret.(*openrpc.Document).Methods, 6)
+}
+
+func TestSchemaOf(t *testing.T) {
+	a := assert.New(t, false)
+
+	s := schemaOf(reflect.TypeOf(&discoverNode{}), nil)
+	a.Equal(s.Type, openrpc.Types{"object"}).
+		Length(s.Properties, 7).
+		Equal(s.Required, []string{"name", "created"}).
+		Equal(s.Properties["tag"].Type, openrpc.Types{"string"}).
+		Equal(s.Properties["data"], &openrpc.Schema{Type: openrpc.Types{"string"}, Format: "byte"}).
+		Equal(s.Properties["created"].Format, "date-time").
+		Equal(s.Properties["extra"], &openrpc.Schema{}).
+		Equal(string(s.Properties["meta"].AdditionalProperties), `{"type":"integer"}`)
+
+	// 循环引用
+	children := s.Properties["children"]
+	a.Equal(children.Type, openrpc.Types{"array"}).
+		Equal(children.Items, &openrpc.Schema{Type: openrpc.Types{"object"}})
+
+	a.Equal(schemaOf(reflect.TypeOf(1.5), nil).Type, openrpc.Types{"number"}).
+		Equal(schemaOf(reflect.TypeOf(true), nil).Type, openrpc.Types{"boolean"}).
+		Equal(schemaOf(reflect.TypeOf([2]int{}), nil).Items.Type, openrpc.Types{"integer"}).
+		Equal(schemaOf(reflect.TypeOf(func() {}), nil), &openrpc.Schema{})
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// TransportError 传输层的错误
+//
+// 比如写入失败、连接中断等，请求可能并未到达对方，一般可以在重新连接之后重试。
+type TransportError struct{ Err error }
+
+// ProtocolError 协议层的错误
+//
+// 数据无法解析或是不符合 JSON-RPC 规范，包括对方返回的 [CodeParseError]、
+// [CodeInvalidRequest]、[CodeMethodNotFound] 和 [CodeInvalidParams]，
+// 不修改请求内容的话，重试也不会成功。
+type ProtocolError struct{ Err error }
+
+// ApplicationError 服务函数的错误
+//
+// 包括对方服务函数返回的其它 *[Error] 以及本地服务函数的 panic 等，
+// 是否可以重试由具体的业务决定。
+//
+// 对方返回的 *[Error] 依然可以通过 errors.As 获取。
+type ApplicationError struct{ Err error }
+
+func (e *TransportError) Error() string { return e.Err.Error() }
+
+func (e *TransportError) Unwrap() error { return e.Err }
+
+func (e *ProtocolError) Error() string { return e.Err.Error() }
+
+func (e *ProtocolError) Unwrap() error { return e.Err }
+
+func (e *ApplicationError) Error() string { return e.Err.Error() }
+
+func (e *ApplicationError) Unwrap() error { return e.Err }
+
+// err 是否已经归类
+func classified(err error) bool {
+	var te *TransportError
+	var pe *ProtocolError
+	var ae *ApplicationError
+	return errors.As(err, &te) || errors.As(err, &pe) || errors.As(err, &ae)
+}
+
+func transportError(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	return &TransportError{Err: err}
+}
+
+func protocolError(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	return &ProtocolError{Err: err}
+}
+
+func applicationError(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	return &ApplicationError{Err: err}
+}
+
+// 对方返回的错误 e 根据错误代码归类
+func remoteError(e *Error) error {
+	switch e.Code {
+	case CodeParseError, CodeInvalidRequest, CodeMethodNotFound, CodeInvalidParams:
+		return &ProtocolError{Err: e}
+	default:
+		return &ApplicationError{Err: e}
+	}
+}
+
+// 读取数据时的错误 err 归类
+//
+// 数据格式和报头的错误归为 [ProtocolError]，其它的归为 [TransportError]。
+func readError(err error) error {
+	var se *json.SyntaxError
+	var ue *json.UnmarshalTypeError
+	var tl *tooLargeError
+	switch {
+	case errors.As(err, &se), errors.As(err, &ue), errors.As(err, &tl),
+		errors.Is(err, errInvalidHeader),
+		errors.Is(err, errInvalidContentType),
+		errors.Is(err, errMissContentLength),
+		errors.Is(err, errHeaderTooLarge),
+		errors.Is(err, errUnsupportedEncoding),
+		errors.Is(err, errUnsupportedCharset):
+		return protocolError(err)
+	default:
+		return transportError(err)
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestErrorCategory(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Nil(transportError(nil)).Nil(protocolError(nil)).Nil(applicationError(nil))
+
+	err := transportError(io.ErrUnexpectedEOF)
+	var te *TransportError
+	a.True(errors.As(err, &te)).ErrorIs(err, io.ErrUnexpectedEOF).
+		Equal(err.Error(), io.ErrUnexpectedEOF.Error())
+
+	// 已经归类的不再重复包装
+	a.Equal(protocolError(err), err).Equal(transportError(err), err)
+
+	var pe *ProtocolError
+	var ae *ApplicationError
+	var e *Error
+	err = remoteError(NewError(CodeMethodNotFound, "not found"))
+	a.True(errors.As(err, &pe)).True(errors.As(err, &e)).Equal(e.Code, CodeMethodNotFound)
+	err = remoteError(NewError(CodeInternalError, "internal"))
+	a.True(errors.As(err, &ae)).False(errors.As(err, &pe)).True(errors.As(err, &e))
+	err = remoteError(NewError(1, "app"))
+	a.True(errors.As(err, &ae))
+
+	a.True(errors.As(readError(io.EOF), &te)).
+		True(errors.As(readError(errMissContentLength), &pe)).
+		True(errors.As(readError(json.Unmarshal([]byte("{"), &struct{}{})), &pe)).
+		True(errors.As(readError(json.Unmarshal([]byte(`"x"`), new(int))), &pe))
+}
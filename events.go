@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件通道的缓存大小
+const eventsBufferSize = 64
+
+// EventType 连接事件的类型
+type EventType int8
+
+// 连接事件的类型
+const (
+	EventConnected  EventType = iota // 开始运行 [Conn.Serve]
+	EventReadError                   // 读取数据出错
+	EventWriteError                  // 写入数据出错
+	EventUnmatched                   // 返回数据找不到对应的请求
+	EventClosing                     // 开始关闭连接
+	EventClosed                      // 连接已经关闭，[Conn.Serve] 即将返回。
+	EventExpired                     // 等待返回数据的请求已经过期，参考 [Conn.Sweep]。
+)
+
+// Event 连接上发生的事件
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// 与事件相关的错误
+	//
+	// 对于 [EventClosed]，为 [Conn.Serve] 的返回值；
+	// 对于 [EventReadError] 和 [EventWriteError]，会包装为 [TransportError] 或是 [ProtocolError]。
+	Err error
+
+	// 与事件相关的请求 ID
+	//
+	// 仅 [EventUnmatched] 和 [EventExpired] 有值。
+	ID *ID
+}
+
+type events struct {
+	once sync.Once
+	c    chan Event
+}
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventReadError:
+		return "read error"
+	case EventWriteError:
+		return "write error"
+	case EventUnmatched:
+		return "unmatched"
+	case EventClosing:
+		return "closing"
+	case EventClosed:
+		return "closed"
+	case EventExpired:
+		return "expired"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Events 返回连接事件的通道
+//
+// 相比于从 errlog 中分析错误信息，监控程序可以通过此通道获取连接状态的变化并作出处理。
+// 事件的发送不会阻塞连接，当通道中未读取的事件过多时，新的事件会被丢弃。
+// 通道不会被关闭，[EventClosed] 是由 [Conn.Serve] 发送的最后一个事件。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用。
+func (conn *Conn) Events() <-chan Event {
+	conn.events.once.Do(func() {
+		conn.events.c = make(chan Event, eventsBufferSize)
+	})
+	return conn.events.c
+}
+
+func (conn *Conn) emit(typ EventType, err error, id *ID) {
+	if conn.events.c == nil {
+		return
+	}
+
+	select {
+	case conn.events.c <- Event{Type: typ, Time: conn.server.clock.Now(), Err: err, ID: id}:
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("write error") }
+
+func TestConn_Events(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":"not-exists","result":{}}`)
+	conn := srv.NewConn(NewStreamTransport(false, in, new(bytes.Buffer), nil), nil)
+	events := conn.Events()
+	a.Equal(conn.Events(), events)
+	a.Equal(conn.Serve(context.Background()), io.EOF)
+
+	types := make([]EventType, 0, 4)
+	for len(events) > 0 {
+		e := <-events
+		a.False(e.Time.IsZero())
+		types = append(types, e.Type)
+		switch e.Type {
+		case EventUnmatched:
+			a.Equal(e.ID.String(), "not-exists").Error(e.Err)
+		case EventClosing, EventClosed:
+			a.Equal(e.Err, io.EOF)
+		}
+	}
+	a.Equal(types, []EventType{EventConnected, EventUnmatched, EventClosing, EventClosed})
+
+	// 写入错误
+	conn = srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failWriter{}, nil), nil)
+	events = conn.Events()
+	a.Error(conn.Notify("f1", &inType{Age: 1}))
+	e := <-events
+	a.Equal(e.Type, EventWriteError).Error(e.Err)
+
+	// 未调用 Events 不会发送事件
+	conn = srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failWriter{}, nil), nil)
+	a.Error(conn.Notify("f1", &inType{Age: 1})).Nil(conn.events.c)
+
+	// 通道已满时丢弃事件
+	conn = srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), failWriter{}, nil), nil)
+	events = conn.Events()
+	for i := 0; i < eventsBufferSize+1; i++ {
+		a.Error(conn.Notify("f1", &inType{Age: 1}))
+	}
+	a.Length(events, eventsBufferSize)
+
+	a.Equal(EventClosed.String(), "closed").
+		Equal(EventExpired.String(), "expired").
+		Equal(EventType(100).String(), "<unknown>")
+}
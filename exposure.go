@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+// Exposure 服务可以通过哪些传输层调用
+type Exposure uint8
+
+const (
+	ExposeHTTP     Exposure = 1 << iota // 通过 [HTTPConn] 调用
+	ExposeSocket                        // 通过 [Conn] 调用，[NewInProcessTransport] 除外。
+	ExposeInternal                      // 通过 [NewInProcessTransport] 创建的传输层调用
+
+	// 所有的传输层，这也是未指定 [WithExposure] 时的默认值。
+	ExposeAll = ExposeHTTP | ExposeSocket | ExposeInternal
+)
+
+// WithExposure 指定服务可以通过哪些传输层调用
+//
+// 在分派请求时检测，对于不允许的传输层，向对方返回与服务不存在相同的 [CodeMethodNotFound] 错误，
+// 可以防止管理类的服务通过对外公开的传输层被调用。
+// 比如 ExposeInternal 表示服务只能在进程内部通过 [NewInProcessTransport] 调用。
+//
+// e 为 0 表示不作限制，与 [ExposeAll] 相同。
+func WithExposure(e Exposure) MethodOption {
+	return func(h *handler) { h.exposure = e }
+}
+
+// 传输层 t 对应的 [Exposure]
+func exposureOf(t Transport) Exposure {
+	if _, ok := t.(*inProcessTransport); ok {
+		return ExposeInternal
+	}
+	return ExposeSocket
+}
+
+// req 是否可以调用 h
+func (h *handler) exposed(req *body) bool { return h.exposedTo(req.via) }
+
+// 通过 via 是否可以调用 h，via 为 0 时与 [ExposeSocket] 相同。
+func (h *handler) exposedTo(via Exposure) bool {
+	if h.exposure == 0 {
+		return true
+	}
+
+	if via == 0 {
+		via = ExposeSocket
+	}
+	return h.exposure&via != 0
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestWithExposure(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	f := func(notify bool, in *inType, out *outType) error { return nil }
+	a.True(srv.RegisterWith("internal", f, WithExposure(ExposeInternal))).
+		True(srv.RegisterWith("http", f, WithExposure(ExposeHTTP))).
+		True(srv.RegisterWith("socket", f, WithExposure(ExposeSocket|ExposeInternal))).
+		True(srv.RegisterWith("all", f, WithExposure(ExposeAll)))
+
+	// socket
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	call := func(method string) *Error {
+		out.Reset()
+		in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"` + method + `","params":{}}`)
+		req, err := srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		conn.serve(req, 0)
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp.Error
+	}
+	a.Equal(call("internal").Code, CodeMethodNotFound).
+		Equal(call("http").Code, CodeMethodNotFound).
+		Nil(call("socket")).
+		Nil(call("all")).
+		Nil(call("f1"))
+
+	// http
+	hs := httptest.NewServer(srv.NewHTTPConn("", nil))
+	defer hs.Close()
+	httpCall := func(method string) *Error {
+		resp, err := http.Post(hs.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"`+method+`","params":{}}`))
+		a.NotError(err)
+		defer resp.Body.Close()
+
+		b := &body{}
+		a.NotError(json.NewDecoder(resp.Body).Decode(b))
+		return b.Error
+	}
+	a.Equal(httpCall("internal").Code, CodeMethodNotFound).
+		Equal(httpCall("socket").Code, CodeMethodNotFound).
+		Nil(httpCall("http")).
+		Nil(httpCall("all"))
+
+	// 进程内
+	t1, t2 := NewInProcessTransport(false)
+	server := srv.NewConn(t1, nil)
+	client := srv.NewConn(t2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	errs := make(chan *Error, 1)
+	srv.ErrHandler(func(err *Error) { errs <- err })
+	done := make(chan struct{}, 1)
+	cb := func(*outType) error {
+		done <- struct{}{}
+		return nil
+	}
+	a.NotError(client.Send("internal", &inType{}, cb))
+	<-done
+	a.NotError(client.Send("socket", &inType{}, cb))
+	<-done
+	a.NotError(client.Send("http", &inType{}, cb))
+	a.Equal((<-errs).Code, CodeMethodNotFound)
+
+	cancel()
+	t1.Close()
+	t2.Close()
+	<-exit
+	<-exit
+}
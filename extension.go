@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+type extensionsKey struct{}
+
+// body 中直接处理的字段，不会被当作扩展字段。
+//
+// 除 traceparent 之外，都是由规范定义的字段。
+var bodyFields = map[string]struct{}{
+	"jsonrpc":     {},
+	"id":          {},
+	"method":      {},
+	"params":      {},
+	"result":      {},
+	"error":       {},
+	"traceparent": {},
+}
+
+// 带扩展字段的 body
+//
+// 在编解码时会处理 body.extensions 中的内容。
+type extBody struct {
+	*body
+}
+
+// 将写入的 *body 转换为带有扩展字段的对象
+type extTransport struct {
+	Transport
+	extensions map[string]json.RawMessage
+}
+
+// 为返回数据附加由 [Server.ResponseMetadata] 生成的扩展字段
+type metaTransport struct {
+	Transport
+	s      *Server
+	method string
+	start  time.Time
+}
+
+// KeepExtensions 是否保留请求和返回数据中的扩展字段
+//
+// 扩展字段是指顶层对象中除 jsonrpc、id、method、params、result 和 error 之外的字段，
+// 默认情况下这些字段会被丢弃。如果 v 为 true，
+// 作为服务端时，请求中的扩展字段会原样附加在返回数据中；
+// 作为客户端时，返回数据中的扩展字段可以在回调函数中通过 [Extensions] 获取。
+// 可用于实现协议扩展或是代理等需要完整保留数据的场景。
+//
+// 保留扩展字段需要对数据进行额外的解析，会有一定的性能损耗。
+func (s *Server) KeepExtensions(v bool) { s.extensions = v }
+
+// Extensions 返回回调函数中对应的返回数据中的扩展字段
+//
+// ctx 为回调函数的 context.Context 参数，仅在 [Server.KeepExtensions] 为 true 时才有值。
+func Extensions(ctx context.Context) map[string]json.RawMessage {
+	if ext, ok := ctx.Value(extensionsKey{}).(map[string]json.RawMessage); ok {
+		return ext
+	}
+	return nil
+}
+
+func (b *extBody) UnmarshalJSON(data []byte) error {
+	type alias body
+	if err := json.Unmarshal(data, (*alias)(b.body)); err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for k := range bodyFields {
+		delete(fields, k)
+	}
+	if len(fields) > 0 {
+		b.extensions = fields
+	}
+	return nil
+}
+
+func (b *extBody) MarshalJSON() ([]byte, error) {
+	type alias body
+	data, err := json.Marshal((*alias)(b.body))
+	if err != nil || len(b.extensions) == 0 {
+		return data, err
+	}
+
+	keys := make([]string, 0, len(b.extensions))
+	for k := range b.extensions {
+		if _, found := bodyFields[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(data[:len(data)-1]) // 去掉最后的 }
+	for _, k := range keys {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(b.extensions[k])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (t *extTransport) Peer() string { return peerOf(t.Transport) }
+
+// ResponseMetadata 为返回数据附加扩展字段
+//
+// f 在输出返回数据之前调用，method 为请求的服务名，elapsed 为处理该请求所用的时间，
+// 返回值会作为扩展字段附加在返回数据中，与请求中原样返回的扩展字段同名时，以 f 的返回值为准。
+// 比如返回处理请求的节点 ID 以及处理时间等，客户端在负载均衡之后也能知道是由哪个节点处理的。
+// 客户端需要开启 [Server.KeepExtensions] 才能通过 [Extensions] 获取这些字段。
+//
+// f 为空表示不附加任何内容。多次调用会相互覆盖。
+func (s *Server) ResponseMetadata(f func(method string, elapsed time.Duration) map[string]json.RawMessage) {
+	s.respMeta = f
+}
+
+func (t *metaTransport) Peer() string { return peerOf(t.Transport) }
+
+func (t *metaTransport) Write(v interface{}) error {
+	b := bodyOf(v)
+	if b == nil || b.isRequest() {
+		return t.Transport.Write(v)
+	}
+
+	md := t.s.respMeta(t.method, t.s.clock.Now().Sub(t.start))
+	if len(md) == 0 {
+		return t.Transport.Write(v)
+	}
+
+	ext := make(map[string]json.RawMessage, len(b.extensions)+len(md))
+	for k, v := range b.extensions {
+		ext[k] = v
+	}
+	for k, v := range md {
+		ext[k] = v
+	}
+	b.extensions = ext
+	return t.Transport.Write(&extBody{body: b})
+}
+
+func (t *extTransport) Write(v interface{}) error {
+	if b, ok := v.(*body); ok && b.extensions == nil {
+		b.extensions = t.extensions
+		v = &extBody{body: b}
+	}
+	return t.Transport.Write(v)
+}
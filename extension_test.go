@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestExtBody(t *testing.T) {
+	a := assert.New(t, false)
+
+	b := &body{}
+	a.NotError(json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1,"method":"m","x-trace":"t","meta":{"k":1}}`), &extBody{body: b})).
+		Equal(b.Method, "m").
+		Equal(b.ID.String(), "1").
+		Equal(b.extensions, map[string]json.RawMessage{"x-trace": json.RawMessage(`"t"`), "meta": json.RawMessage(`{"k":1}`)})
+
+	b = &body{}
+	a.NotError(json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1}`), &extBody{body: b})).Nil(b.extensions)
+
+	data, err := json.Marshal(&extBody{body: &body{
+		Version:    Version,
+		extensions: map[string]json.RawMessage{"x-trace": json.RawMessage(`"t"`), "a": json.RawMessage(`1`), "id": json.RawMessage(`2`)},
+	}})
+	a.NotError(err).Equal(string(data), `{"jsonrpc":"2.0","a":1,"x-trace":"t"}`)
+
+	data, err = json.Marshal(&extBody{body: &body{Version: Version}})
+	a.NotError(err).Equal(string(data), `{"jsonrpc":"2.0"}`)
+}
+
+func TestServer_KeepExtensions(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srv.KeepExtensions(true)
+
+	in := bytes.NewBufferString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{"Age":1},"x-trace":"t"}`)
+	out := new(bytes.Buffer)
+	tr := NewStreamTransport(false, in, out, nil)
+
+	req, err := srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	a.Contains(out.String(), `"x-trace":"t"`).Contains(out.String(), `"id":"1"`)
+
+	// 错误信息也同样附加扩展字段
+	out.Reset()
+	in.WriteString(`{"jsonrpc":"2.0","id":"2","method":"not-exists","x-trace":"t"}`)
+	req, err = srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	a.Contains(out.String(), `"x-trace":"t"`).Contains(out.String(), `"error"`)
+
+	// 客户端
+	var ext map[string]json.RawMessage
+	p := &pending{ctx: context.Background(), cb: newCallback(func(ctx context.Context, out *outType) error {
+		ext = Extensions(ctx)
+		return nil
+	})}
+	in.WriteString(`{"jsonrpc":"2.0","id":"3","result":{},"x-trace":"t"}`)
+	resp, err := srv.read(tr)
+	a.NotError(err).NotNil(resp)
+	a.NotError(srv.callback(p, resp)).
+		Equal(ext, map[string]json.RawMessage{"x-trace": json.RawMessage(`"t"`)})
+
+	a.Nil(Extensions(context.Background()))
+
+	// 未启用
+	srv.KeepExtensions(false)
+	out.Reset()
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{"Age":1},"x-trace":"t"}`)
+	req, err = srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	a.NotContains(out.String(), `x-trace`)
+}
+
+func TestServer_ResponseMetadata(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	clock := NewManualClock(time.Now())
+	srv.Clock(clock)
+	srv.KeepExtensions(true)
+
+	var method string
+	srv.ResponseMetadata(func(m string, elapsed time.Duration) map[string]json.RawMessage {
+		method = m
+		if m == "f2" {
+			return nil
+		}
+		return map[string]json.RawMessage{
+			"node":    json.RawMessage(`"n1"`),
+			"elapsed": json.RawMessage(strconv.FormatInt(elapsed.Milliseconds(), 10)),
+		}
+	})
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	call := func(data string) map[string]json.RawMessage {
+		out.Reset()
+		in.WriteString(data)
+		req, err := srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		conn.serve(req, 0)
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), &extBody{body: resp}))
+		return resp.extensions
+	}
+
+	ext := call(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{},"node":"client","tenant":"t1"}`)
+	a.Equal(method, "f1").
+		Equal(ext, map[string]json.RawMessage{
+			"node":    json.RawMessage(`"n1"`),
+			"elapsed": json.RawMessage(`0`),
+			"tenant":  json.RawMessage(`"t1"`),
+		})
+
+	// 错误信息同样附加
+	ext = call(`{"jsonrpc":"2.0","id":"1","method":"not-exists","params":{}}`)
+	a.Equal(method, "not-exists").Equal(string(ext["node"]), `"n1"`)
+
+	// 返回空值
+	a.Nil(call(`{"jsonrpc":"2.0","id":"1","method":"f2","params":{}}`))
+
+	srv.ResponseMetadata(nil)
+	a.Nil(call(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{}}`))
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults 故障注入的参数
+//
+// 所有的概率值都在 [0,1] 之间，0 表示从不发生，1 表示总是发生。
+type Faults struct {
+	// 写入之前随机延迟的时间上限以及发生延迟的概率
+	Delay     time.Duration
+	DelayRate float64
+
+	// 读取到的帧被截断的概率
+	//
+	// 被截断的帧无法解析，[Transport.Read] 会返回错误，
+	// 与对方发送了不完整的数据时的表现相同。
+	TruncateRate float64
+
+	// 写入的数据被重复发送的概率，可用于模拟重复的返回数据。
+	DuplicateRate float64
+
+	// 写入的数据被延后到下一次写入之后才发送的概率
+	//
+	// 被延后的数据只有在下一次写入时才会真正发送，如果之后没有写入，则不会发送。
+	ReorderRate float64
+
+	// 在读写时断开连接的概率
+	//
+	// 断开时会关闭底层的 [Transport]，并返回 [io.ErrUnexpectedEOF]，
+	// 之后的读写操作也都返回该错误。
+	DisconnectRate float64
+
+	// 随机数的种子，为 0 时采用当前时间。
+	//
+	// 相同的种子可以在相同的读写顺序下重现相同的故障。
+	Seed int64
+}
+
+type faultTransport struct {
+	Transport
+	f *Faults
+
+	mux    sync.Mutex
+	rand   *rand.Rand
+	held   interface{} // 被延后发送的数据
+	closed bool
+}
+
+// NewFaultTransport 为 t 添加故障注入的功能
+//
+// 按 f 中的概率在读写时注入延迟、截断、重复、乱序以及断开连接等故障，
+// 方便用户测试重试及重连等逻辑。仅用于测试环境。
+func NewFaultTransport(t Transport, f *Faults) Transport {
+	seed := f.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &faultTransport{
+		Transport: t,
+		f:         f,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// 以概率 rate 返回 true
+func (t *faultTransport) hit(rate float64) bool {
+	return rate > 0 && t.rand.Float64() < rate
+}
+
+// 判断是否需要断开连接，调用方需要持有锁。
+func (t *faultTransport) disconnect() error {
+	if !t.closed && t.hit(t.f.DisconnectRate) {
+		t.closed = true
+		t.held = nil
+		t.Transport.Close()
+	}
+
+	if t.closed {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (t *faultTransport) Read(v interface{}) error {
+	t.mux.Lock()
+	err := t.disconnect()
+	t.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var data json.RawMessage
+	if err := t.Transport.Read(&data); err != nil {
+		return err
+	}
+
+	t.mux.Lock()
+	if len(data) > 1 && t.hit(t.f.TruncateRate) {
+		data = data[:1+t.rand.Intn(len(data)-1)]
+	}
+	t.mux.Unlock()
+
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (t *faultTransport) Write(v interface{}) error {
+	t.mux.Lock()
+	if err := t.disconnect(); err != nil {
+		t.mux.Unlock()
+		return err
+	}
+
+	var delay time.Duration
+	if t.f.Delay > 0 && t.hit(t.f.DelayRate) {
+		delay = time.Duration(t.rand.Int63n(int64(t.f.Delay)))
+	}
+
+	values := []interface{}{v}
+	if t.hit(t.f.DuplicateRate) {
+		values = append(values, v)
+	}
+
+	if t.held != nil {
+		values = append(values, t.held)
+		t.held = nil
+	} else if t.hit(t.f.ReorderRate) {
+		t.held = v
+		values = values[1:]
+	}
+	t.mux.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	for _, v := range values {
+		if err := t.Transport.Write(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
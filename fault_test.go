@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestNewFaultTransport(t *testing.T) {
+	a := assert.New(t, false)
+
+	newTransport := func(f *Faults) (Transport, *bytes.Buffer, *bytes.Buffer) {
+		in, out := new(bytes.Buffer), new(bytes.Buffer)
+		return NewFaultTransport(NewStreamTransport(false, in, out, nil), f), in, out
+	}
+
+	// 无故障
+	ft, in, out := newTransport(&Faults{})
+	a.NotError(ft.Write(1)).Equal(out.String(), "1")
+	in.WriteString(`{"jsonrpc":"2.0"}`)
+	req := &body{}
+	a.NotError(ft.Read(req)).Equal(req.Version, Version)
+
+	// 重复
+	ft, _, out = newTransport(&Faults{DuplicateRate: 1})
+	a.NotError(ft.Write(1)).Equal(out.String(), "11")
+
+	// 乱序
+	ft, _, out = newTransport(&Faults{ReorderRate: 1})
+	a.NotError(ft.Write(1)).Empty(out.String())
+	a.NotError(ft.Write(2)).Equal(out.String(), "21")
+
+	// 截断
+	ft, in, _ = newTransport(&Faults{TruncateRate: 1})
+	in.WriteString(`{"jsonrpc":"2.0"}`)
+	a.Error(ft.Read(&body{}))
+
+	// 断开
+	ft, _, out = newTransport(&Faults{DisconnectRate: 1})
+	a.ErrorIs(ft.Write(1), io.ErrUnexpectedEOF).Empty(out.String())
+	a.ErrorIs(ft.Read(&body{}), io.ErrUnexpectedEOF)
+
+	// 延迟
+	ft, _, out = newTransport(&Faults{Delay: 50 * time.Millisecond, DelayRate: 1, Seed: 1})
+	a.NotError(ft.Write(1)).Equal(out.String(), "1")
+
+	// 相同的种子产生相同的故障
+	results := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		ft, _, out := newTransport(&Faults{DuplicateRate: 0.5, Seed: 10})
+		for j := 0; j < 20; j++ {
+			a.NotError(ft.Write(1))
+		}
+		results = append(results, out.String())
+	}
+	a.Equal(results[0], results[1]).
+		True(strings.Count(results[0], "1") > 20)
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.18
+
+package jsonrpc
+
+// RegisterFunc 以泛型的方式注册服务
+//
+// 与 [Server.RegisterWith] 相同，但是 f 的签名在编译期即可确定，
+// 调用时也不再经由反射，In 和 Out 依然不能是指针或函数类型。
+// 需要在运行时决定签名的服务，依然可以使用 [Server.Register]。
+//
+// 如果 method 已经存在，返回 false。
+func RegisterFunc[In, Out any](s *Server, method string, f func(bool, *In, *Out) error, opts ...MethodOption) bool {
+	r := s.methods()
+	if r.Exists(method) {
+		return false
+	}
+
+	h := newHandler(f)
+	h.typed = func(notify bool, in, out interface{}) error {
+		return f(notify, in.(*In), out.(*Out))
+	}
+	return r.add(method, h, opts)
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.18
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.False(RegisterFunc(srv, "f1", func(bool, *inType, *outType) error { return nil }))
+
+	a.True(RegisterFunc(srv, "typed", func(notify bool, in *inType, out *outType) error {
+		out.Name = in.First + in.Last
+		out.Age = in.Age
+		return nil
+	}, WithDescription("typed")))
+	h, _ := srv.lookup("typed")
+	a.NotNil(h).NotNil(h.typed).Equal(h.desc, "typed")
+
+	params := json.RawMessage(`{"first":"f","last":"l","Age":5}`)
+	req := &body{Version: Version, ID: &ID{number: 1, isNumber: true}, Params: &params}
+	out, err := h.exec(context.Background(), req, nil)
+	a.NotError(err).Equal(out, &outType{Name: "fl", Age: 5})
+
+	a.True(RegisterFunc(srv, "typed-error", func(bool, *int, *int) error { return errors.New("error") }))
+	h, _ = srv.lookup("typed-error")
+	params = json.RawMessage("1")
+	_, err = h.exec(context.Background(), &body{Version: Version, Params: &params}, nil)
+	a.Equal(err.(*Error).Code, CodeInternalError)
+
+	// 指针类型依然在运行时检测
+	a.Panic(func() {
+		RegisterFunc(srv, "typed-ptr", func(bool, **int, *int) error { return nil })
+	})
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// 分组及其成员
+type groups struct {
+	mux     sync.RWMutex
+	members map[string]map[*Conn]struct{}
+	joined  map[*Conn]map[string]struct{} // 各个连接加入的分组
+	buffers map[string]*ringBuffer        // 由 Server.GroupBuffer 指定的缓存
+}
+
+// Join 将当前连接加入分组 name
+//
+// 之后可以通过 [Server.NotifyGroup] 向分组内的所有连接发送通知，
+// 可用于聊天室、租户频道或是按主题分发等场景。
+// 分组在第一个连接加入时创建，在最后一个连接离开时删除。
+// [Conn.Serve] 退出时会自动离开所有的分组。
+func (conn *Conn) Join(name string) {
+	g := &conn.server.groups
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.join(conn, name)
+}
+
+func (g *groups) join(conn *Conn, name string) {
+	if g.members == nil {
+		g.members = make(map[string]map[*Conn]struct{}, 10)
+		g.joined = make(map[*Conn]map[string]struct{}, 10)
+	}
+
+	m, found := g.members[name]
+	if !found {
+		m = make(map[*Conn]struct{}, 10)
+		g.members[name] = m
+	}
+	m[conn] = struct{}{}
+
+	j, found := g.joined[conn]
+	if !found {
+		j = make(map[string]struct{}, 5)
+		g.joined[conn] = j
+	}
+	j[name] = struct{}{}
+}
+
+// Leave 当前连接离开分组 name
+func (conn *Conn) Leave(name string) {
+	g := &conn.server.groups
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.leave(conn, name)
+}
+
+// Groups 当前连接加入的分组
+//
+// 返回值已经排序。
+func (conn *Conn) Groups() []string {
+	g := &conn.server.groups
+	g.mux.RLock()
+	defer g.mux.RUnlock()
+
+	names := make([]string, 0, len(g.joined[conn]))
+	for name := range g.joined[conn] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 离开所有的分组
+func (conn *Conn) leaveGroups() {
+	g := &conn.server.groups
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	for name := range g.joined[conn] {
+		g.leave(conn, name)
+	}
+}
+
+func (g *groups) leave(conn *Conn, name string) {
+	if m, found := g.members[name]; found {
+		delete(m, conn)
+		if len(m) == 0 {
+			delete(g.members, name)
+		}
+	}
+
+	if j, found := g.joined[conn]; found {
+		delete(j, name)
+		if len(j) == 0 {
+			delete(g.joined, conn)
+		}
+	}
+}
+
+// GroupSize 分组 name 中的连接数量
+func (s *Server) GroupSize(name string) int {
+	s.groups.mux.RLock()
+	defer s.groups.mux.RUnlock()
+	return len(s.groups.members[name])
+}
+
+// NotifyGroup 向分组 name 中的所有连接发送通知
+//
+// in 仅编码一次，之后由各个连接共用；opts 会应用于每一个连接。
+// 某个连接发送失败并不会中断对其它连接的发送，返回值为第一个发送失败的错误。
+// 如果分组不存在，则不发送任何内容。
+// 如果通过 [Server.GroupBuffer] 指定了缓存，通知会被缓存并附加游标。
+func (s *Server) NotifyGroup(name, method string, in interface{}, opts ...CallOption) error {
+	var params json.RawMessage
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		params = data
+		in = encodedParams(data)
+	}
+
+	// 缓存与获取成员需要在同一个锁内，以免与 Conn.JoinSince 之间产生遗漏。
+	s.groups.mux.Lock()
+	if b, found := s.groups.buffers[name]; found {
+		opts = append(opts[:len(opts):len(opts)], withCursor(b.add(method, params)))
+	}
+	conns := make([]*Conn, 0, len(s.groups.members[name]))
+	for conn := range s.groups.members[name] {
+		conns = append(conns, conn)
+	}
+	s.groups.mux.Unlock()
+
+	var err error
+	for _, conn := range conns {
+		if err2 := conn.Notify(method, in, opts...); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
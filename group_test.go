@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_NotifyGroup(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	out1, out2, out3 := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	c1 := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out1, nil), nil)
+	c2 := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out2, nil), nil)
+	c3 := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out3, nil), nil)
+
+	c1.Join("room")
+	c1.Join("tenant")
+	c2.Join("room")
+	c3.Join("tenant")
+	a.Equal(srv.GroupSize("room"), 2).
+		Equal(srv.GroupSize("tenant"), 2).
+		Equal(c1.Groups(), []string{"room", "tenant"})
+
+	a.NotError(srv.NotifyGroup("room", "f1", &inType{Age: 1}))
+	a.Contains(out1.String(), `"method":"f1"`).
+		Contains(out2.String(), `"Age":1`).
+		Empty(out3.String())
+
+	// 不存在的分组
+	a.NotError(srv.NotifyGroup("not-exists", "f1", nil))
+	a.Error(srv.NotifyGroup("room", "f1", make(chan int)))
+
+	c2.Leave("room")
+	c2.Leave("not-exists")
+	a.Equal(srv.GroupSize("room"), 1).Empty(c2.Groups())
+
+	// Serve 退出时离开所有分组
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.Equal(c1.Serve(ctx), context.Canceled)
+	a.Equal(srv.GroupSize("room"), 0).
+		Equal(srv.GroupSize("tenant"), 1).
+		Empty(c1.Groups())
+}
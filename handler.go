@@ -5,36 +5,103 @@
 package jsonrpc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"sync/atomic"
+	"time"
 )
 
-var errType = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	errType     = reflect.TypeOf((*error)(nil)).Elem()
+	ctxType     = reflect.TypeOf((*context.Context)(nil)).Elem()
+	readerType  = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	decoderType = reflect.TypeOf((*json.Decoder)(nil))
+)
 
 type handler struct {
 	f       reflect.Value
 	in, out reflect.Type
+
+	// params 的类型为 io.Reader 或是 *json.Decoder，in 为空。
+	stream reflect.Type
+
+	ctx bool // 第一个参数是否为 context.Context
+
+	// 由 RegisterFunc 生成的非反射调用方式，不为空时代替 f.Call。
+	typed func(notify bool, in, out interface{}) error
+
+	// 是否需要在 ctx 中附加请求方的信息
+	request bool
+
+	// 以下为通过 MethodOption 指定的选项
+	limit      *limiter
+	rate       *rateLimiter
+	timeout    time.Duration
+	validator  func(interface{}) error
+	guard      func(string) error
+	desc       string
+	exposure   Exposure
+	migrations []func(string, json.RawMessage) (json.RawMessage, error)
+	processors []func(Peer, string, interface{}) (interface{}, error)
+}
+
+// 限制服务的并发数量
+type limiter struct {
+	sem     chan struct{}
+	queue   int64 // 允许等待的最大数量
+	waiting int64
+}
+
+func newLimiter(concurrency, queue int) *limiter {
+	return &limiter{
+		sem:   make(chan struct{}, concurrency),
+		queue: int64(queue),
+	}
+}
+
+// 获取执行权限，如果等待的数量已经超过限制，返回 false。
+func (l *limiter) acquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > l.queue {
+		atomic.AddInt64(&l.waiting, -1)
+		return false
+	}
+	l.sem <- struct{}{}
+	atomic.AddInt64(&l.waiting, -1)
+	return true
 }
 
+func (l *limiter) release() { <-l.sem }
+
 // Send 的回调函数
 type callback struct {
 	f      reflect.Value
 	result reflect.Type
+	ctx    bool // 第一个参数是否为 context.Context
 }
 
 func newCallback(f interface{}) *callback {
 	t := reflect.TypeOf(f)
 
 	if t.Kind() != reflect.Func ||
-		t.NumIn() != 1 ||
-		t.In(0).Kind() != reflect.Ptr ||
+		(t.NumIn() != 1 && t.NumIn() != 2) ||
+		(t.NumIn() == 2 && t.In(0) != ctxType) ||
+		t.In(t.NumIn()-1).Kind() != reflect.Ptr ||
 		t.NumOut() != 1 ||
 		!t.Out(0).Implements(errType) {
 		panic(fmt.Sprintf("函数 %s 签名不正确", t.String()))
 	}
 
-	in := t.In(0).Elem()
+	in := t.In(t.NumIn() - 1).Elem()
 	if in.Kind() == reflect.Func || in.Kind() == reflect.Ptr || in.Kind() == reflect.Invalid {
 		panic(fmt.Sprintf("函数 %s 签名不正确", t.String()))
 	}
@@ -42,59 +109,169 @@ func newCallback(f interface{}) *callback {
 	return &callback{
 		f:      reflect.ValueOf(f),
 		result: in,
+		ctx:    t.NumIn() == 2,
 	}
 }
 
 func newHandler(f interface{}) *handler {
-	t := reflect.TypeOf(f)
+	h := handlerOf(reflect.ValueOf(f))
+	if h == nil {
+		panic(fmt.Sprintf("函数 %s 签名不正确", reflect.TypeOf(f).String()))
+	}
+	return h
+}
+
+// 根据函数 f 生成 handler，如果 f 的签名不正确，返回 nil。
+func handlerOf(f reflect.Value) *handler {
+	t := f.Type()
+
+	var offset int // 可选的 context.Context 参数所占的位置
+	if t.Kind() == reflect.Func && t.NumIn() == 4 && t.In(0) == ctxType {
+		offset = 1
+	}
 
 	if t.Kind() != reflect.Func ||
-		t.NumIn() != 3 ||
-		t.In(0).Kind() != reflect.Bool ||
-		t.In(1).Kind() != reflect.Ptr ||
-		t.In(2).Kind() != reflect.Ptr ||
+		t.NumIn() != 3+offset ||
+		t.In(offset).Kind() != reflect.Bool ||
+		(t.In(offset+1).Kind() != reflect.Ptr && t.In(offset+1) != readerType) ||
+		t.In(offset+2).Kind() != reflect.Ptr ||
 		t.NumOut() != 1 ||
 		!t.Out(0).Implements(errType) {
-		panic(fmt.Sprintf("函数 %s 签名不正确", t.String()))
+		return nil
 	}
 
-	in := t.In(1).Elem()
-	if in.Kind() == reflect.Func || in.Kind() == reflect.Ptr || in.Kind() == reflect.Invalid {
-		panic(fmt.Sprintf("函数 %s 签名不正确", t.String()))
+	out := t.In(offset + 2).Elem()
+	if out.Kind() == reflect.Func || out.Kind() == reflect.Ptr || out.Kind() == reflect.Invalid {
+		return nil
 	}
 
-	out := t.In(2).Elem()
-	if out.Kind() == reflect.Func || out.Kind() == reflect.Ptr || out.Kind() == reflect.Invalid {
-		panic(fmt.Sprintf("函数 %s 签名不正确", t.String()))
+	if params := t.In(offset + 1); params == readerType || params == decoderType {
+		return &handler{
+			f:      f,
+			stream: params,
+			out:    out,
+			ctx:    offset == 1,
+		}
+	}
+
+	in := t.In(offset + 1).Elem()
+	if in.Kind() == reflect.Func || in.Kind() == reflect.Ptr || in.Kind() == reflect.Invalid {
+		return nil
 	}
 
 	return &handler{
-		f:   reflect.ValueOf(f),
+		f:   f,
 		in:  in,
 		out: out,
+		ctx: offset == 1,
 	}
 }
 
 func (h *handler) call(req *body) (*body, error) {
-	inValue := reflect.New(h.in)
-	if req.Params != nil {
-		if err := json.Unmarshal(*req.Params, inValue.Interface()); err != nil {
-			return nil, NewErrorWithError(CodeParseError, err)
+	out, err := h.exec(handlerContext(req), req, nil)
+	if err != nil || out == nil {
+		return nil, err
+	}
+	return h.encode(req, out)
+}
+
+// 执行服务并返回 result 对象，如果是通知类型的请求，返回 nil。
+//
+// ctx 仅在服务函数带有 context.Context 参数时才会传递给服务函数；
+// validator 为额外的参数验证函数，可以为空。
+func (h *handler) exec(ctx context.Context, req *body, validator func(interface{}) error) (interface{}, error) {
+	params, err := h.migrate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var inValue reflect.Value
+	if h.stream != nil {
+		inValue = h.streamParams(params)
+	} else {
+		inValue = reflect.New(h.in)
+		if params != nil {
+			if err := unmarshal(params, inValue.Interface()); err != nil {
+				return nil, NewErrorWithError(CodeParseError, err)
+			}
+		}
+
+		if err := validate(validator, inValue.Interface()); err != nil {
+			return nil, err
 		}
 	}
 
 	notify := req.ID == nil
 	outValue := reflect.New(h.out)
-	ret := h.f.Call([]reflect.Value{reflect.ValueOf(notify), inValue, outValue})
-	if !ret[0].IsNil() {
-		return nil, NewErrorWithError(CodeInternalError, ret[0].Interface().(error))
+	if h.typed != nil {
+		err = h.typed(notify, inValue.Interface(), outValue.Interface())
+	} else {
+		args := []reflect.Value{reflect.ValueOf(notify), inValue, outValue}
+		if h.ctx {
+			args = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, args...)
+		}
+		if ret := h.f.Call(args); !ret[0].IsNil() {
+			err = ret[0].Interface().(error)
+		}
+	}
+	if err != nil {
+		return nil, NewErrorWithError(CodeInternalError, err)
 	}
 
 	if notify {
 		return nil, nil
 	}
+	return outValue.Interface(), nil
+}
+
+// 将 params 包装为服务函数所需要的 io.Reader 或是 *json.Decoder
+//
+// 不需要先将参数解码为完整的对象，由服务函数自行按需读取。
+// params 为空时，返回的对象读取时直接返回 io.EOF。
+func (h *handler) streamParams(params json.RawMessage) reflect.Value {
+	var r io.Reader = bytes.NewReader(params)
+	if h.stream == decoderType {
+		return reflect.ValueOf(json.NewDecoder(r))
+	}
+	return reflect.ValueOf(&r).Elem()
+}
+
+// 依次调用参数的迁移函数，返回最终的参数。
+func (h *handler) migrate(req *body) (json.RawMessage, error) {
+	var params json.RawMessage
+	if req.Params != nil {
+		params = *req.Params
+	}
 
-	data, err := json.Marshal(outValue.Interface())
+	for _, m := range h.migrations {
+		var err error
+		if params, err = m(req.Method, params); err != nil {
+			if err2, ok := err.(*Error); ok {
+				return nil, err2
+			}
+			return nil, NewErrorWithError(CodeInvalidParams, err)
+		}
+	}
+	return params, nil
+}
+
+// 依次调用返回数据的处理函数，返回最终需要编码的对象。
+func (h *handler) process(p Peer, req *body, out interface{}) (interface{}, error) {
+	for _, f := range h.processors {
+		var err error
+		if out, err = f(p, req.Method, out); err != nil {
+			if err2, ok := err.(*Error); ok {
+				return nil, err2
+			}
+			return nil, NewErrorWithError(CodeInternalError, err)
+		}
+	}
+	return out, nil
+}
+
+// 将 out 编码为返回给客户端的数据
+func (h *handler) encode(req *body, out interface{}) (*body, error) {
+	data, err := marshal(out)
 	if err != nil {
 		return nil, NewErrorWithError(CodeParseError, err)
 	}
@@ -106,21 +283,57 @@ func (h *handler) call(req *body) (*body, error) {
 	}, nil
 }
 
-func (c *callback) call(response *body) error {
+func (c *callback) call(ctx context.Context, response *body) error {
 	if response.Error != nil {
 		return response.Error
 	}
 
 	rv := reflect.New(c.result)
 	if response.Result != nil {
-		if err := json.Unmarshal(*response.Result, rv.Interface()); err != nil {
+		if err := unmarshal(*response.Result, rv.Interface()); err != nil {
 			return err
 		}
 	}
 
-	ret := c.f.Call([]reflect.Value{rv})
+	args := []reflect.Value{rv}
+	if c.ctx {
+		args = []reflect.Value{reflect.ValueOf(&ctx).Elem(), rv}
+	}
+
+	ret := c.f.Call(args)
 	if !ret[0].IsNil() {
 		return ret[0].Interface().(error)
 	}
 	return nil
 }
+
+// 将 v 编码为 JSON
+//
+// 如果 v 实现了 [json.Marshaler]，比如由 easyjson 等工具生成的代码，
+// 则直接调用其 MarshalJSON 方法，跳过 encoding/json 基于反射的处理过程，
+// 此时会验证其返回值，无效的 JSON 返回 [CodeInternalError]。
+func marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(json.Marshaler)
+	if !ok {
+		return json.Marshal(v)
+	}
+
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, NewError(CodeInternalError, fmt.Sprintf("%T.MarshalJSON 返回了无效的 JSON", v))
+	}
+	return data, nil
+}
+
+// 将 data 解码至 v
+//
+// 如果 v 实现了 [json.Unmarshaler]，则直接调用其 UnmarshalJSON 方法。
+func unmarshal(data []byte, v interface{}) error {
+	if u, ok := v.(json.Unmarshaler); ok {
+		return u.UnmarshalJSON(data)
+	}
+	return json.Unmarshal(data, v)
+}
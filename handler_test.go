@@ -5,14 +5,21 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"math"
+	"reflect"
 	"testing"
 
 	"github.com/issue9/assert/v4"
 )
 
+type testCtxKey int
+
+const ctxKey testCtxKey = 1
+
 func TestNewCallback(t *testing.T) {
 	a := assert.New(t, false)
 
@@ -48,6 +55,21 @@ func TestNewCallback(t *testing.T) {
 	a.Panic(func() {
 		newCallback(func(*interface{}) {})
 	})
+
+	a.NotPanic(func() {
+		c := newCallback(func(context.Context, *int) error { return nil })
+		a.True(c.ctx)
+	})
+
+	// 第一个参数不是 context.Context
+	a.Panic(func() {
+		newCallback(func(int, *int) error { return nil })
+	})
+
+	// 参数过多
+	a.Panic(func() {
+		newCallback(func(context.Context, *int, *int) error { return nil })
+	})
 }
 
 func TestNewHandler(t *testing.T) {
@@ -98,6 +120,24 @@ func TestNewHandler(t *testing.T) {
 	a.NotPanic(func() {
 		newHandler(func(bool, *int, *int) error { return nil })
 	})
+
+	// 带 context.Context
+	a.NotPanic(func() {
+		h := newHandler(func(context.Context, bool, *int, *int) error { return nil })
+		a.True(h.ctx).Equal(h.in.Kind(), reflect.Int)
+	})
+	a.NotPanic(func() {
+		h := newHandler(func(context.Context, bool, io.Reader, *int) error { return nil })
+		a.True(h.ctx).Equal(h.stream, readerType)
+	})
+
+	// context.Context 的位置不正确
+	a.Panic(func() {
+		newHandler(func(bool, context.Context, *int, *int) error { return nil })
+	})
+	a.Panic(func() {
+		newHandler(func(*int, bool, *int, *int) error { return nil })
+	})
 }
 
 func TestHandler_call(t *testing.T) {
@@ -199,6 +239,51 @@ func TestHandler_call(t *testing.T) {
 	}
 }
 
+func TestHandler_stream(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Panic(func() {
+		newHandler(func(bool, io.Writer, *int) error { return nil })
+	})
+
+	// *json.Decoder，逐个读取数组元素。
+	h := newHandler(func(notify bool, in *json.Decoder, out *int) error {
+		if _, err := in.Token(); err != nil {
+			return err
+		}
+		for in.More() {
+			var v int
+			if err := in.Decode(&v); err != nil {
+				return err
+			}
+			*out += v
+		}
+		_, err := in.Token()
+		return err
+	})
+	params := json.RawMessage(`[1,2,3,4]`)
+	resp, err := h.call(&body{ID: NewNumberID(1), Params: &params})
+	a.NotError(err).Equal(string(*resp.Result), "10")
+
+	// io.Reader
+	h = newHandler(func(notify bool, in io.Reader, out *string) error {
+		data, err := io.ReadAll(in)
+		*out = string(data)
+		return err
+	})
+	params = json.RawMessage(`{"k":"v"}`)
+	resp, err = h.call(&body{ID: NewNumberID(1), Params: &params})
+	a.NotError(err).Equal(string(*resp.Result), `"{\"k\":\"v\"}"`)
+
+	// 未指定参数
+	h = newHandler(func(notify bool, in *json.Decoder, out *int) error {
+		var v int
+		return in.Decode(&v)
+	})
+	_, err = h.call(&body{ID: NewNumberID(1)})
+	a.Equal(err.(*Error).Code, CodeInternalError).Equal(err.Error(), io.EOF.Error())
+}
+
 func TestCallback_call(t *testing.T) {
 	a := assert.New(t, false)
 
@@ -237,10 +322,21 @@ func TestCallback_call(t *testing.T) {
 			resp: &body{Result: (*json.RawMessage)(&num)},
 			err:  true,
 		},
+
+		{ // 带 context 参数
+			c: newCallback(func(ctx context.Context, i *int) error {
+				if ctx.Value(ctxKey) != "v" {
+					return errors.New("ctx")
+				}
+				return nil
+			}),
+			resp: &body{Result: (*json.RawMessage)(&num)},
+		},
 	}
 
+	ctx := context.WithValue(context.Background(), ctxKey, "v")
 	for i, item := range data {
-		err := item.c.call(item.resp)
+		err := item.c.call(ctx, item.resp)
 		if item.err {
 			a.Error(err, "not error at %d", i)
 		} else {
@@ -248,3 +344,58 @@ func TestCallback_call(t *testing.T) {
 		}
 	}
 }
+
+// 模拟 easyjson 等工具生成的类型
+type codecType struct {
+	value string
+}
+
+type invalidCodecType struct{}
+
+func (c *codecType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.value + "-m")
+}
+
+func (c *codecType) UnmarshalJSON(data []byte) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	c.value = v + "-u"
+	return nil
+}
+
+func (c *invalidCodecType) MarshalJSON() ([]byte, error) { return []byte(`"v`), nil }
+
+func TestMarshal(t *testing.T) {
+	a := assert.New(t, false)
+
+	data, err := marshal(&codecType{value: "v"})
+	a.NotError(err).Equal(string(data), `"v-m"`)
+
+	data, err = marshal(&inType{Age: 1})
+	a.NotError(err).Equal(string(data), `{"last":"","first":"","Age":1}`)
+
+	c := &codecType{}
+	a.NotError(unmarshal([]byte(`"v"`), c)).Equal(c.value, `v-u`)
+
+	in := &inType{}
+	a.NotError(unmarshal([]byte(`{"Age":1}`), in)).Equal(in.Age, 1)
+
+	// handler 使用自定义的编解码
+	h := newHandler(func(notify bool, in, out *codecType) error {
+		out.value = in.value
+		return nil
+	})
+	params := json.RawMessage(`"p"`)
+	resp, err := h.call(&body{ID: &ID{alpha: "1"}, Params: &params})
+	a.NotError(err).Equal(string(*resp.Result), `"p-u-m"`)
+
+	// 无效的 MarshalJSON 返回值
+	data, err = marshal(&invalidCodecType{})
+	a.Nil(data).Equal(err.(*Error).Code, CodeInternalError)
+
+	h = newHandler(func(notify bool, in *codecType, out *invalidCodecType) error { return nil })
+	resp, err = h.call(&body{ID: &ID{alpha: "1"}, Params: &params})
+	a.Nil(resp).Equal(err.(*Error).Code, CodeInternalError)
+}
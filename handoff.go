@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ListenFDsEnv 通过 [Handoff] 传递监听时使用的环境变量名
+//
+// 其值为传递的监听数量，监听的文件描述符从 3 开始依次排列。
+const ListenFDsEnv = "JSONRPC_LISTEN_FDS"
+
+// 第一个传递的文件描述符，0、1、2 分别为标准输入、输出和错误。
+const listenFDStart = 3
+
+// 可以导出文件描述符的监听，[net.TCPListener] 和 [net.UnixListener] 均实现了此接口。
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Handoff 启动新的进程并将 ls 传递给新进程
+//
+// 新进程继承当前进程的环境变量和标准输入输出，并可以通过 [InheritedListeners] 取得 ls。
+// 在新进程开始服务之后，当前进程可以取消 [Server.ServeListeners] 的 ctx，
+// 停止接收新的连接，并在 [ListenOptions.DrainTimeout] 之内处理完已有的连接后退出，
+// 以实现在不中断服务的情况下升级程序。
+//
+// path 和 args 与 [exec.Command] 的参数相同，一般为 os.Args[0] 和 os.Args[1:]。
+// ls 中的元素必须实现了 File() (*os.File, error) 方法，比如 [net.TCPListener]。
+//
+// NOTE: 不支持 windows。
+func Handoff(ls []net.Listener, path string, args ...string) (*os.Process, error) {
+	files := make([]*os.File, 0, len(ls))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, l := range ls {
+		fl, ok := l.(fileListener)
+		if !ok {
+			return nil, fmt.Errorf("%T 无法导出文件描述符", l)
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), ListenFDsEnv+"="+strconv.Itoa(len(files)))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+// InheritedListeners 返回由父进程通过 [Handoff] 传递过来的监听
+//
+// 如果当前进程不是由 [Handoff] 启动的，返回空值。
+// 调用之后会清除 [ListenFDsEnv] 环境变量，以免被当前进程启动的子进程误用。
+func InheritedListeners() ([]net.Listener, error) {
+	v := os.Getenv(ListenFDsEnv)
+	if v == "" {
+		return nil, nil
+	}
+	if err := os.Unsetenv(ListenFDsEnv); err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("无效的环境变量 %s=%s", ListenFDsEnv, v)
+	}
+
+	ls := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		f := os.NewFile(uintptr(listenFDStart+i), "listener"+strconv.Itoa(i))
+		l, err := net.FileListener(f)
+		f.Close() // FileListener 会复制文件描述符
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
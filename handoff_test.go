@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 由 TestHandoff 启动的子进程
+func TestHandoff_child(t *testing.T) {
+	if os.Getenv(ListenFDsEnv) == "" {
+		return
+	}
+
+	a := assert.New(t, false)
+	ls, err := InheritedListeners()
+	a.NotError(err).Length(ls, 1)
+	a.Empty(os.Getenv(ListenFDsEnv))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv := initServer(a)
+	srv.ServeListeners(ctx, ls, &ListenOptions{
+		Header:  true,
+		Timeout: 100 * time.Millisecond,
+		Conn:    func(*Conn) { time.AfterFunc(time.Second, cancel) },
+	})
+}
+
+func TestHandoff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("不支持 windows")
+	}
+	a := assert.New(t, false)
+
+	ls, err := InheritedListeners()
+	a.NotError(err).Nil(ls)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	addr := l.Addr().String()
+
+	p, err := Handoff([]net.Listener{l}, os.Args[0], "-test.run=^TestHandoff_child$")
+	a.NotError(err).NotNil(p)
+	a.NotError(l.Close()) // 原进程关闭监听之后，新进程依然可以接收连接
+
+	c, err := NewTCPClientTransport(true, addr, time.Second, nil)
+	a.NotError(err)
+	defer c.Close()
+
+	srv := initServer(a)
+	req, err := srv.newRequest(false, "f1", &inType{Age: 1})
+	a.NotError(err)
+	a.NotError(c.Write(req))
+	resp := &body{}
+	a.NotError(c.Read(resp)).Equal(resp.ID, req.ID)
+
+	state, err := p.Wait()
+	a.NotError(err).True(state.Success())
+
+	// 无法导出文件描述符
+	_, err = Handoff([]net.Listener{&net.TCPListener{}, nil}, os.Args[0])
+	a.Error(err)
+}
+
+func TestServer_ServeListeners_drain(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan error, 1)
+	go func() {
+		exit <- srv.ServeListeners(ctx, []net.Listener{l}, &ListenOptions{
+			Header:       true,
+			Timeout:      50 * time.Millisecond,
+			DrainTimeout: 5 * time.Second,
+		})
+	}()
+
+	c, err := NewTCPClientTransport(true, addr, time.Second, nil)
+	a.NotError(err)
+
+	call := func() {
+		req, err := srv.newRequest(false, "f1", &inType{Age: 1})
+		a.NotError(err)
+		a.NotError(c.Write(req))
+		resp := &body{}
+		a.NotError(c.Read(resp)).Equal(resp.ID, req.ID)
+	}
+	call()
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// 已经停止监听，但是已有的连接依然可用。
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	a.Error(err)
+	call()
+	select {
+	case <-exit:
+		a.TB().Fatal("未等待已有的连接")
+	default:
+	}
+
+	a.NotError(c.Close())
+	a.ErrorIs(<-exit, context.Canceled)
+}
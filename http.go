@@ -6,6 +6,7 @@ package jsonrpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
@@ -13,11 +14,15 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
-	contentType   = http.CanonicalHeaderKey("content-Type")
-	contentLength = http.CanonicalHeaderKey("content-length")
+	contentType     = http.CanonicalHeaderKey("content-Type")
+	contentLength   = http.CanonicalHeaderKey("content-length")
+	contentEncoding = http.CanonicalHeaderKey("content-encoding")
+	acceptEncoding  = http.CanonicalHeaderKey("accept-encoding")
+	timeoutHeader   = http.CanonicalHeaderKey("x-timeout")
 )
 
 // 可能的 mimetype 值，第一个元素作为默认值，在输出时使用。
@@ -33,24 +38,40 @@ const charset = "utf-8"
 
 // HTTPConn 表示 json rpc 的 HTTP 服务端中间件
 type HTTPConn struct {
-	server *Server
-	errlog *log.Logger
-	url    string
+	server     *Server
+	errlog     *log.Logger
+	url        string
+	deadLetter DeadLetter
+	identify   func(*http.Request) interface{}
+
+	deadlineMargin time.Duration
+
+	credentials Credentials
+	client      *http.Client
 }
 
 type httpTransport struct {
-	r    *http.Request
-	w    http.ResponseWriter
-	wMux sync.Mutex
+	r     *http.Request
+	w     http.ResponseWriter
+	wMux  sync.Mutex
+	clock Clock
 }
 
 type httpClientTransport struct {
-	url  string
-	resp *http.Response
+	ctx         context.Context
+	url         string
+	client      *http.Client
+	credentials Credentials
+	clock       Clock
+	resp        *http.Response
 }
 
-func newHTTPClientTransport(url string) Transport {
-	return &httpClientTransport{url: url}
+func (h *HTTPConn) newClientTransport(ctx context.Context) Transport {
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpClientTransport{ctx: ctx, url: h.url, client: client, credentials: h.credentials, clock: h.server.clock}
 }
 
 func (h *httpClientTransport) Write(v interface{}) error {
@@ -59,8 +80,48 @@ func (h *httpClientTransport) Write(v interface{}) error {
 		return err
 	}
 
-	h.resp, err = http.Post(h.url, mimetypes[0], bytes.NewBuffer(body))
-	return err
+	var timeout string
+	if b := bodyOf(v); b != nil && !b.deadline.IsZero() {
+		timeout = strconv.FormatInt(timeoutMillis(b.deadline, h.clock.Now()), 10)
+	}
+
+	// 凭证被拒绝时，重新获取凭证之后重试一次。
+	for retried := false; ; retried = true {
+		token, err := h.do(body, timeout)
+		if err != nil || h.resp.StatusCode != http.StatusUnauthorized || h.credentials == nil {
+			return err
+		}
+
+		h.resp.Body.Close()
+		h.resp = nil
+		if retried {
+			return ErrUnauthorized
+		}
+		h.credentials.Invalidate(token)
+	}
+}
+
+// 发送请求并返回所使用的凭证
+func (h *httpClientTransport) do(body []byte, timeout string) (token string, err error) {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(contentType, mimetypes[0])
+	if timeout != "" {
+		req.Header.Set(timeoutHeader, timeout)
+	}
+	if h.credentials != nil {
+		if token, err = h.credentials.Token(h.ctx); err != nil {
+			return "", err
+		}
+		if token != "" {
+			req.Header.Set(authorization, token)
+		}
+	}
+
+	h.resp, err = h.client.Do(req)
+	return token, err
 }
 
 func (h *httpClientTransport) Read(v interface{}) error {
@@ -69,6 +130,9 @@ func (h *httpClientTransport) Read(v interface{}) error {
 		return err
 	}
 
+	if data, err = trimBOM(data); err != nil {
+		return err
+	}
 	return json.Unmarshal(data, v)
 }
 
@@ -95,7 +159,7 @@ func (s *Server) NewHTTPConn(url string, errlog *log.Logger) *HTTPConn {
 }
 
 func (h *HTTPConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	t := newHTTPTransport(w, r)
+	t := newHTTPTransport(w, r, h.server.clock)
 	defer func() {
 		if err := t.Close(); err != nil {
 			h.printErr(err)
@@ -106,8 +170,21 @@ func (h *HTTPConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		h.printErr(err)
 	}
+	if req == nil {
+		return
+	}
+	req.via = ExposeHTTP
+	req.ctx = r.Context()
+	if h.identify != nil {
+		req.identity = h.identify(r)
+	}
 
-	if err := h.server.response(t, req); err != nil {
+	if req.batch != nil {
+		err = h.server.responseBatch(t, req, nil)
+	} else {
+		err = h.server.response(t, req)
+	}
+	if err != nil {
 		h.printErr(err)
 	}
 }
@@ -119,49 +196,70 @@ func (h *HTTPConn) printErr(v interface{}) {
 }
 
 // Notify 请求 JSON RPC 服务端
-func (h *HTTPConn) Notify(method string, params interface{}) error {
-	return h.request(method, true, params, nil)
+func (h *HTTPConn) Notify(method string, params interface{}, opts ...CallOption) error {
+	return h.request(context.Background(), method, true, params, nil, opts)
 }
 
 // Send 请求 JSON RPC 服务端
-func (h *HTTPConn) Send(method string, params, callback interface{}) error {
-	return h.request(method, false, params, callback)
+func (h *HTTPConn) Send(method string, params, callback interface{}, opts ...CallOption) error {
+	return h.SendContext(context.Background(), method, params, callback, opts...)
+}
+
+// SendContext 请求 JSON RPC 服务端
+//
+// ctx 和 opts 的作用与 [Conn.SendContext] 相同。
+func (h *HTTPConn) SendContext(ctx context.Context, method string, params, callback interface{}, opts ...CallOption) error {
+	return h.request(ctx, method, false, params, callback, opts)
 }
 
-func (h *HTTPConn) request(method string, notify bool, in, callback interface{}) error {
+func (h *HTTPConn) request(ctx context.Context, method string, notify bool, in, callback interface{}, opts []CallOption) error {
 	if h.url == "" {
 		panic("初始化时未声明 url 参数，无法作为客户端使用")
 	}
 
-	t := newHTTPClientTransport(h.url)
+	t := h.newClientTransport(ctx)
 	defer func() {
 		if err := t.Close(); err != nil {
 			h.printErr(err)
 		}
 	}()
 
-	_, err := h.server.request(t, notify, method, in)
+	req, err := h.server.newRequest(notify, method, in)
+	if err != nil {
+		return err
+	}
+	mctx, err := withDeadlineMargin(ctx, h.deadlineMargin, h.server.clock)
 	if err != nil {
 		return err
 	}
+	o := newCallOptions(opts)
+	v := o.apply(mctx, req, h.server.clock)
+	if err := transportError(o.write(t, v, h.server.clock)); err != nil {
+		storeDeadLetter(h.deadLetter, req.ID, method, v, err)
+		return err
+	}
 	if notify {
 		return nil
 	}
 
 	resp := &body{}
 	if err := t.Read(resp); err != nil {
-		return err
+		return readError(err)
 	}
 
-	cb := newCallback(callback)
-	return cb.call(resp)
+	err = h.server.callback(&pending{ctx: ctx, method: method, cb: newCallback(callback)}, resp)
+	if resp.Error != nil && err == error(resp.Error) {
+		return remoteError(resp.Error)
+	}
+	return err
 }
 
 // 声明基于 HTTP 的 Transport 实例
-func newHTTPTransport(w http.ResponseWriter, r *http.Request) Transport {
+func newHTTPTransport(w http.ResponseWriter, r *http.Request, clock Clock) Transport {
 	return &httpTransport{
-		r: r,
-		w: w,
+		r:     r,
+		w:     w,
+		clock: clock,
 	}
 }
 
@@ -185,7 +283,23 @@ func (s *httpTransport) Read(v interface{}) error {
 		return err
 	}
 
-	return json.Unmarshal(data[:n], v)
+	if data, err = trimBOM(data[:n]); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	if h := s.r.Header.Get(timeoutHeader); h != "" {
+		d, err := parseTimeout(h)
+		if err != nil {
+			return err
+		}
+		if b := bodyOf(v); b != nil {
+			b.deadline = s.clock.Now().Add(d)
+		}
+	}
+	return nil
 }
 
 func (s *httpTransport) Write(obj interface{}) error {
@@ -203,6 +317,8 @@ func (s *httpTransport) Write(obj interface{}) error {
 	return err
 }
 
+func (s *httpTransport) Peer() string { return s.r.RemoteAddr }
+
 func (s *httpTransport) Close() error {
 	return s.r.Body.Close()
 }
@@ -211,6 +327,9 @@ func (s *httpTransport) Close() error {
 //
 // 如果存在该值，则必须要以 mimetype 开头，
 // charset 如果有指定，必须为 utf-8，否则不作判断
+//
+// 类型和参数均不区分大小写，charset 的值可以带引号；
+// 如果 charset 为 UTF-16 或 UTF-32，返回 [errUnsupportedCharset]。
 func validContentType(header string) error {
 	if header == "" {
 		return nil
@@ -219,7 +338,7 @@ func validContentType(header string) error {
 	pairs := strings.Split(header, ";")
 
 	var found bool
-	mimetype := strings.ToLower(pairs[0])
+	mimetype := strings.ToLower(strings.TrimSpace(pairs[0]))
 	for _, item := range mimetypes {
 		if mimetype == item {
 			found = true
@@ -232,10 +351,11 @@ func validContentType(header string) error {
 
 	for _, pair := range pairs[1:] {
 		index := strings.IndexByte(pair, '=')
-		if index > 0 &&
-			strings.ToLower(strings.TrimSpace(pair[:index])) == "charset" &&
-			strings.ToLower(strings.TrimSpace(pair[index+1:])) != charset {
-			return errInvalidContentType
+		if index <= 0 || strings.ToLower(strings.TrimSpace(pair[:index])) != "charset" {
+			continue
+		}
+		if err := validCharset(pair[index+1:]); err != nil {
+			return err
 		}
 	}
 
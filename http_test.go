@@ -5,8 +5,13 @@
 package jsonrpc
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/issue9/assert/v4"
 )
@@ -36,15 +41,14 @@ func TestHTTPConn_ServeHTTP(t *testing.T) {
 	err := conn.Send("f2", &inType{Age: 18}, func(out *outType) error {
 		return nil
 	})
-	err1, ok := err.(*Error)
-	a.True(ok).Equal(err1.Code, CodeInvalidParams) // 由函数 f2 抛出的错误 Error
+	var err1 *Error
+	a.True(errors.As(err, &err1)).Equal(err1.Code, CodeInvalidParams) // 由函数 f2 抛出的错误 Error
 
 	// 检测抛出错误是否正确
 	err = conn.Send("f3", &inType{Age: 18}, func(out *outType) error {
 		return nil
 	})
-	err1, ok = err.(*Error)
-	a.True(ok).Equal(err1.Code, CodeInternalError) // 由函数 f3 抛出的普通错误
+	a.True(errors.As(err, &err1)).Equal(err1.Code, CodeInternalError) // 由函数 f3 抛出的普通错误
 
 	a.Error(conn.Send("not-found", &inType{Age: 18}, func(out *outType) error {
 		a.Equal(out.Age, 0)
@@ -52,6 +56,39 @@ func TestHTTPConn_ServeHTTP(t *testing.T) {
 	})) // 不存在的服务名称
 }
 
+func TestHTTPConn_SendContext(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	conn := s.NewHTTPConn("", nil)
+	srv := httptest.NewServer(conn)
+	defer srv.Close()
+	conn.url = srv.URL
+
+	var before string
+	s.RegisterCallbackBefore(func(ctx context.Context, method string) error {
+		before = ctx.Value(ctxKey).(string) + method
+		if method == "ok/err" {
+			return errors.New("before")
+		}
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey, "v")
+	a.NotError(conn.SendContext(ctx, "f1", &inType{Age: 18}, func(ctx context.Context, out *outType) error {
+		a.Equal(ctx.Value(ctxKey), "v").Equal(out.Age, 18)
+		return nil
+	}))
+	a.Equal(before, "vf1")
+
+	called := false
+	err := conn.SendContext(ctx, "ok/err", &inType{Age: 18}, func(out *outType) error {
+		called = true
+		return nil
+	})
+	a.Equal(err.Error(), "before").False(called).Equal(before, "vok/err")
+}
+
 func TestValidContentType(t *testing.T) {
 	a := assert.New(t, false)
 
@@ -68,4 +105,42 @@ func TestValidContentType(t *testing.T) {
 	a.Error(validContentType("text/json;"))
 	a.Error(validContentType("application/json;charset="))
 	a.Error(validContentType("application/json;charset=utf8"))
+
+	// 大小写与引号
+	a.NotError(validContentType("Application/JSON; Charset=Utf-8"))
+	a.NotError(validContentType(" application/json ; charset = utf-8 "))
+	a.NotError(validContentType(`application/json;charset="utf-8"`))
+	a.NotError(validContentType(`application/json;charset="UTF-8"`))
+	a.Error(validContentType(`application/json;charset="utf8"`))
+	a.Error(validContentType(`application/json;charset="utf-8`))
+
+	a.ErrorIs(validContentType("application/json;charset=utf-16"), errUnsupportedCharset)
+	a.ErrorIs(validContentType(`application/json;charset="UTF-16LE"`), errUnsupportedCharset)
+	a.ErrorIs(validContentType("application/json;charset=utf-32"), errUnsupportedCharset)
+	a.ErrorIs(validContentType("application/json;charset=gbk"), errInvalidContentType)
+}
+
+func TestHTTPConn_SendContext_timeout(t *testing.T) {
+	a := assert.New(t, false)
+	s := NewServer(func() string { return <-uniqueID })
+	s.Register("slow", func(notify bool, in, out *int) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+
+	conn := s.NewHTTPConn("", nil)
+	srv := httptest.NewServer(conn)
+	defer srv.Close()
+	conn.url = srv.URL
+
+	err := conn.Send("slow", 1, func(out *int) error { return nil }, WithCallTimeout(10*time.Millisecond))
+	a.Error(err)
+	var e *Error
+	a.True(errors.As(err, &e)).Equal(e.Code, CodeTimeout)
+
+	// 无效的 X-Timeout
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	r.Header.Set(contentLength, "2")
+	r.Header.Set(timeoutHeader, "-1")
+	a.Equal(newHTTPTransport(httptest.NewRecorder(), r, systemClock{}).Read(&body{}), errInvalidHeader)
 }
@@ -0,0 +1,305 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// IncidentKind 异常事件的类型
+type IncidentKind int8
+
+// 异常事件的类型
+const (
+	IncidentPanic     IncidentKind = iota // 服务函数发生了 panic
+	IncidentEncode                        // 无法将返回值编码为 JSON
+	IncidentWrite                         // 向传输层写入返回数据时出错
+	IncidentDuplicate                     // 同一请求多次写入返回数据
+)
+
+// Incident 处理请求时发生的异常事件
+//
+// 相比于 errlog 中的文本，Incident 是结构化的数据，
+// 方便转发给 Sentry 等错误收集系统。
+type Incident struct {
+	Kind IncidentKind
+
+	// 请求的服务名
+	Method string
+
+	// 请求的 ID，通知类型的请求为 nil。
+	ID *ID
+
+	// 对方的地址
+	//
+	// 如果 [Transport] 实现了 Peer() string 方法，则为该方法的返回值，否则为空。
+	Peer string
+
+	// 请求中的 W3C traceparent 值，未指定时为空。
+	TraceParent string
+
+	// 具体的错误信息，对于 panic 则是根据 panic 值生成的错误对象。
+	//
+	// 根据 Kind 包装为 [TransportError]、[ProtocolError] 或 [ApplicationError]，
+	// 可以通过 errors.As 判断其类别。
+	Err error
+
+	// 发生 panic 时的调用栈，其它类型为空。
+	Stack []byte
+
+	// 事件发生的时间
+	Time time.Time
+}
+
+// WriteFailure 写入失败的返回数据
+type WriteFailure struct {
+	// 返回数据的 ID，对应请求的 ID，无法解析的请求为 nil。
+	ID *ID
+
+	// 返回数据的内容，Result 与 Error 只有一个有值。
+	Result json.RawMessage
+	Error  *Error
+
+	// 对方的地址，与 [Incident.Peer] 相同。
+	Peer string
+
+	// 写入失败的原因
+	Err error
+}
+
+// 传输层可以实现此接口以向 Incident 提供对方的地址
+type peer interface {
+	Peer() string
+}
+
+func (k IncidentKind) String() string {
+	switch k {
+	case IncidentPanic:
+		return "panic"
+	case IncidentEncode:
+		return "encode"
+	case IncidentWrite:
+		return "write"
+	case IncidentDuplicate:
+		return "duplicate"
+	default:
+		return "<unknown>"
+	}
+}
+
+// IncidentHandler 指定处理异常事件的函数
+//
+// 在指定了该函数之后，服务函数中发生的 panic 会被恢复，
+// 并向对方返回 [CodeInternalError] 错误，同时将相关信息传递给 h；
+// 否则 panic 会照常向上传递。
+//
+// 多次调用会相互覆盖。
+func (s *Server) IncidentHandler(h func(*Incident)) { s.incident = h }
+
+// WriteErrHandler 指定向传输层写入返回数据失败时的处理函数
+//
+// 一般发生在对方在返回数据之前断开了连接等情况，
+// 可用于触发重连、持久化未送达的数据或是统计等。
+// 该函数与 [Server.IncidentHandler] 相互独立，两者都会被调用。
+//
+// 多次调用会相互覆盖。
+func (s *Server) WriteErrHandler(h func(*WriteFailure)) { s.writeErr = h }
+
+func newWriteFailure(t Transport, v interface{}, err error) *WriteFailure {
+	f := &WriteFailure{Err: err}
+
+	if resp := bodyOf(v); resp != nil {
+		f.ID = resp.ID
+		f.Error = resp.Error
+		if resp.Result != nil {
+			f.Result = *resp.Result
+		}
+	}
+
+	f.Peer = peerOf(t)
+	return f
+}
+
+// 返回 t 对应的对方地址，如果 t 未实现 peer 接口，返回空值。
+func peerOf(t Transport) string {
+	if p, ok := t.(peer); ok {
+		return p.Peer()
+	}
+	return ""
+}
+
+// 保证每个请求最多只写入一次返回数据的传输层
+//
+// 多次写入时，不再输出到传输层，而是以 [IncidentDuplicate] 报告给 [Server.IncidentHandler]。
+type onceTransport struct {
+	Transport
+	s       *Server
+	req     *body
+	mux     sync.Mutex
+	written bool
+}
+
+func (t *onceTransport) Write(v interface{}) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.written {
+		t.s.report(t.Transport, IncidentDuplicate, t.req, errDuplicateResponse)
+		return errDuplicateResponse
+	}
+
+	if err := t.Transport.Write(v); err != nil {
+		return err
+	}
+	t.written = true
+	return nil
+}
+
+func (t *onceTransport) Peer() string { return peerOf(t.Transport) }
+
+// 报告写入返回数据时的错误，重复写入已经由 onceTransport 报告。
+func (s *Server) reportWrite(t Transport, req *body, err error) {
+	if err != errDuplicateResponse {
+		s.report(t, IncidentWrite, req, err)
+	}
+}
+
+func (s *Server) report(t Transport, kind IncidentKind, req *body, err error) {
+	s.reportStack(t, kind, req, err, nil)
+}
+
+func (s *Server) reportStack(t Transport, kind IncidentKind, req *body, err error, stack []byte) {
+	if s.incident == nil {
+		return
+	}
+
+	switch kind {
+	case IncidentWrite:
+		err = transportError(err)
+	case IncidentDuplicate:
+		err = protocolError(err)
+	default:
+		err = applicationError(err)
+	}
+
+	s.incident(&Incident{
+		Kind:        kind,
+		Method:      req.Method,
+		ID:          req.ID,
+		Peer:        peerOf(t),
+		TraceParent: req.TraceParent,
+		Err:         err,
+		Stack:       stack,
+		Time:        s.clock.Now(),
+	})
+}
+
+// 执行服务函数并对结果进行编码
+//
+// 如果服务指定了超时时间或是请求带有截止时间，则在超时之后返回 [CodeTimeout] 错误。
+// 调用方需要已经获取了 h.limit 的名额，该名额在服务函数真正返回之后才会释放，
+// 即使已经超时返回。
+func (s *Server) call(t Transport, h *handler, req *body) (*body, error) {
+	release := func() {}
+	if h.limit != nil {
+		release = h.limit.release
+	}
+
+	timeout := h.timeout
+	if !req.deadline.IsZero() {
+		d := req.deadline.Sub(s.clock.Now())
+		if d <= 0 {
+			release()
+			return nil, NewError(CodeTimeout, fmt.Sprintf("请求 %s 已经超时", req.Method))
+		}
+		if timeout <= 0 || d < timeout {
+			timeout = d
+		}
+	}
+
+	ctx := handlerContext(req)
+	if h.request {
+		ctx = context.WithValue(ctx, requestKey{}, &requestInfo{
+			peer: Peer{Addr: peerOf(t), Identity: req.identity},
+			via:  req.via,
+		})
+	}
+	if timeout <= 0 {
+		defer release()
+		return s.exec(ctx, t, h, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		resp *body
+		err  error
+	}
+	ret := make(chan result, 1)
+	go func() {
+		defer release()
+		resp, err := s.exec(ctx, t, h, req)
+		ret <- result{resp: resp, err: err}
+	}()
+
+	timer, stop := s.clock.NewTimer(timeout)
+	defer stop()
+	select {
+	case r := <-ret:
+		return r.resp, r.err
+	case <-timer:
+		return nil, NewError(CodeTimeout, fmt.Sprintf("服务 %s 执行超时", req.Method))
+	}
+}
+
+func (s *Server) exec(ctx context.Context, t Transport, h *handler, req *body) (resp *body, err error) {
+	if s.slow != nil {
+		defer s.slow.watch(s.clock, t, req)()
+	}
+
+	if s.incident != nil {
+		defer func() {
+			if v := recover(); v != nil {
+				s.reportStack(t, IncidentPanic, req, fmt.Errorf("%v", v), debug.Stack())
+				resp = nil
+				err = NewError(CodeInternalError, fmt.Sprint(v))
+			}
+		}()
+	}
+
+	validator := s.validator
+	if h.validator != nil {
+		validator = h.validator
+		if s.validator != nil {
+			validator = func(v interface{}) error {
+				if err := s.validator(v); err != nil {
+					return err
+				}
+				return h.validator(v)
+			}
+		}
+	}
+
+	out, err := h.exec(ctx, req, validator)
+	if err != nil || out == nil {
+		return nil, err
+	}
+
+	if len(h.processors) > 0 {
+		if out, err = h.process(Peer{Addr: peerOf(t), Identity: req.identity}, req, out); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp, err = h.encode(req, out); err != nil {
+		s.report(t, IncidentEncode, req, err)
+	}
+	return resp, err
+}
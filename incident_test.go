@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var (
+	_ peer = &streamTransport{}
+	_ peer = &websocketTransport{}
+	_ peer = &httpTransport{}
+)
+
+// 写入总是失败的 Transport
+type failedWriter struct{}
+
+func (w failedWriter) Write([]byte) (int, error) { return 0, errors.New("failed") }
+
+func TestServer_IncidentHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.True(srv.Register("panic", func(notify bool, in, out *int) error {
+		panic("panic")
+	}))
+	a.True(srv.Register("nan", func(notify bool, in *int, out *float64) error {
+		*out = math.NaN()
+		return nil
+	}))
+
+	// 未指定 IncidentHandler，panic 照常向上传递。
+	req, err := srv.newRequest(false, "panic", 1)
+	a.NotError(err)
+	a.Panic(func() {
+		srv.response(NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil), req)
+	})
+
+	var incident *Incident
+	srv.IncidentHandler(func(i *Incident) { incident = i })
+
+	call := func(t Transport, method string) *body {
+		incident = nil
+		req, err := srv.newRequest(false, method, 1)
+		a.NotError(err)
+		srv.response(t, req)
+		return req
+	}
+
+	out := new(bytes.Buffer)
+	req = call(NewStreamTransport(false, new(bytes.Buffer), out, nil), "panic")
+	a.NotNil(incident).
+		Equal(incident.Kind, IncidentPanic).
+		Equal(incident.Method, "panic").
+		Equal(incident.ID, req.ID).
+		Equal(incident.Err.Error(), "panic").
+		NotEmpty(incident.Stack).
+		True(errors.As(incident.Err, new(*ApplicationError))).
+		False(incident.Time.IsZero())
+	resp := &body{}
+	a.NotError(json.Unmarshal(out.Bytes(), resp)).
+		Equal(resp.Error.Code, CodeInternalError)
+
+	call(NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil), "nan")
+	a.NotNil(incident).
+		Equal(incident.Kind, IncidentEncode).
+		Empty(incident.Stack)
+
+	call(NewStreamTransport(false, new(bytes.Buffer), failedWriter{}, nil), "f1")
+	a.NotNil(incident).
+		Equal(incident.Kind, IncidentWrite).
+		Equal(incident.Err.Error(), "failed").
+		True(errors.As(incident.Err, new(*TransportError)))
+
+	// 正常请求不会触发
+	call(NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil), "f1")
+	a.Nil(incident)
+
+	// Peer
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(io.Discard, c2)
+	call(NewSocketTransport(false, c1, 0), "nan")
+	a.NotNil(incident).Equal(incident.Peer, "pipe")
+
+	a.Equal(IncidentPanic.String(), "panic").
+		Equal(IncidentEncode.String(), "encode").
+		Equal(IncidentWrite.String(), "write").
+		Equal(IncidentKind(10).String(), "<unknown>")
+}
+
+func TestServer_WriteErrHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	failures := make([]*WriteFailure, 0, 10)
+	srv.WriteErrHandler(func(f *WriteFailure) { failures = append(failures, f) })
+
+	in := new(bytes.Buffer)
+	transport := NewStreamTransport(false, in, failedWriter{}, nil)
+
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{"Age":1}}`)
+	req, err := srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.Error(srv.response(transport, req)).
+		Length(failures, 1).
+		Equal(failures[0].ID.String(), "1").
+		Equal(string(failures[0].Result), `{"name":"","age":1}`).
+		Nil(failures[0].Error).
+		Equal(failures[0].Err.Error(), "failed")
+
+	in.WriteString(`{"jsonrpc":"2.0","id":"2","method":"not-exists"}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.Error(srv.response(transport, req)).
+		Length(failures, 2).
+		Equal(failures[1].ID.String(), "2").
+		Nil(failures[1].Result).
+		Equal(failures[1].Error.Code, CodeMethodNotFound)
+
+	// 无法解析的请求
+	in.WriteString(`{"jsonrpc":}`)
+	_, err = srv.read(transport)
+	a.Error(err).
+		Length(failures, 3).
+		Nil(failures[2].ID).
+		Equal(failures[2].Error.Code, CodeParseError)
+
+	// 有序输出
+	srvConn, clientConn := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, srvConn, 0), nil)
+	conn.Ordered(true)
+	failures = failures[:0]
+	a.NotError(srvConn.Close())
+	conn.serve(&body{Version: Version, ID: &ID{alpha: "3"}, Method: "f1"}, conn.seq.add())
+	a.Length(failures, 1).Equal(failures[0].ID.String(), "3")
+	clientConn.Close()
+}
+
+func TestOnceTransport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	var incident *Incident
+	srv.IncidentHandler(func(i *Incident) { incident = i })
+	failures := 0
+	srv.WriteErrHandler(func(*WriteFailure) { failures++ })
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go io.Copy(io.Discard, c2)
+
+	req := &body{Version: Version, ID: &ID{alpha: "1"}, Method: "f1"}
+	ot := &onceTransport{Transport: NewSocketTransport(false, c1, 0), s: srv, req: req}
+	a.Equal(ot.Peer(), "pipe")
+
+	a.NotError(srv.write(ot, &body{Version: Version, ID: req.ID}))
+	a.Nil(incident)
+
+	a.Equal(srv.write(ot, &body{Version: Version, ID: req.ID}), errDuplicateResponse)
+	a.NotNil(incident).
+		Equal(incident.Kind, IncidentDuplicate).
+		Equal(incident.ID, req.ID).
+		Equal(incident.Peer, "pipe").
+		Equal(failures, 0)
+
+	// 写入失败之后可以再次写入
+	out := &failedOnce{}
+	ot = &onceTransport{Transport: NewStreamTransport(false, new(bytes.Buffer), out, nil), s: srv, req: req}
+	a.Error(ot.Write(&body{Version: Version, ID: req.ID}))
+	a.NotError(ot.Write(&body{Version: Version, ID: req.ID}))
+	a.Equal(IncidentDuplicate.String(), "duplicate")
+}
+
+// 第一次写入失败
+type failedOnce struct {
+	failed bool
+}
+
+func (w *failedOnce) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+		return 0, errors.New("failed")
+	}
+	return len(p), nil
+}
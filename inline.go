@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// CallInline 发送请求并在当前的 goroutine 中等待返回数据
+//
+// 适用于命令行工具等只需要简单地请求并等待结果的场景，不需要在另一个 goroutine 中运行 [Conn.Serve]。
+// 写入请求之后会直接从传输层读取数据，直到读取到与请求对应的返回数据，
+// 期间读取到的通知、请求或是其它请求的返回数据，均按 [Conn.Serve] 的方式同步处理。
+//
+// out 为返回数据的解码对象，为空表示忽略返回数据；如果对方返回了错误，
+// 则返回包装了该 *[Error] 的 [ProtocolError] 或是 [ApplicationError]，写入失败时返回 [TransportError]。
+// opts 与 [Conn.Send] 中的含义相同。
+//
+// ctx 仅在读取数据的间隙检测，与 [Conn.Serve] 一样，可能会被 [Transport.Read] 阻塞，
+// 可以为传输层指定读取的超时时间以便及时响应 ctx 的取消。
+//
+// NOTE: 不能与 [Conn.Serve] 同时使用，也不能被并发调用。
+func (conn *Conn) CallInline(ctx context.Context, method string, in, out interface{}, opts ...CallOption) error {
+	req, err := conn.server.newRequest(false, method, in)
+	if err != nil {
+		return err
+	}
+	mctx, err := withDeadlineMargin(ctx, conn.deadlineMargin, conn.server.clock)
+	if err != nil {
+		return err
+	}
+	o := newCallOptions(opts)
+	v := o.apply(mctx, req, conn.server.clock)
+	if err := transportError(o.write(conn.transport, v, conn.server.clock)); err != nil {
+		conn.emit(EventWriteError, err, nil)
+		storeDeadLetter(conn.deadLetter, req.ID, method, v, err)
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		body, err := conn.server.read(conn.transport)
+		if err != nil {
+			err = readError(err)
+			conn.emit(EventReadError, err, nil)
+			return err
+		}
+		if body == nil {
+			continue
+		}
+
+		if !body.isRequest() && body.ID != nil && req.ID.Equal(body.ID) {
+			if body.Error != nil {
+				return remoteError(body.Error)
+			}
+			if out == nil || body.Result == nil {
+				return nil
+			}
+			return protocolError(json.Unmarshal(*body.Result, out))
+		}
+
+		var seq uint64
+		if conn.seq != nil && body.isRequest() {
+			seq = conn.seq.add()
+		}
+		conn.serve(body, seq)
+	}
+}
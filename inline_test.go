@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_CallInline(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	c1, c2 := net.Pipe()
+	server := srv.NewConn(NewSocketTransport(true, c1, 0), nil)
+	client := srv.NewConn(NewSocketTransport(true, c2, 0), nil)
+
+	// 在返回数据之前向客户端发送通知
+	notified := make(chan int, 1)
+	a.True(srv.Register("notified", func(notify bool, in *inType, out *outType) error {
+		notified <- in.Age
+		return nil
+	}))
+	a.True(srv.Register("trigger", func(notify bool, in *inType, out *outType) error {
+		out.Age = in.Age
+		return server.Notify("notified", in)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	out := &outType{}
+	a.NotError(client.CallInline(context.Background(), "f1", &inType{First: "f", Last: "l", Age: 1}, out)).
+		Equal(out, &outType{Name: "fl", Age: 1})
+
+	out = &outType{}
+	a.NotError(client.CallInline(context.Background(), "trigger", &inType{Age: 2}, out)).
+		Equal(out.Age, 2).
+		Equal(<-notified, 2)
+
+	a.NotError(client.CallInline(context.Background(), "f1", &inType{}, nil))
+
+	err := client.CallInline(context.Background(), "f2", &inType{}, out)
+	var e *Error
+	a.True(errors.As(err, &e)).Equal(e.Code, CodeInvalidParams)
+
+	canceled, cancelCall := context.WithCancel(context.Background())
+	cancelCall()
+	a.Equal(client.CallInline(canceled, "f1", &inType{}, out), context.Canceled)
+
+	cancel()
+	a.NotError(c2.Close())
+	<-exit
+	a.ErrorIs(client.CallInline(context.Background(), "f1", &inType{}, out), io.ErrClosedPipe)
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// 进程内的传输层
+type inProcessTransport struct {
+	in       <-chan interface{}
+	out      chan<- interface{}
+	done     chan struct{} // 任意一端关闭之后，两端都不能再读写。
+	once     *sync.Once
+	deepCopy bool
+}
+
+// NewInProcessTransport 创建一对用于进程内通讯的传输层
+//
+// 写入其中一个的数据，可以从另一个读取，分别用于客户端和服务端的 [Conn]，
+// 这样同一个服务既可以通过网络供远程调用，也可以在进程内以极低的延时调用。
+//
+// 消息以结构体的形式直接传递给对方，不会对消息整体进行编解码，
+// 但是参数和返回值依然是 JSON 格式，扩展字段以及截止时间等也会原样传递。
+// deepCopy 为 true 时，会复制参数、返回值以及错误信息等数据，双方不会共享任何内存；
+// 否则这些数据由双方共享，任何一方都不应该修改它们。
+//
+// 通过其调用的服务被视为 [ExposeInternal]。任意一端关闭之后，另一端的读取操作会返回 io.EOF。
+func NewInProcessTransport(deepCopy bool) (Transport, Transport) {
+	c1, c2 := make(chan interface{}), make(chan interface{})
+	done := make(chan struct{})
+	once := &sync.Once{}
+	return &inProcessTransport{in: c1, out: c2, done: done, once: once, deepCopy: deepCopy},
+		&inProcessTransport{in: c2, out: c1, done: done, once: once, deepCopy: deepCopy}
+}
+
+func (t *inProcessTransport) Read(v interface{}) error {
+	var msg interface{}
+	select {
+	case msg = <-t.in:
+	case <-t.done:
+		return io.EOF
+	}
+
+	src, ok := msg.(*body)
+	if !ok {
+		return json.Unmarshal(msg.(json.RawMessage), v)
+	}
+	if b, ok := v.(*batchBody); ok { // 单个对象不可能是批量请求
+		v = b.v
+	}
+
+	switch dst := v.(type) {
+	case *body:
+		*dst = *src
+		dst.extensions = nil // 未指定 [Server.KeepExtensions]
+		return nil
+	case *extBody:
+		*dst.body = *src
+		return nil
+	default: // 需要原始数据或是未知的类型，只能经过编解码。
+		data, err := json.Marshal(&extBody{body: src})
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+}
+
+func (t *inProcessTransport) Write(v interface{}) (err error) {
+	var msg interface{}
+	switch b := v.(type) {
+	case *body:
+		msg, err = t.copy(b)
+	case *extBody:
+		msg, err = t.copy(b.body)
+	default:
+		var data []byte
+		if data, err = json.Marshal(v); err == nil {
+			msg = json.RawMessage(data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	select {
+	case t.out <- msg:
+		return nil
+	case <-t.done:
+		return io.ErrClosedPipe
+	}
+}
+
+// 复制 b 中需要传递给对方的字段
+func (t *inProcessTransport) copy(b *body) (*body, error) {
+	c := &body{
+		Version:     b.Version,
+		ID:          b.ID,
+		Method:      b.Method,
+		Params:      b.Params,
+		Result:      b.Result,
+		Error:       b.Error,
+		TraceParent: b.TraceParent,
+		extensions:  b.extensions,
+		deadline:    b.deadline,
+	}
+	if !t.deepCopy {
+		return c, nil
+	}
+
+	if b.ID != nil {
+		id := *b.ID
+		c.ID = &id
+	}
+	c.Params = cloneRawMessage(b.Params)
+	c.Result = cloneRawMessage(b.Result)
+	if b.Error != nil {
+		e := *b.Error
+		if e.Data != nil {
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				return nil, err
+			}
+			e.Data = json.RawMessage(data)
+		}
+		c.Error = &e
+	}
+	if b.extensions != nil {
+		c.extensions = make(map[string]json.RawMessage, len(b.extensions))
+		for k, v := range b.extensions {
+			c.extensions[k] = append(json.RawMessage(nil), v...)
+		}
+	}
+	return c, nil
+}
+
+func (t *inProcessTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+func cloneRawMessage(m *json.RawMessage) *json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	c := append(json.RawMessage(nil), *m...)
+	return &c
+}
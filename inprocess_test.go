@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Transport = &inProcessTransport{}
+
+func TestNewInProcessTransport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	t1, t2 := NewInProcessTransport(true)
+	server := srv.NewConn(t1, nil)
+	client := srv.NewConn(t2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	result := make(chan *outType, 1)
+	a.NotError(client.Send("f1", &inType{First: "f", Last: "l", Age: 5}, func(out *outType) error {
+		result <- out
+		return nil
+	}))
+	a.Equal(<-result, &outType{Name: "fl", Age: 5})
+
+	errs := make(chan *Error, 1)
+	srv.ErrHandler(func(err *Error) { errs <- err })
+	a.NotError(client.Send("f2", &inType{}, func(*outType) error { return nil }))
+	a.Equal((<-errs).Code, CodeInvalidParams)
+
+	cancel()
+	a.NotError(t1.Close())
+	<-exit
+	<-exit
+}
+
+func TestInProcessTransport(t *testing.T) {
+	a := assert.New(t, false)
+
+	params := json.RawMessage(`{"age":1}`)
+	req := &body{
+		Version:    Version,
+		ID:         NewNumberID(1),
+		Method:     "f1",
+		Params:     &params,
+		extensions: map[string]json.RawMessage{"tenant": json.RawMessage(`"t1"`)},
+		deadline:   time.Now().Add(time.Minute),
+	}
+
+	write := func(t Transport, v interface{}) {
+		go func() { a.NotError(t.Write(v)) }()
+	}
+
+	// 共享数据
+	t1, t2 := NewInProcessTransport(false)
+	write(t1, req)
+	b := &body{}
+	a.NotError(t2.Read(b)).
+		Equal(b.Method, "f1").
+		True(b.Params == req.Params).
+		Equal(b.deadline, req.deadline).
+		Nil(b.extensions)
+
+	write(t1, &extBody{body: req})
+	b = &body{}
+	a.NotError(t2.Read(&extBody{body: b})).
+		Equal(b.extensions, req.extensions)
+
+	// 需要原始数据
+	write(t1, req)
+	b = &body{}
+	a.NotError(t2.Read(&rawBody{v: &extBody{body: b}, body: b})).
+		Equal(b.Method, "f1").
+		Equal(b.extensions, req.extensions).
+		Contains(string(b.raw), `"tenant":"t1"`)
+
+	// 非 *body 的对象
+	write(t2, json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"f2"}`))
+	b = &body{}
+	a.NotError(t1.Read(b)).
+		Equal(b.Method, "f2").
+		Equal(b.ID, NewNumberID(2))
+
+	a.NotError(t1.Close())
+	a.Equal(t2.Read(&body{}), io.EOF).
+		Equal(t2.Write(req), io.ErrClosedPipe).
+		NotError(t2.Close())
+
+	// 复制数据
+	t1, t2 = NewInProcessTransport(true)
+	write(t1, req)
+	b = &body{}
+	a.NotError(t2.Read(&extBody{body: b})).
+		True(b.Params != req.Params).
+		Equal(b.Params, req.Params).
+		Equal(b.extensions, req.extensions)
+
+	write(t2, &body{Version: Version, ID: NewNumberID(1), Error: NewErrorWithData(CodeInternalError, "error", &outType{Name: "n"})})
+	b = &body{}
+	a.NotError(t1.Read(b)).
+		Equal(b.Error.Data, json.RawMessage(`{"name":"n","age":0}`))
+	a.NotError(t1.Close())
+}
+
+func BenchmarkInProcessTransport(b *testing.B) {
+	a := assert.New(b, false)
+	params := json.RawMessage(`{"age":1}`)
+	req := &body{Version: Version, ID: NewNumberID(1), Method: "f1", Params: &params}
+
+	t1, t2 := NewInProcessTransport(false)
+	defer t1.Close()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if err := t1.Write(req); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		a.NotError(t2.Read(&body{}))
+	}
+}
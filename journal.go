@@ -0,0 +1,363 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JournalEntry 请求日志中的记录
+type JournalEntry struct {
+	// 请求的 ID
+	ID string `json:"id"`
+
+	// 请求的服务名
+	Method string `json:"method"`
+
+	// 请求的完整内容
+	Data json.RawMessage `json:"data"`
+}
+
+// Journal 客户端的请求日志
+//
+// 通过 [Conn.Journal] 指定之后，由 [Conn.Send] 等方法发送的请求，
+// 在发送之前会先写入日志，收到返回数据之后再标记为已完成，
+// 进程重启之后可以通过 [Conn.Replay] 重新发送所有未完成的请求，
+// 以实现请求至少送达一次的保证。
+//
+// 所有的方法都可能被并发调用。
+type Journal interface {
+	// Append 写入一条请求记录
+	//
+	// 返回之前应该保证 e 已经被持久化。
+	Append(e *JournalEntry) error
+
+	// Done 将 id 对应的请求标记为已完成
+	Done(id string) error
+
+	// Pending 按写入顺序返回所有未完成的请求
+	Pending() ([]*JournalEntry, error)
+}
+
+// FileJournal 基于文件的 [Journal] 实现
+//
+// 每条记录占用文件中的一行，打开时会清除已经完成的记录。
+type FileJournal struct {
+	mux     sync.Mutex
+	path    string
+	f       *os.File
+	pending map[string]*JournalEntry
+	order   []string
+	aead    cipher.AEAD // 不为空表示需要加密
+}
+
+// 日志文件中单行记录的最大长度
+const maxJournalLineSize = 32 << 20
+
+var errJournalDecrypt = errors.New("无法解密请求日志，密钥错误或是内容已经被修改")
+
+// 日志文件中的单行记录
+type journalLine struct {
+	*JournalEntry
+	Done string `json:"done,omitempty"`
+}
+
+// NewFileJournal 打开或是创建 path 指定的请求日志文件
+func NewFileJournal(path string) (*FileJournal, error) {
+	return newFileJournal(path, nil)
+}
+
+// NewEncryptedFileJournal 打开或是创建 path 指定的加密请求日志文件
+//
+// 请求中可能包含密码等敏感信息，此函数创建的日志会以 AES-GCM 加密每一行记录，
+// 避免以明文的形式保存在磁盘上。key 为 AES 的密钥，长度只能是 16、24 或 32，
+// 打开已有的文件时必须与创建时的密钥相同，否则返回错误。
+func NewEncryptedFileJournal(path string, key []byte) (*FileJournal, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return newFileJournal(path, aead)
+}
+
+func newFileJournal(path string, aead cipher.AEAD) (*FileJournal, error) {
+	j := &FileJournal{
+		path:    path,
+		pending: map[string]*JournalEntry{},
+		aead:    aead,
+	}
+
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// 从文件中加载未完成的记录
+func (j *FileJournal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), maxJournalLineSize)
+	var decryptErr error
+	for s.Scan() {
+		// 只有最后一行可能因为进程中断而不完整，之前的行无法解密说明密钥错误。
+		if decryptErr != nil {
+			return decryptErr
+		}
+
+		data, err := j.decrypt(s.Bytes())
+		if err != nil {
+			decryptErr = err
+			continue
+		}
+
+		l := &journalLine{}
+		if err := json.Unmarshal(data, l); err != nil {
+			// 最后一行可能因为进程中断而不完整，忽略即可。
+			continue
+		}
+
+		switch {
+		case l.Done != "":
+			delete(j.pending, l.Done)
+		case l.JournalEntry != nil:
+			if _, found := j.pending[l.ID]; !found {
+				j.order = append(j.order, l.ID)
+			}
+			j.pending[l.ID] = l.JournalEntry
+		}
+	}
+	return s.Err()
+}
+
+// 仅保留未完成的记录，重新生成日志文件。
+func (j *FileJournal) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	order := make([]string, 0, len(j.pending))
+	w := bufio.NewWriter(tmp)
+	for _, id := range j.order {
+		e, found := j.pending[id]
+		if !found {
+			continue
+		}
+		order = append(order, id)
+		if err = j.writeLine(w, &journalLine{JournalEntry: e}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), j.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	j.order = order
+
+	j.f, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0)
+	return err
+}
+
+func (j *FileJournal) writeLine(w io.Writer, l *journalLine) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if data, err = j.encrypt(data); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// 加密单行记录
+//
+// 内容为 base64 编码的随机数与密文，以保证记录中不会出现换行符。
+func (j *FileJournal) encrypt(data []byte) ([]byte, error) {
+	if j.aead == nil {
+		return data, nil
+	}
+
+	nonce := make([]byte, j.aead.NonceSize(), j.aead.NonceSize()+len(data)+j.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := j.aead.Seal(nonce, nonce, data, nil)
+
+	dst := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(dst, sealed)
+	return dst, nil
+}
+
+func (j *FileJournal) decrypt(line []byte) ([]byte, error) {
+	if j.aead == nil {
+		return line, nil
+	}
+
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(data, line)
+	if err != nil || n < j.aead.NonceSize() {
+		return nil, errJournalDecrypt
+	}
+	data = data[:n]
+
+	size := j.aead.NonceSize()
+	if data, err = j.aead.Open(nil, data[:size], data[size:], nil); err != nil {
+		return nil, errJournalDecrypt
+	}
+	return data, nil
+}
+
+func (j *FileJournal) Append(e *JournalEntry) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if err := j.writeLine(j.f, &journalLine{JournalEntry: e}); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+
+	if _, found := j.pending[e.ID]; !found {
+		j.order = append(j.order, e.ID)
+	}
+	j.pending[e.ID] = e
+	return nil
+}
+
+// Done 将 id 对应的请求标记为已完成
+//
+// 为了性能考虑，不会等待数据写入磁盘，
+// 这可能导致进程意外中断之后，已经完成的请求被再次发送。
+func (j *FileJournal) Done(id string) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if _, found := j.pending[id]; !found {
+		return nil
+	}
+	delete(j.pending, id)
+	return j.writeLine(j.f, &journalLine{Done: id})
+}
+
+func (j *FileJournal) Pending() ([]*JournalEntry, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	entries := make([]*JournalEntry, 0, len(j.pending))
+	for _, id := range j.order {
+		if e, found := j.pending[id]; found {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Close 关闭日志文件
+func (j *FileJournal) Close() error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.f.Close()
+}
+
+// Journal 指定请求日志
+//
+// 指定之后，通过 [Conn.Send] 和 [Conn.SendContext] 发送的请求会先写入 j，
+// 在收到返回数据（包括错误信息）之后再标记为完成。写入失败的请求依然保留在日志中。
+// 通知不需要对方返回数据，所以不会写入日志。
+//
+// NOTE: 需要在 [Conn.Send] 和 [Conn.Serve] 之前调用。
+func (conn *Conn) Journal(j Journal) { conn.journal = j }
+
+// Replay 重新发送请求日志中所有未完成的请求
+//
+// 一般在进程重启并重新建立连接之后调用。由于原来的回调函数已经不存在，
+// 这些请求的返回数据统一交由 f 处理，method 为请求的服务名，result 为返回的数据；
+// 返回错误信息的请求与普通请求相同，由 [Server.ErrHandler] 处理。
+//
+// 如果未指定请求日志，则不作任何操作。
+func (conn *Conn) Replay(f func(method string, result *json.RawMessage) error) error {
+	if conn.journal == nil {
+		return nil
+	}
+
+	entries, err := conn.journal.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		method := e.Method
+		cb := newCallback(func(result *json.RawMessage) error { return f(method, result) })
+
+		id := NewStringID(e.ID)
+		if !conn.callbacks.Store(id, &pending{ctx: context.WithValue(context.Background(), valuesKey{}, &conn.values), method: method, cb: cb, id: id, req: e.Data}) {
+			continue // 已经在等待返回数据
+		}
+		if err := conn.transport.Write(e.Data); err != nil {
+			conn.callbacks.Delete(id)
+			return err
+		}
+	}
+	return nil
+}
+
+// 将请求写入日志
+func (conn *Conn) appendJournal(req *body, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.journal.Append(&JournalEntry{ID: req.ID.String(), Method: req.Method, Data: data})
+}
+
+// 将返回数据对应的请求标记为完成
+func (conn *Conn) doneJournal(resp *body) {
+	if conn.journal == nil || resp.ID == nil {
+		return
+	}
+	if err := conn.journal.Done(resp.ID.String()); err != nil {
+		conn.printErr(err)
+	}
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Journal = &FileJournal{}
+
+func TestFileJournal(t *testing.T) {
+	a := assert.New(t, false)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := NewFileJournal(path)
+	a.NotError(err).NotNil(j)
+	entries, err := j.Pending()
+	a.NotError(err).Empty(entries)
+
+	a.NotError(j.Append(&JournalEntry{ID: "1", Method: "m1", Data: json.RawMessage(`{"id":"1"}`)})).
+		NotError(j.Append(&JournalEntry{ID: "2", Method: "m2", Data: json.RawMessage(`{"id":"2"}`)})).
+		NotError(j.Append(&JournalEntry{ID: "3", Method: "m3", Data: json.RawMessage(`{"id":"3"}`)})).
+		NotError(j.Done("2")).
+		NotError(j.Done("not-exists"))
+	entries, err = j.Pending()
+	a.NotError(err).Length(entries, 2).
+		Equal(entries[0].ID, "1").
+		Equal(entries[1].ID, "3")
+	a.NotError(j.Close())
+
+	// 模拟进程中断时写入了不完整的行
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	a.NotError(err)
+	_, err = f.WriteString(`{"id":"4","met`)
+	a.NotError(err).NotError(f.Close())
+
+	// 重新打开
+	j, err = NewFileJournal(path)
+	a.NotError(err).NotNil(j)
+	entries, err = j.Pending()
+	a.NotError(err).Length(entries, 2).
+		Equal(entries[0].Method, "m1").
+		Equal(string(entries[1].Data), `{"id":"3"}`)
+
+	// 已经压缩
+	data, err := os.ReadFile(path)
+	a.NotError(err).
+		Equal(bytes.Count(data, []byte("\n")), 2).
+		NotContains(string(data), "done")
+
+	a.NotError(j.Done("1")).NotError(j.Close())
+	j, err = NewFileJournal(path)
+	a.NotError(err).NotNil(j)
+	entries, err = j.Pending()
+	a.NotError(err).Length(entries, 1).Equal(entries[0].ID, "3")
+	a.NotError(j.Close())
+}
+
+func TestConn_Journal(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := NewFileJournal(path)
+	a.NotError(err)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	conn.Journal(j)
+
+	a.NotError(conn.Send("f1", &inType{Age: 1}, func(*outType) error { return nil }))
+	a.NotError(conn.Send("f2", &inType{Age: 2}, func(*outType) error { return nil }))
+	a.NotError(conn.Notify("f3", nil))
+	entries, err := j.Pending()
+	a.NotError(err).Length(entries, 2)
+
+	// 返回错误信息同样标记为完成
+	req := &body{}
+	a.NotError(json.Unmarshal(entries[0].Data, req))
+	conn.serve(&body{Version: Version, ID: req.ID, Error: NewError(CodeInternalError, "error")}, 0)
+	entries, err = j.Pending()
+	a.NotError(err).Length(entries, 1).Equal(entries[0].Method, "f2")
+	a.NotError(j.Close())
+
+	// 重启之后重新发送
+	j, err = NewFileJournal(path)
+	a.NotError(err)
+	out.Reset()
+	conn = srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	conn.Journal(j)
+
+	var method, result string
+	a.NotError(conn.Replay(func(m string, r *json.RawMessage) error {
+		method = m
+		result = string(*r)
+		return nil
+	}))
+	a.Equal(out.String(), string(entries[0].Data))
+
+	raw := json.RawMessage(`{"age":2}`)
+	conn.serve(&body{Version: Version, ID: NewStringID(entries[0].ID), Result: &raw}, 0)
+	a.Equal(method, "f2").Equal(result, `{"age":2}`)
+	entries, err = j.Pending()
+	a.NotError(err).Empty(entries)
+	a.NotError(j.Close())
+
+	// 未指定日志
+	conn = srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	a.NotError(conn.Replay(nil))
+}
+
+func TestNewEncryptedFileJournal(t *testing.T) {
+	a := assert.New(t, false)
+	path := filepath.Join(t.TempDir(), "journal")
+	key := bytes.Repeat([]byte{1}, 32)
+
+	j, err := NewEncryptedFileJournal(path, []byte("short"))
+	a.Error(err).Nil(j)
+
+	j, err = NewEncryptedFileJournal(path, key)
+	a.NotError(err).NotNil(j)
+	a.NotError(j.Append(&JournalEntry{ID: "1", Method: "login", Data: json.RawMessage(`{"password":"secret"}`)})).
+		NotError(j.Append(&JournalEntry{ID: "2", Method: "m2", Data: json.RawMessage(`{"id":"2"}`)})).
+		NotError(j.Done("2")).
+		NotError(j.Close())
+
+	data, err := os.ReadFile(path)
+	a.NotError(err).
+		NotContains(string(data), "secret").
+		NotContains(string(data), "login")
+
+	// 模拟进程中断时写入了不完整的行
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	a.NotError(err)
+	_, err = f.WriteString(`AAAA`)
+	a.NotError(err).NotError(f.Close())
+
+	j, err = NewEncryptedFileJournal(path, key)
+	a.NotError(err).NotNil(j)
+	entries, err := j.Pending()
+	a.NotError(err).Length(entries, 1).
+		Equal(entries[0].Method, "login").
+		Equal(string(entries[0].Data), `{"password":"secret"}`)
+	a.NotError(j.Append(&JournalEntry{ID: "3", Method: "m3", Data: json.RawMessage(`{"id":"3"}`)})).
+		NotError(j.Close())
+
+	// 密钥错误
+	j, err = NewEncryptedFileJournal(path, bytes.Repeat([]byte{2}, 32))
+	a.ErrorIs(err, errJournalDecrypt).Nil(j)
+
+	// 以明文的方式打开
+	j, err = NewFileJournal(path)
+	a.NotError(err).NotNil(j)
+	entries, err = j.Pending()
+	a.NotError(err).Empty(entries)
+	a.NotError(j.Close())
+}
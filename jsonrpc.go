@@ -8,9 +8,11 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strconv"
+	"time"
 )
 
 // Version JSON RPC 的版本
@@ -23,13 +25,24 @@ const (
 	CodeMethodNotFound = -32601
 	CodeInvalidParams  = -32602
 	CodeInternalError  = -32603
+
+	// 以下为 -32000 至 -32099 之间由实现自定义的服务端错误
+
+	CodeServerBusy = -32000 // 服务繁忙，超过了并发限制
+	CodeTimeout    = -32001 // 服务执行超时
+	CodeStale      = -32002 // 请求已经超过了其有效期
+	CodeReplay     = -32003 // 重放的请求，参考 [Server.ReplayWindow]。
+	CodeTooLarge   = -32004 // 请求的数据过大，参考 [Conn.MaxMessageSize]。
 )
 
 // 一些错误定义
 var (
-	errInvalidHeader      = errors.New("无效的报头格式")
-	errInvalidContentType = errors.New("无效的报头 Content-Type")
-	errMissContentLength  = errors.New("缺少 Content-Length 报头")
+	errInvalidHeader       = errors.New("无效的报头格式")
+	errInvalidContentType  = errors.New("无效的报头 Content-Type")
+	errMissContentLength   = errors.New("缺少 Content-Length 报头")
+	errHeaderTooLarge      = errors.New("报头过大")
+	errUnsupportedEncoding = errors.New("不支持的 Content-Encoding")
+	errDuplicateResponse   = errors.New("已经返回过数据")
 )
 
 // Error JSON-RPC 返回的错误类型
@@ -51,6 +64,35 @@ type ID struct {
 	isNumber bool
 }
 
+// NewNumberID 声明数值类型的 ID
+func NewNumberID(v int64) *ID { return &ID{number: v, isNumber: true} }
+
+// NewStringID 声明字符串类型的 ID
+func NewStringID(v string) *ID { return &ID{alpha: v} }
+
+// IsNumber 是否为数值类型的 ID
+func (id *ID) IsNumber() bool { return id.isNumber }
+
+// Number 返回数值类型的 ID 值
+//
+// 如果不是数值类型，则返回 0。
+func (id *ID) Number() int64 {
+	if id.isNumber {
+		return id.number
+	}
+	return 0
+}
+
+// Alpha 返回字符串类型的 ID 值
+//
+// 如果不是字符串类型，则返回空值。
+func (id *ID) Alpha() string {
+	if id.isNumber {
+		return ""
+	}
+	return id.alpha
+}
+
 // Equal 两个 ID 是否相等
 func (id *ID) Equal(val *ID) bool {
 	if id.isNumber != val.isNumber {
@@ -63,6 +105,26 @@ func (id *ID) Equal(val *ID) bool {
 	return id.alpha == val.alpha
 }
 
+// IDKey [ID] 的可比较形式
+//
+// 可以作为 map 的键名，数值 1 与字符串 "1" 对应不同的值。
+type IDKey struct {
+	number   int64
+	alpha    string
+	isNumber bool
+}
+
+// Key 返回 ID 的可比较形式
+//
+// 与 [ID.String] 不同，返回值区分了数值和字符串类型的 ID，
+// 在需要以 ID 作为键名时，应该使用此方法。
+func (id *ID) Key() IDKey {
+	if id.isNumber {
+		return IDKey{number: id.number, isNumber: true}
+	}
+	return IDKey{alpha: id.alpha}
+}
+
 // MarshalJSON json.Marshaler.MarshalJSON
 func (id *ID) MarshalJSON() ([]byte, error) {
 	if id.isNumber {
@@ -131,10 +193,87 @@ type body struct {
 
 	// 失败时的返回结果，如果成功，则不应该输出该对象。
 	Error *Error `json:"error,omitempty"`
+
+	// W3C Trace Context 中的 traceparent，非规范定义的字段。
+	//
+	// 请求时由客户端通过 [WithTraceParent] 指定，服务端原样附加在返回数据中。
+	TraceParent string `json:"traceparent,omitempty"`
+
+	// 扩展字段，仅在 [Server.KeepExtensions] 为 true 时才会有值。
+	extensions map[string]json.RawMessage
+
+	// 请求的截止时间，由带报头的传输层通过 X-Timeout 报头传递。
+	deadline time.Time
+
+	// 发送请求时指定的选项，可能为空。
+	opts *callOptions
+
+	// 请求的原始数据，仅在指定了 [Server.RawHandler] 或 [Server.UnroutedHandler] 时才会有值。
+	raw []byte
+
+	// 请求方的身份信息，参考 [Peer.Identity]。
+	identity interface{}
+
+	// 请求所在的连接，通过 HTTP 请求时为空。
+	conn *Conn
+
+	// 请求的上下文，连接断开或是 HTTP 请求结束时取消，可能为空。
+	ctx context.Context
+
+	// 批量请求中的各个元素，仅在读取到的是 JSON 数组时才有值，此时其它字段均为空。
+	batch []json.RawMessage
+
+	// 请求来自哪种传输层，为 0 时表示 [ExposeSocket]。
+	via Exposure
+
+	// 从传输层读取完成的时间，仅在指定了 [Conn.OnReadFrame] 等函数时才会有值。
+	received time.Time
+
+	// 是否为由 [MirrorServer] 复制的请求，此类请求不会被再次复制。
+	mirrored bool
+}
+
+// 从传输层读写的对象中获取 *body
+func bodyOf(v interface{}) *body {
+	switch b := v.(type) {
+	case *body:
+		return b
+	case *extBody:
+		return b.body
+	case *rawBody:
+		return b.body
+	case *batchBody:
+		return b.body
+	case *tapBody:
+		return bodyOf(b.v)
+	case *strictBody:
+		return bodyOf(b.v)
+	default:
+		return nil
+	}
+}
+
+func hasDeadline(v interface{}) bool {
+	b := bodyOf(v)
+	return b != nil && !b.deadline.IsZero()
 }
 
 func (b *body) isRequest() bool {
-	return b.Method != "" || b.Params != nil
+	return b.Method != "" || b.Params != nil || b.batch != nil
+}
+
+// 数据中 params 和 result 所占的字节数，批量请求则为各个元素的字节数之和。
+func (b *body) size() (size int64) {
+	if b.Params != nil {
+		size += int64(len(*b.Params))
+	}
+	if b.Result != nil {
+		size += int64(len(*b.Result))
+	}
+	for _, item := range b.batch {
+		size += int64(len(item))
+	}
+	return size
 }
 
 func (b *body) isEmptyRequest() bool {
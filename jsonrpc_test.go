@@ -102,6 +102,25 @@ func TestID_UnmarshalJSON(t *testing.T) {
 	a.Nil(req.ID)
 }
 
+func TestID_Key(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Equal(NewNumberID(1).Key(), NewNumberID(1).Key()).
+		Equal(NewStringID("1").Key(), NewStringID("1").Key()).
+		NotEqual(NewNumberID(1).Key(), NewStringID("1").Key()).
+		NotEqual(NewNumberID(0).Key(), NewStringID("").Key())
+
+	// 解码之后的值
+	id1, id2 := &ID{}, &ID{}
+	a.NotError(id1.UnmarshalJSON([]byte(`"abc"`))).
+		NotError(id1.UnmarshalJSON([]byte(`5`))).
+		NotError(id2.UnmarshalJSON([]byte(`5`))).
+		Equal(id1.Key(), id2.Key())
+
+	m := map[IDKey]int{NewNumberID(1).Key(): 1, NewStringID("1").Key(): 2}
+	a.Length(m, 2).Equal(m[NewNumberID(1).Key()], 1)
+}
+
 func TestID_String(t *testing.T) {
 	a := assert.New(t, false)
 
@@ -114,3 +133,25 @@ func TestID_String(t *testing.T) {
 	id.number = -133
 	a.Equal(id.String(), "-133")
 }
+
+func TestNewID(t *testing.T) {
+	a := assert.New(t, false)
+
+	id := NewNumberID(-5)
+	a.True(id.IsNumber()).
+		Equal(id.Number(), -5).
+		Empty(id.Alpha()).
+		Equal(id.String(), "-5")
+	data, err := json.Marshal(id)
+	a.NotError(err).Equal(string(data), "-5")
+
+	id = NewStringID("5")
+	a.False(id.IsNumber()).
+		Equal(id.Number(), 0).
+		Equal(id.Alpha(), "5").
+		Equal(id.String(), "5")
+	data, err = json.Marshal(id)
+	a.NotError(err).Equal(string(data), `"5"`)
+
+	a.False(NewNumberID(5).Equal(NewStringID("5")))
+}
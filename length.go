@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLengthMismatch Content-Length 与实际内容的长度不符
+//
+// 由 [NewStrictStreamTransport] 等开启了长度检测的传输层返回，
+// 具体的长度信息可以通过 errors.As 转换为 *[LengthMismatchError] 获取。
+var ErrLengthMismatch = errors.New("Content-Length 与内容的长度不符")
+
+// LengthMismatchError Content-Length 与实际内容的长度不符时返回的错误
+type LengthMismatchError struct {
+	// 报头中 Content-Length 的值
+	Expected int64
+
+	// 实际的 JSON 内容的长度
+	//
+	// 如果 Content-Length 过小，且无法从已经缓存的数据中确定 JSON 的结束位置，则为 -1。
+	Actual int64
+}
+
+func (e *LengthMismatchError) Error() string {
+	if e.Actual < 0 {
+		return fmt.Sprintf("%s：Content-Length 为 %d，内容不完整", ErrLengthMismatch, e.Expected)
+	}
+	return fmt.Sprintf("%s：Content-Length 为 %d，实际为 %d", ErrLengthMismatch, e.Expected, e.Actual)
+}
+
+func (e *LengthMismatchError) Is(target error) bool { return target == ErrLengthMismatch }
+
+// NewStrictStreamTransport 返回严格检测 Content-Length 的基于流的 Transport 实例
+//
+// Content-Length 与实际内容不符时，默认的实现只会在解码时返回难以理解的 JSON 错误。
+// 此函数返回的对象在读取 Content-Length 指定的字节之后，会检测 JSON 是否恰好在这些字节内结束，
+// 否则返回 *[LengthMismatchError]。
+// 由于无法预知对方会发送多少数据，Content-Length 大于实际的内容时，
+// 依然会等待后续的数据，直到读满 Content-Length 之后才能检测到错误。
+//
+// 返回的对象始终是带报头的，压缩之后的内容由解压时检测其完整性。
+func NewStrictStreamTransport(in io.Reader, out io.Writer, close func() error) Transport {
+	t := NewStreamTransport(true, in, out, close).(*streamTransport)
+	t.strictLength = true
+	return t
+}
+
+// 检测 data 是否为恰好在结尾处结束的 JSON
+//
+// 只能在 s.inMux 的保护下调用。
+func (s *streamTransport) checkLength(data []byte) error {
+	end, err := jsonEnd(data)
+	switch {
+	case err == nil:
+		if len(bytes.TrimSpace(data[end:])) > 0 {
+			return &LengthMismatchError{Expected: int64(len(data)), Actual: int64(end)}
+		}
+		return nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// Content-Length 过小，尝试从已经缓存但未读取的数据中查找 JSON 的结束位置。
+		actual := int64(-1)
+		if peek, _ := s.buffer.Peek(s.buffer.Buffered()); len(peek) > 0 {
+			all := make([]byte, 0, len(data)+len(peek))
+			if end, err := jsonEnd(append(append(all, data...), peek...)); err == nil {
+				actual = int64(end)
+			}
+		}
+		return &LengthMismatchError{Expected: int64(len(data)), Actual: actual}
+	default:
+		return err
+	}
+}
+
+// 返回 data 中第一个 JSON 值的结束位置
+func jsonEnd(data []byte) (int, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	var v json.RawMessage
+	if err := d.Decode(&v); err != nil {
+		if err == io.EOF { // 没有任何内容
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return int(d.InputOffset()), nil
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestNewStrictStreamTransport(t *testing.T) {
+	a := assert.New(t, false)
+
+	read := func(data string) error {
+		tr := NewStrictStreamTransport(strings.NewReader(data), new(bytes.Buffer), nil)
+		return tr.Read(&body{})
+	}
+	mismatch := func(err error) *LengthMismatchError {
+		a.ErrorIs(err, ErrLengthMismatch)
+		var e *LengthMismatchError
+		a.True(errors.As(err, &e))
+		return e
+	}
+
+	a.NotError(read("Content-Length: 2\r\n\r\n{}"))
+	a.NotError(read("Content-Length: 4\r\n\r\n {}\n"))
+
+	// Content-Length 过大
+	e := mismatch(read("Content-Length: 10\r\n\r\n{}Content-Length: 2\r\n\r\n{}"))
+	a.Equal(e.Expected, 10).Equal(e.Actual, 2).Contains(e.Error(), "10")
+
+	// Content-Length 过小
+	e = mismatch(read(`Content-Length: 5` + "\r\n\r\n" + `{"a":1}`))
+	a.Equal(e.Expected, 5).Equal(e.Actual, 7)
+
+	e = mismatch(read(`Content-Length: 5` + "\r\n\r\n" + `{"a":`))
+	a.Equal(e.Expected, 5).Equal(e.Actual, -1).Contains(e.Error(), "不完整")
+
+	// 非长度的错误
+	err := read("Content-Length: 2\r\n\r\n{]")
+	a.Error(err).False(errors.Is(err, ErrLengthMismatch))
+
+	// 未开启严格检测
+	tr := NewStreamTransport(true, strings.NewReader("Content-Length: 10\r\n\r\n{}Content-"), nil, nil)
+	err = tr.Read(&body{})
+	a.Error(err).False(errors.Is(err, ErrLengthMismatch))
+}
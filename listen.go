@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errReusePortUnsupported = errors.New("当前系统不支持 SO_REUSEPORT")
+
+// ListenOptions [Server.ListenAndServe] 的参数
+type ListenOptions struct {
+	// 是否带报头，与 [NewSocketTransport] 的 header 参数相同。
+	Header bool
+
+	// 读取数据的超时时间，与 [NewSocketTransport] 的 timeout 参数相同。
+	//
+	// 为 0 时，在 ctx 取消之后，连接需要等到对方下一次发送数据才能退出。
+	Timeout time.Duration
+
+	// 应用于每个连接的参数，可以为空。
+	Socket *SocketOptions
+
+	// 以 SO_REUSEPORT 打开的监听数量
+	//
+	// 每个监听都有独立的 Accept 循环，由内核在各个监听之间分配新的连接，
+	// 可以减少大量短连接时 Accept 的竞争。
+	// 小于 0 表示与 CPU 的数量相同，0 和 1 表示只打开一个普通的监听。
+	// 仅支持 linux 和 BSD 系列的系统，在其它系统上启用会返回错误。
+	ReusePort int
+
+	// 与 [Server.NewConn] 的 errlog 参数相同，同时也用于输出 Accept 的错误。
+	ErrLog *log.Logger
+
+	// 在每个连接开始服务之前调用，可用于对 [Conn] 作一些设置，比如 [Conn.Ordered] 等。
+	Conn func(*Conn)
+
+	// 停止监听之后，等待已有连接处理完成的最长时间
+	//
+	// 在 ctx 取消之后，会立即关闭监听，而已有的连接会继续服务，
+	// 直到对方断开或是超过此时间才关闭，可配合 [Handoff] 实现平滑重启。
+	// 为 0 表示在 ctx 取消之后立即关闭所有连接。
+	DrainTimeout time.Duration
+}
+
+// ListenAndServe 监听 addr 并为每个连接提供服务
+//
+// network 可以是 tcp、tcp4、tcp6 和 unix 等面向流的网络类型；
+// opt 为空时，表示采用默认值。
+//
+// 该方法会一直阻塞直到 ctx 被取消或是监听出错。
+// 返回时所有的监听都已经关闭，但连接可能仍在处理中。
+func (s *Server) ListenAndServe(ctx context.Context, network, addr string, opt *ListenOptions) error {
+	if opt == nil {
+		opt = &ListenOptions{}
+	}
+
+	ls, err := listen(ctx, network, addr, opt.ReusePort)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeListeners(ctx, ls, opt)
+}
+
+// ServeListeners 为 ls 上的每个连接提供服务
+//
+// 与 [Server.ListenAndServe] 相同，但是监听由调用方提供，
+// 比如由 [InheritedListeners] 返回的监听。opt.ReusePort 会被忽略。
+//
+// 返回时 ls 都已经被关闭。
+func (s *Server) ServeListeners(ctx context.Context, ls []net.Listener, opt *ListenOptions) error {
+	if opt == nil {
+		opt = &ListenOptions{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		for _, l := range ls {
+			l.Close()
+		}
+	}()
+
+	// 连接的 ctx 不从 ctx 派生，以便在停止监听之后还可以继续处理已有的连接。
+	connCtx, cancelConns := context.WithCancel(context.Background())
+	defer cancelConns()
+	conns := &sync.WaitGroup{}
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, len(ls))
+	for _, l := range ls {
+		wg.Add(1)
+		go func(l net.Listener) {
+			defer wg.Done()
+			if err := s.accept(ctx, connCtx, conns, l, opt); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(l)
+	}
+	wg.Wait()
+
+	if opt.DrainTimeout > 0 {
+		drained := make(chan struct{})
+		go func() {
+			conns.Wait()
+			close(drained)
+		}()
+
+		select {
+		case <-drained:
+		case <-time.After(opt.DrainTimeout):
+		}
+	}
+	cancelConns()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+func (s *Server) accept(ctx, connCtx context.Context, conns *sync.WaitGroup, l net.Listener, opt *ListenOptions) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if opt.ErrLog != nil {
+					opt.ErrLog.Println(err)
+				}
+				continue
+			}
+			return err
+		}
+
+		t, err := NewSocketTransportWithOptions(opt.Header, c, opt.Timeout, opt.Socket)
+		if err != nil {
+			if opt.ErrLog != nil {
+				opt.ErrLog.Println(err)
+			}
+			c.Close()
+			continue
+		}
+
+		conn := s.NewConn(t, opt.ErrLog)
+		if opt.Conn != nil {
+			opt.Conn(conn)
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			conn.Serve(connCtx)
+		}()
+	}
+}
+
+// 打开 n 个监听
+func listen(ctx context.Context, network, addr string, n int) ([]net.Listener, error) {
+	if n < 0 {
+		n = runtime.NumCPU()
+	}
+	if n <= 1 {
+		l, err := (&net.ListenConfig{}).Listen(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+
+	lc := &net.ListenConfig{Control: reusePortControl}
+	ls := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := lc.Listen(ctx, network, addr)
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+
+		// 端口为 0 时，之后的监听需要使用第一个监听分配的端口。
+		addr = l.Addr().String()
+	}
+	return ls, nil
+}
+
+func reusePortControl(network, address string, c syscall.RawConn) (err error) {
+	if e := c.Control(func(fd uintptr) { err = setReusePort(fd) }); e != nil {
+		return e
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestListen(t *testing.T) {
+	a := assert.New(t, false)
+	ctx := context.Background()
+
+	ls, err := listen(ctx, "tcp", "127.0.0.1:0", 0)
+	a.NotError(err).Length(ls, 1)
+	a.NotError(ls[0].Close())
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		return
+	}
+
+	ls, err = listen(ctx, "tcp", "127.0.0.1:0", 3)
+	a.NotError(err).Length(ls, 3).
+		Equal(ls[0].Addr().String(), ls[1].Addr().String()).
+		Equal(ls[0].Addr().String(), ls[2].Addr().String())
+	for _, l := range ls {
+		a.NotError(l.Close())
+	}
+
+	ls, err = listen(ctx, "tcp", "127.0.0.1:0", -1)
+	a.NotError(err).Length(ls, runtime.NumCPU())
+	for _, l := range ls {
+		a.NotError(l.Close())
+	}
+}
+
+func TestServer_ListenAndServe(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	// 获取一个可用的端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	addr := l.Addr().String()
+	a.NotError(l.Close())
+
+	reusePort := 2
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		reusePort = 0
+	}
+
+	configured := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan error, 1)
+	go func() {
+		exit <- srv.ListenAndServe(ctx, "tcp", addr, &ListenOptions{
+			Header:    true,
+			Timeout:   100 * time.Millisecond,
+			ReusePort: reusePort,
+			Conn:      func(*Conn) { configured <- struct{}{} },
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		c, err := NewTCPClientTransport(true, addr, time.Second, nil)
+		a.NotError(err)
+
+		req, err := srv.newRequest(false, "f1", &inType{Age: i})
+		a.NotError(err)
+		a.NotError(c.Write(req))
+		resp := &body{}
+		a.NotError(c.Read(resp)).Equal(resp.ID, req.ID)
+		a.NotError(c.Close())
+	}
+	a.Length(configured, 5)
+
+	cancel()
+	a.ErrorIs(<-exit, context.Canceled)
+
+	// 地址被占用
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	defer l.Close()
+	a.Error(srv.ListenAndServe(context.Background(), "tcp", l.Addr().String(), nil))
+}
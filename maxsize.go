@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"fmt"
+	"io"
+)
+
+// TooLargeData [CodeTooLarge] 错误的 Data 字段
+type TooLargeData struct {
+	Size  int64 `json:"size"`  // 数据的大小
+	Limit int64 `json:"limit"` // 允许的最大值
+}
+
+// 数据超过了大小限制
+type tooLargeError struct{ size, limit int64 }
+
+// 可以在读取内容之前限制数据大小的传输层
+type sizeLimiter interface {
+	limitSize(int64)
+}
+
+func (e *tooLargeError) Error() string {
+	return fmt.Sprintf("数据大小 %d 超过了限制 %d", e.size, e.limit)
+}
+
+func (e *tooLargeError) data() *TooLargeData {
+	return &TooLargeData{Size: e.size, Limit: e.limit}
+}
+
+// MaxMessageSize 限制单条数据的大小
+//
+// 超过 size 的请求不会交由服务处理，而是向对方返回 [CodeTooLarge] 错误，
+// 其 Data 字段为 [TooLargeData]，之后连接依然会继续处理后续的数据。
+//
+// 对于带报头的流，在读取内容之前即根据 Content-Length 判断，超出的内容会被直接丢弃而不会载入内存，
+// 此时无法得知请求的 ID，返回的错误中也不包含 ID；压缩的内容则以解压之后的大小为准。
+// 其它传输层在解码之后根据 params 的大小判断，通知不会返回错误。
+//
+// 小于等于 0 表示不作限制。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用。
+func (conn *Conn) MaxMessageSize(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	conn.maxSize = size
+	if l, ok := conn.transport.(sizeLimiter); ok {
+		l.limitSize(size)
+	}
+}
+
+// 如果请求 req 超过了 [Conn.MaxMessageSize] 的限制，向对方返回错误并返回 true。
+func (conn *Conn) tooLarge(req *body) bool {
+	if conn.maxSize <= 0 || !req.isRequest() {
+		return false
+	}
+
+	size := req.size()
+	if size <= conn.maxSize {
+		return false
+	}
+
+	err := &tooLargeError{size: size, limit: conn.maxSize}
+	conn.server.handleUnrouted(req, err)
+	if req.ID == nil && req.batch == nil { // 通知
+		conn.printErr(err)
+		return true
+	}
+	if err := conn.server.writeError(conn.transport, req.ID, CodeTooLarge, err, err.data()); err != nil {
+		conn.writeErr(err)
+	}
+	return true
+}
+
+func (s *streamTransport) limitSize(size int64) {
+	s.inMux.Lock()
+	s.maxSize = size
+	s.inMux.Unlock()
+}
+
+// 丢弃超过大小限制的内容
+//
+// 读取超时时已经丢弃的字节数保存在 s.frame 中，下次调用时继续丢弃。
+// 只能在 s.inMux 的保护下调用。
+func (s *streamTransport) discard() error {
+	f := &s.frame
+	s.limited.R = s.buffer
+	s.limited.N = f.header.length - f.discarded
+	n, err := io.Copy(io.Discard, &s.limited)
+	f.discarded += n
+	if err != nil {
+		return err
+	}
+	if f.discarded < f.header.length {
+		return io.ErrUnexpectedEOF
+	}
+	return &tooLargeError{size: f.header.length, limit: s.maxSize}
+}
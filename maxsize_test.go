@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestStreamTransport_limitSize(t *testing.T) {
+	a := assert.New(t, false)
+
+	frame := func(content string) string {
+		return "Content-Length:" + strconv.Itoa(len(content)) + "\r\n\r\n" + content
+	}
+	large := `{"jsonrpc":"2.0","method":"f1","params":"` + strings.Repeat("x", 1000) + `"}`
+	in := bytes.NewBufferString(frame(large) + frame(`{"jsonrpc":"2.0"}`))
+	tr := NewStreamTransport(true, in, new(bytes.Buffer), nil)
+	tr.(sizeLimiter).limitSize(100)
+
+	req := &body{}
+	err := tr.Read(req)
+	var tl *tooLargeError
+	a.True(errors.As(err, &tl)).
+		Equal(tl.size, len(large)).
+		Equal(tl.limit, 100).
+		Equal(tl.data(), &TooLargeData{Size: int64(len(large)), Limit: 100})
+
+	var pe *ProtocolError
+	a.True(errors.As(readError(err), &pe))
+
+	// 超出的内容已经被丢弃，可以继续读取之后的内容。
+	req = &body{}
+	a.NotError(tr.Read(req)).Equal(req.Version, Version)
+
+	// 内容不完整
+	in = bytes.NewBufferString("Content-Length:200\r\n\r\n{}")
+	tr = NewStreamTransport(true, in, new(bytes.Buffer), nil)
+	tr.(sizeLimiter).limitSize(100)
+	a.Error(tr.Read(&body{}))
+
+	// 解压之后的大小
+	data, err := compress("gzip", []byte(large))
+	a.NotError(err).True(len(data) < 100)
+	in = bytes.NewBufferString("Content-Encoding:gzip\r\nContent-Length:" + strconv.Itoa(len(data)) + "\r\n\r\n" + string(data))
+	tr = NewStreamTransport(true, in, new(bytes.Buffer), nil)
+	tr.(sizeLimiter).limitSize(100)
+	a.True(errors.As(tr.Read(&body{}), &tl)).Equal(tl.size, len(large))
+}
+
+func TestConn_MaxMessageSize(t *testing.T) {
+	a := assert.New(t, false)
+
+	for _, header := range []bool{true, false} {
+		srv := initServer(a)
+		srvConn, clientConn := net.Pipe()
+		conn := srv.NewConn(NewSocketTransport(header, srvConn, 0), log.New(ioutil.Discard, "", 0))
+		conn.MaxMessageSize(150)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan struct{}, 1)
+		go func() {
+			conn.Serve(ctx)
+			exit <- struct{}{}
+		}()
+
+		client := NewStreamTransport(header, clientConn, clientConn, nil)
+
+		// 超过大小
+		req, err := srv.newRequest(false, "f1", &inType{Age: 1, Last: strings.Repeat("x", 200)})
+		a.NotError(err).NotError(client.Write(req))
+		resp := &body{}
+		a.NotError(client.Read(resp)).
+			Equal(resp.Error.Code, CodeTooLarge).
+			NotNil(resp.Error.Data)
+		if header { // 内容被直接丢弃，无法得知 ID。
+			a.Nil(resp.ID)
+		} else {
+			a.True(resp.ID.Equal(req.ID))
+		}
+
+		// 超过大小的通知
+		req, err = srv.newRequest(true, "f1", &inType{Age: 1, Last: strings.Repeat("x", 200)})
+		a.NotError(err).NotError(client.Write(req))
+		if header {
+			resp = &body{}
+			a.NotError(client.Read(resp)).Equal(resp.Error.Code, CodeTooLarge)
+		}
+
+		// 连接依然可用
+		req, err = srv.newRequest(false, "f1", &inType{Age: 1})
+		a.NotError(err).NotError(client.Write(req))
+		resp = &body{}
+		a.NotError(client.Read(resp)).
+			Nil(resp.Error).
+			True(resp.ID.Equal(req.ID))
+
+		cancel()
+		a.NotError(clientConn.Close())
+		<-exit
+	}
+}
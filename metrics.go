@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricsContentType [WriteMetrics] 输出内容的类型
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics 以 Prometheus 文本格式输出统计数据
+//
+// stats 的键名作为 conn 标签的值，用于区分不同的连接，值一般由 [Conn.Stats] 获取，为空的会被忽略。
+// 输出的指标包括：
+//   - jsonrpc_messages_total 和 jsonrpc_bytes_total，以 direction 标签区分读写；
+//   - jsonrpc_client_calls_total、jsonrpc_client_retries_total 和 jsonrpc_client_responses_total，以 method 标签区分服务；
+//   - jsonrpc_client_errors_total，以 method 和 code 标签区分服务和错误代码；
+//   - jsonrpc_client_latency_seconds，往返时间的直方图，区间由 [LatencyBuckets] 指定。
+//
+// 不依赖 Prometheus 的客户端库，可直接作为 /metrics 的输出，参考 [MetricsHandler]。
+func WriteMetrics(w io.Writer, stats map[string]*Stats) error {
+	conns := make([]string, 0, len(stats))
+	for name, s := range stats {
+		if s != nil {
+			conns = append(conns, name)
+		}
+	}
+	sort.Strings(conns)
+
+	buf := new(bytes.Buffer)
+	family := func(name, typ, help string, f func(conn string, s *Stats)) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, conn := range conns {
+			f(conn, stats[conn])
+		}
+	}
+
+	family("jsonrpc_messages_total", "counter", "Number of messages read or written.", func(conn string, s *Stats) {
+		writeMetric(buf, "jsonrpc_messages_total", s.MessagesIn, "conn", conn, "direction", "in")
+		writeMetric(buf, "jsonrpc_messages_total", s.MessagesOut, "conn", conn, "direction", "out")
+	})
+	family("jsonrpc_bytes_total", "counter", "Number of bytes read or written.", func(conn string, s *Stats) {
+		writeMetric(buf, "jsonrpc_bytes_total", s.BytesIn, "conn", conn, "direction", "in")
+		writeMetric(buf, "jsonrpc_bytes_total", s.BytesOut, "conn", conn, "direction", "out")
+	})
+
+	calls := func(name, help string, v func(*CallStats) int64) {
+		family(name, "counter", help, func(conn string, s *Stats) {
+			for _, method := range sortedMethods(s) {
+				writeMetric(buf, name, v(s.Calls[method]), "conn", conn, "method", method)
+			}
+		})
+	}
+	calls("jsonrpc_client_calls_total", "Number of requests sent.", func(c *CallStats) int64 { return c.Calls })
+	calls("jsonrpc_client_retries_total", "Number of retries after write failures.", func(c *CallStats) int64 { return c.Retries })
+	calls("jsonrpc_client_responses_total", "Number of responses received.", func(c *CallStats) int64 { return c.Responses })
+
+	family("jsonrpc_client_errors_total", "counter", "Number of error responses received.", func(conn string, s *Stats) {
+		for _, method := range sortedMethods(s) {
+			c := s.Calls[method]
+			codes := make([]int, 0, len(c.Errors))
+			for code := range c.Errors {
+				codes = append(codes, code)
+			}
+			sort.Ints(codes)
+			for _, code := range codes {
+				writeMetric(buf, "jsonrpc_client_errors_total", c.Errors[code], "conn", conn, "method", method, "code", strconv.Itoa(code))
+			}
+		}
+	})
+
+	family("jsonrpc_client_latency_seconds", "histogram", "Round-trip time of requests.", func(conn string, s *Stats) {
+		for _, method := range sortedMethods(s) {
+			c := s.Calls[method]
+			for i, le := range LatencyBuckets {
+				var v int64
+				if i < len(c.Latency) {
+					v = c.Latency[i]
+				}
+				writeMetric(buf, "jsonrpc_client_latency_seconds_bucket", v, "conn", conn, "method", method, "le", formatFloat(le.Seconds()))
+			}
+			writeMetric(buf, "jsonrpc_client_latency_seconds_bucket", c.Responses, "conn", conn, "method", method, "le", "+Inf")
+			writeLabels(buf, "jsonrpc_client_latency_seconds_sum", "conn", conn, "method", method)
+			buf.WriteString(formatFloat(c.LatencySum.Seconds()))
+			buf.WriteByte('\n')
+			writeMetric(buf, "jsonrpc_client_latency_seconds_count", c.Responses, "conn", conn, "method", method)
+		}
+	})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MetricsHandler 返回以 Prometheus 文本格式输出统计数据的 [http.Handler]
+//
+// 每次请求时调用 stats 获取统计数据，其格式与 [WriteMetrics] 的参数相同。
+func MetricsHandler(stats func() map[string]*Stats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		if err := WriteMetrics(buf, stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MetricsContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+func sortedMethods(s *Stats) []string {
+	methods := make([]string, 0, len(s.Calls))
+	for method := range s.Calls {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// 输出一行指标，labels 为键值对。
+func writeMetric(buf *bytes.Buffer, name string, v int64, labels ...string) {
+	writeLabels(buf, name, labels...)
+	buf.WriteString(strconv.FormatInt(v, 10))
+	buf.WriteByte('\n')
+}
+
+// 输出指标名称和标签，以空格结尾。
+func writeLabels(buf *bytes.Buffer, name string, labels ...string) {
+	buf.WriteString(name)
+	buf.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(labels[i])
+		buf.WriteString(`="`)
+		labelReplacer.WriteString(buf, labels[i+1])
+		buf.WriteByte('"')
+	}
+	buf.WriteString("} ")
+}
+
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
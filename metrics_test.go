@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	a := assert.New(t, false)
+
+	latency := make([]int64, len(LatencyBuckets))
+	for i := 2; i < len(latency); i++ {
+		latency[i] = 2
+	}
+	stats := map[string]*Stats{
+		"c1": {
+			MessagesIn:  3,
+			MessagesOut: 4,
+			BytesIn:     30,
+			BytesOut:    40,
+			Calls: map[string]*CallStats{
+				`m"1`: {
+					Calls:      3,
+					Retries:    1,
+					Responses:  3,
+					Errors:     map[int]int64{CodeMethodNotFound: 1},
+					Latency:    latency,
+					LatencySum: 1500 * time.Millisecond,
+				},
+			},
+		},
+		"c2": nil,
+	}
+
+	buf := new(bytes.Buffer)
+	a.NotError(WriteMetrics(buf, stats))
+	out := buf.String()
+	a.Contains(out, "# TYPE jsonrpc_messages_total counter\n").
+		Contains(out, `jsonrpc_messages_total{conn="c1",direction="in"} 3`+"\n").
+		Contains(out, `jsonrpc_bytes_total{conn="c1",direction="out"} 40`+"\n").
+		Contains(out, `jsonrpc_client_calls_total{conn="c1",method="m\"1"} 3`+"\n").
+		Contains(out, `jsonrpc_client_retries_total{conn="c1",method="m\"1"} 1`+"\n").
+		Contains(out, `jsonrpc_client_errors_total{conn="c1",method="m\"1",code="-32601"} 1`+"\n").
+		Contains(out, "# TYPE jsonrpc_client_latency_seconds histogram\n").
+		Contains(out, `jsonrpc_client_latency_seconds_bucket{conn="c1",method="m\"1",le="0.005"} 0`+"\n").
+		Contains(out, `jsonrpc_client_latency_seconds_bucket{conn="c1",method="m\"1",le="0.01"} 2`+"\n").
+		Contains(out, `jsonrpc_client_latency_seconds_bucket{conn="c1",method="m\"1",le="+Inf"} 3`+"\n").
+		Contains(out, `jsonrpc_client_latency_seconds_sum{conn="c1",method="m\"1"} 1.5`+"\n").
+		Contains(out, `jsonrpc_client_latency_seconds_count{conn="c1",method="m\"1"} 3`+"\n").
+		NotContains(out, "c2")
+
+	// 空数据
+	buf.Reset()
+	a.NotError(WriteMetrics(buf, nil)).Contains(buf.String(), "# TYPE jsonrpc_bytes_total counter\n")
+
+	// MetricsHandler
+	w := httptest.NewRecorder()
+	MetricsHandler(func() map[string]*Stats { return stats }).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	a.Equal(w.Code, http.StatusOK).
+		Equal(w.Header().Get("Content-Type"), MetricsContentType).
+		Equal(w.Body.String(), out)
+}
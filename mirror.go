@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+)
+
+type mirror struct {
+	rate   float64
+	target func(notify bool, method string, params json.RawMessage)
+}
+
+// 丢弃所有返回数据的 [Transport]
+type discardTransport struct{}
+
+// Mirror 将部分请求复制给 target
+//
+// 可用于将生产环境的流量复制给新版本的服务，在不影响正常请求的前提下进行验证。
+// rate 为复制的比例，取值范围为 (0,1]，小于等于 0 或是 target 为空表示不复制；
+// target 在单独的 goroutine 中调用，其结果不会影响原请求，
+// 参数 notify 表示原请求是否为通知，params 为原请求参数的副本。
+// 只有通过了 TTL、防重放、[Server.RegisterBefore]、可见性以及限流等检测，
+// 即将交由服务处理的请求才会被复制。
+//
+// 复制到另一个 [Server] 可以使用 [MirrorServer]，
+// 复制到上游服务则可以通过 [Conn.Notify] 等方法发送，以忽略对方的返回数据。
+func (s *Server) Mirror(rate float64, target func(notify bool, method string, params json.RawMessage)) {
+	if rate <= 0 || target == nil {
+		s.mirror = nil
+	} else {
+		s.mirror = &mirror{rate: rate, target: target}
+	}
+}
+
+// MirrorServer 将复制的请求交由 srv 处理
+//
+// 返回值可作为 [Server.Mirror] 的参数，srv 的返回数据会被丢弃。
+// 复制的请求不会被 srv 再次复制，所以 srv 可以是调用 [Server.Mirror] 的服务本身。
+func MirrorServer(srv *Server) func(notify bool, method string, params json.RawMessage) {
+	return func(notify bool, method string, params json.RawMessage) {
+		req := &body{Version: Version, Method: method, mirrored: true}
+		if params != nil {
+			req.Params = &params
+		}
+		if !notify {
+			req.ID = NewNumberID(0)
+		}
+		_ = srv.response(discardTransport{}, req)
+	}
+}
+
+// 根据 [Server.Mirror] 的设置复制请求 req
+func (s *Server) mirrorRequest(req *body) {
+	m := s.mirror
+	if m == nil || req.mirrored || (m.rate < 1 && rand.Float64() >= m.rate) {
+		return
+	}
+
+	var params json.RawMessage
+	if req.Params != nil {
+		params = append(json.RawMessage(nil), *req.Params...)
+	}
+	go m.target(req.ID == nil, req.Method, params)
+}
+
+func (discardTransport) Read(interface{}) error { return io.EOF }
+
+func (discardTransport) Write(interface{}) error { return nil }
+
+func (discardTransport) Close() error { return nil }
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_Mirror(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	shadow := NewServer(srv.unique)
+	mirrored := make(chan *inType, 10)
+	a.True(shadow.Register("f1", func(notify bool, in *inType, out *outType) error {
+		mirrored <- in
+		return nil
+	}))
+	srv.Mirror(1, MirrorServer(shadow))
+
+	call := func(data string) string {
+		in := bytes.NewBufferString(data)
+		out := new(bytes.Buffer)
+		tr := NewStreamTransport(false, in, out, nil)
+		req, err := srv.read(tr)
+		a.NotError(err).NotNil(req)
+		a.NotError(srv.response(tr, req))
+		return out.String()
+	}
+
+	// 原请求的返回数据不受影响
+	a.Contains(call(`{"jsonrpc":"2.0","id":1,"method":"f1","params":{"Age":5}}`), `"age":5`)
+	a.Equal((<-mirrored).Age, 5)
+
+	// 副本中不存在的服务
+	a.Contains(call(`{"jsonrpc":"2.0","id":2,"method":"f2","params":{}}`), `"error"`)
+
+	// 通知
+	type mirroredRequest struct {
+		notify bool
+		method string
+		params json.RawMessage
+	}
+	reqs := make(chan mirroredRequest, 10)
+	srv.Mirror(1, func(notify bool, method string, params json.RawMessage) {
+		reqs <- mirroredRequest{notify: notify, method: method, params: params}
+	})
+	a.Empty(call(`{"jsonrpc":"2.0","method":"f1","params":{"Age":6}}`))
+	r := <-reqs
+	a.True(r.notify).Equal(r.method, "f1").Equal(string(r.params), `{"Age":6}`)
+
+	// 未通过检测的请求不会被复制
+	srv.RegisterBefore(func(method string) error {
+		if method == "f1" {
+			return errors.New("before")
+		}
+		return nil
+	})
+	a.Contains(call(`{"jsonrpc":"2.0","id":4,"method":"f1","params":{"Age":8}}`), `"error"`)
+	a.Contains(call(`{"jsonrpc":"2.0","id":5,"method":"not-exists","params":{}}`), `"error"`)
+	srv.RegisterBefore(nil)
+	time.Sleep(10 * time.Millisecond)
+	a.Length(reqs, 0)
+
+	// 复制给自身
+	count := make(chan struct{}, 10)
+	a.True(srv.Register("count", func(bool, *inType, *outType) error {
+		count <- struct{}{}
+		return nil
+	}))
+	srv.Mirror(1, MirrorServer(srv))
+	call(`{"jsonrpc":"2.0","id":6,"method":"count","params":{}}`)
+	<-count
+	<-count
+	time.Sleep(10 * time.Millisecond)
+	a.Length(count, 0)
+
+	// 取消复制
+	srv.Mirror(0, MirrorServer(shadow))
+	a.Nil(srv.mirror)
+	srv.Mirror(1, nil)
+	a.Nil(srv.mirror)
+	call(`{"jsonrpc":"2.0","id":3,"method":"f1","params":{"Age":7}}`)
+	a.Length(mirrored, 0).Length(reqs, 0)
+}
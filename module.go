@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Module 占用指定服务名前缀的扩展模块
+//
+// 取消请求、进度通知以及订阅发布等功能，可以以 Module 的形式实现，
+// 并通过 [Server.Install] 组合在一起。
+type Module interface {
+	// Prefix 模块占用的服务名前缀
+	//
+	// 比如 $/ 或是 rpc.x. 等，同一个 [Server] 中的前缀不能相互包含。
+	Prefix() string
+
+	// Methods 模块提供的服务
+	//
+	// 键名为去掉前缀之后的服务名，键值与 [Registry.Register] 的 f 参数相同。
+	// 这些服务用于处理对方发送的请求或是通知。
+	Methods() map[string]interface{}
+}
+
+// ConnModule 需要向对方发送数据的模块
+//
+// 对于进度通知等需要主动向对方发送数据的模块，可以实现此接口，
+// 在通过 [Server.NewConn] 创建连接时，会调用 Attach 将连接传递给模块。
+type ConnModule interface {
+	Module
+	Attach(conn *Conn)
+}
+
+// Install 安装模块 m
+//
+// 会将 m 提供的服务加上前缀之后注册到当前的注册表中，
+// 如果 m 的前缀与已经安装的模块有冲突，或是当前注册表中已经存在以该前缀开头的服务，则返回错误。
+// 安装之后，该前缀即被 m 占用，不应该再注册以该前缀开头的服务。
+//
+// NOTE: 需要在创建连接之前调用。
+func (s *Server) Install(m Module) error {
+	prefix := m.Prefix()
+	if prefix == "" {
+		return errors.New("模块的前缀不能为空")
+	}
+
+	for _, mod := range s.modules {
+		if p := mod.Prefix(); strings.HasPrefix(p, prefix) || strings.HasPrefix(prefix, p) {
+			return fmt.Errorf("前缀 %s 与已经安装的模块 %s 冲突", prefix, p)
+		}
+	}
+
+	for _, method := range s.Methods() {
+		if strings.HasPrefix(method, prefix) {
+			return fmt.Errorf("已经存在以 %s 开头的服务 %s", prefix, method)
+		}
+	}
+
+	methods := m.Methods()
+	prefixed := make(map[string]interface{}, len(methods))
+	for name, f := range methods {
+		prefixed[prefix+name] = f
+	}
+	s.Registers(prefixed)
+
+	s.modules = append(s.modules, m)
+	return nil
+}
+
+// Modules 返回所有已经安装的模块
+func (s *Server) Modules() []Module {
+	return append(make([]Module, 0, len(s.modules)), s.modules...)
+}
+
+// 将 conn 传递给所有需要的模块
+func (s *Server) attach(conn *Conn) {
+	for _, m := range s.modules {
+		if cm, ok := m.(ConnModule); ok {
+			cm.Attach(conn)
+		}
+	}
+}
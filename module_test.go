@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 简单的进度通知模块
+type progressModule struct {
+	conns    []*Conn
+	canceled string
+}
+
+func (m *progressModule) Prefix() string { return "$/" }
+
+func (m *progressModule) Methods() map[string]interface{} {
+	return map[string]interface{}{
+		"cancelRequest": func(notify bool, in *string, out *int) error {
+			m.canceled = *in
+			return nil
+		},
+	}
+}
+
+func (m *progressModule) Attach(conn *Conn) { m.conns = append(m.conns, conn) }
+
+func (m *progressModule) progress(v int) error {
+	for _, conn := range m.conns {
+		if err := conn.Notify("$/progress", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type emptyModule string
+
+func (m emptyModule) Prefix() string { return string(m) }
+
+func (m emptyModule) Methods() map[string]interface{} { return nil }
+
+func TestServer_Install(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	m := &progressModule{}
+	a.NotError(srv.Install(m)).
+		True(srv.Exists("$/cancelRequest")).
+		Length(srv.Modules(), 1)
+
+	a.Error(srv.Install(emptyModule(""))).
+		Error(srv.Install(emptyModule("$/"))).
+		Error(srv.Install(emptyModule("$"))).
+		Error(srv.Install(emptyModule("$/x/"))).
+		Error(srv.Install(emptyModule("f"))). // 已经存在 f1
+		NotError(srv.Install(emptyModule("rpc.x."))).
+		Length(srv.Modules(), 2)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	a.Length(m.conns, 1)
+
+	// 处理对方的请求
+	in.WriteString(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":"1"}`)
+	req, err := srv.read(conn.transport)
+	a.NotError(err).NotNil(req)
+	conn.serve(req, 0)
+	a.Equal(m.canceled, "1")
+
+	// 向对方发送通知
+	a.NotError(m.progress(50))
+	req = &body{}
+	a.NotError(json.Unmarshal(out.Bytes(), req)).
+		Equal(req.Method, "$/progress").
+		Equal(string(*req.Params), "50")
+}
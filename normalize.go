@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"sort"
+	"sync"
+)
+
+// 服务名的规范化处理
+type normalizer struct {
+	funcs []func(string) string
+
+	mux   sync.Mutex
+	table *table            // 生成 index 时的服务表
+	index map[string]string // 规范化之后的服务名与原始服务名的对应关系
+}
+
+// NormalizeMethod 指定服务名的规范化函数
+//
+// 默认情况下服务名是严格匹配的。为了兼容一些不规范的客户端，
+// 可以在找不到完全匹配的服务时，将请求的服务名与已注册的服务名都按 f 依次处理之后再进行匹配，
+// 比如以下代码会忽略服务名首尾的空格以及大小写：
+//
+//	srv.NormalizeMethod(strings.TrimSpace, strings.ToLower)
+//
+// Unicode NFC 等规范化可以借助 golang.org/x/text/unicode/norm 包中的 norm.NFC.String 实现。
+// 多个服务名规范化之后相同时，按字典顺序采用第一个。
+//
+// f 为空表示恢复为严格匹配。多次调用会相互覆盖。
+func (s *Server) NormalizeMethod(f ...func(string) string) {
+	if len(f) == 0 {
+		s.normalizer = nil
+		return
+	}
+	s.normalizer = &normalizer{funcs: f}
+}
+
+// 查找 method 对应的服务
+func (s *Server) lookup(method string) (*handler, string) {
+	r := s.methods()
+	h, alias := r.lookup(method)
+	if h != nil || s.normalizer == nil {
+		return h, alias
+	}
+
+	n := s.normalizer.normalize(method)
+	if name, found := s.normalizer.load(r.load())[n]; found {
+		return r.lookup(name)
+	}
+	return r.lookup(n) // 通过 Registry.RegisterMatcher 注册的服务
+}
+
+func (n *normalizer) normalize(method string) string {
+	for _, f := range n.funcs {
+		method = f(method)
+	}
+	return method
+}
+
+// 返回服务表 t 对应的索引
+//
+// 服务表一旦发布便不再修改，所以只在服务表变化之后才重新生成索引。
+func (n *normalizer) load(t *table) map[string]string {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	if n.table == t {
+		return n.index
+	}
+
+	names := make([]string, 0, len(t.servers)+len(t.aliases)+len(t.versions))
+	for name := range t.servers {
+		names = append(names, name)
+	}
+	for name := range t.aliases {
+		names = append(names, name)
+	}
+	for name := range t.versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make(map[string]string, len(names))
+	for _, name := range names {
+		if key := n.normalize(name); index[key] == "" {
+			index[key] = name
+		}
+	}
+
+	n.table = t
+	n.index = index
+	return index
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_NormalizeMethod(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.methods().Alias("Old", "f1"))
+
+	// 默认严格匹配
+	h, _ := srv.lookup(" F1 ")
+	a.Nil(h)
+
+	srv.NormalizeMethod(strings.TrimSpace, strings.ToLower)
+	h, alias := srv.lookup(" F1 ")
+	a.NotNil(h).Empty(alias)
+
+	h, alias = srv.lookup("f1")
+	a.NotNil(h).Empty(alias)
+
+	h, alias = srv.lookup("OLD")
+	a.NotNil(h).Equal(alias, "f1")
+
+	h, _ = srv.lookup("f4")
+	a.Nil(h)
+
+	// 服务表变化之后重新生成索引
+	a.True(srv.Register("F4", f1))
+	h, _ = srv.lookup("f4 ")
+	a.NotNil(h)
+
+	// 恢复严格匹配
+	srv.NormalizeMethod()
+	h, _ = srv.lookup(" F1 ")
+	a.Nil(h)
+}
@@ -0,0 +1,414 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package openrpc
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 需要全部大写的缩写
+var initialisms = map[string]string{
+	"api":  "API",
+	"http": "HTTP",
+	"id":   "ID",
+	"ip":   "IP",
+	"json": "JSON",
+	"rpc":  "RPC",
+	"uri":  "URI",
+	"url":  "URL",
+}
+
+type generator struct {
+	doc     *Document
+	types   bytes.Buffer
+	names   map[string]string // 已经使用的类型名称及其来源
+	structs map[string]bool   // 生成为结构体的类型
+	json    bool              // 是否用到了 encoding/json
+}
+
+// 生成代码时服务的相关信息
+type method struct {
+	*Method
+	name   string // Go 中的方法名
+	params string // 参数类型
+	result string // 返回值类型，通知类型为空。
+}
+
+// Generate 根据 doc 生成 Go 代码并写入 w
+//
+// pkg 为生成代码的包名。
+func Generate(w io.Writer, pkg string, doc *Document) error {
+	g := &generator{
+		doc:     doc,
+		names:   make(map[string]string, 10),
+		structs: make(map[string]bool, 10),
+	}
+	for _, name := range []string{"Service", "Register", "Client", "NewClient"} {
+		g.names[name] = "生成的代码"
+	}
+
+	if err := g.components(); err != nil {
+		return err
+	}
+	methods, err := g.methods()
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("// Code generated by openrpcgen. DO NOT EDIT.\n")
+	if doc.Info.Title != "" {
+		fmt.Fprintf(buf, "//\n// %s %s\n", doc.Info.Title, doc.Info.Version)
+	}
+	fmt.Fprintf(buf, "\npackage %s\n\nimport (\n\t\"context\"\n", pkg)
+	if g.json {
+		buf.WriteString("\t\"encoding/json\"\n")
+	}
+	buf.WriteString("\n\t\"github.com/issue9/jsonrpc\"\n)\n\n")
+	buf.Write(g.types.Bytes())
+	writeService(buf, methods)
+	writeRegister(buf, methods)
+	writeClient(buf, methods)
+
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("无法格式化生成的代码：%w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// 生成 components 中的类型
+func (g *generator) components() error {
+	if g.doc.Components == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name, s := range g.doc.Components.Schemas {
+		names = append(names, name)
+		typ := exportName(name)
+		if err := g.reserve(typ, name); err != nil {
+			return err
+		}
+		g.structs[typ] = isStruct(s)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := g.doc.Components.Schemas[name]
+		typ := exportName(name)
+		if isStruct(s) {
+			if err := g.defineStruct(typ, s, s.Description); err != nil {
+				return err
+			}
+			continue
+		}
+
+		t, err := g.goType(s, typ+"Value")
+		if err != nil {
+			return err
+		}
+		writeDoc(&g.types, "", typ, s.Description)
+		fmt.Fprintf(&g.types, "type %s %s\n\n", typ, t)
+	}
+	return nil
+}
+
+// 生成各个服务的参数和返回值类型
+func (g *generator) methods() ([]*method, error) {
+	methods := make([]*method, 0, len(g.doc.Methods))
+	used := make(map[string]string, len(g.doc.Methods))
+	for _, m := range g.doc.Methods {
+		if m.ParamStructure == "by-position" {
+			return nil, fmt.Errorf("服务 %s 的参数按位置传递，目前仅支持按名称传递", m.Name)
+		}
+
+		name := exportName(m.Name)
+		if prev, found := used[name]; found {
+			return nil, fmt.Errorf("服务 %s 和 %s 生成的方法名相同", prev, m.Name)
+		}
+		used[name] = m.Name
+
+		mm := &method{Method: m, name: name, params: name + "Params"}
+		if err := g.reserve(mm.params, m.Name); err != nil {
+			return nil, err
+		}
+		params := &Schema{Properties: make(map[string]*Schema, len(m.Params))}
+		for _, p := range m.Params {
+			s := &Schema{}
+			if p.Schema != nil {
+				*s = *p.Schema
+			}
+			if s.Description == "" {
+				s.Description = summary(p.Summary, p.Description)
+			}
+			params.Properties[p.Name] = s
+			if p.Required {
+				params.Required = append(params.Required, p.Name)
+			}
+		}
+		if err := g.defineStruct(mm.params, params, m.Name+" 的参数"); err != nil {
+			return nil, err
+		}
+
+		if m.Result != nil {
+			t, err := g.goType(m.Result.Schema, name+"Result")
+			if err != nil {
+				return nil, err
+			}
+			mm.result = strings.TrimPrefix(t, "*") // 服务函数的返回值不能是指针的指针
+		}
+
+		methods = append(methods, mm)
+	}
+	return methods, nil
+}
+
+// 将 s 定义为名称为 name 的结构体
+func (g *generator) defineStruct(name string, s *Schema, desc string) error {
+	props := make([]string, 0, len(s.Properties))
+	for p := range s.Properties {
+		props = append(props, p)
+	}
+	sort.Strings(props)
+
+	required := make(map[string]bool, len(s.Required))
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	buf := &bytes.Buffer{}
+	fields := make(map[string]string, len(props))
+	for _, p := range props {
+		ps := s.Properties[p]
+		field := exportName(p)
+		if prev, found := fields[field]; found {
+			return fmt.Errorf("%s 的字段 %s 和 %s 生成的字段名相同", name, prev, p)
+		}
+		fields[field] = p
+
+		typ, err := g.goType(ps, name+field)
+		if err != nil {
+			return err
+		}
+
+		tag := p
+		if !required[p] {
+			tag += ",omitempty"
+			if g.structs[typ] {
+				typ = "*" + typ
+			}
+		}
+
+		if ps != nil {
+			writeDoc(buf, "\t", field, ps.Description)
+		}
+		fmt.Fprintf(buf, "\t%s %s `json:\"%s\"`\n", field, typ, tag)
+	}
+
+	writeDoc(&g.types, "", name, desc)
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n\n", name, buf.String())
+	return nil
+}
+
+// 返回 s 对应的 Go 类型
+//
+// 如果 s 是带有属性的对象，会生成名称为 name 的结构体。
+func (g *generator) goType(s *Schema, name string) (string, error) {
+	if s == nil {
+		g.json = true
+		return "json.RawMessage", nil
+	}
+
+	if s.Ref != "" {
+		ref, _, err := g.doc.schema(s.Ref)
+		if err != nil {
+			return "", err
+		}
+		return exportName(ref), nil
+	}
+
+	typ, nullable := s.Type.primary()
+	if typ == "" && len(s.Properties) > 0 {
+		typ = "object"
+	}
+
+	var t string
+	switch typ {
+	case "string":
+		t = "string"
+	case "integer":
+		t = "int64"
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		item, err := g.goType(s.Items, name+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.Properties) > 0 {
+			if err := g.reserve(name, name); err != nil {
+				return "", err
+			}
+			g.structs[name] = true
+			if err := g.defineStruct(name, s, s.Description); err != nil {
+				return "", err
+			}
+			t = name
+			break
+		}
+
+		ap, err := s.additional()
+		if err != nil {
+			return "", err
+		}
+		if ap == nil {
+			return "map[string]interface{}", nil
+		}
+		v, err := g.goType(ap, name+"Value")
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + v, nil
+	default:
+		g.json = true
+		return "json.RawMessage", nil
+	}
+
+	if nullable {
+		t = "*" + t
+	}
+	return t, nil
+}
+
+func (g *generator) reserve(name, source string) error {
+	if prev, found := g.names[name]; found {
+		return fmt.Errorf("%s 和 %s 生成的类型名 %s 相同", prev, source, name)
+	}
+	g.names[name] = source
+	return nil
+}
+
+func writeService(buf *bytes.Buffer, methods []*method) {
+	buf.WriteString("// Service 需要由服务端实现的接口\ntype Service interface {\n")
+	for _, m := range methods {
+		writeDoc(buf, "\t", m.name, methodDoc(m))
+		if m.result == "" {
+			fmt.Fprintf(buf, "\t%s(ctx context.Context, in *%s) error\n\n", m.name, m.params)
+		} else {
+			fmt.Fprintf(buf, "\t%s(ctx context.Context, in *%s, out *%s) error\n\n", m.name, m.params, m.result)
+		}
+	}
+	buf.WriteString("}\n\n")
+}
+
+func writeRegister(buf *bytes.Buffer, methods []*method) {
+	buf.WriteString("// Register 将 svc 注册到 s\n//\n// 如果已经存在同名的服务，则会 panic。\n")
+	buf.WriteString("func Register(s *jsonrpc.Server, svc Service) {\n\ts.Registers(map[string]interface{}{\n")
+	for _, m := range methods {
+		if m.result == "" {
+			fmt.Fprintf(buf, "\t\t%q: func(ctx context.Context, _ bool, in *%s, _ *struct{}) error {\n\t\t\treturn svc.%s(ctx, in)\n\t\t},\n",
+				m.Name, m.params, m.name)
+		} else {
+			fmt.Fprintf(buf, "\t\t%q: func(ctx context.Context, _ bool, in *%s, out *%s) error {\n\t\t\treturn svc.%s(ctx, in, out)\n\t\t},\n",
+				m.Name, m.params, m.result, m.name)
+		}
+	}
+	buf.WriteString("\t})\n}\n\n")
+}
+
+func writeClient(buf *bytes.Buffer, methods []*method) {
+	buf.WriteString("// Client 调用服务的客户端\ntype Client struct {\n\tconn *jsonrpc.Conn\n}\n\n")
+	buf.WriteString("// NewClient 声明 [Client]\n//\n// 需要在其它 goroutine 中运行 conn 的 Serve 方法。\n")
+	buf.WriteString("func NewClient(conn *jsonrpc.Conn) *Client { return &Client{conn: conn} }\n\n")
+	for _, m := range methods {
+		writeDoc(buf, "", m.name, methodDoc(m))
+		if m.result == "" {
+			fmt.Fprintf(buf, "func (c *Client) %s(in *%s, opts ...jsonrpc.CallOption) error {\n\treturn c.conn.Notify(%q, in, opts...)\n}\n\n",
+				m.name, m.params, m.Name)
+		} else {
+			fmt.Fprintf(buf, "func (c *Client) %s(ctx context.Context, in *%s, opts ...jsonrpc.CallOption) (%s, error) {\n\tvar out %s\n\terr := c.conn.Call(ctx, %q, in, &out, opts...)\n\treturn out, err\n}\n\n",
+				m.name, m.params, m.result, m.result, m.Name)
+		}
+	}
+}
+
+func methodDoc(m *method) string {
+	if doc := summary(m.Summary, m.Description); doc != "" {
+		return doc
+	}
+	if m.result == "" {
+		return "通知 " + m.Name
+	}
+	return "调用 " + m.Name
+}
+
+func summary(summary, desc string) string {
+	if summary != "" {
+		return summary
+	}
+	return desc
+}
+
+// 以 name 开头写入文档注释，text 为空时不写入任何内容。
+func writeDoc(buf *bytes.Buffer, indent, name, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case i == 0:
+			fmt.Fprintf(buf, "%s// %s %s\n", indent, name, line)
+		case line == "":
+			fmt.Fprintf(buf, "%s//\n", indent)
+		default:
+			fmt.Fprintf(buf, "%s// %s\n", indent, line)
+		}
+	}
+}
+
+// 将 s 转换为可导出的 Go 标识符
+func exportName(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+
+	var b strings.Builder
+	for _, part := range parts {
+		if v, found := initialisms[strings.ToLower(part)]; found {
+			b.WriteString(v)
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+
+	name := b.String()
+	if name == "" || !unicode.IsUpper([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+func isStruct(s *Schema) bool {
+	if s == nil || s.Ref != "" || len(s.Properties) == 0 {
+		return false
+	}
+	typ, _ := s.Type.primary()
+	return typ == "" || typ == "object"
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package openrpc
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestGenerate(t *testing.T) {
+	a := assert.New(t, false)
+
+	data, err := os.ReadFile("./testdata/petstore.json")
+	a.NotError(err)
+	doc, err := Parse(data)
+	a.NotError(err)
+
+	buf := new(bytes.Buffer)
+	a.NotError(Generate(buf, "petstore", doc))
+	golden, err := os.ReadFile("./testdata/petstore.golden")
+	a.NotError(err)
+	a.Equal(buf.String(), string(golden))
+
+	generate := func(data string) error {
+		doc, err := Parse([]byte(data))
+		a.NotError(err)
+		return Generate(new(bytes.Buffer), "p", doc)
+	}
+
+	// 未用到 encoding/json
+	buf.Reset()
+	doc, err = Parse([]byte(`{"openrpc":"1.2.6","methods":[{"name":"m","params":[],"result":{"name":"r","schema":{"type":"boolean"}}}]}`))
+	a.NotError(err)
+	a.NotError(Generate(buf, "p", doc)).
+		NotContains(buf.String(), "encoding/json").
+		Contains(buf.String(), "out *bool")
+
+	// 按位置传递参数
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"m","paramStructure":"by-position","params":[]}]}`))
+
+	// 引用不存在的对象
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"m","params":[{"name":"p","schema":{"$ref":"#/components/schemas/X"}}]}]}`))
+
+	// 方法名冲突
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"a.b","params":[]},{"name":"a_b","params":[]}]}`))
+
+	// 类型名冲突
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"m","params":[]}],"components":{"schemas":{"MParams":{"type":"string"}}}}`))
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"m","params":[]}],"components":{"schemas":{"Client":{"type":"string"}}}}`))
+
+	// 字段名冲突
+	a.Error(generate(`{"openrpc":"1.2.6","methods":[{"name":"m","params":[{"name":"a-b"},{"name":"a_b"}]}]}`))
+}
+
+func TestExportName(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Equal(exportName("list_pets"), "ListPets").
+		Equal(exportName("pet.get"), "PetGet").
+		Equal(exportName("petId"), "PetId").
+		Equal(exportName("user.id"), "UserID").
+		Equal(exportName("2fa"), "X2fa").
+		Equal(exportName("..."), "X").
+		Equal(exportName("名称"), "X名称")
+}
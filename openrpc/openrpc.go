@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package openrpc 根据 OpenRPC 文档生成服务端和客户端的代码
+//
+// 生成的代码包含参数和返回值的类型定义、需要由服务端实现的 Service 接口、
+// 将 Service 注册到 [jsonrpc.Server] 的 Register 函数以及基于 [jsonrpc.Conn] 的 Client，
+// 由此可以先约定文档，再由各方分别实现服务端与客户端：
+//
+//	doc, err := openrpc.Parse(data)
+//	err = openrpc.Generate(w, "petstore", doc)
+//
+// 也可以直接使用 cmd/openrpcgen 命令。
+//
+// 仅支持 OpenRPC 规范中与代码生成相关的字段，schema 仅支持 JSON Schema 的常用子集，
+// 无法表示的类型会以 json.RawMessage 代替。
+package openrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Document OpenRPC 文档
+type Document struct {
+	OpenRPC    string      `json:"openrpc"`
+	Info       Info        `json:"info"`
+	Methods    []*Method   `json:"methods"`
+	Components *Components `json:"components,omitempty"`
+}
+
+// Info 文档的基本信息
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Method 服务的描述
+type Method struct {
+	Name        string               `json:"name"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Params      []*ContentDescriptor `json:"params"`
+
+	// 返回值，为空表示该服务为通知。
+	Result *ContentDescriptor `json:"result,omitempty"`
+
+	// 参数的传递方式，可以是 by-name、by-position 或 either，目前仅支持按名称传递。
+	ParamStructure string `json:"paramStructure,omitempty"`
+}
+
+// ContentDescriptor 参数或返回值的描述
+type ContentDescriptor struct {
+	Name        string  `json:"name"`
+	Summary     string  `json:"summary,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Components 可被引用的对象
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema JSON Schema 的子集
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        Types              `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+
+	// 可以是 bool 或是 *Schema
+	AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+}
+
+// Types JSON Schema 中的 type 字段
+//
+// 可以是单个字符串或是字符串数组。
+type Types []string
+
+const componentsPrefix = "#/components/schemas/"
+
+// Parse 解析 OpenRPC 文档
+func Parse(data []byte) (*Document, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+
+	if doc.OpenRPC == "" {
+		return nil, errors.New("缺少 openrpc 字段")
+	}
+	if len(doc.Methods) == 0 {
+		return nil, errors.New("未定义任何服务")
+	}
+
+	names := make(map[string]struct{}, len(doc.Methods))
+	for _, m := range doc.Methods {
+		if m.Name == "" {
+			return nil, errors.New("服务缺少 name 字段")
+		}
+		if _, found := names[m.Name]; found {
+			return nil, fmt.Errorf("服务 %s 重复定义", m.Name)
+		}
+		names[m.Name] = struct{}{}
+	}
+
+	return doc, nil
+}
+
+// 查找 ref 引用的 schema
+func (doc *Document) schema(ref string) (string, *Schema, error) {
+	if len(ref) <= len(componentsPrefix) || ref[:len(componentsPrefix)] != componentsPrefix {
+		return "", nil, fmt.Errorf("不支持的引用 %s", ref)
+	}
+
+	name := ref[len(componentsPrefix):]
+	if doc.Components != nil {
+		if s, found := doc.Components.Schemas[name]; found {
+			return name, s, nil
+		}
+	}
+	return "", nil, fmt.Errorf("引用的对象 %s 不存在", ref)
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Types{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// 除 null 之外的类型以及是否可以为 null
+func (t Types) primary() (typ string, nullable bool) {
+	for _, v := range t {
+		if v == "null" {
+			nullable = true
+		} else if typ == "" {
+			typ = v
+		}
+	}
+	return typ, nullable
+}
+
+// additionalProperties 的 schema
+//
+// 如果未指定或是为 false，返回 nil；为 true 时返回空的 schema。
+func (s *Schema) additional() (*Schema, error) {
+	if len(s.AdditionalProperties) == 0 {
+		return nil, nil
+	}
+
+	var b bool
+	if err := json.Unmarshal(s.AdditionalProperties, &b); err == nil {
+		if b {
+			return &Schema{}, nil
+		}
+		return nil, nil
+	}
+
+	ap := &Schema{}
+	if err := json.Unmarshal(s.AdditionalProperties, ap); err != nil {
+		return nil, err
+	}
+	return ap, nil
+}
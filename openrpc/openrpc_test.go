@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package openrpc
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestParse(t *testing.T) {
+	a := assert.New(t, false)
+
+	data, err := os.ReadFile("./testdata/petstore.json")
+	a.NotError(err)
+	doc, err := Parse(data)
+	a.NotError(err).NotNil(doc).
+		Equal(doc.Info.Title, "Petstore").
+		Length(doc.Methods, 4).
+		Equal(doc.Methods[1].Name, "pet.get").
+		True(doc.Methods[1].Params[0].Required).
+		Nil(doc.Methods[3].Result)
+
+	name, s, err := doc.schema("#/components/schemas/Pet")
+	a.NotError(err).Equal(name, "Pet").Equal(s.Description, "宠物")
+	_, _, err = doc.schema("#/components/schemas/Cat")
+	a.Error(err)
+	_, _, err = doc.schema("#/definitions/Pet")
+	a.Error(err)
+
+	_, err = Parse([]byte(`{`))
+	a.Error(err)
+	_, err = Parse([]byte(`{"methods":[{"name":"m"}]}`))
+	a.Error(err)
+	_, err = Parse([]byte(`{"openrpc":"1.2.6","methods":[]}`))
+	a.Error(err)
+	_, err = Parse([]byte(`{"openrpc":"1.2.6","methods":[{"name":""}]}`))
+	a.Error(err)
+	_, err = Parse([]byte(`{"openrpc":"1.2.6","methods":[{"name":"m"},{"name":"m"}]}`))
+	a.Error(err)
+}
+
+func TestTypes(t *testing.T) {
+	a := assert.New(t, false)
+
+	s := &Schema{}
+	a.NotError(json.Unmarshal([]byte(`{"type":"string"}`), s)).Equal(s.Type, Types{"string"})
+	typ, nullable := s.Type.primary()
+	a.Equal(typ, "string").False(nullable)
+
+	a.NotError(json.Unmarshal([]byte(`{"type":["null","integer"]}`), s)).Equal(s.Type, Types{"null", "integer"})
+	typ, nullable = s.Type.primary()
+	a.Equal(typ, "integer").True(nullable)
+
+	a.Error(json.Unmarshal([]byte(`{"type":5}`), s))
+
+	data, err := json.Marshal(Types{"string"})
+	a.NotError(err).Equal(string(data), `"string"`)
+	data, err = json.Marshal(Types{"string", "null"})
+	a.NotError(err).Equal(string(data), `["string","null"]`)
+}
+
+func TestSchema_additional(t *testing.T) {
+	a := assert.New(t, false)
+
+	s := &Schema{}
+	ap, err := s.additional()
+	a.NotError(err).Nil(ap)
+
+	s.AdditionalProperties = json.RawMessage("false")
+	ap, err = s.additional()
+	a.NotError(err).Nil(ap)
+
+	s.AdditionalProperties = json.RawMessage("true")
+	ap, err = s.additional()
+	a.NotError(err).Equal(ap, &Schema{})
+
+	s.AdditionalProperties = json.RawMessage(`{"type":"integer"}`)
+	ap, err = s.additional()
+	a.NotError(err).Equal(ap.Type, Types{"integer"})
+
+	s.AdditionalProperties = json.RawMessage(`5`)
+	_, err = s.additional()
+	a.Error(err)
+}
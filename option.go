@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MethodOption 注册服务时的选项
+//
+// 用于 [Registry.RegisterWith] 和 [Server.RegisterWith]，
+// 使与服务相关的策略都可以在注册时一并指定。
+type MethodOption func(*handler)
+
+// 令牌桶算法的限流
+type rateLimiter struct {
+	mux    sync.Mutex
+	rate   float64 // 每秒产生的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// WithTimeout 指定服务的执行超时时间
+//
+// 超时之后会向对方返回 [CodeTimeout] 错误。
+// 服务函数无法被中断，超时之后依然会在后台执行完毕，但是其返回值会被丢弃；
+// 在执行完毕之前依然占用 [WithConcurrency] 的并发数量。
+func WithTimeout(d time.Duration) MethodOption {
+	return func(h *handler) { h.timeout = d }
+}
+
+// WithConcurrency 限制服务的并发数量
+//
+// 参数的含义与 [Registry.Limit] 相同。
+func WithConcurrency(concurrency, queue int) MethodOption {
+	return func(h *handler) {
+		h.limit = nil
+		if concurrency > 0 {
+			h.limit = newLimiter(concurrency, queue)
+		}
+	}
+}
+
+// WithValidator 指定服务参数的验证函数
+//
+// 可用于根据 schema 等对参数进行验证，在 [Server.RegisterValidator]
+// 指定的函数之后执行，错误的处理方式也与之相同。
+func WithValidator(v func(params interface{}) error) MethodOption {
+	return func(h *handler) { h.validator = v }
+}
+
+// WithGuard 指定服务的访问控制函数
+//
+// 在执行服务之前调用，可用于权限验证等。
+// 如果返回了错误，则不再执行服务，错误的处理方式与 [Server.RegisterBefore] 相同。
+func WithGuard(g func(method string) error) MethodOption {
+	return func(h *handler) { h.guard = g }
+}
+
+// WithRateLimit 限制服务的调用频率
+//
+// rate 为每秒允许的调用次数，burst 为允许突发的最大次数，
+// 超出限制的请求直接返回 [CodeServerBusy] 错误。rate 小于等于 0 表示取消限制。
+func WithRateLimit(rate float64, burst int) MethodOption {
+	return func(h *handler) {
+		h.rate = nil
+		if rate > 0 {
+			h.rate = newRateLimiter(rate, burst)
+		}
+	}
+}
+
+// WithMigration 指定服务参数的迁移函数
+//
+// 在参数解码之前调用，用于将旧格式的参数转换为当前服务所需的格式，
+// 从而在服务参数格式变化之后，无需为旧的格式另外注册服务。
+// method 为请求时使用的服务名，在通过 [Registry.Alias] 添加的别名调用时，
+// 可以据此判断参数的版本；params 为原始的参数，未指定参数时为空，
+// 返回值为转换之后的参数。
+//
+// 多次指定时，按指定的顺序依次调用，前一个函数的返回值作为后一个函数的 params 参数，
+// 可以用于处理跨越多个版本的参数迁移。
+// 返回的错误如果是 *[Error]，则原样返回给对方，否则以 [CodeInvalidParams] 返回。
+func WithMigration(m func(method string, params json.RawMessage) (json.RawMessage, error)) MethodOption {
+	return func(h *handler) { h.migrations = append(h.migrations, m) }
+}
+
+// WithResultProcessor 指定服务返回数据的处理函数
+//
+// 在服务执行成功之后、返回数据编码之前调用，
+// 可用于根据对方的权限过滤字段、转换单位或是调整字段名称等。
+// p 为请求方的信息；method 为请求时使用的服务名；
+// result 为服务函数输出的对象，类型为服务函数第三个参数的类型，
+// 返回值为实际需要编码的对象，可以与 result 的类型不同。
+//
+// 多次指定时，按指定的顺序依次调用，前一个函数的返回值作为后一个函数的 result 参数。
+// 返回的错误如果是 *[Error]，则原样返回给对方，否则以 [CodeInternalError] 返回。
+// 通知没有返回数据，不会调用。
+func WithResultProcessor(f func(p Peer, method string, result interface{}) (interface{}, error)) MethodOption {
+	return func(h *handler) { h.processors = append(h.processors, f) }
+}
+
+// WithDescription 指定服务的描述信息
+//
+// 对于通过 [Registry.RegisterMatcherWith] 注册的服务，
+// 可以用于描述其匹配的服务名，并通过 [Registry.Matchers] 获取。
+func WithDescription(desc string) MethodOption {
+	return func(h *handler) { h.desc = desc }
+}
+
+// RegisterWith 注册一个新的服务并指定相关的选项
+//
+// method 和 f 与 [Registry.Register] 相同。
+func (r *Registry) RegisterWith(method string, f interface{}, opts ...MethodOption) bool {
+	if r.Exists(method) {
+		return false
+	}
+	return r.add(method, newHandler(f), opts)
+}
+
+func (r *Registry) add(method string, h *handler, opts []MethodOption) bool {
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return r.update(func(t *table) bool {
+		if t.exists(method) {
+			return false
+		}
+		t.servers[method] = h
+		return true
+	})
+}
+
+// RegisterWith 注册一个新的服务并指定相关的选项
+//
+// 具体说明可参考 [Registry.RegisterWith]。
+func (s *Server) RegisterWith(method string, f interface{}, opts ...MethodOption) bool {
+	return s.methods().RegisterWith(method, f, opts...)
+}
+
+// RegisterMatcherWith 注册服务名称通过函数判断的新服务并指定相关的选项
+//
+// 具体说明可参考 [Registry.RegisterMatcherWith]。
+func (s *Server) RegisterMatcherWith(m func(string) bool, f interface{}, opts ...MethodOption) {
+	s.methods().RegisterMatcherWith(m, f, opts...)
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// 获取一个令牌，如果没有可用的令牌，返回 false。
+//
+// now 为当前时间，第一次调用时令牌桶是满的。
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
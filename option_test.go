@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_RegisterWith(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	f := func(notify bool, in, out *int) error {
+		if *in > 0 {
+			time.Sleep(time.Duration(*in) * time.Millisecond)
+		}
+		*out = *in
+		return nil
+	}
+
+	a.False(srv.RegisterWith("f1", f))
+	a.True(srv.RegisterWith("timeout", f, WithTimeout(50*time.Millisecond)))
+	a.True(srv.RegisterWith("rate", f, WithRateLimit(1, 2)))
+	a.True(srv.RegisterWith("guard", f, WithGuard(func(string) error { return errors.New("deny") })))
+	a.True(srv.RegisterWith("validator", f, WithValidator(func(v interface{}) error {
+		if *v.(*int) < 0 {
+			return errors.New("negative")
+		}
+		return nil
+	})))
+	a.True(srv.RegisterWith("limit", f, WithConcurrency(1, 0), WithConcurrency(0, 0)))
+
+	call := func(method string, in int) *body {
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, new(bytes.Buffer), out, nil)
+		params := json.RawMessage(strconv.Itoa(in))
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: method, Params: &params}))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Nil(call("timeout", 1).Error)
+	a.Equal(call("timeout", 100).Error.Code, CodeTimeout)
+
+	a.Nil(call("rate", 1).Error)
+	a.Nil(call("rate", 1).Error)
+	a.Equal(call("rate", 1).Error.Code, CodeServerBusy)
+
+	a.Equal(call("guard", 1).Error.Code, CodeMethodNotFound)
+
+	a.Nil(call("validator", 1).Error)
+	a.Equal(call("validator", -1).Error.Code, CodeInvalidParams)
+
+	h, _ := srv.methods().lookup("limit")
+	a.Nil(h.limit)
+}
+
+func TestWithTimeout_concurrency(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	running := make(chan struct{}, 1)
+	exit := make(chan struct{})
+	a.True(srv.RegisterWith("block", func(bool, *int, *int) error {
+		running <- struct{}{}
+		<-exit
+		return nil
+	}, WithTimeout(10*time.Millisecond), WithConcurrency(1, 0)))
+
+	call := func() *Error {
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, new(bytes.Buffer), out, nil)
+		params := json.RawMessage("1")
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: "block", Params: &params}))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp.Error
+	}
+
+	a.Equal(call().Code, CodeTimeout)
+	<-running
+
+	// 第一个服务函数依然在执行，名额不会被释放。
+	a.Equal(call().Code, CodeServerBusy)
+
+	close(exit)
+	h, _ := srv.methods().lookup("block")
+	for len(h.limit.sem) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan *Error, 1)
+	go func() { done <- call() }()
+	<-running
+	a.Nil(<-done)
+}
+
+func TestRateLimiter(t *testing.T) {
+	a := assert.New(t, false)
+
+	now := time.Now()
+	l := newRateLimiter(100, 0)
+	a.True(l.allow(now)).False(l.allow(now))
+	a.False(l.allow(now.Add(5 * time.Millisecond)))
+	a.True(l.allow(now.Add(20 * time.Millisecond)))
+}
+
+func TestWithMigration(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	type params struct {
+		Name string `json:"name"`
+	}
+
+	// v1 的参数为字符串，v2 的参数为 {"first":""}，当前版本为 {"name":""}。
+	v1 := func(method string, p json.RawMessage) (json.RawMessage, error) {
+		if method != "user.v1" {
+			return p, nil
+		}
+		var name string
+		if err := json.Unmarshal(p, &name); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]string{"first": name})
+	}
+	v2 := func(method string, p json.RawMessage) (json.RawMessage, error) {
+		if method == "user" {
+			return p, nil
+		}
+		if method == "user.v0" {
+			return nil, NewError(CodeMethodNotFound, "不再支持")
+		}
+		v := map[string]string{}
+		if err := json.Unmarshal(p, &v); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&params{Name: v["first"]})
+	}
+
+	a.True(srv.RegisterWith("user", func(notify bool, in *params, out *string) error {
+		*out = in.Name
+		return nil
+	}, WithMigration(v1), WithMigration(v2)))
+	a.True(srv.Alias("user.v1", "user")).
+		True(srv.Alias("user.v2", "user")).
+		True(srv.Alias("user.v0", "user"))
+
+	call := func(method, params string) *body {
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, new(bytes.Buffer), out, nil)
+		p := json.RawMessage(params)
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: method, Params: &p}))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Equal(string(*call("user", `{"name":"n"}`).Result), `"n"`).
+		Equal(string(*call("user.v2", `{"first":"n2"}`).Result), `"n2"`).
+		Equal(string(*call("user.v1", `"n1"`).Result), `"n1"`).
+		Equal(call("user.v1", `{}`).Error.Code, CodeInvalidParams).
+		Equal(call("user.v0", `{}`).Error.Code, CodeMethodNotFound)
+}
+
+func TestWithResultProcessor(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	// 非管理员隐藏 Age 字段
+	filter := func(p Peer, method string, result interface{}) (interface{}, error) {
+		if p.Identity == "admin" {
+			return result, nil
+		}
+		return map[string]string{"name": result.(*outType).Name}, nil
+	}
+	deny := func(p Peer, method string, result interface{}) (interface{}, error) {
+		if p.Identity == "banned" {
+			return nil, errors.New("banned")
+		}
+		if p.Identity == "denied" {
+			return nil, NewError(CodeInvalidRequest, "denied")
+		}
+		return result, nil
+	}
+	a.True(srv.RegisterWith("user", f1, WithResultProcessor(filter), WithResultProcessor(deny)))
+
+	call := func(identity interface{}) *body {
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, new(bytes.Buffer), out, nil)
+		p := json.RawMessage(`{"first":"f","last":"l","Age":5}`)
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: "user", Params: &p, identity: identity}))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Equal(string(*call("admin").Result), `{"name":"fl","age":5}`).
+		Equal(string(*call(nil).Result), `{"name":"fl"}`).
+		Equal(call("banned").Error.Code, CodeInternalError).
+		Equal(call("denied").Error.Code, CodeInvalidRequest)
+}
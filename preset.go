@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var errPresetNotObject = errors.New("预设参数不是 JSON 对象，无法与 overrides 合并")
+
+// 已经编码的参数
+//
+// [Server.newRequest] 会直接使用，不再进行编码。
+type encodedParams json.RawMessage
+
+// Preset 预设的请求
+//
+// 对于轮询等需要反复发起相似请求的场景，可以将服务名、默认参数以及选项保存为 Preset，
+// 默认参数仅在创建时编码一次，之后的每次请求都直接使用编码后的内容。
+// 可以通过 [Conn.SendPreset] 和 [Conn.NotifyPreset] 发起请求。
+//
+// 创建之后不可修改，可以在多个连接之间共享。
+type Preset struct {
+	method string
+	params json.RawMessage            // 编码后的默认参数，为空表示没有参数。
+	fields map[string]json.RawMessage // 默认参数为对象时的各个字段
+	opts   []CallOption
+}
+
+// NewPreset 声明 [Preset] 对象
+//
+// method 为服务名；params 为默认参数，为 nil 表示没有参数；
+// opts 为每次请求都会应用的选项，调用时指定的选项在其之后应用。
+func NewPreset(method string, params interface{}, opts ...CallOption) (*Preset, error) {
+	p := &Preset{method: method, opts: opts}
+	if params == nil {
+		return p, nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	p.params = data
+
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &p.fields); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Method 服务名
+func (p *Preset) Method() string { return p.method }
+
+// 返回合并 overrides 之后的参数
+//
+// overrides 中的字段会覆盖默认参数中的同名字段，为 nil 时直接返回默认参数。
+func (p *Preset) encode(overrides interface{}) (interface{}, error) {
+	if overrides == nil {
+		if p.params == nil {
+			return nil, nil
+		}
+		return encodedParams(p.params), nil
+	}
+
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	if p.params == nil {
+		return encodedParams(data), nil
+	}
+
+	if p.fields == nil || len(data) == 0 || data[0] != '{' {
+		return nil, errPresetNotObject
+	}
+	fields := make(map[string]json.RawMessage, len(p.fields))
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range p.fields {
+		if _, found := fields[k]; !found {
+			fields[k] = v
+		}
+	}
+
+	if data, err = json.Marshal(fields); err != nil {
+		return nil, err
+	}
+	return encodedParams(data), nil
+}
+
+func (p *Preset) options(opts []CallOption) []CallOption {
+	if len(opts) == 0 {
+		return p.opts
+	}
+	if len(p.opts) == 0 {
+		return opts
+	}
+	return append(append(make([]CallOption, 0, len(p.opts)+len(opts)), p.opts...), opts...)
+}
+
+// SendPreset 以预设的内容发送请求
+//
+// overrides 为本次请求的参数，其字段会覆盖预设参数中的同名字段，
+// 为 nil 表示直接使用预设参数；
+// 如果预设参数不是 JSON 对象，则 overrides 必须为 nil。
+// 其它参数与 [Conn.SendContext] 相同。
+func (conn *Conn) SendPreset(ctx context.Context, p *Preset, overrides, callback interface{}, opts ...CallOption) error {
+	in, err := p.encode(overrides)
+	if err != nil {
+		return err
+	}
+	return conn.SendContext(ctx, p.method, in, callback, p.options(opts)...)
+}
+
+// NotifyPreset 以预设的内容发送通知
+//
+// overrides 与 [Conn.SendPreset] 相同，其它参数与 [Conn.Notify] 相同。
+func (conn *Conn) NotifyPreset(p *Preset, overrides interface{}, opts ...CallOption) error {
+	in, err := p.encode(overrides)
+	if err != nil {
+		return err
+	}
+	return conn.Notify(p.method, in, p.options(opts)...)
+}
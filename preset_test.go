@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestPreset_encode(t *testing.T) {
+	a := assert.New(t, false)
+
+	p, err := NewPreset("f1", &inType{First: "f", Last: "l"})
+	a.NotError(err).Equal(p.Method(), "f1")
+
+	in, err := p.encode(nil)
+	a.NotError(err).Equal(in, encodedParams(`{"last":"l","first":"f","Age":0}`))
+
+	in, err = p.encode(map[string]interface{}{"Age": 5, "last": "x"})
+	a.NotError(err).Equal(in, encodedParams(`{"Age":5,"first":"f","last":"x"}`))
+
+	_, err = p.encode([]int{1})
+	a.Equal(err, errPresetNotObject)
+
+	// 非对象
+	p, err = NewPreset("f1", []int{1, 2})
+	a.NotError(err)
+	in, err = p.encode(nil)
+	a.NotError(err).Equal(in, encodedParams(`[1,2]`))
+	_, err = p.encode(map[string]int{"Age": 1})
+	a.Equal(err, errPresetNotObject)
+
+	// 无参数
+	p, err = NewPreset("f1", nil)
+	a.NotError(err)
+	in, err = p.encode(nil)
+	a.NotError(err).Nil(in)
+	in, err = p.encode(&inType{Age: 1})
+	a.NotError(err).Equal(in, encodedParams(`{"last":"","first":"","Age":1}`))
+
+	_, err = NewPreset("f1", make(chan int))
+	a.Error(err)
+}
+
+func TestConn_SendPreset(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out, nil), nil)
+	p, err := NewPreset("f1", &inType{First: "f", Last: "l"}, WithMetadata(map[string]json.RawMessage{"trace": json.RawMessage(`1`)}))
+	a.NotError(err)
+
+	a.NotError(conn.NotifyPreset(p, map[string]int{"Age": 5}))
+	a.Contains(out.String(), `"method":"f1"`).
+		Contains(out.String(), `"params":{"Age":5,"first":"f","last":"l"}`).
+		Contains(out.String(), `"trace":1`)
+
+	out.Reset()
+	a.NotError(conn.SendPreset(context.Background(), p, nil, func(*outType) error { return nil }, WithMetadata(nil)))
+	a.Contains(out.String(), `"params":{"last":"l","first":"f","Age":0}`).
+		NotContains(out.String(), `"trace"`).
+		Contains(out.String(), `"id":`)
+
+	a.Error(conn.NotifyPreset(p, []int{1}))
+	a.Error(conn.SendPreset(context.Background(), p, []int{1}, func(*outType) error { return nil }))
+}
+
+func BenchmarkConn_NotifyPreset(b *testing.B) {
+	a := assert.New(b, false)
+	srv := NewServer(func() string { return "1" })
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), out, nil), nil)
+	p, err := NewPreset("f1", &inType{First: "f", Last: "l", Age: 5})
+	a.NotError(err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		a.NotError(conn.NotifyPreset(p, nil))
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// Priority 写入数据的优先级
+type Priority int8
+
+// 写入数据的优先级，值越大优先级越高。
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	priorityLen
+)
+
+var errTransportClosed = errors.New("传输层已经关闭")
+
+type priorityTransport struct {
+	Transport
+	priority func(method string, err *Error) Priority
+
+	mux    sync.Mutex
+	cond   *sync.Cond
+	lanes  [priorityLen][]*priorityItem
+	closed bool
+}
+
+type priorityItem struct {
+	v    interface{}
+	done chan error
+}
+
+// DefaultPriority 默认的优先级判断函数
+//
+// 错误信息为 [PriorityHigh]，其它为 [PriorityNormal]。
+func DefaultPriority(method string, err *Error) Priority {
+	if err != nil {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// NewPriorityTransport 为 t 添加带优先级的写入队列
+//
+// 所有的写入操作都会先进入队列，再由单独的 goroutine 按优先级依次写入 t，
+// 同一优先级的数据保持先进先出。在连接拥堵时，高优先级的数据，
+// 比如错误信息、取消请求等，可以跳过排在前面的大量数据先行发送。
+// Write 会等待数据真正写入之后才返回。
+//
+// priority 用于判断数据的优先级，method 为请求的服务名，如果是返回数据则为空；
+// err 为返回的错误信息，如果不是错误则为 nil。为空表示采用 [DefaultPriority]。
+//
+// NOTE: 需要调用 Close 才能释放写入队列所占用的 goroutine。
+func NewPriorityTransport(t Transport, priority func(method string, err *Error) Priority) Transport {
+	if priority == nil {
+		priority = DefaultPriority
+	}
+
+	pt := &priorityTransport{
+		Transport: t,
+		priority:  priority,
+	}
+	pt.cond = sync.NewCond(&pt.mux)
+	go pt.loop()
+
+	return pt
+}
+
+func (t *priorityTransport) getPriority(v interface{}) Priority {
+	b := bodyOf(v)
+	if b == nil {
+		return PriorityNormal
+	}
+
+	p := t.priority(b.Method, b.Error)
+	if b.opts != nil && b.opts.hasPriority {
+		p = b.opts.priority
+	}
+	switch {
+	case p < PriorityLow:
+		return PriorityLow
+	case p > PriorityHigh:
+		return PriorityHigh
+	default:
+		return p
+	}
+}
+
+func (t *priorityTransport) Write(v interface{}) error {
+	item := &priorityItem{v: v, done: make(chan error, 1)}
+	p := t.getPriority(v)
+
+	t.mux.Lock()
+	if t.closed {
+		t.mux.Unlock()
+		return errTransportClosed
+	}
+	t.lanes[p] = append(t.lanes[p], item)
+	t.cond.Signal()
+	t.mux.Unlock()
+
+	return <-item.done
+}
+
+// 取出优先级最高的数据，如果已经关闭，则返回 nil。
+func (t *priorityTransport) pop() *priorityItem {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for {
+		if t.closed {
+			return nil
+		}
+
+		for p := PriorityHigh; p >= PriorityLow; p-- {
+			if lane := t.lanes[p]; len(lane) > 0 {
+				t.lanes[p] = lane[1:]
+				return lane[0]
+			}
+		}
+
+		t.cond.Wait()
+	}
+}
+
+func (t *priorityTransport) loop() {
+	for {
+		item := t.pop()
+		if item == nil {
+			return
+		}
+		item.done <- t.Transport.Write(item.v)
+	}
+}
+
+func (t *priorityTransport) Close() error {
+	t.mux.Lock()
+	t.closed = true
+	for p, lane := range t.lanes {
+		for _, item := range lane {
+			item.done <- errTransportClosed
+		}
+		t.lanes[p] = nil
+	}
+	t.cond.Broadcast()
+	t.mux.Unlock()
+
+	return t.Transport.Close()
+}
+
+func (t *priorityTransport) Peer() string { return peerOf(t.Transport) }
+
+func (t *priorityTransport) setClock(c Clock) {
+	if s, ok := t.Transport.(clockSetter); ok {
+		s.setClock(c)
+	}
+}
+
+func (t *priorityTransport) limitSize(size int64) {
+	if l, ok := t.Transport.(sizeLimiter); ok {
+		l.limitSize(size)
+	}
+}
+
+func (t *priorityTransport) CompressionStats() *CompressionStats {
+	if c, ok := t.Transport.(compressionStater); ok {
+		return c.CompressionStats()
+	}
+	return nil
+}
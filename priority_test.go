@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Transport = &priorityTransport{}
+
+// 在 release 之前，所有的写入都会被阻塞。
+type blockTransport struct {
+	Transport
+	release chan struct{}
+	mux     sync.Mutex
+	written []string
+}
+
+func (t *blockTransport) Write(v interface{}) error {
+	<-t.release
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.written = append(t.written, v.(*body).Method)
+	return nil
+}
+
+func TestNewPriorityTransport(t *testing.T) {
+	a := assert.New(t, false)
+
+	bt := &blockTransport{
+		Transport: NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil),
+		release:   make(chan struct{}),
+	}
+	pt := NewPriorityTransport(bt, func(method string, err *Error) Priority {
+		switch method {
+		case "high":
+			return PriorityHigh
+		case "low":
+			return PriorityLow - 1 // 超出范围
+		default:
+			return DefaultPriority(method, err)
+		}
+	})
+
+	wg := &sync.WaitGroup{}
+	write := func(method string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.NotError(pt.Write(&body{Method: method}))
+		}()
+		time.Sleep(50 * time.Millisecond) // 保证进入队列的顺序
+	}
+
+	write("first") // 正在写入
+	write("low")
+	write("normal1")
+	write("normal2")
+	write("high")
+
+	close(bt.release)
+	wg.Wait()
+	a.Equal(bt.written, []string{"first", "high", "normal1", "normal2", "low"})
+
+	a.NotError(pt.Close())
+	a.Equal(pt.Write(&body{}), errTransportClosed)
+
+	a.Equal(DefaultPriority("", NewError(CodeInternalError, "")), PriorityHigh).
+		Equal(DefaultPriority("m", nil), PriorityNormal)
+}
+
+func TestNewPriorityTransport_forward(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := bytes.NewBufferString("Content-Length:60\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"f1\",\"params\":\"" + strings.Repeat("x", 17) + "\"}")
+	conn := srv.NewConn(NewPriorityTransport(NewStreamTransport(true, in, new(bytes.Buffer), nil), nil), nil)
+	defer conn.transport.Close()
+
+	// MaxMessageSize 依然有效
+	conn.MaxMessageSize(50)
+	var tl *tooLargeError
+	a.True(errors.As(conn.transport.Read(&body{}), &tl)).Equal(tl.limit, 50)
+
+	// Peer
+	srvConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	pt := NewPriorityTransport(NewSocketTransport(true, srvConn, 0), nil)
+	defer pt.Close()
+	a.Equal(peerOf(pt), srvConn.RemoteAddr().String())
+}
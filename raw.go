@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import "encoding/json"
+
+// 在解码的同时保留原始数据的 body
+type rawBody struct {
+	v    interface{} // *body 或是 *extBody
+	body *body
+}
+
+// RawHandler 指定处理请求原始数据的函数
+//
+// raw 为请求对象未经解码的原始数据，已经去掉了传输层的报头以及压缩等处理，
+// 可用于签名验证、校验和或是需要完整记录请求内容的审计日志等。
+// 该函数在 [Server.RegisterBefore] 注册的函数之前调用，
+// 如果返回错误，则会中断调用，返回错误尽量采用 [Error] 类型，
+// 其它类型的错误以 [CodeInvalidRequest] 返回给客户端。
+//
+// 保留原始数据需要额外的内存复制，h 为空表示不再保留原始数据。
+// 多次调用会相互覆盖。
+func (s *Server) RawHandler(h func(method string, raw []byte) error) { s.raw = h }
+
+func (b *rawBody) UnmarshalJSON(data []byte) error {
+	// data 在返回之后可能会被复用，需要复制。
+	// 在解码之前复制，以便在解码失败时依然可以获取原始数据。
+	b.body.raw = append([]byte(nil), data...)
+	return json.Unmarshal(data, b.v)
+}
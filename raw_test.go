@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_RawHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	transport := NewStreamTransport(true, in, out, nil)
+
+	// 未指定处理函数，不保留原始数据。
+	in.WriteString("Content-Length: 59\r\n\r\n" + `{"jsonrpc":"2.0","id":"1","method":"f1","params":{"age":1}}`)
+	req, err := srv.read(transport)
+	a.NotError(err).NotNil(req).Nil(req.raw)
+
+	const data = `{"jsonrpc":"2.0","id":"1","method":"f1","params":{ "age":1}}`
+	var method, raw string
+	srv.RawHandler(func(m string, r []byte) error {
+		method = m
+		raw = string(r)
+		if m == "f2" {
+			return errors.New("invalid signature")
+		}
+		return nil
+	})
+
+	in.WriteString("Content-Length: 60\r\n\r\n" + data)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).
+		Equal(method, "f1").
+		Equal(raw, data).
+		Contains(out.String(), `"result"`)
+
+	// 返回错误
+	out.Reset()
+	in.WriteString("Content-Length: 52\r\n\r\n" + `{"jsonrpc":"2.0","id":"2","method":"f2","params":{}}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).
+		Equal(method, "f2").
+		Contains(out.String(), "-32600").
+		Contains(out.String(), "invalid signature")
+
+	// 同时保留扩展字段
+	srv.KeepExtensions(true)
+	in.WriteString("Content-Length: 58\r\n\r\n" + `{"jsonrpc":"2.0","id":"3","method":"f1","params":{},"x":1}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req).
+		Equal(string(req.raw), `{"jsonrpc":"2.0","id":"3","method":"f1","params":{},"x":1}`).
+		Equal(string(req.extensions["x"]), "1")
+}
@@ -0,0 +1,318 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry 服务的注册表
+//
+// [Server] 通过 Registry 查找请求对应的服务，
+// 可以通过 [Server.Swap] 一次性替换 [Server] 当前使用的注册表。
+//
+// 注册表一般只在启动时写入，之后被大量读取，所以采用了写时复制的方式：
+// 查找服务时无需加锁，而每次写入都会复制整个表。
+// 需要注册大量服务时，可以通过 [Registry.Registers] 一次性写入，只产生一次复制。
+type Registry struct {
+	mux   sync.Mutex   // 写入时的锁
+	table atomic.Value // *table
+}
+
+// 服务表，一旦发布便不再修改。
+type table struct {
+	servers  map[string]*handler
+	matchers []matcher
+	aliases  map[string]string
+	versions map[string][]int // 服务名对应的所有版本号，已排序。
+}
+
+type matcher struct {
+	matcher func(string) bool
+	h       *handler
+}
+
+// NewRegistry 声明空的 [Registry] 对象
+func NewRegistry() *Registry {
+	r := &Registry{}
+	r.table.Store(&table{
+		servers:  map[string]*handler{},
+		matchers: []matcher{},
+		aliases:  map[string]string{},
+		versions: map[string][]int{},
+	})
+	return r
+}
+
+func (r *Registry) load() *table { return r.table.Load().(*table) }
+
+// 复制当前的服务表并交由 f 修改，f 返回 true 时发布修改后的表。
+func (r *Registry) update(f func(*table) bool) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	old := r.load()
+	t := &table{
+		servers:  make(map[string]*handler, len(old.servers)+1),
+		matchers: make([]matcher, len(old.matchers), len(old.matchers)+1),
+		aliases:  make(map[string]string, len(old.aliases)),
+		versions: make(map[string][]int, len(old.versions)),
+	}
+	for k, v := range old.servers {
+		t.servers[k] = v
+	}
+	copy(t.matchers, old.matchers)
+	for k, v := range old.aliases {
+		t.aliases[k] = v
+	}
+	for k, v := range old.versions {
+		t.versions[k] = v
+	}
+
+	if !f(t) {
+		return false
+	}
+	r.table.Store(t)
+	return true
+}
+
+func (t *table) exists(method string) bool {
+	if _, found := t.servers[method]; found {
+		return true
+	}
+	_, found := t.aliases[method]
+	return found
+}
+
+// Register 注册一个新的服务
+//
+// f 为处理服务的函数，其原型为以下方式：
+//
+//	func(notify bool, params, result pointer) error
+//
+// 其中 notify 表示是否为通知类型的请求；params 为用户请求的对象；
+// result 为返回给用户的数据对象；error 则为处理出错是的返回值。
+// params 和 result 必须为指针类型。
+//
+// f 也可以带有 context.Context 作为第一个参数：
+//
+//	func(ctx context.Context, notify bool, params, result pointer) error
+//
+// ctx 在 [Conn.Serve] 退出或是 HTTP 请求结束时取消，
+// 如果请求带有截止时间或是通过 [WithTimeout] 指定了超时时间，则 ctx 也会带有相应的截止时间，
+// 执行时间较长的服务可以据此提前退出。
+// 此外，还可以通过 ctx 调用 [NotifyCaller]、[ConnValues] 和 [TraceParent] 等函数。
+//
+// 如果 params 和 result 实现了 [json.Unmarshaler] 和 [json.Marshaler]，
+// 则会直接调用相应的方法进行编解码，而不是通过 encoding/json 的反射。
+// 对于由 easyjson 等工具生成的类型，可以以此获得更高的性能。
+//
+// params 也可以是 io.Reader 或是 *json.Decoder 类型，此时参数不会被解码为对象，
+// 而是由 f 自行读取，适用于批量导入等参数较大且可以逐步处理的场景。
+// 未指定参数时，读取会直接返回 io.EOF。这种情况下 [WithValidator] 等验证函数不会被调用。
+//
+// 返回值表示是否添加成功，在已经存在相同值时，会添加失败。
+//
+// NOTE: 如果 f 的签名不正确，则会直接 panic
+func (r *Registry) Register(method string, f interface{}) bool {
+	return r.RegisterWith(method, f)
+}
+
+// RegisterMatcher 注册服务名称通过函数判断的新服务
+//
+// m 为服务名称的匹配方法，其原型如下：
+//
+//	func(method string) bool
+//
+// 如果服务名称能正确匹配则返回 true。
+//
+// 通过 RegisterMatcher 注册的服务，其权重要低于 Register 注册的服务，
+// 即一个服务名称只有在 Register 注册的列表中找不到，才会考虑通过在
+// RegisterMatcher 注册的列表中查找。
+func (r *Registry) RegisterMatcher(m func(string) bool, f interface{}) {
+	r.RegisterMatcherWith(m, f)
+}
+
+// RegisterMatcherWith 注册服务名称通过函数判断的新服务并指定相关的选项
+//
+// m 和 f 与 [Registry.RegisterMatcher] 相同。
+func (r *Registry) RegisterMatcherWith(m func(string) bool, f interface{}, opts ...MethodOption) {
+	h := newHandler(f)
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	r.update(func(t *table) bool {
+		t.matchers = append(t.matchers, matcher{matcher: m, h: h})
+		return true
+	})
+}
+
+// Exists 是否已经存在相同的方法名
+//
+// 通过 [Registry.Alias] 添加的别名也被视为已经存在。
+func (r *Registry) Exists(method string) bool { return r.load().exists(method) }
+
+// Registers 注册多个服务方法
+//
+// 所有的服务只产生一次复制，且要么全部添加成功，要么都不添加。
+// 如果已经存在相同的方法名，则会直接 panic
+func (r *Registry) Registers(methods map[string]interface{}) {
+	handlers := make(map[string]*handler, len(methods))
+	for method, f := range methods {
+		handlers[method] = newHandler(f)
+	}
+
+	r.update(func(t *table) bool {
+		for method, h := range handlers {
+			if t.exists(method) {
+				panic("已经存在相同的方法：" + method)
+			}
+			t.servers[method] = h
+		}
+		return true
+	})
+}
+
+// RegisterService 注册 svc 中所有符合要求的导出方法
+//
+// 与 net/rpc 类似，svc 的导出方法中签名符合 [Registry.Register] 要求的，
+// 都会以 name.Method 的形式注册为服务，其它的方法会被忽略。
+// name 为空时采用 svc 的类型名称。
+// 如果方法是以指针作为接收者的，那么 svc 也需要是指针。
+//
+// 所有的服务要么全部添加成功，要么都不添加，已经存在相同的方法名时返回 false。
+//
+// NOTE: 如果 svc 没有任何符合要求的方法，则会直接 panic
+func (r *Registry) RegisterService(name string, svc interface{}) bool {
+	v := reflect.ValueOf(svc)
+	if name == "" {
+		name = reflect.Indirect(v).Type().Name()
+	}
+
+	typ := v.Type()
+	handlers := make(map[string]*handler, typ.NumMethod())
+	for i := 0; i < typ.NumMethod(); i++ {
+		if h := handlerOf(v.Method(i)); h != nil {
+			handlers[name+"."+typ.Method(i).Name] = h
+		}
+	}
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("%s 没有可注册的方法", typ.String()))
+	}
+
+	return r.update(func(t *table) bool {
+		for method := range handlers {
+			if t.exists(method) {
+				return false
+			}
+		}
+		for method, h := range handlers {
+			t.servers[method] = h
+		}
+		return true
+	})
+}
+
+// Alias 为服务 method 添加别名 old
+//
+// 一般用于服务改名之后，让旧的名称依然可以使用。
+// 通过 old 调用时，会触发由 [Server.DeprecatedHandler] 注册的函数，
+// 且在返回错误信息时，如果 [Error.Data] 为空，会附加 [Deprecation] 对象作为提示。
+//
+// 如果 method 不存在或是 old 已经存在，则返回 false。
+func (r *Registry) Alias(old, method string) bool {
+	return r.update(func(t *table) bool {
+		if _, found := t.servers[method]; !found || t.exists(old) {
+			return false
+		}
+		t.aliases[old] = method
+		return true
+	})
+}
+
+// Limit 限制服务 method 的并发数量
+//
+// concurrency 为同时执行的最大数量，超出的请求会进入等待队列；
+// queue 为等待队列的最大长度，队列已满时，请求直接返回 [CodeServerBusy] 错误，
+// 为 0 表示不等待，超出并发数量即返回错误。
+// concurrency 小于等于 0 表示取消限制。
+//
+// 该限制与服务绑定，通过别名调用时同样受限制。
+// 如果 method 不存在，返回 false。
+func (r *Registry) Limit(method string, concurrency, queue int) bool {
+	return r.update(func(t *table) bool {
+		f, found := t.servers[method]
+		if !found {
+			return false
+		}
+
+		h := *f
+		WithConcurrency(concurrency, queue)(&h)
+		t.servers[method] = &h
+		return true
+	})
+}
+
+// Methods 返回所有通过名称注册的服务名
+//
+// 返回值已经排序，不包含别名以及通过 [Registry.RegisterMatcher] 注册的服务。
+// 可用于生成帮助信息或是命令行的自动补全等。
+func (r *Registry) Methods() []string {
+	t := r.load()
+	methods := make([]string, 0, len(t.servers))
+	for k := range t.servers {
+		methods = append(methods, k)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Matchers 返回所有通过函数匹配的服务的描述信息
+//
+// 按注册顺序返回，描述信息由 [Registry.RegisterMatcherWith] 的 [WithDescription] 指定，
+// 未指定的其描述为空字符串。
+func (r *Registry) Matchers() []string {
+	t := r.load()
+	desc := make([]string, 0, len(t.matchers))
+	for _, m := range t.matchers {
+		desc = append(desc, m.h.desc)
+	}
+	return desc
+}
+
+// 查找 method 对应的服务
+//
+// 如果 method 是别名，alias 返回实际的服务名，否则为空；
+// 找不到返回 nil。
+func (r *Registry) lookup(method string) (h *handler, alias string) {
+	t := r.load()
+	if h, found := t.servers[method]; found {
+		return h, ""
+	}
+
+	if name, found := t.aliases[method]; found {
+		if h, found := t.servers[name]; found {
+			return h, name
+		}
+	}
+
+	if versions := t.versions[method]; len(versions) > 0 { // 未指定版本，采用最新的版本。
+		if h, found := t.servers[versionedName(method, versions[len(versions)-1])]; found {
+			return h, ""
+		}
+	}
+
+	for _, m := range t.matchers {
+		if m.matcher(method) {
+			return m.h, ""
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestRegistry_lookup(t *testing.T) {
+	a := assert.New(t, false)
+
+	r := NewRegistry()
+	a.True(r.Register("f1", f1)).
+		False(r.Register("f1", f1)).
+		True(r.Alias("old", "f1"))
+	r.RegisterMatcher(func(m string) bool { return strings.HasPrefix(m, "ok/") }, f2)
+
+	h, alias := r.lookup("f1")
+	a.NotNil(h).Empty(alias)
+
+	h, alias = r.lookup("old")
+	a.NotNil(h).Equal(alias, "f1")
+
+	h, alias = r.lookup("ok/1")
+	a.NotNil(h).Empty(alias)
+
+	h, alias = r.lookup("not-exists")
+	a.Nil(h).Empty(alias)
+}
+
+func TestServer_Swap(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.Exists("f1"))
+
+	r := NewRegistry()
+	r.Registers(map[string]interface{}{"f4": f1})
+
+	old := srv.Swap(r)
+	a.NotNil(old).
+		True(old.Exists("f1")).
+		False(srv.Exists("f1")).
+		True(srv.Exists("f4"))
+
+	// 之后的注册作用于新的注册表
+	a.True(srv.Register("f5", f1)).
+		True(r.Exists("f5")).
+		False(old.Exists("f5"))
+
+	a.Equal(srv.Swap(old), r).True(srv.Exists("f1"))
+}
+
+func TestServer_Limit(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	release := make(chan struct{})
+	a.True(srv.Register("slow", func(notify bool, in, out *int) error {
+		<-release
+		return nil
+	}))
+	a.False(srv.Limit("not-exists", 1, 1)).
+		True(srv.Limit("slow", 1, 1)).
+		True(srv.Alias("old", "slow"))
+
+	call := func(method string) *body {
+		out := new(bytes.Buffer)
+		req, err := srv.newRequest(false, method, 1)
+		a.NotError(err)
+		a.NotError(srv.response(NewStreamTransport(false, new(bytes.Buffer), out, nil), req))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	results := make(chan *body, 2)
+	go func() { results <- call("slow") }() // 执行
+	time.Sleep(50 * time.Millisecond)
+	go func() { results <- call("old") }() // 等待
+	time.Sleep(50 * time.Millisecond)
+
+	resp := call("slow") // 超出队列长度
+	a.Equal(resp.Error.Code, CodeServerBusy)
+
+	close(release)
+	a.Nil((<-results).Error).Nil((<-results).Error)
+
+	// 取消限制
+	a.True(srv.Limit("slow", 0, 0))
+	h, _ := srv.methods().lookup("slow")
+	a.Nil(h.limit)
+}
+
+func TestServer_Methods(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.True(srv.Alias("old", "f1"))
+	a.True(srv.RegisterWith("a", f1, WithDescription("a")))
+	a.Equal(srv.Methods(), []string{"a", "f1", "f2", "f3"})
+
+	srv.RegisterMatcherWith(func(string) bool { return false }, f1, WithDescription("never"))
+	a.Equal(srv.Matchers(), []string{"", "never"})
+
+	a.Empty(NewRegistry().Methods()).Empty(NewRegistry().Matchers())
+}
+
+func TestRegistry_Registers(t *testing.T) {
+	a := assert.New(t, false)
+
+	r := NewRegistry()
+	r.Registers(map[string]interface{}{"f1": f1, "f2": f2})
+	a.Equal(r.Methods(), []string{"f1", "f2"})
+
+	// 存在相同的服务时，所有服务都不添加。
+	a.Panic(func() {
+		r.Registers(map[string]interface{}{"f3": f3, "f1": f1})
+	})
+	a.Equal(r.Methods(), []string{"f1", "f2"})
+}
+
+type arith struct{ calls int }
+
+func (arith) Add(_ bool, in *[2]int, out *int) error {
+	*out = in[0] + in[1]
+	return nil
+}
+
+func (a *arith) Mul(_ context.Context, _ bool, in *[2]int, out *int) error {
+	a.calls++
+	*out = in[0] * in[1]
+	return nil
+}
+
+func (arith) String() string { return "arith" }
+
+func TestRegistry_RegisterService(t *testing.T) {
+	a := assert.New(t, false)
+
+	r := NewRegistry()
+	a.True(r.RegisterService("", arith{}))
+	a.Equal(r.Methods(), []string{"arith.Add"})
+
+	svc := &arith{}
+	a.True(r.RegisterService("math", svc))
+	a.Equal(r.Methods(), []string{"arith.Add", "math.Add", "math.Mul"})
+
+	h, _ := r.lookup("math.Mul")
+	a.NotNil(h).True(h.ctx)
+	params := json.RawMessage("[3,4]")
+	out, err := h.exec(context.Background(), &body{Version: Version, ID: NewNumberID(1), Params: &params}, nil)
+	a.NotError(err).Equal(*(out.(*int)), 12).Equal(svc.calls, 1)
+
+	// 存在相同的服务时，所有服务都不添加。
+	a.True(r.Register("other.Mul", f1))
+	a.False(r.RegisterService("other", &arith{}))
+	a.Equal(r.Methods(), []string{"arith.Add", "math.Add", "math.Mul", "other.Mul"})
+
+	// 没有符合要求的方法
+	a.Panic(func() { r.RegisterService("invalid", strings.Builder{}) })
+}
+
+func BenchmarkRegistry_lookup(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 100; i++ {
+		r.Register("method"+strconv.Itoa(i), f1)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if h, _ := r.lookup("method50"); h == nil {
+				b.Fatal("not found")
+			}
+		}
+	})
+}
+
+// 需要 -race 才能检测出问题
+func TestServer_Register_concurrent(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			name := "c" + strconv.Itoa(i)
+			srv.Register(name, f1)
+			srv.Alias(name+"-old", name)
+			srv.RegisterMatcher(func(m string) bool { return m == name+"-m" }, f1)
+			srv.RegisterVersion(name, 2, f1)
+			srv.methods().Limit(name, 2, 2)
+			srv.RegisterBefore(func(string) error { return nil })
+			srv.RegisterCallbackBefore(func(context.Context, string) error { return nil })
+		}
+		srv.Swap(NewRegistry())
+	}()
+
+	for i := 0; i < 50; i++ {
+		p := json.RawMessage(`{}`)
+		req := &body{Version: Version, ID: srv.id(), Method: "c" + strconv.Itoa(i%10), Params: &p}
+		a.NotError(srv.response(NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil), req))
+		srv.Methods()
+		srv.Exists("f1")
+	}
+	<-done
+
+	a.Empty(srv.Methods())
+}
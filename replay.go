@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	nonceField = "nonce" // 防止重放的扩展字段，与 [WithTTL] 共用 timestamp 字段。
+	nonceSize  = 16      // nonce 的字节数
+)
+
+var (
+	errMissingNonce = errors.New("缺少 nonce 或是 timestamp 字段")
+	errInvalidNonce = errors.New("无效的 nonce 或是 timestamp 字段")
+	errNonceExpired = errors.New("请求的时间超出了允许的范围")
+	errReplayed     = errors.New("重复的请求")
+)
+
+// 已经使用过的 nonce
+type replayWindow struct {
+	mux    sync.Mutex
+	window time.Duration
+	seen   map[string]struct{}
+	queue  []nonceItem // 按接收时间排序
+}
+
+type nonceItem struct {
+	nonce  string
+	expire time.Time
+}
+
+// WithNonce 为请求附加随机的 nonce
+//
+// 会在请求中附加 nonce 和 timestamp 两个扩展字段，
+// 用于对方通过 [Server.ReplayWindow] 识别重放的请求。
+// 如果传输层对请求进行了签名或是加密，这两个字段也应该包含在签名的内容中。
+func WithNonce() CallOption {
+	return func(o *callOptions) { o.nonce = true }
+}
+
+// ReplayWindow 开启请求的重放保护
+//
+// 开启之后，请求必须带有通过 [WithNonce] 附加的 nonce 和 timestamp 字段，
+// timestamp 与当前时间相差超过 window，或是 nonce 已经使用过的请求，
+// 都不会被执行，而是返回 [CodeReplay] 错误。
+// 对于通过不可信的网络公开，且会执行命令的服务，应该与签名或是加密的传输层一起使用，
+// 否则攻击者可以直接修改 nonce。
+//
+// 已经使用过的 nonce 会保留 2*window 的时间，window 越大占用的内存也越多，
+// 同时 window 应该远大于双方时钟的误差。
+// 需要开启 [Server.KeepExtensions]，window 小于等于 0 表示关闭重放保护。
+//
+// NOTE: 需要在处理请求之前调用。
+func (s *Server) ReplayWindow(window time.Duration) {
+	if window <= 0 {
+		s.replay = nil
+		return
+	}
+	s.replay = &replayWindow{window: window, seen: make(map[string]struct{}, 100)}
+}
+
+// 返回在 md 的基础上添加了 nonce 字段的扩展字段，md 本身不会被修改。
+func withNonce(md map[string]json.RawMessage, now time.Time) map[string]json.RawMessage {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+
+	ext := make(map[string]json.RawMessage, len(md)+2)
+	for k, v := range md {
+		ext[k] = v
+	}
+	ext[nonceField] = json.RawMessage(`"` + hex.EncodeToString(nonce) + `"`)
+	ext[timestampField] = json.RawMessage(strconv.FormatInt(now.UnixMilli(), 10))
+	return ext
+}
+
+// 检测请求 req 是否为重放的请求
+func (w *replayWindow) check(req *body, now time.Time) error {
+	nonceData, found := req.extensions[nonceField]
+	if !found {
+		return errMissingNonce
+	}
+	tsData, found := req.extensions[timestampField]
+	if !found {
+		return errMissingNonce
+	}
+
+	var nonce string
+	var ts int64
+	if json.Unmarshal(nonceData, &nonce) != nil || nonce == "" || json.Unmarshal(tsData, &ts) != nil {
+		return errInvalidNonce
+	}
+
+	if d := now.Sub(time.UnixMilli(ts)); d > w.window || d < -w.window {
+		return errNonceExpired
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.purge(now)
+	if _, found := w.seen[nonce]; found {
+		return errReplayed
+	}
+	w.seen[nonce] = struct{}{}
+	w.queue = append(w.queue, nonceItem{nonce: nonce, expire: now.Add(2 * w.window)})
+	return nil
+}
+
+// 清除已经过期的 nonce
+//
+// timestamp 可以比当前时间晚 window，所以 nonce 至少需要保留 2*window。
+func (w *replayWindow) purge(now time.Time) {
+	var i int
+	for ; i < len(w.queue) && now.After(w.queue[i].expire); i++ {
+		delete(w.seen, w.queue[i].nonce)
+	}
+	if i > 0 {
+		w.queue = append(w.queue[:0], w.queue[i:]...)
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestWithNonce(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Now()
+
+	md := map[string]json.RawMessage{"k": json.RawMessage(`1`)}
+	ext := withNonce(md, now)
+	a.Length(md, 1).Length(ext, 3).
+		Equal(string(ext[timestampField]), strconv.FormatInt(now.UnixMilli(), 10))
+	var nonce string
+	a.NotError(json.Unmarshal(ext[nonceField], &nonce)).Length(nonce, 2*nonceSize)
+	a.NotEqual(withNonce(nil, now)[nonceField], ext[nonceField])
+
+	// 与 WithTTL 同时使用
+	req := &body{Version: Version, Method: "f1"}
+	v := newCallOptions([]CallOption{WithNonce(), WithTTL(time.Second), WithMetadata(md)}).apply(context.Background(), req, NewManualClock(now))
+	a.Equal(v, &extBody{body: req}).
+		Length(req.extensions, 4).
+		Length(md, 1)
+}
+
+func TestReplayWindow(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Now()
+	w := &replayWindow{window: time.Minute, seen: map[string]struct{}{}}
+
+	req := func(nonce string, ts time.Time) *body {
+		return &body{extensions: map[string]json.RawMessage{
+			nonceField:     json.RawMessage(`"` + nonce + `"`),
+			timestampField: json.RawMessage(strconv.FormatInt(ts.UnixMilli(), 10)),
+		}}
+	}
+
+	a.Equal(w.check(&body{}, now), errMissingNonce).
+		Equal(w.check(&body{extensions: map[string]json.RawMessage{nonceField: json.RawMessage(`"1"`)}}, now), errMissingNonce).
+		Equal(w.check(req("", now), now), errInvalidNonce).
+		Equal(w.check(req("1", now.Add(-2*time.Minute)), now), errNonceExpired).
+		Equal(w.check(req("1", now.Add(2*time.Minute)), now), errNonceExpired)
+
+	a.NotError(w.check(req("1", now), now)).
+		Equal(w.check(req("1", now), now), errReplayed).
+		NotError(w.check(req("2", now.Add(time.Minute)), now.Add(time.Second)))
+
+	// 过期之后清除
+	a.NotError(w.check(req("3", now.Add(3*time.Minute)), now.Add(3*time.Minute))).
+		Length(w.seen, 1).Length(w.queue, 1)
+}
+
+func TestServer_ReplayWindow(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srv.KeepExtensions(true)
+	srv.ReplayWindow(time.Minute)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	client := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), in, nil), nil)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	call := func() (*Error, []byte) {
+		out.Reset()
+		data := append([]byte(nil), in.Bytes()...)
+		req, err := srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		conn.serve(req, 0)
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp.Error, data
+	}
+
+	a.NotError(client.Send("f1", &inType{}, func(*outType) error { return nil }, WithNonce()))
+	err, data := call()
+	a.Nil(err)
+
+	// 重放
+	in.Write(data)
+	err, _ = call()
+	a.Equal(err.Code, CodeReplay)
+
+	// 缺少 nonce
+	a.NotError(client.Send("f1", &inType{}, func(*outType) error { return nil }))
+	err, _ = call()
+	a.Equal(err.Code, CodeReplay)
+
+	srv.ReplayWindow(0)
+	a.NotError(client.Send("f1", &inType{}, func(*outType) error { return nil }))
+	err, _ = call()
+	a.Nil(err)
+}
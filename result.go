@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.18
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Result 批量请求中单个请求的返回结果
+type Result[T any] struct {
+	// 请求成功时的返回值
+	Value T
+
+	// 请求失败时的错误信息，成功则为 nil。
+	Error *Error
+}
+
+// HTTPBatch 以批量请求的方式发送 calls
+//
+// 返回值与 calls 的顺序一一对应，调用者无需自行根据 ID 匹配请求和返回值。
+// 通知类型的请求，在返回值中对应的元素为 nil。
+// 所有请求的返回值都会被解析为类型 T。
+//
+// 返回的 error 表示整个批量请求的错误，比如网络错误或是服务端无法解析该请求等；
+// 单个请求的错误则由 [Result.Error] 表示。
+func HTTPBatch[T any](h *HTTPConn, calls ...*Call) ([]*Result[T], error) {
+	resps, err := h.batch(calls)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResults[T](resps), nil
+}
+
+// ConnBatch 以批量请求的方式通过 conn 发送 calls
+//
+// 返回值与 [HTTPBatch] 相同，返回数据由 [Conn.Serve] 读取，
+// 所以需要在 conn 的 Serve 执行期间调用。
+//
+// 在所有请求都返回之前会一直阻塞，直到 ctx 被取消或是连接被关闭。
+func ConnBatch[T any](ctx context.Context, conn *Conn, calls ...*Call) ([]*Result[T], error) {
+	resps, err := conn.batch(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResults[T](resps), nil
+}
+
+func newResults[T any](resps []*body) []*Result[T] {
+	results := make([]*Result[T], 0, len(resps))
+	for _, resp := range resps {
+		if resp == nil {
+			results = append(results, nil)
+			continue
+		}
+
+		r := &Result[T]{Error: resp.Error}
+		if r.Error == nil && resp.Result != nil {
+			if err := json.Unmarshal(*resp.Result, &r.Value); err != nil {
+				r.Error = NewErrorWithError(CodeParseError, err)
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.18
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestHTTPBatch(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	// 模拟支持批量请求的服务端，f1 原样返回参数，其它返回错误。
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs := make([]*body, 0, 10)
+		a.NotError(json.NewDecoder(r.Body).Decode(&reqs))
+
+		resps := make([]*body, 0, len(reqs))
+		for i := len(reqs) - 1; i >= 0; i-- { // 倒序返回
+			req := reqs[i]
+			if req.ID == nil {
+				continue
+			}
+			resp := &body{Version: Version, ID: req.ID}
+			if req.Method == "f1" {
+				resp.Result = req.Params
+			} else {
+				resp.Error = NewError(CodeMethodNotFound, req.Method)
+			}
+			resps = append(resps, resp)
+		}
+		a.NotError(json.NewEncoder(w).Encode(resps))
+	}))
+	defer srv.Close()
+
+	conn := s.NewHTTPConn(srv.URL, nil)
+	results, err := HTTPBatch[*inType](conn,
+		&Call{Method: "f1", Params: &inType{Age: 1}},
+		&Call{Method: "f1", Params: &inType{Age: 2}, Notify: true},
+		&Call{Method: "not-exists"},
+		&Call{Method: "f1", Params: &inType{Age: 3}},
+	)
+	a.NotError(err).Length(results, 4)
+	a.Nil(results[0].Error).Equal(results[0].Value.Age, 1)
+	a.Nil(results[1])
+	a.Equal(results[2].Error.Code, CodeMethodNotFound).Nil(results[2].Value)
+	a.Nil(results[3].Error).Equal(results[3].Value.Age, 3)
+
+	// 类型不匹配
+	ints, err := HTTPBatch[int](conn, &Call{Method: "f1", Params: &inType{Age: 1}})
+	a.NotError(err).Length(ints, 1).
+		Equal(ints[0].Error.Code, CodeParseError)
+}
+
+func TestHTTPConn_ServeHTTP_batch(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	srv := httptest.NewServer(s.NewHTTPConn("", nil))
+	defer srv.Close()
+
+	results, err := HTTPBatch[*outType](s.NewHTTPConn(srv.URL, nil),
+		&Call{Method: "f1", Params: &inType{First: "f", Age: 1}},
+		&Call{Method: "f1", Params: &inType{Age: 2}, Notify: true},
+		&Call{Method: "not-exists"},
+		&Call{Method: "f1", Params: &inType{Last: "l", Age: 3}},
+	)
+	a.NotError(err).Length(results, 4)
+	a.Nil(results[0].Error).Equal(results[0].Value, &outType{Name: "f", Age: 1})
+	a.Nil(results[1])
+	a.Equal(results[2].Error.Code, CodeMethodNotFound)
+	a.Nil(results[3].Error).Equal(results[3].Value, &outType{Name: "l", Age: 3})
+}
+
+func TestConnBatch(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	c1, c2 := net.Pipe()
+	server := srv.NewConn(NewSocketTransport(true, c1, 0), nil)
+	client := srv.NewConn(NewSocketTransport(true, c2, 0), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		server.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	results, err := ConnBatch[*outType](ctx, client,
+		&Call{Method: "f1", Params: &inType{First: "f", Age: 1}},
+		&Call{Method: "f1", Params: &inType{Age: 2}, Notify: true},
+		&Call{Method: "not-exists"},
+		&Call{Method: "f1", Params: &inType{Last: "l", Age: 3}},
+	)
+	a.NotError(err).Length(results, 4)
+	a.Nil(results[0].Error).Equal(results[0].Value, &outType{Name: "f", Age: 1})
+	a.Nil(results[1])
+	a.Equal(results[2].Error.Code, CodeMethodNotFound)
+	a.Nil(results[3].Error).Equal(results[3].Value, &outType{Name: "l", Age: 3})
+
+	// 类型不匹配
+	ints, err := ConnBatch[int](ctx, client, &Call{Method: "f1", Params: &inType{Age: 1}})
+	a.NotError(err).Length(ints, 1).
+		Equal(ints[0].Error.Code, CodeParseError)
+
+	// 参数错误，不发送任何内容。
+	ints, err = ConnBatch[int](ctx, client, &Call{Method: "f1", Params: make(chan int)})
+	a.Error(err).Nil(ints)
+
+	cancel()
+	a.NotError(c1.Close()).NotError(c2.Close())
+	<-exit
+	<-exit
+}
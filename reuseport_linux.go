@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package jsonrpc
+
+import "syscall"
+
+// syscall 中的 linux 未定义 SO_REUSEPORT，其值来自 asm-generic/socket.h。
+const soReusePort = 0xf
+
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
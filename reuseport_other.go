@@ -0,0 +1,9 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !(linux && !mips && !mipsle && !mips64 && !mips64le) && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package jsonrpc
+
+func setReusePort(uintptr) error { return errReusePortUnsupported }
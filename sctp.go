@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// 单条 SCTP 消息的默认最大长度
+const defaultSCTPMessageSize = 64 * 1024
+
+var errSCTPMessageTooLarge = errors.New("SCTP 消息超过了缓存的大小")
+
+// SCTPConn SCTP 连接的接口
+//
+// 标准库并未提供 SCTP 的支持，github.com/ishidawataru/sctp 等第三方包中的连接，
+// 可以通过简单的包装实现此接口，之所以不直接引用这些包，是为了不让本包依赖于它们。
+type SCTPConn interface {
+	// 读取一条完整的消息
+	//
+	// 返回消息的长度以及其所在的流编号。
+	ReadMessage(p []byte) (n int, stream uint16, err error)
+
+	// 向编号为 stream 的流写入一条消息
+	//
+	// 可能会被并发调用。
+	WriteMessage(p []byte, stream uint16) (int, error)
+
+	Close() error
+}
+
+type sctpTransport struct {
+	conn    SCTPConn
+	streams uint16
+	next    uint32 // 下一个请求所使用的流
+	buf     []byte
+	inMux   sync.Mutex
+
+	// 请求 ID 与其所在的流，返回数据会写入与请求相同的流。
+	requests   map[IDKey]uint16
+	requestMux sync.Mutex
+}
+
+// NewSCTPTransport 声明基于 SCTP 的 Transport 实例
+//
+// 每一条 JSON RPC 消息对应一条 SCTP 消息，由 SCTP 保证消息的边界，所以不需要报头。
+//
+// streams 为可用的流数量，发出的请求和通知会依次分布在各个流上，
+// 返回数据则写入与其请求相同的流，以避免某个较大的消息阻塞其它消息（队头阻塞），
+// 小于等于 1 表示只使用编号为 0 的流；
+// size 为单条消息的最大长度，超过此值的消息在读取时会返回错误，小于等于 0 表示采用 64K。
+func NewSCTPTransport(conn SCTPConn, streams uint16, size int) Transport {
+	if streams == 0 {
+		streams = 1
+	}
+	if size <= 0 {
+		size = defaultSCTPMessageSize
+	}
+
+	return &sctpTransport{
+		conn:     conn,
+		streams:  streams,
+		buf:      make([]byte, size),
+		requests: make(map[IDKey]uint16, 10),
+	}
+}
+
+func (t *sctpTransport) Read(v interface{}) error {
+	t.inMux.Lock()
+	defer t.inMux.Unlock()
+
+	n, stream, err := t.conn.ReadMessage(t.buf)
+	if err != nil {
+		return err
+	}
+	if n >= len(t.buf) { // 无法确定是否完整，只能当作超出大小处理。
+		return errSCTPMessageTooLarge
+	}
+
+	if err := json.Unmarshal(t.buf[:n], v); err != nil {
+		return err
+	}
+
+	if b := bodyOf(v); b != nil && b.ID != nil && b.isRequest() {
+		t.requestMux.Lock()
+		t.requests[b.ID.Key()] = stream
+		t.requestMux.Unlock()
+	}
+	return nil
+}
+
+func (t *sctpTransport) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.conn.WriteMessage(data, t.stream(v))
+	return err
+}
+
+// 返回写入 v 时所使用的流
+func (t *sctpTransport) stream(v interface{}) uint16 {
+	if b := bodyOf(v); b != nil && b.ID != nil && !b.isRequest() {
+		t.requestMux.Lock()
+		stream, found := t.requests[b.ID.Key()]
+		delete(t.requests, b.ID.Key())
+		t.requestMux.Unlock()
+		if found {
+			return stream
+		}
+	}
+
+	return uint16((atomic.AddUint32(&t.next, 1) - 1) % uint32(t.streams))
+}
+
+func (t *sctpTransport) Close() error { return t.conn.Close() }
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Transport = &sctpTransport{}
+
+type sctpMessage struct {
+	data   []byte
+	stream uint16
+}
+
+// 以 channel 模拟 SCTP 连接
+type memSCTP struct {
+	in, out chan sctpMessage
+	mux     sync.Mutex
+	streams []uint16 // 写入时使用的流
+	once    sync.Once
+}
+
+func newMemSCTP() (*memSCTP, *memSCTP) {
+	c1, c2 := make(chan sctpMessage, 10), make(chan sctpMessage, 10)
+	return &memSCTP{in: c1, out: c2}, &memSCTP{in: c2, out: c1}
+}
+
+func (c *memSCTP) ReadMessage(p []byte) (int, uint16, error) {
+	m, ok := <-c.in
+	if !ok {
+		return 0, 0, io.EOF
+	}
+	return copy(p, m.data), m.stream, nil
+}
+
+func (c *memSCTP) WriteMessage(p []byte, stream uint16) (int, error) {
+	c.mux.Lock()
+	c.streams = append(c.streams, stream)
+	c.mux.Unlock()
+	c.out <- sctpMessage{data: append([]byte(nil), p...), stream: stream}
+	return len(p), nil
+}
+
+func (c *memSCTP) Close() error {
+	c.once.Do(func() { close(c.out) })
+	return nil
+}
+
+func TestNewSCTPTransport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	c1, c2 := newMemSCTP()
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		srv.NewConn(NewSCTPTransport(c1, 3, 0), nil).Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewSCTPTransport(c2, 3, 0)
+	for i := 0; i < 4; i++ {
+		req, err := srv.newRequest(false, "f1", &inType{Age: i})
+		a.NotError(err)
+		a.NotError(client.Write(req))
+	}
+
+	for i := 0; i < 4; i++ {
+		resp := &body{}
+		a.NotError(client.Read(resp)).NotNil(resp.Result)
+	}
+
+	// 请求依次分布在各个流，返回数据与请求所在的流相同。
+	a.Equal(c2.streams, []uint16{0, 1, 2, 0})
+	c1.mux.Lock()
+	a.Length(c1.streams, 4)
+	counts := map[uint16]int{}
+	for _, s := range c1.streams {
+		counts[s]++
+	}
+	c1.mux.Unlock()
+	a.Equal(counts, map[uint16]int{0: 2, 1: 1, 2: 1})
+
+	cancel()
+	a.NotError(client.Close())
+	<-exit
+}
+
+func TestSCTPTransport_Read(t *testing.T) {
+	a := assert.New(t, false)
+
+	c1, c2 := newMemSCTP()
+	tr := NewSCTPTransport(c1, 0, 10)
+	a.Equal(tr.(*sctpTransport).streams, 1)
+
+	c2.WriteMessage([]byte(`{"jsonrpc":"2.0","id":1,"method":"f1"}`), 0)
+	a.ErrorIs(tr.Read(&body{}), errSCTPMessageTooLarge)
+
+	c2.Close()
+	a.Equal(tr.Read(&body{}), io.EOF)
+}
@@ -5,33 +5,79 @@
 package jsonrpc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server JSON RPC 服务实例
+//
+// 与服务注册相关的方法可以在处理请求的同时调用，包括 Register 系列方法、[Server.Alias]、
+// [Server.Swap]、[Server.RegisterBefore]、[Server.RegisterAfter] 和 [Server.RegisterCallbackBefore] 等，
+// 正在处理的请求会使用调用之前的内容，之后的请求才会看到新的内容。
+// 其它的设置类方法，除非另有说明，都需要在处理请求之前调用。
 type Server struct {
-	unique     func() string
-	servers    sync.Map
-	matchers   []matcher
-	before     func(string) error
-	errHandler func(*Error)
+	unique         func() string
+	registry       atomic.Value
+	before         atomic.Value // *beforeHook
+	after          atomic.Value // *afterHook
+	callbackBefore atomic.Value // *callbackBeforeHook
+	errHandler     func(*Error)
+	deprecated     func(string, string)
+	incident       func(*Incident)
+	validator      func(interface{}) error
+	extensions     bool
+	notifyErr      func(string, *Error)
+	writeErr       func(*WriteFailure)
+	raw            func(string, []byte) error
+	visible        func(Peer, string) bool
+	slow           *slowCall
+	unrouted       func(json.RawMessage, error)
+	modules        []Module
+	clock          Clock
+	replay         *replayWindow
+	respMeta       func(string, time.Duration) map[string]json.RawMessage
+	normalizer     *normalizer
+	groups         groups
+	mirror         *mirror
+	batchSize      int
+	batchWorkers   int
 }
 
-type matcher struct {
-	matcher func(string) bool
-	h       *handler
+// Deprecation 通过别名调用服务出错时，附加在 [Error.Data] 中的提示信息
+//
+// 仅在 [Error.Data] 为空时才会附加。
+type Deprecation struct {
+	// 已经弃用的服务名
+	Deprecated string `json:"deprecated"`
+
+	// 应该使用的服务名
+	Replacement string `json:"replacement"`
 }
 
 // NewServer 新的 [Server] 实例
 func NewServer(idgen func() string) *Server {
-	return &Server{
-		unique:   idgen,
-		matchers: []matcher{},
-	}
+	s := &Server{unique: idgen, clock: systemClock{}}
+	s.registry.Store(NewRegistry())
+	return s
+}
+
+// 当前正在使用的注册表
+func (s *Server) methods() *Registry { return s.registry.Load().(*Registry) }
+
+// Swap 以 r 替换当前的整个服务注册表
+//
+// 替换操作是原子性的，正在处理的请求不会看到部分更新的服务列表。
+// 对于需要大规模调整服务的场景，可以先通过 [NewRegistry] 构建好新的注册表，
+// 再调用此方法一次性替换。
+//
+// 返回被替换的注册表。之后对 [Server] 的 Register 等操作均作用于 r。
+func (s *Server) Swap(r *Registry) *Registry {
+	return s.registry.Swap(r).(*Registry)
 }
 
 func (s *Server) id() *ID { return &ID{alpha: s.unique()} }
@@ -46,114 +92,325 @@ func (s *Server) id() *ID { return &ID{alpha: s.unique()} }
 // 如果返回错误值，则会退出 RPC 调用，返回错误尽量采用 [Error] 类型；
 //
 // NOTE: 如果多次调用，仅最后次启作用。
-func (s *Server) RegisterBefore(f func(method string) error) { s.before = f }
+func (s *Server) RegisterBefore(f func(method string) error) { s.before.Store(&beforeHook{f: f}) }
 
-// Register 注册一个新的服务
+// RegisterAfter 注册 After 函数
 //
-// f 为处理服务的函数，其原型为以下方式：
+// f 的原型如下：
 //
-//	func(notify bool, params, result pointer) error
+//	func(method string, result json.RawMessage, err error, elapsed time.Duration)
 //
-// 其中 notify 表示是否为通知类型的请求；params 为用户请求的对象；
-// result 为返回给用户的数据对象；error 则为处理出错是的返回值。
-// params 和 result 必须为指针类型。
+// 在服务执行完成之后调用，可用于输出访问日志和统计耗时等。
+// method RPC 服务名；
+// result 为编码之后的返回值，通知或是 err 不为空时为空；
+// err 为服务返回的错误，包括参数错误、执行超时以及 panic 等；
+// elapsed 为服务的执行时间，包含了参数的解码和返回值的编码，但不包括写入的时间。
 //
-// 返回值表示是否添加成功，在已经存在相同值时，会添加失败。
+// 在执行服务之前即被拒绝的请求，比如找不到服务或是 [Server.RegisterBefore] 返回了错误等，不会调用 f。
 //
-// NOTE: 如果 f 的签名不正确，则会直接 panic
-func (s *Server) Register(method string, f interface{}) bool {
-	if s.Exists(method) {
-		return false
-	}
-
-	s.servers.Store(method, newHandler(f))
-	return true
+// NOTE: 如果多次调用，仅最后次启作用。
+func (s *Server) RegisterAfter(f func(method string, result json.RawMessage, err error, elapsed time.Duration)) {
+	s.after.Store(&afterHook{f: f})
 }
 
-// RegisterMatcher 注册服务名称通过函数判断的新服务
+// RegisterCallbackBefore 注册在执行 Send 的回调函数之前调用的函数
+//
+// f 的原型如下：
 //
-// m 为服务名称的匹配方法，其原型如下：
+//	func(ctx context.Context, method string)(err error)
 //
-//	func(method string) bool
+// ctx 为调用 [Conn.SendContext] 或 [HTTPConn.SendContext] 时传递的值；
+// method 为请求的服务名；
+// 如果返回错误值，则不再调用回调函数，该错误会作为回调函数的错误进行处理。
+//
+// NOTE: 如果多次调用，仅最后次启作用。
+func (s *Server) RegisterCallbackBefore(f func(ctx context.Context, method string) error) {
+	s.callbackBefore.Store(&callbackBeforeHook{f: f})
+}
+
+// 包装 before 函数，atomic.Value 要求每次存储的类型相同。
+type beforeHook struct {
+	f func(string) error
+}
+
+type afterHook struct {
+	f func(string, json.RawMessage, error, time.Duration)
+}
+
+type callbackBeforeHook struct {
+	f func(context.Context, string) error
+}
+
+// Register 注册一个新的服务
 //
-// 如果服务名称能正确匹配则返回 true。
+// 具体说明可参考 [Registry.Register]。
+func (s *Server) Register(method string, f interface{}) bool {
+	return s.methods().Register(method, f)
+}
+
+// RegisterMatcher 注册服务名称通过函数判断的新服务
 //
-// 通过 RegisterMatcher 注册的服务，其权重要低于 Register 注册的服务，
-// 即一个服务名称只有在 Register 注册的列表中找不到，才会考虑通过在
-// RegisterMatcher 注册的列表中查找。
+// 具体说明可参考 [Registry.RegisterMatcher]。
 func (s *Server) RegisterMatcher(m func(string) bool, f interface{}) {
-	s.matchers = append(s.matchers, matcher{matcher: m, h: newHandler(f)})
+	s.methods().RegisterMatcher(m, f)
 }
 
 // Exists 是否已经存在相同的方法名
-func (s *Server) Exists(method string) bool {
-	_, found := s.servers.Load(method)
-	return found
-}
+func (s *Server) Exists(method string) bool { return s.methods().Exists(method) }
 
 // Registers 注册多个服务方法
 //
 // 如果已经存在相同的方法名，则会直接 panic
 func (s *Server) Registers(methods map[string]interface{}) {
-	for method, f := range methods {
-		if !s.Register(method, f) {
-			panic("已经存在相同的方法：" + method)
-		}
-	}
+	s.methods().Registers(methods)
+}
+
+// RegisterService 注册 svc 中所有符合要求的导出方法
+//
+// 具体说明可参考 [Registry.RegisterService]。
+func (s *Server) RegisterService(name string, svc interface{}) bool {
+	return s.methods().RegisterService(name, svc)
+}
+
+// Alias 为服务 method 添加别名 old
+//
+// 具体说明可参考 [Registry.Alias]。
+func (s *Server) Alias(old, method string) bool { return s.methods().Alias(old, method) }
+
+// Methods 返回所有通过名称注册的服务名
+//
+// 具体说明可参考 [Registry.Methods]。
+func (s *Server) Methods() []string { return s.methods().Methods() }
+
+// Matchers 返回所有通过函数匹配的服务的描述信息
+//
+// 具体说明可参考 [Registry.Matchers]。
+func (s *Server) Matchers() []string { return s.methods().Matchers() }
+
+// Limit 限制服务 method 的并发数量
+//
+// 具体说明可参考 [Registry.Limit]。
+func (s *Server) Limit(method string, concurrency, queue int) bool {
+	return s.methods().Limit(method, concurrency, queue)
 }
 
+// DeprecatedHandler 指定通过别名调用服务时的处理函数
+//
+// 可用于输出日志或是统计旧名称的使用情况。
+// old 为调用时使用的别名，method 为实际的服务名。
+// 多次调用会相互覆盖。
+func (s *Server) DeprecatedHandler(h func(old, method string)) { s.deprecated = h }
+
 // ErrHandler 指定请求数据的错误处理函数
 //
 // 仅针对请求数据，多次调用会相互覆盖。
 func (s *Server) ErrHandler(h func(*Error)) { s.errHandler = h }
 
+// NotifyErrHandler 指定处理通知时的错误处理函数
+//
+// 按照规范，通知类型的请求不能有任何返回，包括错误信息，
+// 所以在调用不存在的服务或是服务返回错误时，这些错误只会交由 h 处理，
+// 可用于输出日志或是统计。method 为通知的服务名。
+// 多次调用会相互覆盖。
+func (s *Server) NotifyErrHandler(h func(method string, err *Error)) { s.notifyErr = h }
+
+// 返回用于解码的对象
+//
+// v 为实际传递给解码函数的对象，解码之后的内容保存在 req 中。
+func (s *Server) newBody() (req *body, v interface{}) {
+	req = &body{}
+	v = req
+	if s.extensions {
+		v = &extBody{body: req}
+	}
+	if s.keepRaw() {
+		v = &rawBody{v: v, body: req}
+	}
+	return req, v
+}
+
 func (s *Server) read(t Transport) (*body, error) {
-	req := &body{}
-	if err := t.Read(req); err != nil {
+	req, v := s.newBody()
+	if err := t.Read(&batchBody{v: v, body: req}); err != nil {
 		if errors.Is(err, os.ErrDeadlineExceeded) {
 			return nil, nil
 		}
+		if isClosed(err) { // 连接已经断开，无法再返回错误信息。
+			return nil, err
+		}
+		s.handleUnrouted(req, err)
+		var tl *tooLargeError
+		if errors.As(err, &tl) {
+			return nil, s.writeError(t, nil, CodeTooLarge, err, tl.data())
+		}
 		return nil, s.writeError(t, nil, CodeParseError, err, nil)
 	}
 
+	if req.batch != nil {
+		if len(req.batch) == 0 {
+			err := errors.New("批量请求不能为空")
+			s.handleUnrouted(req, err)
+			return nil, s.writeError(t, nil, CodeInvalidRequest, err, nil)
+		}
+		if size := s.maxBatchSize(); len(req.batch) > size {
+			err := fmt.Errorf("批量请求的数量 %d 超过了限制 %d", len(req.batch), size)
+			s.handleUnrouted(req, err)
+			return nil, s.writeError(t, nil, CodeInvalidRequest, err, nil)
+		}
+		return req, nil
+	}
+
+	if req.TraceParent != "" && !validTraceParent(req.TraceParent) {
+		req.TraceParent = ""
+	}
+
 	if req.isEmptyRequest() {
-		return nil, s.writeError(t, nil, CodeInvalidRequest, errors.New("无效的请求内容"), nil)
+		err := errors.New("无效的请求内容")
+		s.handleUnrouted(req, err)
+		return nil, s.writeError(t, nil, CodeInvalidRequest, err, nil)
 	}
 
 	return req, nil
 }
 
 func (s *Server) response(t Transport, req *body) error {
-	if s.before != nil {
-		if err := s.before(req.Method); err != nil {
-			return s.writeError(t, req.ID, CodeMethodNotFound, err, nil)
+	if s.respMeta != nil {
+		t = &metaTransport{Transport: t, s: s, method: req.Method, start: s.clock.Now()}
+	}
+	if req.extensions != nil {
+		t = &extTransport{Transport: t, extensions: req.extensions}
+	}
+	if req.TraceParent != "" {
+		t = &traceTransport{Transport: t, traceparent: req.TraceParent}
+	}
+	if req.ID != nil {
+		t = &onceTransport{Transport: t, s: s, req: req}
+	}
+
+	if s.raw != nil && req.raw != nil {
+		if err := s.raw(req.Method, req.raw); err != nil {
+			return s.responseError(t, req, CodeInvalidRequest, err, nil)
+		}
+	}
+
+	if isStale(req, s.clock.Now()) {
+		msg := fmt.Errorf("请求 %s 已经过期", req.Method)
+		return s.responseError(t, req, CodeStale, msg, nil)
+	}
+
+	if s.replay != nil {
+		if err := s.replay.check(req, s.clock.Now()); err != nil {
+			return s.responseError(t, req, CodeReplay, err, nil)
+		}
+	}
+
+	if before, ok := s.before.Load().(*beforeHook); ok && before.f != nil {
+		if err := before.f(req.Method); err != nil {
+			return s.responseError(t, req, CodeMethodNotFound, err, nil)
 		}
 	}
 
 	var h *handler
-	if f, found := s.servers.Load(req.Method); found {
-		h = f.(*handler)
-	} else {
-		for _, m := range s.matchers {
-			if m.matcher(req.Method) {
-				h = m.h
-				break
-			}
+	var method string
+	if s.isVisible(t, req) {
+		h, method = s.lookup(requestMethod(req))
+	}
+	if h == nil || !h.exposed(req) {
+		msg := fmt.Errorf("未找到对应的服务 %s", req.Method)
+		return s.responseError(t, req, CodeMethodNotFound, msg, nil)
+	}
+
+	var data interface{}
+	if method != "" { // 通过别名调用
+		if s.deprecated != nil {
+			s.deprecated(req.Method, method)
 		}
-		if h == nil {
-			msg := fmt.Errorf("未找到对应的服务 %s", req.Method)
-			return s.writeError(t, req.ID, CodeMethodNotFound, msg, nil)
+		data = &Deprecation{Deprecated: req.Method, Replacement: method}
+	}
+
+	if h.guard != nil {
+		if err := h.guard(req.Method); err != nil {
+			return s.responseError(t, req, CodeMethodNotFound, err, nil)
 		}
 	}
 
-	resp, err := h.call(req)
+	if h.rate != nil && !h.rate.allow(s.clock.Now()) {
+		msg := fmt.Errorf("服务 %s 调用过于频繁", req.Method)
+		return s.responseError(t, req, CodeServerBusy, msg, nil)
+	}
+
+	if h.limit != nil {
+		if !h.limit.acquire() {
+			msg := fmt.Errorf("服务 %s 繁忙", req.Method)
+			return s.responseError(t, req, CodeServerBusy, msg, nil)
+		}
+		// 由 s.call 在服务函数返回之后释放
+	}
+
+	s.mirrorRequest(req)
+
+	start := s.clock.Now()
+	resp, err := s.call(t, h, req)
+	if after, ok := s.after.Load().(*afterHook); ok && after.f != nil {
+		var result json.RawMessage
+		if resp != nil && resp.Result != nil {
+			result = *resp.Result
+		}
+		after.f(req.Method, result, err, s.clock.Now().Sub(start))
+	}
 	if err != nil {
-		return s.writeError(t, req.ID, CodeParseError, err, nil)
+		if err2, ok := err.(*Error); ok && data != nil && err2.Data == nil {
+			err = NewErrorWithData(err2.Code, err2.Message, data)
+		}
+		if err = s.responseError(t, req, CodeParseError, err, data); err != nil {
+			s.reportWrite(t, req, err)
+		}
+		return err
 	}
 	if resp == nil {
 		return nil
 	}
-	return t.Write(resp)
+
+	if err = s.write(t, resp); err != nil {
+		s.reportWrite(t, req, err)
+	}
+	return err
+}
+
+// 作为客户端处理服务端返回的数据
+func (s *Server) callback(p *pending, resp *body) error {
+	if before, ok := s.callbackBefore.Load().(*callbackBeforeHook); ok && before.f != nil {
+		if err := before.f(p.ctx, p.method); err != nil {
+			return err
+		}
+	}
+
+	ctx := p.ctx
+	if resp.TraceParent != "" && TraceParent(ctx) == "" {
+		ctx = WithTraceParent(ctx, resp.TraceParent)
+	}
+	if resp.extensions != nil {
+		ctx = context.WithValue(ctx, extensionsKey{}, resp.extensions)
+	}
+	return p.cb.call(ctx, resp)
+}
+
+// 向请求 req 返回错误信息
+//
+// 通知类型的请求不能有任何返回，此时仅将错误交由 [Server.NotifyErrHandler] 处理。
+func (s *Server) responseError(t Transport, req *body, code int, err error, data interface{}) error {
+	if req.ID != nil {
+		return s.writeError(t, req.ID, code, err, data)
+	}
+
+	if s.notifyErr != nil {
+		err2, ok := err.(*Error)
+		if !ok {
+			err2 = NewErrorWithData(code, err.Error(), data)
+		}
+		s.notifyErr(req.Method, err2)
+	}
+	return nil
 }
 
 func (s *Server) writeError(t Transport, id *ID, code int, err error, data interface{}) error {
@@ -168,13 +425,27 @@ func (s *Server) writeError(t Transport, id *ID, code int, err error, data inter
 		resp.Error = NewErrorWithData(code, err.Error(), data)
 	}
 
-	return t.Write(resp)
+	return s.write(t, resp)
 }
 
-// 作为客户端向服务端主动发送请求
-func (s *Server) request(t Transport, notify bool, method string, in interface{}) (req *body, err error) {
+// 向 t 写入返回数据 v
+//
+// v 为 *body 或是由 orderedTransport 缓存的对象，
+// 写入失败时交由 [Server.WriteErrHandler] 处理。
+func (s *Server) write(t Transport, v interface{}) error {
+	err := t.Write(v)
+	if err != nil && err != errDuplicateResponse && s.writeErr != nil {
+		s.writeErr(newWriteFailure(t, v, err))
+	}
+	return err
+}
+
+func (s *Server) newRequest(notify bool, method string, in interface{}) (*body, error) {
 	var params *json.RawMessage
-	if in != nil {
+	if p, ok := in.(encodedParams); ok {
+		data := json.RawMessage(p)
+		params = &data
+	} else if in != nil {
 		data, err := json.Marshal(in)
 		if err != nil {
 			return nil, err
@@ -182,7 +453,7 @@ func (s *Server) request(t Transport, notify bool, method string, in interface{}
 		params = (*json.RawMessage)(&data)
 	}
 
-	req = &body{
+	req := &body{
 		Version: Version,
 		Method:  method,
 		Params:  params,
@@ -190,10 +461,5 @@ func (s *Server) request(t Transport, notify bool, method string, in interface{}
 	if !notify {
 		req.ID = s.id()
 	}
-
-	if err = t.Write(req); err != nil {
-		return nil, err
-	}
-
 	return req, nil
 }
@@ -9,9 +9,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/issue9/assert/v4"
 	"github.com/issue9/unique/v2"
@@ -97,12 +99,7 @@ func TestServer_read(t *testing.T) {
 		err int // 0 表示无错误，其它表示对应的 Error.Code
 	}{
 		{
-			req: ``,
-			err: CodeParseError,
-		},
-
-		{
-			req: `{"jsonrpc"`,
+			req: `{"jsonrpc":}`,
 			err: CodeParseError,
 		},
 
@@ -136,6 +133,16 @@ func TestServer_read(t *testing.T) {
 				Equal(resp.Error.Code, item.err, "not equal v1=%v,v2=%v @ %d", resp.Error.Code, item.err, i)
 		}
 	}
+
+	// 连接断开时不再返回错误信息
+	in.Reset()
+	out.Reset()
+	f, err := srv.read(NewStreamTransport(false, in, out, nil))
+	a.Equal(err, io.EOF).Nil(f).Equal(out.Len(), 0)
+
+	in.WriteString(`{"jsonrpc"`)
+	f, err = srv.read(NewStreamTransport(false, in, out, nil))
+	a.Equal(err, io.ErrUnexpectedEOF).Nil(f).Equal(out.Len(), 0)
 }
 
 func TestServer_response(t *testing.T) {
@@ -239,6 +246,109 @@ func TestServer_response(t *testing.T) {
 	}
 }
 
+func TestServer_RegisterAfter(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	clock := NewManualClock(time.Now())
+	srv.Clock(clock)
+	a.True(srv.Register("slow", func(notify bool, in *int, out *int) error {
+		clock.Advance(time.Second)
+		*out = *in
+		return nil
+	}))
+
+	type record struct {
+		method  string
+		result  json.RawMessage
+		err     error
+		elapsed time.Duration
+	}
+	var records []*record
+	srv.RegisterAfter(func(method string, result json.RawMessage, err error, elapsed time.Duration) {
+		records = append(records, &record{method: method, result: result, err: err, elapsed: elapsed})
+	})
+
+	serve := func(req string) {
+		in, out := bytes.NewBufferString(req), new(bytes.Buffer)
+		transport := NewStreamTransport(false, in, out, nil)
+		body, err := srv.read(transport)
+		a.NotError(err).NotNil(body)
+		a.NotError(srv.response(transport, body))
+	}
+
+	serve(`{"jsonrpc":"2.0","id":1,"method":"slow","params":5}`)
+	a.Length(records, 1).
+		Equal(records[0].method, "slow").
+		Equal(string(records[0].result), "5").
+		NotError(records[0].err).
+		Equal(records[0].elapsed, time.Second)
+
+	// 服务返回错误
+	serve(`{"jsonrpc":"2.0","id":2,"method":"f2","params":{"Age":18}}`)
+	a.Length(records, 2).
+		Equal(records[1].method, "f2").
+		Nil(records[1].result).
+		Error(records[1].err).
+		Equal(records[1].elapsed, 0)
+
+	// 通知
+	serve(`{"jsonrpc":"2.0","method":"slow","params":5}`)
+	a.Length(records, 3).
+		Equal(records[2].method, "slow").
+		Nil(records[2].result).
+		NotError(records[2].err)
+
+	// 未执行服务
+	serve(`{"jsonrpc":"2.0","id":3,"method":"not-exists","params":5}`)
+	a.Length(records, 3)
+}
+
+func TestServer_NotifyErrHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	transport := NewStreamTransport(false, in, out, nil)
+
+	// 未指定处理函数，通知的错误也不返回。
+	in.WriteString(`{"jsonrpc":"2.0","method":"not-exists","params":{}}`)
+	req, err := srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).Empty(out.String())
+
+	var method string
+	var code int
+	srv.NotifyErrHandler(func(m string, err *Error) {
+		method = m
+		code = err.Code
+	})
+
+	in.WriteString(`{"jsonrpc":"2.0","method":"not-exists","params":{}}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).
+		Empty(out.String()).
+		Equal(method, "not-exists").
+		Equal(code, CodeMethodNotFound)
+
+	// f2 返回错误
+	in.WriteString(`{"jsonrpc":"2.0","method":"f2","params":{}}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).
+		Empty(out.String()).
+		Equal(method, "f2").
+		Equal(code, CodeInvalidParams)
+
+	// 非通知依然返回错误
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f2","params":{}}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req)).
+		Contains(out.String(), `"error"`)
+}
+
 func TestServer_Registers(t *testing.T) {
 	u := unique.NewString(10)
 	go u.Serve(context.Background())
@@ -272,3 +382,48 @@ func TestServer_Registers(t *testing.T) {
 		})
 	})
 }
+
+func TestServer_Alias(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.False(srv.Alias("old", "not-exists")).
+		False(srv.Alias("f2", "f1")). // f2 已经存在
+		True(srv.Alias("old1", "f1")).
+		True(srv.Alias("old2", "f2")).
+		False(srv.Alias("old1", "f2")).
+		True(srv.Exists("old1")).
+		False(srv.Register("old1", f1))
+
+	var deprecated string
+	srv.DeprecatedHandler(func(old, method string) {
+		deprecated = old + "->" + method
+	})
+
+	call := func(method string) *body {
+		in, out := new(bytes.Buffer), new(bytes.Buffer)
+		transport := NewStreamTransport(false, in, out, nil)
+		req, err := srv.newRequest(false, method, &inType{Age: 18})
+		a.NotError(err)
+		a.NotError(srv.response(transport, req))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	resp := call("old1")
+	a.Nil(resp.Error).Equal(deprecated, "old1->f1")
+	out := &outType{}
+	a.NotError(json.Unmarshal(*resp.Result, out)).Equal(out.Age, 18)
+
+	resp = call("old2")
+	a.Equal(deprecated, "old2->f2").
+		Equal(resp.Error.Code, CodeInvalidParams).
+		Equal(resp.Error.Data, map[string]interface{}{"deprecated": "old2", "replacement": "f2"})
+
+	// 非别名不会附加 Deprecation
+	deprecated = ""
+	resp = call("f2")
+	a.Empty(deprecated).Nil(resp.Error.Data)
+}
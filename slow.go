@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SlowCall 执行时间超过阈值的请求
+type SlowCall struct {
+	// 请求的服务名
+	Method string
+
+	// 请求的 ID，通知类型的请求为 nil。
+	ID *ID
+
+	// 对方的地址，与 [Incident.Peer] 相同。
+	Peer string
+
+	// 服务的执行时间
+	Duration time.Duration
+
+	// 请求参数的字节数
+	ParamsSize int
+
+	// 达到阈值时执行服务的 goroutine 的调用栈
+	//
+	// 仅在 [Server.SlowCallHandler] 的 stack 参数为 true 时才有值。
+	Stack []byte
+}
+
+type slowCall struct {
+	threshold time.Duration
+	stack     bool
+	h         func(*SlowCall)
+}
+
+// SlowCallHandler 指定处理慢请求的函数
+//
+// 服务的执行时间超过 threshold 时，会将相关信息传递给 h，可用于输出日志或是统计，
+// 方便排查延迟异常的请求。
+// 如果 stack 为 true，在执行时间达到 threshold 时会记录执行服务的 goroutine 的调用栈，
+// 用于分析服务耗时的位置。获取调用栈的代价比较高，不建议在 threshold 较小时启用。
+//
+// h 为空表示取消，多次调用会相互覆盖。
+func (s *Server) SlowCallHandler(threshold time.Duration, stack bool, h func(*SlowCall)) {
+	if h == nil {
+		s.slow = nil
+		return
+	}
+	s.slow = &slowCall{threshold: threshold, stack: stack, h: h}
+}
+
+func (c *SlowCall) String() string {
+	return fmt.Sprintf("慢请求 %s 耗时 %s，参数大小 %d，来自 %s", c.Method, c.Duration, c.ParamsSize, c.Peer)
+}
+
+// 开始监视请求 req 的执行，返回的函数需要在服务执行完之后调用。
+//
+// 需要在执行服务的 goroutine 中调用。
+func (sc *slowCall) watch(clock Clock, t Transport, req *body) func() {
+	start := clock.Now()
+
+	var mux sync.Mutex
+	var stack []byte
+	var stop func()
+	if sc.stack {
+		id := goroutineID()
+		stop = afterFunc(clock, sc.threshold, func() {
+			s := goroutineStack(id)
+			mux.Lock()
+			stack = s
+			mux.Unlock()
+		})
+	}
+
+	return func() {
+		d := clock.Now().Sub(start)
+		if stop != nil {
+			stop()
+		}
+		if d < sc.threshold {
+			return
+		}
+
+		c := &SlowCall{
+			Method:   req.Method,
+			ID:       req.ID,
+			Peer:     peerOf(t),
+			Duration: d,
+		}
+		if req.Params != nil {
+			c.ParamsSize = len(*req.Params)
+		}
+		mux.Lock()
+		c.Stack = stack
+		mux.Unlock()
+
+		sc.h(c)
+	}
+}
+
+// 当前 goroutine 的 ID
+func goroutineID() string {
+	var buf [64]byte
+	s := buf[:runtime.Stack(buf[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+	if i := bytes.IndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	if _, err := strconv.ParseUint(string(s), 10, 64); err != nil {
+		return ""
+	}
+	return string(s)
+}
+
+// 获取 ID 为 id 的 goroutine 的调用栈，如果找不到，返回 nil。
+func goroutineStack(id string) []byte {
+	if id == "" {
+		return nil
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+
+	prefix := []byte("goroutine " + id + " [")
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(s, prefix) {
+			return s
+		}
+	}
+	return nil
+}
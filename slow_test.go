@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func slowHandler(notify bool, in, out *int) error {
+	time.Sleep(time.Duration(*in) * time.Millisecond)
+	return nil
+}
+
+func TestServer_SlowCallHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.Register("slow", slowHandler))
+
+	var call *SlowCall
+	srv.SlowCallHandler(50*time.Millisecond, false, func(c *SlowCall) { call = c })
+
+	send := func(params string) {
+		p := json.RawMessage(params)
+		transport := NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil)
+		a.NotError(srv.response(transport, &body{Version: Version, ID: srv.id(), Method: "slow", Params: &p}))
+	}
+
+	send("1")
+	a.Nil(call)
+
+	send("100")
+	a.NotNil(call).
+		Equal(call.Method, "slow").
+		NotNil(call.ID).
+		Equal(call.ParamsSize, 3).
+		True(call.Duration >= 100*time.Millisecond).
+		Nil(call.Stack).
+		Contains(call.String(), "slow")
+
+	// 调用栈
+	call = nil
+	srv.SlowCallHandler(50*time.Millisecond, true, func(c *SlowCall) { call = c })
+	send("100")
+	a.NotNil(call).
+		Contains(string(call.Stack), "slowHandler")
+
+	// 取消
+	call = nil
+	srv.SlowCallHandler(50*time.Millisecond, true, nil)
+	send("100")
+	a.Nil(call)
+}
+
+func TestGoroutineStack(t *testing.T) {
+	a := assert.New(t, false)
+
+	id := goroutineID()
+	a.NotEmpty(id)
+	a.Contains(string(goroutineStack(id)), "TestGoroutineStack")
+	a.Nil(goroutineStack("")).Nil(goroutineStack("0"))
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+// SSHChannelType 在 SSH 连接上打开 JSON RPC 通道时使用的通道类型
+//
+// 作为客户端时，可以通过 ssh.Client.OpenChannel(SSHChannelType, nil) 打开通道；
+// 作为服务端时，对 ssh.NewChannel.ChannelType() 为该值的通道调用 Accept。
+const SSHChannelType = "jsonrpc"
+
+// SSHChannel SSH 通道的接口
+//
+// golang.org/x/crypto/ssh 中的 ssh.Channel 实现了此接口，
+// 之所以不直接引用该类型，是为了不让本包依赖 golang.org/x/crypto。
+type SSHChannel interface {
+	io.ReadWriteCloser
+
+	// 关闭写入端，对方会读到 io.EOF。
+	CloseWrite() error
+}
+
+// SSHOpener 可以打开 SSH 通道的客户端
+//
+// golang.org/x/crypto/ssh 中的 ssh.Client.OpenChannel 带有额外的参数和返回值，
+// 需要简单地包装：
+//
+//	type opener struct{ *ssh.Client }
+//
+//	func (o opener) OpenChannel(channelType string) (jsonrpc.SSHChannel, error) {
+//	    ch, reqs, err := o.Client.OpenChannel(channelType, nil)
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    go ssh.DiscardRequests(reqs)
+//	    return ch, nil
+//	}
+type SSHOpener interface {
+	// OpenChannel 打开类型为 channelType 的通道
+	//
+	// 通道上的请求（ssh.Request）与 JSON RPC 无关，需要由实现者处理。
+	OpenChannel(channelType string) (SSHChannel, error)
+}
+
+// SSHNewChannel 对方请求打开的 SSH 通道
+//
+// 对应 golang.org/x/crypto/ssh 中的 ssh.NewChannel，同样需要简单地包装：
+//
+//	type newChannel struct{ ssh.NewChannel }
+//
+//	func (c newChannel) Accept() (jsonrpc.SSHChannel, error) {
+//	    ch, reqs, err := c.NewChannel.Accept()
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    go ssh.DiscardRequests(reqs)
+//	    return ch, nil
+//	}
+//
+//	func (c newChannel) Reject(message string) error {
+//	    return c.NewChannel.Reject(ssh.UnknownChannelType, message)
+//	}
+type SSHNewChannel interface {
+	// ChannelType 通道的类型
+	ChannelType() string
+
+	// Accept 接受通道
+	Accept() (SSHChannel, error)
+
+	// Reject 拒绝通道，message 为拒绝的原因。
+	Reject(message string) error
+}
+
+// NewSSHTransport 声明基于 SSH 通道的 Transport 实例
+//
+// 可以借助 SSH 已有的认证和隧道功能传输 JSON RPC 数据，
+// header 的含义与 [NewStreamTransport] 相同。
+//
+// 通道上的请求（ssh.Request）与 JSON RPC 无关，
+// 需要调用方自行处理，比如交由 ssh.DiscardRequests 丢弃。
+// 客户端可以通过 [DialSSH] 打开通道，服务端则可以通过 [Server.ServeSSHChannel] 处理对方打开的通道。
+func NewSSHTransport(header bool, ch SSHChannel) Transport {
+	return NewStreamTransport(header, ch, ch, func() error {
+		if err := ch.CloseWrite(); err != nil && err != io.EOF {
+			ch.Close()
+			return err
+		}
+		return ch.Close()
+	})
+}
+
+// DialSSH 通过 o 打开类型为 [SSHChannelType] 的通道并返回作为客户端使用的 [Transport]
+//
+// header 的含义与 [NewStreamTransport] 相同。
+//
+//	t, err := jsonrpc.DialSSH(opener{client}, true)
+//	conn := srv.NewConn(t, nil)
+func DialSSH(o SSHOpener, header bool) (Transport, error) {
+	ch, err := o.OpenChannel(SSHChannelType)
+	if err != nil {
+		return nil, err
+	}
+	return NewSSHTransport(header, ch), nil
+}
+
+// ServeSSHChannel 处理对方打开的 SSH 通道
+//
+// 类型为 [SSHChannelType] 的通道会被接受，并在其上运行 [Conn.Serve] 直到 ctx 被取消或是通道关闭；
+// 其它类型的通道会被拒绝并返回错误。
+// header 的含义与 [NewStreamTransport] 相同，errlog 的含义与 [Server.NewConn] 相同。
+//
+//	for nc := range chans {
+//	    go srv.ServeSSHChannel(ctx, newChannel{nc}, true, nil)
+//	}
+func (s *Server) ServeSSHChannel(ctx context.Context, nc SSHNewChannel, header bool, errlog *log.Logger) error {
+	if typ := nc.ChannelType(); typ != SSHChannelType {
+		if err := nc.Reject("unknown channel type " + typ); err != nil {
+			return err
+		}
+		return fmt.Errorf("不支持的通道类型 %s", typ)
+	}
+
+	ch, err := nc.Accept()
+	if err != nil {
+		return err
+	}
+	return s.NewConn(NewSSHTransport(header, ch), errlog).Serve(ctx)
+}
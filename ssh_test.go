@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+// 以 net.Pipe 模拟 SSH 通道
+type pipeChannel struct {
+	net.Conn
+	closeWrite int
+	close      int
+}
+
+func (c *pipeChannel) CloseWrite() error {
+	c.closeWrite++
+	return nil
+}
+
+func (c *pipeChannel) Close() error {
+	c.close++
+	return c.Conn.Close()
+}
+
+func TestNewSSHTransport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	c1, c2 := net.Pipe()
+	srvCh := &pipeChannel{Conn: c1}
+	clientCh := &pipeChannel{Conn: c2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		srv.NewConn(NewSSHTransport(true, srvCh), nil).Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewSSHTransport(true, clientCh)
+	req, err := srv.newRequest(false, "f1", &inType{Age: 18})
+	a.NotError(err)
+	a.NotError(client.Write(req))
+
+	resp := &body{}
+	a.NotError(client.Read(resp)).
+		Equal(resp.ID, req.ID).
+		Equal(string(*resp.Result), `{"name":"","age":18}`)
+
+	a.NotError(client.Close()).
+		Equal(clientCh.closeWrite, 1).
+		Equal(clientCh.close, 1)
+
+	cancel()
+	<-exit
+}
+
+type pipeOpener struct {
+	ch          SSHChannel
+	channelType string
+}
+
+func (o *pipeOpener) OpenChannel(channelType string) (SSHChannel, error) {
+	o.channelType = channelType
+	return o.ch, nil
+}
+
+type pipeNewChannel struct {
+	channelType string
+	ch          SSHChannel
+	rejected    string
+}
+
+func (c *pipeNewChannel) ChannelType() string { return c.channelType }
+
+func (c *pipeNewChannel) Accept() (SSHChannel, error) { return c.ch, nil }
+
+func (c *pipeNewChannel) Reject(message string) error {
+	c.rejected = message
+	return nil
+}
+
+func TestServer_ServeSSHChannel(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	// 不支持的通道类型
+	nc := &pipeNewChannel{channelType: "session"}
+	a.Error(srv.ServeSSHChannel(context.Background(), nc, true, nil)).NotEmpty(nc.rejected)
+
+	c1, c2 := net.Pipe()
+	nc = &pipeNewChannel{channelType: SSHChannelType, ch: &pipeChannel{Conn: c1}}
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		srv.ServeSSHChannel(ctx, nc, true, nil)
+		exit <- struct{}{}
+	}()
+
+	o := &pipeOpener{ch: &pipeChannel{Conn: c2}}
+	client, err := DialSSH(o, true)
+	a.NotError(err).Equal(o.channelType, SSHChannelType)
+
+	req, err := srv.newRequest(false, "f1", &inType{Age: 18})
+	a.NotError(err)
+	a.NotError(client.Write(req))
+	resp := &body{}
+	a.NotError(client.Read(resp)).
+		Equal(resp.ID, req.ID).
+		Equal(string(*resp.Result), `{"name":"","age":18}`).
+		Empty(nc.rejected)
+
+	a.NotError(client.Close())
+	cancel()
+	<-exit
+}
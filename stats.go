@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets 客户端请求往返时间的统计区间的上限
+//
+// 与 Prometheus 中直方图的 le 相同，可直接用于构建直方图，[WriteMetrics] 也以此作为直方图的区间。
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Stats 连接上的数据统计
+//
+// 字节数仅包含帧的 JSON 内容，不包含报头等传输层自身的数据，
+// 与 [Frame.Data] 的长度相同。
+type Stats struct {
+	MessagesIn  int64 // 读取的消息数量
+	MessagesOut int64 // 写入的消息数量
+	BytesIn     int64 // 读取的字节数
+	BytesOut    int64 // 写入的字节数
+	MaxFrameIn  int64 // 读取的最大帧字节数
+	MaxFrameOut int64 // 写入的最大帧字节数
+
+	// 作为客户端时，以服务名为键名的请求统计
+	Calls map[string]*CallStats
+}
+
+// CallStats 作为客户端时对某一服务的请求统计
+type CallStats struct {
+	Calls     int64 // 通过 Send 和 Notify 发出的请求数量
+	Retries   int64 // 写入失败之后的重试次数，参考 [WithRetry]。
+	Responses int64 // 收到的返回数据数量
+
+	// 按错误代码统计的收到的错误数量
+	Errors map[int]int64
+
+	// 往返时间落在 [LatencyBuckets] 各个区间的累计数量
+	//
+	// Latency[i] 表示小于等于 LatencyBuckets[i] 的数量，
+	// 超过最大值的只计入 Responses 和 LatencySum。
+	Latency    []int64
+	LatencySum time.Duration
+}
+
+type stats struct {
+	s     Stats
+	log   bool     // 是否在 Serve 退出时输出统计信息
+	calls sync.Map // 服务名 => *callStats
+}
+
+type callStats struct {
+	mux sync.Mutex
+	s   CallStats
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("in: %d messages/%d bytes/max %d, out: %d messages/%d bytes/max %d",
+		s.MessagesIn, s.BytesIn, s.MaxFrameIn, s.MessagesOut, s.BytesOut, s.MaxFrameOut)
+}
+
+// CollectStats 统计连接上的消息数量和字节数
+//
+// 统计结果可通过 [Conn.Stats] 获取，可用于发现滥用或是过于频繁通讯的对方。
+// 同时也会统计作为客户端时各个服务的请求数量、收到的错误以及往返时间等，参考 [CallStats]。
+// log 为 true 时，会在 [Conn.Serve] 退出时将统计结果输出到 [Server.NewConn] 指定的日志。
+//
+// 统计需要在编解码时复制每一帧的原始数据，会有一定的性能损耗。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用，且只能调用一次。
+func (conn *Conn) CollectStats(log bool) {
+	if conn.stats != nil {
+		panic("已经启用了统计功能")
+	}
+
+	conn.stats = &stats{log: log}
+	conn.transport = &tapTransport{Transport: conn.transport, tap: conn.stats.tap, clock: conn.server.clock}
+}
+
+// Stats 返回连接上的数据统计
+//
+// 仅在调用 [Conn.CollectStats] 之后才会统计，否则返回 nil。
+func (conn *Conn) Stats() *Stats {
+	if conn.stats == nil {
+		return nil
+	}
+
+	s := &conn.stats.s
+	ret := &Stats{
+		MessagesIn:  atomic.LoadInt64(&s.MessagesIn),
+		MessagesOut: atomic.LoadInt64(&s.MessagesOut),
+		BytesIn:     atomic.LoadInt64(&s.BytesIn),
+		BytesOut:    atomic.LoadInt64(&s.BytesOut),
+		MaxFrameIn:  atomic.LoadInt64(&s.MaxFrameIn),
+		MaxFrameOut: atomic.LoadInt64(&s.MaxFrameOut),
+	}
+
+	conn.stats.calls.Range(func(k, v interface{}) bool {
+		if ret.Calls == nil {
+			ret.Calls = make(map[string]*CallStats)
+		}
+		ret.Calls[k.(string)] = v.(*callStats).snapshot()
+		return true
+	})
+	return ret
+}
+
+// 统计返回数据 resp 对应请求的往返时间和错误
+func (conn *Conn) receivedStats(resp *body) {
+	if conn.stats == nil || resp.ID == nil {
+		return
+	}
+	if p, found := conn.callbacks.Load(resp.ID); found {
+		p := p.(*pending)
+		conn.stats.received(p.method, conn.server.clock.Now().Sub(p.sent), resp.Error)
+	}
+}
+
+// 统计方法 method 发出的请求，retries 为重试次数。
+func (s *stats) sent(method string, retries int) {
+	c := s.call(method)
+	c.mux.Lock()
+	c.s.Calls++
+	c.s.Retries += int64(retries)
+	c.mux.Unlock()
+}
+
+// 统计方法 method 收到的返回数据，d 为往返时间。
+func (s *stats) received(method string, d time.Duration, err *Error) {
+	c := s.call(method)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.s.Responses++
+	c.s.LatencySum += d
+	for i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] }); i < len(LatencyBuckets); i++ {
+		c.s.Latency[i]++
+	}
+	if err != nil {
+		if c.s.Errors == nil {
+			c.s.Errors = make(map[int]int64)
+		}
+		c.s.Errors[err.Code]++
+	}
+}
+
+func (s *stats) call(method string) *callStats {
+	if c, found := s.calls.Load(method); found {
+		return c.(*callStats)
+	}
+	c, _ := s.calls.LoadOrStore(method, &callStats{s: CallStats{Latency: make([]int64, len(LatencyBuckets))}})
+	return c.(*callStats)
+}
+
+func (c *callStats) snapshot() *CallStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	s := c.s
+	s.Latency = append([]int64(nil), c.s.Latency...)
+	if c.s.Errors != nil {
+		s.Errors = make(map[int]int64, len(c.s.Errors))
+		for k, v := range c.s.Errors {
+			s.Errors[k] = v
+		}
+	}
+	return &s
+}
+
+func (s *stats) tap(f *Frame) {
+	size := int64(len(f.Data))
+	if f.Direction == DirectionIn {
+		atomic.AddInt64(&s.s.MessagesIn, 1)
+		atomic.AddInt64(&s.s.BytesIn, size)
+		storeMax(&s.s.MaxFrameIn, size)
+	} else {
+		atomic.AddInt64(&s.s.MessagesOut, 1)
+		atomic.AddInt64(&s.s.BytesOut, size)
+		storeMax(&s.s.MaxFrameOut, size)
+	}
+}
+
+func storeMax(addr *int64, v int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		if v <= old || atomic.CompareAndSwapInt64(addr, old, v) {
+			return
+		}
+	}
+}
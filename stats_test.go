@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_CollectStats(t *testing.T) {
+	a := assert.New(t, false)
+	srv := NewServer(func() string { return <-uniqueID })
+	a.True(srv.Register("echo", func(notify bool, in *string, out *string) error {
+		*out = *in
+		return nil
+	}))
+
+	srvConn, clientConn := net.Pipe()
+	logs := &syncBuffer{}
+	conn := srv.NewConn(NewSocketTransport(false, srvConn, 0), log.New(logs, "", 0))
+	a.Nil(conn.Stats())
+	conn.CollectStats(true)
+	a.Panic(func() { conn.CollectStats(false) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 1)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	client := NewStreamTransport(false, clientConn, clientConn, nil)
+	for _, p := range []string{"1", "12345"} {
+		req, err := srv.newRequest(false, "echo", p)
+		a.NotError(err)
+		a.NotError(client.Write(req))
+		a.NotError(client.Read(&body{}))
+	}
+
+	s := conn.Stats()
+	a.Equal(s.MessagesIn, 2).
+		Equal(s.MessagesOut, 2).
+		True(s.BytesIn > s.MaxFrameIn).
+		True(s.BytesOut > s.MaxFrameOut).
+		True(s.MaxFrameIn > 0).
+		True(s.MaxFrameOut > 0)
+
+	cancel()
+	a.NotError(clientConn.Close())
+	<-exit
+	a.Contains(logs.String(), "连接统计：in: 2 messages")
+}
+
+func TestConn_CollectStats_calls(t *testing.T) {
+	a := assert.New(t, false)
+	srv := NewServer(func() string { return <-uniqueID })
+	a.True(srv.Register("echo", func(notify bool, in *string, out *string) error {
+		*out = *in
+		return nil
+	}))
+	a.True(srv.Register("fail", func(notify bool, in *string, out *string) error {
+		return NewError(-32100, "fail")
+	}))
+
+	done := make(chan struct{}, 10)
+	cs := NewServer(func() string { return <-uniqueID })
+	cs.ErrHandler(func(*Error) { done <- struct{}{} })
+
+	c1, c2 := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	client := cs.NewConn(NewSocketTransport(false, c2, 0), nil)
+	client.CollectStats(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	cb := func(*string) error {
+		done <- struct{}{}
+		return nil
+	}
+	a.NotError(client.Send("echo", "1", cb))
+	a.NotError(client.Send("echo", "2", cb))
+	a.NotError(client.Send("fail", "3", cb))
+	a.NotError(client.Notify("echo", "4"))
+	<-done
+	<-done
+	<-done
+
+	s := client.Stats()
+	a.Length(s.Calls, 2)
+	echo := s.Calls["echo"]
+	a.Equal(echo.Calls, 3).
+		Equal(echo.Responses, 2).
+		Equal(echo.Retries, 0).
+		Nil(echo.Errors).
+		Length(echo.Latency, len(LatencyBuckets)).
+		Equal(echo.Latency[len(LatencyBuckets)-1], 2).
+		True(echo.LatencySum > 0)
+	fail := s.Calls["fail"]
+	a.Equal(fail.Calls, 1).
+		Equal(fail.Responses, 1).
+		Equal(fail.Errors, map[int]int64{-32100: 1})
+
+	cancel()
+	c1.Close()
+	c2.Close()
+	<-exit
+	<-exit
+}
+
+func TestStats_received(t *testing.T) {
+	a := assert.New(t, false)
+
+	s := &stats{}
+	s.received("m", 30*time.Millisecond, nil)
+	s.received("m", time.Minute, nil)
+	c := s.call("m").snapshot()
+	a.Equal(c.Responses, 2).
+		Equal(c.LatencySum, time.Minute+30*time.Millisecond).
+		Equal(c.Latency[3], 0). // 25ms
+		Equal(c.Latency[4], 1). // 50ms
+		Equal(c.Latency[len(LatencyBuckets)-1], 1)
+}
+
+func TestStoreMax(t *testing.T) {
+	a := assert.New(t, false)
+
+	var v int64
+	storeMax(&v, 5)
+	storeMax(&v, 3)
+	a.Equal(v, 5)
+}
+
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.buf.Reset()
+}
+
+func TestConn_CollectStats_transport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := bytes.NewBufferString("X-Timeout:1000\r\nContent-Length:17\r\n\r\n{\"jsonrpc\":\"2.0\"}" +
+		"Content-Length:60\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"f1\",\"params\":\"" + strings.Repeat("x", 17) + "\"}")
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(true, in, out, nil), nil)
+	conn.CollectStats(false)
+	conn.MaxMessageSize(50)
+
+	// 读取时的 X-Timeout
+	req := &body{}
+	a.NotError(conn.transport.Read(req)).
+		Equal(req.Version, Version).
+		False(req.deadline.IsZero()).
+		Equal(conn.Stats().MessagesIn, 1).
+		Equal(conn.Stats().BytesIn, 17)
+
+	// MaxMessageSize 依然有效
+	var tl *tooLargeError
+	a.True(errors.As(conn.transport.Read(&body{}), &tl)).Equal(tl.limit, 50)
+
+	// 写入时的 X-Timeout
+	a.NotError(conn.transport.Write(&body{Version: Version, ID: &ID{isNumber: true, number: 1}, deadline: time.Now().Add(time.Second)}))
+	a.Contains(out.String(), timeoutHeader).
+		Equal(conn.Stats().MessagesOut, 1)
+
+	// Peer
+	srvConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	conn = srv.NewConn(NewSocketTransport(true, srvConn, 0), nil)
+	conn.CollectStats(false)
+	a.Equal(peerOf(conn.transport), srvConn.RemoteAddr().String())
+}
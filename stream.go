@@ -6,17 +6,26 @@ package jsonrpc
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	maxHeaderLineSize = 4096      // 报头单行的最大长度
+	maxHeaderSize     = 16 * 1024 // 报头的最大长度
+)
+
 // 定义基于流的传输层定义
 type streamTransport struct {
 	// header 表示是否数据流中带有报头信息
@@ -25,6 +34,8 @@ type streamTransport struct {
 	header  bool
 	buffer  *bufio.Reader
 	decoder *json.Decoder
+	limited io.LimitedReader // 读取带报头的内容时复用
+	frame   frameReader      // 读取超时之后，保存未读完的数据。
 	inMux   sync.Mutex
 
 	out    io.Writer
@@ -32,26 +43,145 @@ type streamTransport struct {
 
 	// 关闭流的函数
 	close func() error
+
+	// 对方的地址，可能为空。
+	peer string
+
+	// 计算 X-Timeout 报头的时间源
+	clock Clock
+
+	// 超过此大小的内容才会被压缩，为 0 表示不压缩。
+	threshold int
+
+	// 对方能接受的压缩方式
+	peerEncoding atomic.Value
+
+	compression adaptiveCompression
+
+	// 是否严格检测 Content-Length 与内容是否相符
+	strictLength bool
+
+	// 内容的最大长度，为 0 表示不限制，参考 [Conn.MaxMessageSize]。
+	maxSize int64
 }
 
-// 对 net.Conn 进行了自定义，使 Read 具有超时功能。
+// 对 net.Conn 进行了自定义，使 Read 和 Write 具有超时功能。
 type socket struct {
 	net.Conn
-	timeout time.Duration
+	timeout      time.Duration
+	writeTimeout time.Duration
 }
 
 func (conn *socket) Read(p []byte) (int, error) {
-	conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	if conn.timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	}
 	return conn.Conn.Read(p)
 }
 
-func newSocketStream(conn net.Conn, timeout time.Duration) io.ReadWriteCloser {
-	if timeout > 0 {
-		return &socket{Conn: conn, timeout: timeout}
+func (conn *socket) Write(p []byte) (int, error) {
+	if conn.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(conn.writeTimeout))
+	}
+	return conn.Conn.Write(p)
+}
+
+func newSocketStream(conn net.Conn, timeout, writeTimeout time.Duration) io.ReadWriteCloser {
+	if timeout > 0 || writeTimeout > 0 {
+		return &socket{Conn: conn, timeout: timeout, writeTimeout: writeTimeout}
 	}
 	return conn
 }
 
+// SocketOptions 对 net.Conn 的一些设置项
+//
+// 零值表示不作任何修改，保持 net.Conn 的默认值。
+// 如果 net.Conn 不支持某一项设置，则会忽略该项。
+type SocketOptions struct {
+	// TCP keepalive 的探测间隔
+	//
+	// 大于 0 表示启用并指定探测间隔；小于 0 表示禁用 keepalive。
+	KeepAlive time.Duration
+
+	// 是否启用 Nagle 算法
+	//
+	// Go 默认是禁用 Nagle 算法的，即 SetNoDelay(true)。
+	Nagle bool
+
+	// 操作系统为该连接分配的读写缓存大小，仅在大于 0 时有效。
+	ReadBuffer  int
+	WriteBuffer int
+
+	// 写入数据的超时时间，仅在大于 0 时有效。
+	//
+	// 如果对方一直不读取数据，写入操作可能会被永远阻塞，
+	// 指定此值可以让写入操作在超时之后返回错误，
+	// 该错误符合 errors.Is(err, os.ErrDeadlineExceeded)，
+	// 会由 [Conn.Notify] 和 [Conn.Send] 等方法返回。
+	//
+	// NOTE: 超时之后数据可能只写入了一部分，此时连接上的数据已经不再完整，
+	// 应该关闭该连接。
+	WriteTimeout time.Duration
+
+	// 启用压缩时的阈值，仅在带报头时有效。
+	//
+	// 具体说明可参考 [NewStreamTransportWithCompression]。
+	CompressThreshold int
+
+	// 是否严格检测 Content-Length，仅在带报头时有效。
+	//
+	// 具体说明可参考 [NewStrictStreamTransport]。
+	StrictLength bool
+}
+
+func (o *SocketOptions) apply(conn net.Conn) error {
+	if o == nil {
+		return nil
+	}
+
+	if o.KeepAlive != 0 {
+		if c, ok := conn.(interface {
+			SetKeepAlive(bool) error
+			SetKeepAlivePeriod(time.Duration) error
+		}); ok {
+			if err := c.SetKeepAlive(o.KeepAlive > 0); err != nil {
+				return err
+			}
+			if o.KeepAlive > 0 {
+				if err := c.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if o.Nagle {
+		if c, ok := conn.(interface{ SetNoDelay(bool) error }); ok {
+			if err := c.SetNoDelay(false); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.ReadBuffer > 0 {
+		if c, ok := conn.(interface{ SetReadBuffer(int) error }); ok {
+			if err := c.SetReadBuffer(o.ReadBuffer); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.WriteBuffer > 0 {
+		if c, ok := conn.(interface{ SetWriteBuffer(int) error }); ok {
+			if err := c.SetWriteBuffer(o.WriteBuffer); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // NewSocketTransport 声明基于 net.Conn 的 Transport 实例
 //
 // HTTP、UDP 和 websocket 有专门的实现方法。
@@ -60,8 +190,55 @@ func newSocketStream(conn net.Conn, timeout time.Duration) io.ReadWriteCloser {
 // Conn.Serve() 通过 context.WithCancel 中断当前的服务，但是该功能可能由于 net.Conn.Read()
 // 方法阻塞而无法真正中断服务，timeout 指定了 net.Conn.Read() 方法在无法读取数据是的超时时间。
 func NewSocketTransport(header bool, conn net.Conn, timeout time.Duration) Transport {
-	s := newSocketStream(conn, timeout)
-	return NewStreamTransport(header, s, s, func() error { return s.Close() })
+	return newSocketTransport(header, conn, timeout, 0)
+}
+
+func newSocketTransport(header bool, conn net.Conn, timeout, writeTimeout time.Duration) Transport {
+	s := newSocketStream(conn, timeout, writeTimeout)
+	t := NewStreamTransport(header, s, s, func() error { return s.Close() }).(*streamTransport)
+	if addr := conn.RemoteAddr(); addr != nil {
+		t.peer = addr.String()
+	}
+	return t
+}
+
+// NewSocketTransportWithOptions 声明基于 net.Conn 的 Transport 实例
+//
+// 与 [NewSocketTransport] 相同，但是会在创建之前将 opt 应用于 conn，
+// opt 为空表示不作任何修改。
+func NewSocketTransportWithOptions(header bool, conn net.Conn, timeout time.Duration, opt *SocketOptions) (Transport, error) {
+	if err := opt.apply(conn); err != nil {
+		return nil, err
+	}
+
+	if opt == nil {
+		return newSocketTransport(header, conn, timeout, 0), nil
+	}
+
+	t := newSocketTransport(header, conn, timeout, opt.WriteTimeout).(*streamTransport)
+	t.threshold = opt.CompressThreshold
+	t.strictLength = opt.StrictLength
+	return t, nil
+}
+
+// NewTCPClientTransport 声明用于客户端的 TCP Transport 接口
+//
+// 这是对 [NewSocketTransportWithOptions] 的二次封装，其中的 conn 参数由 [net.Dial] 创建。
+//
+// addr 用于指定服务端地址；opt 为对连接的设置项，可以为空。
+// timeout 指定了在无法读取数据时的超时时间。
+func NewTCPClientTransport(header bool, addr string, timeout time.Duration, opt *SocketOptions) (Transport, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := NewSocketTransportWithOptions(header, conn, timeout, opt)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return t, nil
 }
 
 // NewStreamTransport 返回基于流的 Transport 实例
@@ -73,10 +250,11 @@ func NewStreamTransport(header bool, in io.Reader, out io.Writer, close func() e
 		header: header,
 		out:    out,
 		close:  close,
+		clock:  systemClock{},
 	}
 
 	if header {
-		t.buffer = bufio.NewReader(in)
+		t.buffer = bufio.NewReaderSize(in, maxHeaderLineSize)
 	} else {
 		t.decoder = json.NewDecoder(in)
 	}
@@ -84,6 +262,8 @@ func NewStreamTransport(header bool, in io.Reader, out io.Writer, close func() e
 	return t
 }
 
+func (s *streamTransport) setClock(c Clock) { s.clock = c }
+
 func (s *streamTransport) Read(v interface{}) error {
 	s.inMux.Lock()
 	defer s.inMux.Unlock()
@@ -92,81 +272,371 @@ func (s *streamTransport) Read(v interface{}) error {
 		return s.decoder.Decode(v)
 	}
 
-	var length int64
+	// 读取超时的数据会保留在 s.frame 中，下次调用时继续读取，
+	// 这样以超时作为中断手段时，不会破坏正在读取的数据。
+	err := s.readFrame(v)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		s.frame.reset()
+	}
+	return err
+}
+
+func (s *streamTransport) readFrame(v interface{}) error {
+	f := &s.frame
+	if !f.headerDone {
+		if err := f.readHeader(s.buffer); err != nil {
+			return err
+		}
+		f.headerDone = true
+	}
+
+	h := f.header
+	if h.accept != "" {
+		s.peerEncoding.Store(h.accept)
+	}
+	if h.timeout > 0 {
+		if b := bodyOf(v); b != nil {
+			b.deadline = s.clock.Now().Add(h.timeout)
+		}
+	}
+	if h.length == 0 {
+		return nil
+	}
+	if s.maxSize > 0 && h.length > s.maxSize {
+		return s.discard()
+	}
+
+	// 缓存的大小最多只到 readBufferClasses 中的最大值，之后根据实际读取的内容增长，
+	// 防止通过伪造的 Content-Length 耗尽内存。
+	if f.body == nil {
+		f.body = getReadBuffer(h.length)
+	}
+	buf := f.body
+
+	s.limited.R = s.buffer
+	s.limited.N = h.length - int64(buf.Len())
+	if _, err := buf.ReadFrom(&s.limited); err != nil {
+		return err
+	}
+	if int64(buf.Len()) < h.length {
+		return io.ErrUnexpectedEOF
+	}
+
+	data := buf.Bytes()
+	if h.encoding != "" {
+		var err error
+		if data, err = decompress(h.encoding, data); err != nil {
+			return err
+		}
+		if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+			return &tooLargeError{size: int64(len(data)), limit: s.maxSize}
+		}
+	} else if s.strictLength {
+		if err := s.checkLength(data); err != nil {
+			return err
+		}
+	}
+	data, err := trimBOM(data)
+	if err != nil {
+		return err
+	}
+
+	// json.Decoder 的内部缓存无法复用，所以直接对缓存的内容调用 json.Unmarshal，
+	// 解码后的对象不会引用 data 的内容，缓存可以放回缓存池。
+	return json.Unmarshal(data, v)
+}
+
+// 读取带报头的内容时所使用缓存的大小分级
+var readBufferClasses = [...]int{4 * 1024, 32 * 1024, 256 * 1024}
+
+var readBufferPools = newReadBufferPools()
+
+func newReadBufferPools() (pools [len(readBufferClasses)]*sync.Pool) {
+	for i, size := range readBufferClasses {
+		size := size
+		pools[i] = &sync.Pool{New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, size))
+		}}
+	}
+	return pools
+}
+
+// 获取能容纳 size 字节的缓存
+//
+// 超过最大分级的，从最大分级中获取，由 bytes.Buffer 自行增长。
+func getReadBuffer(size int64) *bytes.Buffer {
+	for i, c := range readBufferClasses {
+		if size <= int64(c) {
+			return readBufferPools[i].Get().(*bytes.Buffer)
+		}
+	}
+	return readBufferPools[len(readBufferPools)-1].Get().(*bytes.Buffer)
+}
+
+// 根据容量将 buf 放回对应的分级，超过最大分级两倍的直接丢弃。
+func putReadBuffer(buf *bytes.Buffer) {
+	c := buf.Cap()
+	if c > 2*readBufferClasses[len(readBufferClasses)-1] {
+		return
+	}
+
+	for i := len(readBufferClasses) - 1; i >= 0; i-- {
+		if c >= readBufferClasses[i] {
+			buf.Reset()
+			readBufferPools[i].Put(buf)
+			return
+		}
+	}
+}
+
+// 报头中与内容相关的信息
+type frameHeader struct {
+	length   int64
+	encoding string        // Content-Encoding 的值
+	accept   string        // 根据 Accept-Encoding 协商出的压缩方式，为空表示不支持压缩。
+	timeout  time.Duration // X-Timeout 的值，为 0 表示未指定。
+}
+
+// 读取一条带报头的数据
+//
+// 读取超时时会保存已经读取的内容，以便下次继续读取。
+type frameReader struct {
+	header     frameHeader
+	headerDone bool   // 报头是否已经读取完成
+	size       int    // 已经读取的报头长度
+	found      bool   // 是否已经读取到了 Content-Length
+	line       []byte // 读取超时时未读完的报头行
+	body       *bytes.Buffer
+	discarded  int64 // 内容过大时已经丢弃的字节数
+}
+
+func (f *frameReader) reset() {
+	if f.body != nil {
+		putReadBuffer(f.body)
+	}
+	*f = frameReader{line: f.line[:0]}
+}
+
+// 从 r 中读取报头
+//
+// 行以 \n 或是 \r\n 结尾，其它位置出现的 \r 以及 NUL 字符均被视为无效的报头；
+// 单行的长度不能超过 r 的缓存大小，所有报头的总长度不能超过 maxHeaderSize。
+func readHeader(r *bufio.Reader) (frameHeader, error) {
+	f := &frameReader{}
+	err := f.readHeader(r)
+	return f.header, err
+}
+
+func (f *frameReader) readHeader(r *bufio.Reader) error {
+	h := &f.header
 	for {
-		line, err := s.buffer.ReadString('\n')
-		if err != nil {
+		line, err := r.ReadSlice('\n')
+		if len(f.line) > 0 || (err != nil && len(line) > 0) {
+			if len(f.line)+len(line) > r.Size() {
+				return errHeaderTooLarge
+			}
+			f.line = append(f.line, line...)
+			line = f.line
+		}
+		if err == bufio.ErrBufferFull {
+			return errHeaderTooLarge
+		} else if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				f.line = f.line[:0]
+			}
 			return err
 		}
-		line = strings.TrimSpace(line)
+		f.line = f.line[:0]
+
+		if f.size += len(line); f.size > maxHeaderSize {
+			return errHeaderTooLarge
+		}
+
+		line = line[:len(line)-1]
+		if l := len(line); l > 0 && line[l-1] == '\r' {
+			line = line[:l-1]
+		}
+		if bytes.IndexByte(line, '\r') >= 0 || bytes.IndexByte(line, 0) >= 0 {
+			return errInvalidHeader
+		}
 
-		if line == "" { // 空行，则表示报头部分已经结束
+		str := strings.TrimSpace(string(line))
+		if str == "" { // 空行，则表示报头部分已经结束
 			break
 		}
 
-		index := strings.IndexByte(line, ':')
+		index := strings.IndexByte(str, ':')
 		if index <= 0 {
 			return errInvalidHeader
 		}
 
-		v := strings.TrimSpace(line[index+1:])
-		switch http.CanonicalHeaderKey(strings.TrimSpace(line[:index])) {
+		v := strings.TrimSpace(str[index+1:])
+		switch http.CanonicalHeaderKey(strings.TrimSpace(str[:index])) {
 		case contentLength:
-			length, err = strconv.ParseInt(v, 10, 64)
+			l, err := strconv.ParseInt(v, 10, 64)
 			if err != nil {
 				return err
 			}
+			if f.found && l != h.length { // 多个不同的 Content-Length
+				return errInvalidHeader
+			}
+			h.length = l
+			f.found = true
 		case contentType:
 			if err := validContentType(v); err != nil {
 				return err
 			}
+		case contentEncoding:
+			h.encoding = strings.ToLower(v)
+		case acceptEncoding:
+			h.accept = negotiateEncoding(v)
+		case timeoutHeader:
+			if h.timeout, err = parseTimeout(v); err != nil {
+				return err
+			}
 		default: // 忽略其它报头
 		}
 	}
 
-	switch {
-	case length < 0:
+	if !f.found || h.length < 0 {
 		return errMissContentLength
-	case length == 0:
-		return nil
 	}
+	return nil
+}
 
-	data := make([]byte, length)
-	n, err := io.ReadFull(s.buffer, data)
-	if err != nil {
-		return err
+// 解析 X-Timeout 报头的值，其值为大于 0 的毫秒数。
+func parseTimeout(v string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, errInvalidHeader
 	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
 
-	return json.Unmarshal(data[:n], v)
+// 将截止时间转换为 X-Timeout 报头的值，已经过期的按 1 毫秒计算。
+//
+// now 为 deadline 所在时间源的当前时间。
+func timeoutMillis(deadline, now time.Time) int64 {
+	if ms := deadline.Sub(now).Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
 }
 
-var contentTypeHeader string
+// 报头中 Content-Length 之前的固定部分
+var contentTypeHeader []byte
+
+// 在缓存中为报头预留的空间，包含了 int64 的最大长度以及结尾的两个换行符。
+var headerReserved []byte
 
 func init() {
-	p := fmt.Sprintf("%s: %s;charset=%s\r\n%s: ", contentType, mimetypes[0], charset, contentLength)
-	contentTypeHeader = p + "%d\r\n\r\n"
+	contentTypeHeader = []byte(fmt.Sprintf("%s: %s;charset=%s\r\n%s: ", contentType, mimetypes[0], charset, contentLength))
+	headerReserved = make([]byte, len(contentTypeHeader)+20+4)
 }
 
+// 超过此大小的缓存不再放回缓存池
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = &sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
 func (s *streamTransport) Write(v interface{}) error {
-	data, err := json.Marshal(v)
-	if err != nil {
+	if s.header && (s.threshold > 0 || hasDeadline(v)) {
+		return s.writeHeaders(v)
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	var reserved int
+	if s.header { // 为报头预留空间，在确定内容长度之后再填充。
+		reserved = len(headerReserved)
+		buf.Write(headerReserved)
+	}
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
 		return err
 	}
+	data := buf.Bytes()
+	data = data[:len(data)-1] // 去掉 Encode 添加的换行符
+
+	// 报头紧挨着内容写入预留空间的尾部，报头和内容合并为一次写入，
+	// 避免被拆分成多个数据包。
+	if s.header {
+		var num [20]byte
+		l := strconv.AppendInt(num[:0], int64(len(data)-reserved), 10)
+		start := reserved - len(contentTypeHeader) - len(l) - 4
+
+		p := start
+		p += copy(data[p:], contentTypeHeader)
+		p += copy(data[p:], l)
+		copy(data[p:], "\r\n\r\n")
+		data = data[start:]
+	}
 
 	s.outMux.Lock()
 	defer s.outMux.Unlock()
 
-	if s.header {
-		_, err = fmt.Fprintf(s.out, contentTypeHeader, len(data))
-		if err != nil {
-			return err
+	_, err := s.out.Write(data)
+	return err
+}
+
+// 输出带有可选报头的内容
+//
+// 相比于 [streamTransport.Write] 中的快速路径，会根据情况输出压缩和超时相关的报头。
+func (s *streamTransport) writeHeaders(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s: %s;charset=%s\r\n", contentType, mimetypes[0], charset)
+
+	b := bodyOf(v)
+	if b != nil && !b.deadline.IsZero() {
+		fmt.Fprintf(buf, "%s: %d\r\n", timeoutHeader, timeoutMillis(b.deadline, s.clock.Now()))
+	}
+
+	if s.threshold > 0 {
+		fmt.Fprintf(buf, "%s: %s\r\n", acceptEncoding, strings.Join(encodings, ", "))
+
+		noCompress := b != nil && b.opts != nil && b.opts.noCompress
+		if enc, _ := s.peerEncoding.Load().(string); enc != "" && !noCompress && len(data) >= s.threshold && s.compression.allow() {
+			compressed, err := compress(enc, data)
+			if err != nil {
+				return err
+			}
+			if s.compression.record(len(data), len(compressed)) {
+				data = compressed
+				fmt.Fprintf(buf, "%s: %s\r\n", contentEncoding, enc)
+			}
 		}
 	}
 
-	_, err = s.out.Write(data)
+	fmt.Fprintf(buf, "%s: %d\r\n\r\n", contentLength, len(data))
+	buf.Write(data)
+
+	s.outMux.Lock()
+	defer s.outMux.Unlock()
+
+	_, err = s.out.Write(buf.Bytes())
 	return err
 }
 
+func (s *streamTransport) Peer() string { return s.peer }
+
+func (s *streamTransport) CompressionStats() *CompressionStats {
+	if s.threshold <= 0 {
+		return nil
+	}
+	return s.compression.stats()
+}
+
 func (s *streamTransport) Close() error {
 	if s.close != nil {
 		return s.close()
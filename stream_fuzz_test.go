@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.18
+
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func FuzzReadHeader(f *testing.F) {
+	f.Add([]byte("Content-Length:2\r\n\r\n"))
+	f.Add([]byte("Content-Type: application/json-rpc;charset=utf-8\r\nContent-Length:3\r\n\r\n"))
+	f.Add([]byte("User-Agent:go\nContent-Length:3\n\n"))
+	f.Add([]byte("Content-Length:NaN\r\n\r\n"))
+	f.Add([]byte("Content-Length:-1\r\n\r\n"))
+	f.Add([]byte("Content-Type-xx\r\n\r\n"))
+	f.Add([]byte("Content-Length:2\rX:\x00\r\n\r\n"))
+	f.Add([]byte("Accept-Encoding: gzip;q=0, deflate\r\nContent-Encoding: gzip\r\nContent-Length:2\r\n\r\n"))
+	f.Add([]byte("X-Timeout: 100\r\nContent-Length:2\r\n\r\n"))
+	f.Add([]byte("Content-Type: application/json-rpc\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := readHeader(bufio.NewReaderSize(bytes.NewReader(data), maxHeaderLineSize))
+		if err != nil {
+			return
+		}
+		if h.length < 0 {
+			t.Fatalf("readHeader 返回了负数 %d", h.length)
+		}
+		if !bytes.Contains(bytes.ToLower(data), []byte("content-length")) {
+			t.Fatalf("未拒绝缺少 Content-Length 的报头 %q", data)
+		}
+		if bytes.IndexByte(data, 0) >= 0 && bytes.Index(data, []byte("\n\n")) > bytes.IndexByte(data, 0) {
+			t.Fatalf("未拒绝包含 NUL 的报头 %q", data)
+		}
+	})
+}
+
+func FuzzStreamTransport_Read(f *testing.F) {
+	f.Add(true, "Content-Length:17\r\n\r\n{\"jsonrpc\":\"2.0\"}")
+	f.Add(true, "Content-Length:999999999999\r\n\r\n{}")
+	f.Add(true, "Content-Type:application/json\r\n\r\n{\"jsonrpc\":\"2.0\"}")
+	f.Add(true, "Content-Length:2\n\n{}")
+	f.Add(false, `{"jsonrpc":"2.0","id":1,"method":"m","params":[1,2]}`)
+	f.Add(false, `{"jsonrpc":"2.0","id":"1","result":{}}`)
+	f.Add(false, `}`)
+
+	f.Fuzz(func(t *testing.T, header bool, in string) {
+		transport := NewStreamTransport(header, strings.NewReader(in), new(bytes.Buffer), nil)
+		for i := 0; i < 5; i++ { // 同一个流中可能包含多条数据
+			if err := transport.Read(&body{}); err != nil {
+				return
+			}
+		}
+	})
+}
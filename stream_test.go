@@ -7,9 +7,13 @@ package jsonrpc
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"math"
 	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -128,11 +132,71 @@ func TestStreamTransport_Read(t *testing.T) {
 			req:    &body{},
 			err:    true,
 		},
-		{ // 未指定 content-length，无法读取内容
+		{ // 未指定 content-length
 			header: true,
 			in:     "Content-Type:application/json\r\n\r\n{\"jsonrpc\":\"2.0\"}",
+			err:    true,
+		},
+		{ // 仅以 \n 结尾
+			header: true,
+			in:     "Content-Length:17\n\n{\"jsonrpc\":\"2.0\"}",
+			req:    &body{Version: Version},
+		},
+		{ // 单独的 \r
+			header: true,
+			in:     "Content-Length:2\rX-Test:1\r\n\r\n{}",
+			err:    true,
+		},
+		{ // 包含 NUL
+			header: true,
+			in:     "Content-Length:2\r\nX-Test:\x00\r\n\r\n{}",
+			err:    true,
+		},
+		{ // 重复且值不同的 Content-Length
+			header: true,
+			in:     "Content-Length:2\r\nContent-Length:3\r\n\r\n{ }",
+			err:    true,
+		},
+		{ // 重复但值相同的 Content-Length
+			header: true,
+			in:     "Content-Length:2\r\nContent-Length:2\r\n\r\n{}",
+			req:    &body{},
+		},
+		{ // 单行过长
+			header: true,
+			in:     "X-Test:" + strings.Repeat("x", maxHeaderLineSize) + "\r\nContent-Length:2\r\n\r\n{}",
+			err:    true,
+		},
+		{ // 报头总长度过长
+			header: true,
+			in:     strings.Repeat("X-Test:"+strings.Repeat("x", 1000)+"\r\n", maxHeaderSize/1000+1) + "Content-Length:2\r\n\r\n{}",
+			err:    true,
+		},
+		{ // 内容长度小于 Content-Length
+			header: true,
+			in:     "Content-Length:999999999999\r\n\r\n{}",
+			err:    true,
+		},
+		{ // UTF-8 BOM
+			header: true,
+			in:     "Content-Length:20\r\n\r\n\xef\xbb\xbf{\"jsonrpc\":\"2.0\"}",
+			req:    &body{Version: Version},
+		},
+		{ // UTF-16LE
+			header: true,
+			in:     "Content-Length:6\r\n\r\n\xff\xfe{\x00}\x00",
+			err:    true,
+		},
+		{ // charset 带引号
+			header: true,
+			in:     "Content-Type:application/json; charset=\"UTF-8\"\r\nContent-Length:2\r\n\r\n{}",
 			req:    &body{},
 		},
+		{ // charset=utf-16
+			header: true,
+			in:     "Content-Type:application/json;charset=UTF-16\r\nContent-Length:2\r\n\r\n{}",
+			err:    true,
+		},
 	}
 
 	for i, item := range data {
@@ -235,8 +299,9 @@ func TestTCP(t *testing.T) {
 		a.NotNil(srvT)
 		srv = server.NewConn(srvT, nil)
 
+		// 对方先退出时，可能先读取到 io.EOF。
 		err = srv.Serve(srvCtx)
-		a.True(errors.Is(err, context.Canceled))
+		a.True(errors.Is(err, context.Canceled) || errors.Is(err, io.EOF), "%v", err)
 		srvExit <- struct{}{}
 	}).Wait(500 * time.Millisecond) // 等待服务启动完成
 
@@ -251,7 +316,7 @@ func TestTCP(t *testing.T) {
 	clientExit := make(chan struct{}, 1)
 	a.Go(func(a *assert.Assertion) {
 		err := client.Serve(clientCtx)
-		a.True(errors.Is(err, context.Canceled))
+		a.True(errors.Is(err, context.Canceled) || errors.Is(err, io.EOF), "%v", err)
 		clientExit <- struct{}{}
 	}).Wait(500 * time.Millisecond) // 等待服务启动完成
 
@@ -270,3 +335,272 @@ func TestTCP(t *testing.T) {
 	<-srvExit
 	<-clientExit
 }
+
+func TestSocketOptions_apply(t *testing.T) {
+	a := assert.New(t, false)
+
+	var o *SocketOptions
+	c1, c2 := net.Pipe()
+	a.NotError(o.apply(c1))
+
+	// net.Pipe 不支持这些设置，直接忽略。
+	o = &SocketOptions{KeepAlive: time.Second, Nagle: true, ReadBuffer: 1024, WriteBuffer: 1024}
+	a.NotError(o.apply(c1))
+	a.NotError(c1.Close()).NotError(c2.Close())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	tp, err := NewTCPClientTransport(true, l.Addr().String(), time.Second, o)
+	a.NotError(err).NotNil(tp).NotError(tp.Close())
+
+	tp, err = NewTCPClientTransport(true, l.Addr().String(), time.Second, &SocketOptions{KeepAlive: -1})
+	a.NotError(err).NotNil(tp).NotError(tp.Close())
+
+	tp, err = NewTCPClientTransport(true, "127.0.0.1:port", time.Second, nil)
+	a.Error(err).Nil(tp)
+}
+
+func TestSocketOptions_WriteTimeout(t *testing.T) {
+	a := assert.New(t, false)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	// 对方不读取数据，写入操作超时返回。
+	tp, err := NewSocketTransportWithOptions(true, c1, 0, &SocketOptions{WriteTimeout: 100 * time.Millisecond})
+	a.NotError(err).NotNil(tp)
+	err = tp.Write(&body{Version: Version})
+	a.True(errors.Is(err, os.ErrDeadlineExceeded))
+
+	a.NotError(tp.Close())
+}
+
+// 记录 Write 的调用次数
+type countWriter struct {
+	bytes.Buffer
+	count int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.count++
+	return w.Buffer.Write(p)
+}
+
+func TestStreamTransport_Write_single(t *testing.T) {
+	a := assert.New(t, false)
+
+	out := &countWriter{}
+	transport := NewStreamTransport(true, new(bytes.Buffer), out, nil)
+	a.NotError(transport.Write(&body{Version: Version}))
+	a.Equal(out.count, 1).
+		Equal(out.String(), "Content-Type: application/json;charset=utf-8\r\nContent-Length: 17\r\n\r\n{\"jsonrpc\":\"2.0\"}")
+
+	// 复用缓存之后，内容依然正确。
+	out.Reset()
+	a.NotError(transport.Write(&body{Version: Version, Method: "m"})).
+		NotError(transport.Write(&body{Version: Version})).
+		Equal(out.String(), "Content-Type: application/json;charset=utf-8\r\nContent-Length: 30\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"m\"}"+
+			"Content-Type: application/json;charset=utf-8\r\nContent-Length: 17\r\n\r\n{\"jsonrpc\":\"2.0\"}")
+}
+
+func BenchmarkStreamTransport_Write(b *testing.B) {
+	transport := NewStreamTransport(true, new(bytes.Buffer), io.Discard, nil)
+	v := &body{Version: Version, Method: "method", ID: &ID{isNumber: true, number: 1}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := transport.Write(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStreamTransport_Read_pooled(t *testing.T) {
+	a := assert.New(t, false)
+
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	w := NewStreamTransport(true, new(bytes.Buffer), in, nil)
+	r := NewStreamTransport(true, in, out, nil)
+
+	large := json.RawMessage(`"` + strings.Repeat("x", 100*1024) + `"`)
+	small := json.RawMessage(`"s"`)
+	a.NotError(w.Write(&body{Version: Version, Method: "large", Params: &large})).
+		NotError(w.Write(&body{Version: Version, Method: "small", Params: &small}))
+
+	b1 := &body{}
+	a.NotError(r.Read(b1))
+	b2 := &body{}
+	a.NotError(r.Read(b2))
+
+	// 缓存被复用之后，之前读取的内容不受影响。
+	a.Equal(b1.Method, "large").Equal(*b1.Params, large).
+		Equal(b2.Method, "small").Equal(*b2.Params, small)
+
+	// 内容不完整
+	in.WriteString("Content-Length: 100\r\n\r\n{}")
+	a.Equal(r.Read(&body{}), io.ErrUnexpectedEOF)
+}
+
+// 依次返回 chunks 中的内容，空字符串表示读取超时。
+type timeoutReader struct {
+	chunks []string
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	c := r.chunks[0]
+	if c == "" {
+		r.chunks = r.chunks[1:]
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(p, c)
+	if n == len(c) {
+		r.chunks = r.chunks[1:]
+	} else {
+		r.chunks[0] = c[n:]
+	}
+	return n, nil
+}
+
+func TestStreamTransport_Read_resume(t *testing.T) {
+	a := assert.New(t, false)
+
+	r := &timeoutReader{chunks: []string{
+		"Content-Le", "", "ngth: 17\r\nX-Timeout: 1000\r", "", "\n\r\n", "",
+		`{"jsonrpc":`, "", `"2.0"}`,
+		"Content-Length: 17\r\n\r\n", `{"jsonrpc":"2.0"`, "", "}",
+	}}
+	tr := NewStreamTransport(true, r, nil, nil)
+
+	b := &body{}
+	for i := 0; i < 4; i++ {
+		a.ErrorIs(tr.Read(b), os.ErrDeadlineExceeded)
+	}
+	a.NotError(tr.Read(b)).
+		Equal(b.Version, Version).
+		False(b.deadline.IsZero())
+	a.Empty(tr.(*streamTransport).frame.line).Nil(tr.(*streamTransport).frame.body)
+
+	b = &body{}
+	a.ErrorIs(tr.Read(b), os.ErrDeadlineExceeded)
+	a.NotError(tr.Read(b)).Equal(b.Version, Version)
+
+	a.Equal(tr.Read(b), io.EOF)
+
+	// 非超时的错误会丢弃已经读取的内容
+	r = &timeoutReader{chunks: []string{"Content-Length: 10\r\n\r\n{}"}}
+	tr = NewStreamTransport(true, r, nil, nil)
+	a.Equal(tr.Read(&body{}), io.ErrUnexpectedEOF).
+		False(tr.(*streamTransport).frame.headerDone)
+}
+
+func TestReadBuffer(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.True(getReadBuffer(0).Cap() >= readBufferClasses[0]).
+		True(getReadBuffer(5*1024).Cap() >= readBufferClasses[1]).
+		True(getReadBuffer(10*1024*1024).Cap() >= readBufferClasses[2])
+
+	buf := bytes.NewBuffer(make([]byte, 0, 40*1024))
+	buf.WriteString("abc")
+	putReadBuffer(buf)
+	a.Equal(buf.Len(), 0)
+
+	// 过大或是过小的缓存直接丢弃
+	buf = bytes.NewBufferString("abc")
+	putReadBuffer(buf)
+	a.Equal(buf.Len(), 3)
+	buf = bytes.NewBuffer(make([]byte, 3, 1024*1024))
+	putReadBuffer(buf)
+	a.Equal(buf.Len(), 3)
+}
+
+func BenchmarkStreamTransport_Read(b *testing.B) {
+	params := json.RawMessage(`"` + strings.Repeat("x", 64*1024) + `"`)
+	data := new(bytes.Buffer)
+	w := NewStreamTransport(true, new(bytes.Buffer), data, nil)
+	if err := w.Write(&body{Version: Version, Method: "method", Params: &params}); err != nil {
+		b.Fatal(err)
+	}
+	frame := data.Bytes()
+
+	in := new(bytes.Buffer)
+	transport := NewStreamTransport(true, in, io.Discard, nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		in.Write(frame)
+		if err := transport.Read(&body{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStreamTransport_timeout(t *testing.T) {
+	a := assert.New(t, false)
+
+	buf := new(bytes.Buffer)
+	st := NewStreamTransport(true, buf, buf, nil)
+	a.NotError(st.Write(&body{Version: Version, Method: "m", deadline: time.Now().Add(time.Second)}))
+	a.Contains(buf.String(), "X-Timeout: ")
+
+	req := &body{}
+	a.NotError(st.Read(req)).
+		Equal(req.Method, "m").
+		True(time.Until(req.deadline) > 900*time.Millisecond).
+		True(time.Until(req.deadline) <= time.Second)
+
+	// 未指定
+	a.NotError(st.Write(&body{Version: Version, Method: "m"}))
+	a.NotContains(buf.String(), "X-Timeout")
+	req = &body{}
+	a.NotError(st.Read(req)).True(req.deadline.IsZero())
+
+	// 无效的值
+	buf.WriteString("X-Timeout: -1\r\nContent-Length: 2\r\n\r\n{}")
+	a.ErrorIs(st.Read(&body{}), errInvalidHeader)
+}
+
+func TestConn_SendContext_timeout(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.Register("sleep", func(notify bool, in, out *int) error {
+		time.Sleep(time.Duration(*in) * time.Millisecond)
+		return nil
+	}))
+
+	errs := make(chan *Error, 10)
+	srv.ErrHandler(func(err *Error) { errs <- err })
+
+	srvConn, clientConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.NewConn(NewSocketTransport(true, srvConn, 0), nil).Serve(ctx)
+	client := srv.NewConn(NewSocketTransport(true, clientConn, 0), nil)
+	go client.Serve(ctx)
+
+	done := make(chan struct{}, 1)
+	callCtx, callCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer callCancel()
+	a.NotError(client.SendContext(callCtx, "sleep", 200, func(*int) error {
+		done <- struct{}{}
+		return nil
+	}))
+	a.Equal((<-errs).Code, CodeTimeout)
+
+	a.NotError(client.SendContext(context.Background(), "sleep", 10, func(*int) error {
+		done <- struct{}{}
+		return nil
+	}))
+	<-done
+}
@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Violation 对方返回的不符合规范的数据
+type Violation struct {
+	// 返回数据中的 ID，可能为空。
+	ID *ID
+
+	// 违反规范的原因
+	Reason string
+
+	// 原始的 JSON 内容
+	//
+	// 该值仅在回调函数中有效，如果需要保存，请自行复制。
+	Data []byte
+}
+
+// 严格模式下对返回数据进行验证的 Transport
+type strictTransport struct {
+	Transport
+	conn      *Conn
+	violation func(*Violation)
+}
+
+// 在解码之前对数据进行检测
+//
+// 通过检测的数据直接解码至 v，底层的传输层依然可以通过 bodyOf 获取 *body。
+type strictBody struct {
+	v         interface{}
+	t         *strictTransport
+	violation *Violation
+}
+
+func (b *strictBody) UnmarshalJSON(data []byte) error {
+	// data 可能来自于传输层的缓存池，检测时使用其副本。
+	if b.violation = b.t.check(append([]byte(nil), data...)); b.violation != nil {
+		return nil
+	}
+	return json.Unmarshal(data, b.v)
+}
+
+func (v *Violation) Error() string {
+	if v.ID == nil {
+		return v.Reason
+	}
+	return fmt.Sprintf("%s: %s", v.ID, v.Reason)
+}
+
+// Strict 以严格模式验证对方返回的数据
+//
+// 严格模式下会对返回的数据作以下检测：
+//   - jsonrpc 字段必须为 [Version]；
+//   - result 和 error 必须有且只有一个；
+//   - id 必须是由当前连接发出且还未收到返回的请求 ID，
+//     仅在 error 不为空时，id 才可以为 null；
+//
+// 不符合要求的数据会被丢弃，并通过 violation 通知用户。
+// 适用于对接一些不完全遵守规范的第三方服务，默认不作检测。
+// 检测需要额外解析数据，会有一定的性能损耗。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用，且只能调用一次。
+func (conn *Conn) Strict(violation func(*Violation)) {
+	if conn.strict {
+		panic("已经启用了严格模式")
+	}
+	if violation == nil {
+		panic("参数 violation 不能为空")
+	}
+
+	conn.strict = true
+	conn.transport = &strictTransport{Transport: conn.transport, conn: conn, violation: violation}
+}
+
+func (t *strictTransport) Read(v interface{}) error {
+	for {
+		b := &strictBody{v: v, t: t}
+		if err := t.Transport.Read(b); err != nil {
+			return err
+		}
+		if b.violation == nil {
+			return nil
+		}
+
+		t.violation(b.violation)
+		if body := bodyOf(v); body != nil { // 丢弃的数据可能已经设置了截止时间
+			body.deadline = time.Time{}
+		}
+	}
+}
+
+func (t *strictTransport) Peer() string { return peerOf(t.Transport) }
+
+func (t *strictTransport) setClock(c Clock) {
+	if s, ok := t.Transport.(clockSetter); ok {
+		s.setClock(c)
+	}
+}
+
+func (t *strictTransport) limitSize(size int64) {
+	if l, ok := t.Transport.(sizeLimiter); ok {
+		l.limitSize(size)
+	}
+}
+
+func (t *strictTransport) CompressionStats() *CompressionStats {
+	if c, ok := t.Transport.(compressionStater); ok {
+		return c.CompressionStats()
+	}
+	return nil
+}
+
+// 检测 data 是否为符合规范的返回数据
+//
+// 请求数据或是无法解析的数据不作处理，由后续的流程决定如何处理。
+func (t *strictTransport) check(data []byte) *Violation {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	if _, found := fields["method"]; found {
+		return nil
+	}
+	if _, found := fields["params"]; found {
+		return nil
+	}
+
+	v := &Violation{Data: data}
+	if rawID, found := fields["id"]; found && string(rawID) != "null" {
+		v.ID = &ID{}
+		if err := v.ID.UnmarshalJSON(rawID); err != nil {
+			v.ID = nil
+			v.Reason = fmt.Sprintf("无效的 id %s", rawID)
+			return v
+		}
+	}
+
+	var version string
+	if err := json.Unmarshal(fields["jsonrpc"], &version); err != nil || version != Version {
+		v.Reason = fmt.Sprintf("无效的 jsonrpc 字段 %s", fields["jsonrpc"])
+		return v
+	}
+
+	_, hasResult := fields["result"]
+	rawErr, hasError := fields["error"]
+	hasError = hasError && string(rawErr) != "null"
+	switch {
+	case hasResult && hasError:
+		v.Reason = "同时包含 result 和 error"
+		return v
+	case !hasResult && !hasError:
+		v.Reason = "缺少 result 或 error"
+		return v
+	}
+
+	if v.ID == nil {
+		if hasError {
+			return nil
+		}
+		v.Reason = "缺少 id"
+		return v
+	}
+
+	if _, found := t.conn.callbacks.Load(v.ID); !found {
+		v.Reason = "未知的 id"
+		return v
+	}
+
+	return nil
+}
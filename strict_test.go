@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ error = &Violation{}
+
+func TestConn_Strict(t *testing.T) {
+	a := assert.New(t, false)
+	srv := NewServer(func() string { return "1" })
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+
+	violations := make([]*Violation, 0, 10)
+	conn.Strict(func(v *Violation) { violations = append(violations, v) })
+	a.Panic(func() { conn.Strict(func(*Violation) {}) })
+	a.NotError(conn.Send("f1", nil, func(*int) error { return nil }))
+
+	in.WriteString(`{"jsonrpc":"1.0","id":"1","result":1}`)
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","result":1,"error":{"code":1,"message":"m"}}`)
+	in.WriteString(`{"jsonrpc":"2.0","id":"1"}`)
+	in.WriteString(`{"jsonrpc":"2.0","id":"2","result":1}`)
+	in.WriteString(`{"jsonrpc":"2.0","result":1}`)
+	in.WriteString(`{"jsonrpc":"2.0","id":{},"result":1}`)
+	in.WriteString(`{"jsonrpc":"2.0","error":{"code":1,"message":"m"}}`) // 合法
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","result":null}`)           // 合法
+	in.WriteString(`{"jsonrpc":"2.0","method":"f1"}`)                    // 请求不检测
+
+	resp := &body{}
+	a.NotError(conn.transport.Read(resp)).
+		NotNil(resp.Error).
+		Length(violations, 6).
+		Equal(violations[0].ID.String(), "1").
+		Contains(violations[0].Reason, "jsonrpc").
+		Equal(violations[1].Reason, "同时包含 result 和 error").
+		Equal(violations[2].Reason, "缺少 result 或 error").
+		Equal(violations[3].Reason, "未知的 id").
+		Equal(violations[3].Error(), "2: 未知的 id").
+		Nil(violations[4].ID).
+		Equal(violations[4].Error(), "缺少 id").
+		Nil(violations[5].ID).
+		Equal(string(violations[5].Data), `{"jsonrpc":"2.0","id":{},"result":1}`)
+
+	resp = &body{}
+	a.NotError(conn.transport.Read(resp)).Equal(resp.ID.String(), "1")
+
+	resp = &body{}
+	a.NotError(conn.transport.Read(resp)).Equal(resp.Method, "f1").Length(violations, 6)
+}
+
+func TestConn_Strict_transport(t *testing.T) {
+	a := assert.New(t, false)
+	srv := NewServer(func() string { return "1" })
+
+	frame := func(header, content string) string {
+		return header + "Content-Length:" + strconv.Itoa(len(content)) + "\r\n\r\n" + content
+	}
+	req := `{"jsonrpc":"2.0","method":"f1"}`
+	in := bytes.NewBufferString(frame("X-Timeout:1000\r\n", `{"jsonrpc":"1.0","id":"1","result":1}`) +
+		frame("", req) + frame("X-Timeout:1000\r\n", req))
+	conn := srv.NewConn(NewStreamTransport(true, in, new(bytes.Buffer), nil), nil)
+	violations := make([]*Violation, 0, 10)
+	conn.Strict(func(v *Violation) { violations = append(violations, v) })
+	conn.CollectStats(false) // 被其它传输层包装之后依然不能重复调用
+	a.Panic(func() { conn.Strict(func(*Violation) {}) })
+
+	// 被丢弃数据的截止时间不会保留
+	resp := &body{}
+	a.NotError(conn.transport.Read(resp)).
+		Length(violations, 1).
+		Equal(resp.Method, "f1").
+		True(resp.deadline.IsZero())
+
+	resp = &body{}
+	a.NotError(conn.transport.Read(resp)).
+		Equal(resp.Method, "f1").
+		False(resp.deadline.IsZero())
+
+	// Peer
+	srvConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	conn = srv.NewConn(NewSocketTransport(true, srvConn, 0), nil)
+	conn.Strict(func(*Violation) {})
+	a.Equal(peerOf(conn.transport), srvConn.RemoteAddr().String())
+}
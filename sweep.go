@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrExpired 等待返回数据的请求已经过期
+//
+// 由 [Conn.Sweep] 清理的请求，会以此错误通过 [EventExpired] 事件通知，
+// 正在等待的 [Conn.Call] 则返回带有此错误的 *[Error]。
+var ErrExpired = errors.New("等待返回数据的请求已经过期")
+
+type sweeper struct {
+	interval time.Duration
+	ttl      time.Duration
+}
+
+// Sweep 定时清理过期的等待返回数据的请求
+//
+// 在 [Conn.Serve] 运行期间，每隔 interval 检查一次所有等待返回数据的请求，
+// 将超过截止时间的请求一次性删除，并通过 [Conn.Events] 发送 [EventExpired] 事件，
+// 以免对方一直不返回数据时，等待中的请求无限增长。
+//
+// 请求的截止时间为发送请求时 ctx 的截止时间，如果 ctx 未指定截止时间，
+// 则为发送时间加上 ttl，ttl 小于等于 0 表示不为这些请求设置截止时间。
+// interval 小于等于 0 表示不清理。
+//
+// NOTE: 需要在 [Conn.Send] 和 [Conn.Serve] 之前调用。
+func (conn *Conn) Sweep(interval, ttl time.Duration) {
+	if interval > 0 {
+		conn.sweeper = &sweeper{interval: interval, ttl: ttl}
+	} else {
+		conn.sweeper = nil
+	}
+}
+
+// 根据 ctx 和 [Conn.Sweep] 的设置计算请求的截止时间
+func (conn *Conn) expireAt(ctx context.Context) time.Time {
+	if conn.sweeper == nil {
+		return time.Time{}
+	}
+	if deadline, ok := ctxDeadline(ctx, conn.server.clock); ok {
+		return deadline
+	}
+	if conn.sweeper.ttl > 0 {
+		return conn.server.clock.Now().Add(conn.sweeper.ttl)
+	}
+	return time.Time{}
+}
+
+// 按 [Conn.Sweep] 指定的间隔清理过期的请求，直到 ctx 被取消。
+func (conn *Conn) runSweeper(ctx context.Context) {
+	for {
+		c, stop := conn.server.clock.NewTimer(conn.sweeper.interval)
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case now := <-c:
+			conn.sweep(now)
+		}
+	}
+}
+
+// 删除截止时间早于 now 的请求，返回删除的数量。
+func (conn *Conn) sweep(now time.Time) int {
+	ps := make([]*pending, 0, 10)
+	conn.callbacks.Range(func(v interface{}) bool {
+		if p, ok := v.(*pending); ok && !p.expire.IsZero() && now.After(p.expire) {
+			ps = append(ps, p)
+		}
+		return true
+	})
+
+	for _, p := range ps {
+		conn.deletePending(p.id)
+		conn.emit(EventExpired, ErrExpired, p.id)
+		if p.result != nil {
+			p.finish(&body{Version: Version, ID: p.id, Error: NewErrorWithError(CodeTimeout, ErrExpired)})
+		}
+	}
+	return len(ps)
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_Sweep(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	clock := NewManualClock(time.Now())
+	srv.Clock(clock)
+	now := clock.Now()
+
+	conn := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), new(bytes.Buffer), nil), nil)
+	conn.Sweep(0, time.Minute)
+	a.Nil(conn.sweeper)
+	conn.Sweep(time.Second, time.Minute)
+	events := conn.Events()
+
+	cb := func(*outType) error { return nil }
+	a.NotError(conn.Send("f1", &inType{Age: 1}, cb))
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(10*time.Second))
+	defer cancel()
+	a.NotError(conn.SendContext(ctx, "f1", &inType{Age: 2}, cb))
+
+	a.Equal(conn.sweep(now), 0)
+	a.Equal(conn.sweep(now.Add(30*time.Second)), 1)
+	a.Equal(conn.sweep(now.Add(2*time.Minute)), 1)
+	a.Equal(conn.sweep(now.Add(time.Hour)), 0)
+	for i := 0; i < 2; i++ {
+		e := <-events
+		a.Equal(e.Type, EventExpired).Equal(e.Err, ErrExpired).NotNil(e.ID)
+	}
+
+	// 未指定 ttl 且 ctx 没有截止时间的请求不会过期
+	conn.Sweep(time.Second, 0)
+	a.NotError(conn.Send("f1", &inType{Age: 3}, cb))
+	a.Equal(conn.sweep(now.Add(time.Hour)), 0)
+
+	// 定时清理，并通知正在等待的 Call。
+	conn.Sweep(time.Second, time.Minute)
+	p := &pending{result: make(chan *body, 1)}
+	_, err := conn.send(context.Background(), "f1", &inType{Age: 4}, p, nil)
+	a.NotError(err)
+
+	sctx, scancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		conn.runSweeper(sctx)
+		close(done)
+	}()
+	for clock.Timers() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(2 * time.Minute)
+	resp := <-p.result
+	a.NotNil(resp.Error).Equal(resp.Error.Code, CodeTimeout)
+
+	scancel()
+	<-done
+}
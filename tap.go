@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Direction 数据帧的传输方向
+type Direction int8
+
+// 数据帧的传输方向
+const (
+	DirectionIn  Direction = iota // 从传输层读取的数据
+	DirectionOut                  // 写入传输层的数据
+)
+
+// Frame 传输层上的原始数据帧
+type Frame struct {
+	Direction Direction
+
+	// 完成读取或是开始写入的时间
+	Time time.Time
+
+	// 帧的原始 JSON 内容，不包含报头等传输层自身的数据。
+	//
+	// 字节数即为 len(Data)。
+	// 该值仅在回调函数中有效，如果需要保存，请自行复制。
+	Data []byte
+}
+
+type tapTransport struct {
+	Transport
+	tap   func(*Frame)
+	clock Clock
+}
+
+// 在编解码时获取原始数据
+//
+// 传递给底层传输层的依然是调用方的对象（可通过 bodyOf 获取），
+// 截止时间、压缩以及优先级等依赖于 *body 的功能不受影响。
+type tapBody struct {
+	v    interface{}
+	data []byte
+}
+
+func (b *tapBody) UnmarshalJSON(data []byte) error {
+	// data 可能来自于传输层的缓存池，需要复制。
+	b.data = append(b.data[:0], data...)
+	return json.Unmarshal(data, b.v)
+}
+
+// 写入时的内容已经由 [tapTransport.Write] 编码
+func (b *tapBody) MarshalJSON() ([]byte, error) { return b.data, nil }
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionIn:
+		return "in"
+	case DirectionOut:
+		return "out"
+	default:
+		return "<unknown>"
+	}
+}
+
+// NewTapTransport 为 t 添加数据帧的监听功能
+//
+// 所有经由 t 读写的原始数据帧都会通过 tap 传递给用户，
+// 可用于调试或是记录传输层上的数据，tap 不应该修改 [Frame] 的内容。
+//
+// NOTE: tap 可能会被多个 goroutine 同时调用。
+func NewTapTransport(t Transport, tap func(*Frame)) Transport {
+	return &tapTransport{Transport: t, tap: tap, clock: systemClock{}}
+}
+
+func (t *tapTransport) Read(v interface{}) error {
+	b := &tapBody{v: v}
+	if err := t.Transport.Read(b); err != nil {
+		return err
+	}
+	t.tap(&Frame{Direction: DirectionIn, Time: t.clock.Now(), Data: b.data})
+	return nil
+}
+
+func (t *tapTransport) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.tap(&Frame{Direction: DirectionOut, Time: t.clock.Now(), Data: data})
+
+	return t.Transport.Write(&tapBody{v: v, data: data})
+}
+
+func (t *tapTransport) Peer() string { return peerOf(t.Transport) }
+
+func (t *tapTransport) setClock(c Clock) {
+	t.clock = c
+	if s, ok := t.Transport.(clockSetter); ok {
+		s.setClock(c)
+	}
+}
+
+func (t *tapTransport) limitSize(size int64) {
+	if l, ok := t.Transport.(sizeLimiter); ok {
+		l.limitSize(size)
+	}
+}
+
+func (t *tapTransport) CompressionStats() *CompressionStats {
+	if c, ok := t.Transport.(compressionStater); ok {
+		return c.CompressionStats()
+	}
+	return nil
+}
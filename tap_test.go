@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ Transport = &tapTransport{}
+
+func TestNewTapTransport(t *testing.T) {
+	a := assert.New(t, false)
+
+	frames := make([]*Frame, 0, 10)
+	mux := sync.Mutex{}
+	tap := func(f *Frame) {
+		mux.Lock()
+		defer mux.Unlock()
+		frames = append(frames, f)
+	}
+
+	in := bytes.NewBufferString("Content-Length:17\r\n\r\n{\"jsonrpc\":\"2.0\"}")
+	out := new(bytes.Buffer)
+	transport := NewTapTransport(NewStreamTransport(true, in, out, nil), tap)
+
+	req := &body{}
+	a.NotError(transport.Read(req)).
+		Equal(req, &body{Version: Version}).
+		Length(frames, 1).
+		Equal(frames[0].Direction, DirectionIn).
+		Equal(string(frames[0].Data), `{"jsonrpc":"2.0"}`).
+		False(frames[0].Time.IsZero())
+
+	a.NotError(transport.Write(&body{Version: Version, ID: &ID{isNumber: true, number: 1}})).
+		Length(frames, 2).
+		Equal(frames[1].Direction, DirectionOut).
+		Equal(string(frames[1].Data), `{"jsonrpc":"2.0","id":1}`).
+		Equal(out.String(), "Content-Type: application/json;charset=utf-8\r\nContent-Length: 24\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1}")
+
+	// 读取错误不触发 tap
+	a.Error(transport.Read(req)).Length(frames, 2)
+
+	// 无效的内容
+	in.WriteString("Content-Length:1\r\n\r\n}")
+	a.Error(transport.Read(req)).Length(frames, 2)
+
+	a.Equal(DirectionIn.String(), "in").
+		Equal(DirectionOut.String(), "out").
+		Equal(Direction(5).String(), "<unknown>")
+}
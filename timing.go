@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import "time"
+
+// FrameTiming 连接上每一帧数据在各个阶段的时间
+//
+// 可用于 APM 等统计请求的排队时间和处理时间。
+type FrameTiming struct {
+	// 服务名，返回数据为空。
+	Method string
+
+	// 数据的 ID，通知类型的请求为 nil。
+	ID *ID
+
+	// 从传输层读取完成的时间
+	Read time.Time
+
+	// 交由服务函数或是回调函数处理的时间，[Conn.OnReadFrame] 中为零值。
+	Dispatch time.Time
+
+	// 写入返回数据的时间，仅 [Conn.OnWriteFrame] 中有值。
+	//
+	// 如果调用了 [Conn.Ordered]，为返回数据生成的时间，而不是真正写入传输层的时间。
+	Write time.Time
+}
+
+type frameHooks struct {
+	read     func(*FrameTiming)
+	dispatch func(*FrameTiming)
+	write    func(*FrameTiming)
+}
+
+// 在写入返回数据时调用 [Conn.OnWriteFrame] 指定的函数
+type timingTransport struct {
+	Transport
+	timing *FrameTiming
+	hook   func(*FrameTiming)
+	clock  Clock
+}
+
+// Queue 从读取到开始处理之间的排队时间
+func (t *FrameTiming) Queue() time.Duration {
+	if t.Dispatch.IsZero() {
+		return 0
+	}
+	return t.Dispatch.Sub(t.Read)
+}
+
+// Handle 从开始处理到写入返回数据之间的处理时间
+func (t *FrameTiming) Handle() time.Duration {
+	if t.Write.IsZero() || t.Dispatch.IsZero() {
+		return 0
+	}
+	return t.Write.Sub(t.Dispatch)
+}
+
+// OnReadFrame 指定从传输层读取到一帧数据之后调用的函数
+//
+// 包括请求和返回数据，无法解析的数据不会触发。
+// f 在读取数据的 goroutine 中调用，会阻塞之后数据的读取，不应该执行耗时操作。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用，多次调用会相互覆盖。
+func (conn *Conn) OnReadFrame(f func(*FrameTiming)) { conn.hooks().read = f }
+
+// OnDispatch 指定一帧数据开始交由服务函数或是回调函数处理时调用的函数
+//
+// 与读取之间的时间差即为排队时间，包含了 [Conn.MemoryLimit] 等造成的等待。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用，多次调用会相互覆盖。
+func (conn *Conn) OnDispatch(f func(*FrameTiming)) { conn.hooks().dispatch = f }
+
+// OnWriteFrame 指定写入请求的返回数据之后调用的函数
+//
+// 写入失败时也会调用，通知类型的请求不会触发。
+//
+// NOTE: 需要在 [Conn.Serve] 之前调用，多次调用会相互覆盖。
+func (conn *Conn) OnWriteFrame(f func(*FrameTiming)) { conn.hooks().write = f }
+
+func (conn *Conn) hooks() *frameHooks {
+	if conn.frameHooks == nil {
+		conn.frameHooks = &frameHooks{}
+	}
+	return conn.frameHooks
+}
+
+func newFrameTiming(req *body) *FrameTiming {
+	return &FrameTiming{
+		Method: req.Method,
+		ID:     req.ID,
+		Read:   req.received,
+	}
+}
+
+// 如果指定了 [Conn.OnWriteFrame]，将 t 包装为 timingTransport。
+func (conn *Conn) withTiming(t Transport, timing *FrameTiming) Transport {
+	if timing == nil || conn.frameHooks.write == nil || timing.ID == nil {
+		return t
+	}
+	return &timingTransport{Transport: t, timing: timing, hook: conn.frameHooks.write, clock: conn.server.clock}
+}
+
+func (t *timingTransport) Write(v interface{}) error {
+	err := t.Transport.Write(v)
+	t.timing.Write = t.clock.Now()
+	t.hook(t.timing)
+	return err
+}
+
+func (t *timingTransport) Peer() string { return peerOf(t.Transport) }
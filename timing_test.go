@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_frameHooks(t *testing.T) {
+	a := assert.New(t, false)
+
+	srv := NewServer(func() string { return <-uniqueID })
+	a.True(srv.Register("sleep", func(notify bool, in *int, out *int) error {
+		time.Sleep(time.Duration(*in) * time.Millisecond)
+		*out = *in
+		return nil
+	}))
+
+	c1, c2 := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	client := srv.NewConn(NewSocketTransport(false, c2, 0), nil)
+
+	var mux sync.Mutex
+	var reads, dispatches, writes []*FrameTiming
+	conn.OnReadFrame(func(t *FrameTiming) {
+		mux.Lock()
+		reads = append(reads, t)
+		mux.Unlock()
+	})
+	conn.OnDispatch(func(t *FrameTiming) {
+		mux.Lock()
+		dispatches = append(dispatches, t)
+		mux.Unlock()
+	})
+	done := make(chan struct{}, 1)
+	conn.OnWriteFrame(func(t *FrameTiming) {
+		mux.Lock()
+		writes = append(writes, t)
+		mux.Unlock()
+		done <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	a.NotError(client.Notify("sleep", 1))
+	a.NotError(client.Send("sleep", 50, func(out *int) error { return nil }))
+	<-done
+
+	mux.Lock()
+	a.Length(reads, 2).Length(dispatches, 2).Length(writes, 1)
+	for _, r := range reads {
+		a.Equal(r.Method, "sleep").
+			False(r.Read.IsZero()).
+			True(r.Dispatch.IsZero()).
+			Equal(r.Queue(), 0).
+			Equal(r.Handle(), 0)
+	}
+	w := writes[0]
+	a.Equal(w.Method, "sleep").
+		NotNil(w.ID).
+		False(w.Dispatch.Before(w.Read)).
+		True(w.Handle() >= 50*time.Millisecond).
+		True(w.Queue() >= 0)
+	mux.Unlock()
+
+	cancel()
+	c1.Close()
+	c2.Close()
+	<-exit
+	<-exit
+}
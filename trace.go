@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import "context"
+
+type traceParentKey struct{}
+
+// 为返回数据附加 traceparent 的传输层
+type traceTransport struct {
+	Transport
+	traceparent string
+}
+
+// WithTraceParent 为 ctx 附加 W3C Trace Context 中的 traceparent 值
+//
+// 通过 [Conn.SendContext] 或 [HTTPConn.SendContext] 发送请求时，
+// ctx 中的 traceparent 会以顶层字段 traceparent 的形式发送给对方，
+// 对方会将其原样附加在返回数据中；对方返回的 traceparent 也可以在回调函数的 ctx 中获取。
+// 不符合 https://www.w3.org/TR/trace-context/#traceparent-header 格式的值会被对方忽略。
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceparent)
+}
+
+// TraceParent 返回 ctx 中的 traceparent 值
+//
+// 在回调函数中，如果发送请求时未指定，则为对方返回的值。
+func TraceParent(ctx context.Context) string {
+	if v, ok := ctx.Value(traceParentKey{}).(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (t *traceTransport) Peer() string { return peerOf(t.Transport) }
+
+func (t *traceTransport) Write(v interface{}) error {
+	if b := bodyOf(v); b != nil && b.TraceParent == "" {
+		b.TraceParent = t.traceparent
+	}
+	return t.Transport.Write(v)
+}
+
+// 验证 traceparent 的格式
+//
+// 格式为 version-traceid-parentid-flags，各部分均为小写的十六进制，
+// 长度分别为 2、32、16 和 2，且 traceid 和 parentid 不能全为 0，version 不能为 ff。
+func validTraceParent(v string) bool {
+	if len(v) != 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return false
+	}
+
+	for i, c := range v {
+		if i == 2 || i == 35 || i == 52 {
+			continue
+		}
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return v[:2] != "ff" &&
+		v[3:35] != "00000000000000000000000000000000" &&
+		v[36:52] != "0000000000000000"
+}
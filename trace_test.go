@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestValidTraceParent(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.True(validTraceParent(testTraceParent)).
+		False(validTraceParent("")).
+		False(validTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7")).
+		False(validTraceParent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")).
+		False(validTraceParent("00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")).
+		False(validTraceParent("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")).
+		False(validTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01")).
+		False(validTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"))
+}
+
+func TestTraceParent(t *testing.T) {
+	a := assert.New(t, false)
+
+	a.Empty(TraceParent(context.Background()))
+	ctx := WithTraceParent(context.Background(), testTraceParent)
+	a.Equal(TraceParent(ctx), testTraceParent)
+}
+
+func TestServer_traceParent(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	transport := NewStreamTransport(false, in, out, nil)
+
+	// 原样返回
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{},"traceparent":"` + testTraceParent + `"}`)
+	req, err := srv.read(transport)
+	a.NotError(err).NotNil(req).Equal(req.TraceParent, testTraceParent)
+	a.NotError(srv.response(transport, req))
+	resp := &body{}
+	a.NotError(json.Unmarshal(out.Bytes(), resp)).Equal(resp.TraceParent, testTraceParent)
+
+	// 无效的值被忽略
+	out.Reset()
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{},"traceparent":"invalid"}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req).Empty(req.TraceParent)
+	a.NotError(srv.response(transport, req)).NotContains(out.String(), "traceparent")
+
+	// 同时保留扩展字段，traceparent 不作为扩展字段。
+	srv.KeepExtensions(true)
+	out.Reset()
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{},"x":1,"traceparent":"` + testTraceParent + `"}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req).
+		Equal(req.TraceParent, testTraceParent).
+		Length(req.extensions, 1)
+	a.NotError(srv.response(transport, req))
+	a.Equal(out.String(), `{"jsonrpc":"2.0","id":"1","result":{"name":"","age":0},"traceparent":"`+testTraceParent+`","x":1}`)
+
+	// Incident
+	a.True(srv.Register("panic", func(notify bool, in, out *int) error {
+		panic("panic")
+	}))
+	var incident *Incident
+	srv.IncidentHandler(func(i *Incident) { incident = i })
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"panic","params":1,"traceparent":"` + testTraceParent + `"}`)
+	req, err = srv.read(transport)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(transport, req))
+	a.NotNil(incident).Equal(incident.TraceParent, testTraceParent)
+}
+
+func TestHTTPConn_traceParent(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+
+	conn := s.NewHTTPConn("", nil)
+	srv := httptest.NewServer(conn)
+	defer srv.Close()
+	conn.url = srv.URL
+
+	ctx := WithTraceParent(context.Background(), testTraceParent)
+	a.NotError(conn.SendContext(ctx, "f1", &inType{Age: 1}, func(ctx context.Context, out *outType) error {
+		a.Equal(TraceParent(ctx), testTraceParent)
+		return nil
+	}))
+
+	// 由返回数据附加
+	called := false
+	err := s.callback(&pending{ctx: context.Background(), cb: newCallback(func(ctx context.Context, out *outType) error {
+		called = true
+		a.Equal(TraceParent(ctx), testTraceParent)
+		return nil
+	})}, &body{Version: Version, ID: NewStringID("1"), TraceParent: testTraceParent})
+	a.NotError(err).True(called)
+}
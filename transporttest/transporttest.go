@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+// Package transporttest 传输层的一致性测试
+//
+// 用户自定义的 [jsonrpc.Transport] 可以通过 [Run] 验证其是否满足 [jsonrpc.Server]
+// 和 [jsonrpc.Conn] 对传输层的要求：
+//
+//	func TestTransport(t *testing.T) {
+//	    transporttest.Run(t, func() (jsonrpc.Transport, jsonrpc.Transport) {
+//	        c1, c2 := net.Pipe()
+//	        return NewMyTransport(c1), NewMyTransport(c2)
+//	    })
+//	}
+package transporttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/issue9/jsonrpc"
+)
+
+// 等待单个操作完成的最长时间
+const timeout = 5 * time.Second
+
+// 大消息的参数长度
+const largeSize = 1 << 20
+
+type message struct {
+	Version string          `json:"jsonrpc"`
+	ID      int             `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Run 对 newPair 返回的传输层进行一致性测试
+//
+// newPair 返回一对相互连接的传输层，写入其中一个的内容可以从另一个中读取，
+// 每个子测试都会调用 newPair 创建新的传输层，并在结束时关闭。
+//
+// 测试内容包括：
+//   - 消息的边界，包括含有换行和报头等特殊内容的消息；
+//   - 双向通讯；
+//   - 并发写入时消息的完整性；
+//   - 大消息；
+//   - 读取时的超时，返回 os.ErrDeadlineExceeded 之后可以继续读取；
+//   - 关闭之后对方的读取操作返回 io.EOF 等表示连接已经断开的错误；
+//   - 通过 [jsonrpc.Conn] 完成请求和返回。
+func Run(t *testing.T, newPair func() (jsonrpc.Transport, jsonrpc.Transport)) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		f    func(*testing.T, jsonrpc.Transport, jsonrpc.Transport)
+	}{
+		{name: "Framing", f: testFraming},
+		{name: "Bidirectional", f: testBidirectional},
+		{name: "Concurrency", f: testConcurrency},
+		{name: "LargeMessage", f: testLargeMessage},
+		{name: "Timeout", f: testTimeout},
+		{name: "Close", f: testClose},
+		{name: "Conn", f: testConn},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t1, t2 := newPair()
+			defer func() {
+				t1.Close()
+				t2.Close()
+			}()
+			test.f(t, t1, t2)
+		})
+	}
+}
+
+func testFraming(t *testing.T, t1, t2 jsonrpc.Transport) {
+	msgs := []*message{
+		{Version: jsonrpc.Version, ID: 1, Method: "m1"},
+		{Version: jsonrpc.Version, ID: 2, Method: "m2", Params: json.RawMessage(`"line1\nline2\r\n\r\n"`)},
+		{Version: jsonrpc.Version, ID: 3, Method: "m3", Params: json.RawMessage(`"Content-Length: 5\r\n\r\n{}"`)},
+		{Version: jsonrpc.Version, Method: "中文", Params: json.RawMessage(`{"a":[1,{"b":"}]"}],"c":null}`)},
+		{Version: jsonrpc.Version, ID: 5, Method: "m5", Params: json.RawMessage(`[]`)},
+	}
+	send(t, t1, msgs...)
+	for _, want := range msgs {
+		equal(t, receive(t, t2), want)
+	}
+}
+
+func testBidirectional(t *testing.T, t1, t2 jsonrpc.Transport) {
+	m1 := &message{Version: jsonrpc.Version, ID: 1, Method: "ping"}
+	m2 := &message{Version: jsonrpc.Version, ID: 2, Method: "pong"}
+
+	send(t, t1, m1)
+	equal(t, receive(t, t2), m1)
+	send(t, t2, m2)
+	equal(t, receive(t, t1), m2)
+}
+
+func testConcurrency(t *testing.T, t1, t2 jsonrpc.Transport) {
+	const writers, count = 8, 20
+
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			for j := 0; j < count; j++ {
+				id := i*count + j + 1
+				params := json.RawMessage(strconv.Quote(strings.Repeat(strconv.Itoa(id), 100)))
+				if err := t1.Write(&message{Version: jsonrpc.Version, ID: id, Method: "m", Params: params}); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(i)
+	}
+
+	ids := make(map[int]bool, writers*count)
+	for i := 0; i < writers*count; i++ {
+		m := receive(t, t2)
+		if want := strconv.Quote(strings.Repeat(strconv.Itoa(m.ID), 100)); string(m.Params) != want {
+			t.Fatalf("消息 %d 的内容不完整：%s", m.ID, m.Params)
+		}
+		if ids[m.ID] {
+			t.Fatalf("重复的消息 %d", m.ID)
+		}
+		ids[m.ID] = true
+	}
+
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("并发写入出错：%v", err)
+		}
+	}
+}
+
+func testLargeMessage(t *testing.T, t1, t2 jsonrpc.Transport) {
+	m := &message{
+		Version: jsonrpc.Version,
+		ID:      1,
+		Method:  "large",
+		Params:  json.RawMessage(strconv.Quote(strings.Repeat("x", largeSize))),
+	}
+	send(t, t1, m)
+	equal(t, receive(t, t2), m)
+}
+
+// 读取操作在没有数据时应该阻塞，或是返回 os.ErrDeadlineExceeded 之后可以继续读取。
+func testTimeout(t *testing.T, t1, t2 jsonrpc.Transport) {
+	m := &message{Version: jsonrpc.Version, ID: 1, Method: "late"}
+	time.AfterFunc(100*time.Millisecond, func() { send(t, t1, m) })
+	equal(t, receive(t, t2), m)
+}
+
+func testClose(t *testing.T, t1, t2 jsonrpc.Transport) {
+	m := &message{Version: jsonrpc.Version, ID: 1, Method: "last"}
+	send(t, t1, m)
+	equal(t, receive(t, t2), m)
+
+	if err := t1.Close(); err != nil {
+		t.Fatalf("关闭时出错：%v", err)
+	}
+	if err := t1.Write(m); err == nil {
+		t.Fatal("关闭之后依然可以写入")
+	}
+
+	err := do(t, "关闭之后读取", func() error {
+		for {
+			err := t2.Read(&message{})
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				return err
+			}
+		}
+	})
+	if !isClosed(err) {
+		t.Fatalf("对方关闭之后，读取操作应该返回表示连接断开的错误，实际返回 %v", err)
+	}
+}
+
+// 与 [jsonrpc.Conn] 判断连接是否断开的方法相同
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+func testConn(t *testing.T, t1, t2 jsonrpc.Transport) {
+	var id int64
+	srv := jsonrpc.NewServer(func() string { return strconv.FormatInt(atomic.AddInt64(&id, 1), 10) })
+	srv.Register("echo", func(notify bool, in, out *json.RawMessage) error {
+		*out = *in
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wg := &sync.WaitGroup{}
+	serve := func(conn *jsonrpc.Conn) *jsonrpc.Conn {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Serve(ctx)
+		}()
+		return conn
+	}
+	serve(srv.NewConn(t1, nil))
+	client := serve(srv.NewConn(t2, nil))
+
+	results := make(chan string, 1)
+	if err := client.Send("echo", "hello", func(out *string) error {
+		results <- *out
+		return nil
+	}); err != nil {
+		t.Fatalf("发送请求出错：%v", err)
+	}
+
+	select {
+	case r := <-results:
+		if r != "hello" {
+			t.Fatalf("返回数据不正确：%s", r)
+		}
+	case <-time.After(timeout):
+		t.Fatal("未收到返回数据")
+	}
+
+	cancel()
+	t1.Close()
+	t2.Close()
+	if do(t, "关闭连接", func() error { wg.Wait(); return nil }) != nil {
+		t.Fatal("关闭连接出错")
+	}
+}
+
+// 在另一个协程中写入 msgs，写入是否成功在 t 结束之前检测。
+func send(t *testing.T, tr jsonrpc.Transport, msgs ...*message) {
+	go func() {
+		for _, m := range msgs {
+			if err := tr.Write(m); err != nil {
+				t.Errorf("写入 %d 出错：%v", m.ID, err)
+				return
+			}
+		}
+	}()
+}
+
+// 读取一条消息，会忽略 os.ErrDeadlineExceeded。
+func receive(t *testing.T, tr jsonrpc.Transport) *message {
+	t.Helper()
+
+	m := &message{}
+	if err := do(t, "读取", func() error {
+		for {
+			err := tr.Read(m)
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				return err
+			}
+		}
+	}); err != nil {
+		t.Fatalf("读取出错：%v", err)
+	}
+	return m
+}
+
+// 执行 f，超时则中断测试。
+func do(t *testing.T, name string, f func() error) error {
+	t.Helper()
+
+	ret := make(chan error, 1)
+	go func() { ret <- f() }()
+	select {
+	case err := <-ret:
+		return err
+	case <-time.After(timeout):
+		t.Fatalf("%s超时", name)
+		return nil
+	}
+}
+
+func equal(t *testing.T, got, want *message) {
+	t.Helper()
+
+	// 传输层可能会对 JSON 进行重新编码，所以参数按解码之后的值进行比较。
+	var g, w interface{}
+	if len(got.Params) > 0 {
+		if err := json.Unmarshal(got.Params, &g); err != nil {
+			t.Fatalf("无法解码参数：%v", err)
+		}
+	}
+	if len(want.Params) > 0 {
+		if err := json.Unmarshal(want.Params, &w); err != nil {
+			t.Fatalf("无法解码参数：%v", err)
+		}
+	}
+
+	if got.Version != want.Version || got.ID != want.ID || got.Method != want.Method || !reflect.DeepEqual(g, w) {
+		t.Fatalf("消息不一致，期望 %+v，实际 %+v", want, got)
+	}
+}
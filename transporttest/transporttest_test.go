@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package transporttest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/issue9/jsonrpc"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("stream", func(t *testing.T) {
+		Run(t, func() (jsonrpc.Transport, jsonrpc.Transport) {
+			c1, c2 := net.Pipe()
+			return jsonrpc.NewSocketTransport(false, c1, 0), jsonrpc.NewSocketTransport(false, c2, 0)
+		})
+	})
+
+	t.Run("header", func(t *testing.T) {
+		Run(t, func() (jsonrpc.Transport, jsonrpc.Transport) {
+			c1, c2 := net.Pipe()
+			return jsonrpc.NewSocketTransport(true, c1, 0), jsonrpc.NewSocketTransport(true, c2, 0)
+		})
+	})
+
+	t.Run("inprocess", func(t *testing.T) {
+		Run(t, func() (jsonrpc.Transport, jsonrpc.Transport) {
+			return jsonrpc.NewInProcessTransport(false)
+		})
+	})
+
+	t.Run("inprocess-copy", func(t *testing.T) {
+		Run(t, func() (jsonrpc.Transport, jsonrpc.Transport) {
+			return jsonrpc.NewInProcessTransport(true)
+		})
+	})
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// 表示请求有效期的扩展字段，值均为毫秒数。
+const (
+	timestampField = "timestamp" // 请求发出时的 Unix 时间
+	ttlField       = "ttl"       // 请求的有效期
+)
+
+// WithTTL 指定请求的有效期
+//
+// 会在请求中附加 timestamp 和 ttl 两个扩展字段，分别表示发送时间和有效期。
+// 对方在开启了 [Server.KeepExtensions] 的情况下，如果收到请求时已经超过了有效期，
+// 则不再执行而是直接返回 [CodeStale] 错误，
+// 可以防止在故障期间积压的请求在恢复之后被执行。
+//
+// 有效期的判断依赖于双方的系统时间，d 应该远大于双方时钟的误差。
+func WithTTL(d time.Duration) CallOption {
+	return func(o *callOptions) { o.ttl = d }
+}
+
+// 返回在 md 的基础上添加了有效期字段的扩展字段，md 本身不会被修改。
+func withTTL(md map[string]json.RawMessage, now time.Time, ttl time.Duration) map[string]json.RawMessage {
+	ext := make(map[string]json.RawMessage, len(md)+2)
+	for k, v := range md {
+		ext[k] = v
+	}
+	ext[timestampField] = json.RawMessage(strconv.FormatInt(now.UnixMilli(), 10))
+	ext[ttlField] = json.RawMessage(strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return ext
+}
+
+// 请求在 now 时是否已经超过了有效期
+//
+// 缺少或是无法解析有效期字段的，均视为未过期。
+func isStale(req *body, now time.Time) bool {
+	ts, found := req.extensions[timestampField]
+	if !found {
+		return false
+	}
+	ttl, found := req.extensions[ttlField]
+	if !found {
+		return false
+	}
+
+	var t, d int64
+	if json.Unmarshal(ts, &t) != nil || json.Unmarshal(ttl, &d) != nil || d <= 0 {
+		return false
+	}
+	return now.UnixMilli()-t > d
+}
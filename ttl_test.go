@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestIsStale(t *testing.T) {
+	a := assert.New(t, false)
+	now := time.Now()
+
+	md := map[string]json.RawMessage{"k": json.RawMessage(`1`)}
+	ext := withTTL(md, now, time.Second)
+	a.Length(md, 1).Length(ext, 3).Equal(ext["k"], md["k"])
+
+	req := &body{extensions: ext}
+	a.False(isStale(req, now)).
+		False(isStale(req, now.Add(time.Second))).
+		True(isStale(req, now.Add(2*time.Second)))
+
+	// 缺少或无效的字段
+	a.False(isStale(&body{}, now)).
+		False(isStale(&body{extensions: map[string]json.RawMessage{timestampField: ext[timestampField]}}, now.Add(time.Hour))).
+		False(isStale(&body{extensions: map[string]json.RawMessage{timestampField: json.RawMessage(`"x"`), ttlField: ext[ttlField]}}, now.Add(time.Hour))).
+		False(isStale(&body{extensions: map[string]json.RawMessage{timestampField: ext[timestampField], ttlField: json.RawMessage(`0`)}}, now.Add(time.Hour)))
+}
+
+func TestWithTTL(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	srv.KeepExtensions(true)
+
+	var notifyErr *Error
+	srv.NotifyErrHandler(func(_ string, err *Error) { notifyErr = err })
+
+	in, out := new(bytes.Buffer), new(bytes.Buffer)
+	tr := NewStreamTransport(false, in, out, nil)
+	client := srv.NewConn(NewStreamTransport(false, new(bytes.Buffer), in, nil), nil)
+
+	// 有效期内
+	a.NotError(client.Send("f1", &inType{Age: 1}, func(*outType) error { return nil }, WithTTL(time.Minute)))
+	a.Contains(in.String(), `"ttl":60000`).Contains(in.String(), `"timestamp":`)
+	req, err := srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	a.Contains(out.String(), `"result"`)
+
+	// 已经过期
+	out.Reset()
+	ts := strconv.FormatInt(time.Now().Add(-time.Minute).UnixMilli(), 10)
+	in.WriteString(`{"jsonrpc":"2.0","id":"2","method":"f1","params":{"Age":1},"timestamp":` + ts + `,"ttl":1000}`)
+	req, err = srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	resp := &body{}
+	a.NotError(json.Unmarshal(out.Bytes(), resp)).
+		NotNil(resp.Error).
+		Equal(resp.Error.Code, CodeStale)
+
+	// 过期的通知
+	out.Reset()
+	in.WriteString(`{"jsonrpc":"2.0","method":"f1","params":{"Age":1},"timestamp":` + ts + `,"ttl":1000}`)
+	req, err = srv.read(tr)
+	a.NotError(err).NotNil(req)
+	a.NotError(srv.response(tr, req))
+	a.Equal(out.Len(), 0).NotNil(notifyErr).Equal(notifyErr.Code, CodeStale)
+}
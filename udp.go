@@ -5,25 +5,120 @@
 package jsonrpc
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"sync"
 	"time"
 )
 
-type udp struct {
-	conn *net.UDPConn
+// UDP 数据报的最大内容长度，即 65535 减去 IPv4 报头和 UDP 报头的长度。
+const maxDatagramSize = 65507
 
-	addr    *net.UDPAddr
+// ErrMessageTooLarge 编码后的数据超过了单个数据报所能容纳的大小
+//
+// UDP 的传输层在写入时会检测数据的大小，超过 [UDPOptions.MaxSize] 时不会写入，
+// 而是返回一个符合 errors.Is(err, ErrMessageTooLarge) 的错误。
+var ErrMessageTooLarge = errors.New("数据超过了数据报的最大长度")
+
+// 无状态的数据报连接
+//
+// 向最后一次读取的数据报的来源地址写入数据。
+type packet struct {
+	conn net.PacketConn
+
+	addr    net.Addr
 	addrMux sync.RWMutex
 	timeout time.Duration
+
+	allow   func(net.Addr) bool
+	dropped func(net.Addr)
+	max     int // 为 0 表示不限制
 }
 
-func (conn *udp) Read(p []byte) (n int, err error) {
-	var addr *net.UDPAddr
-	conn.conn.SetReadDeadline(time.Now().Add(conn.timeout))
-	n, addr, err = conn.conn.ReadFromUDP(p)
-	if err != nil {
-		return 0, err
+// 限制写入的数据大小的有状态数据报连接
+type datagram struct {
+	io.ReadWriteCloser
+	max int
+}
+
+// UDPOptions UDP 传输层的设置项
+//
+// UDP 是无连接的，任何人都可以伪造数据报的来源地址，
+// 在不作限制的情况下，伪造的请求会被执行，且返回数据会发送给被伪造的地址。
+type UDPOptions struct {
+	// 验证数据报的来源地址
+	//
+	// 返回 false 的数据报会被直接丢弃，既不会被处理，也不会向其返回任何数据。
+	// 可以通过 [UDPAllowlist] 创建基于网段的验证函数。
+	// 为空表示不作验证。
+	//
+	// NOTE: 验证的是数据报中的来源地址，并不能防止伪造成允许范围内地址的数据报，
+	// 需要更高安全性的，应该采用 TCP 等面向连接的传输层。
+	Allow func(*net.UDPAddr) bool
+
+	// 丢弃数据报时调用的函数，可用于记录日志或是统计，可以为空。
+	Dropped func(*net.UDPAddr)
+
+	// 单个数据报的最大字节数
+	//
+	// 包含报头在内的数据超过此值时，写入操作会返回 [ErrMessageTooLarge]。
+	// 为 0 表示采用 UDP 的上限 65507，超过链路 MTU 的数据报会在 IP 层被分片，
+	// 任意分片的丢失都会导致整个数据报丢失，可以根据 MTU 设置为更小的值，比如 1472。
+	MaxSize int
+}
+
+// UDPAllowlist 返回只允许 cidrs 中的地址的验证函数
+//
+// cidrs 为 CIDR 格式的网段，比如 192.168.1.0/24，也可以是单个 IP 地址。
+// 返回值可用于 [UDPOptions.Allow]。
+func UDPAllowlist(cidrs ...string) (func(*net.UDPAddr) bool, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+
+	return func(addr *net.UDPAddr) bool {
+		for _, n := range nets {
+			if n.Contains(addr.IP) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (conn *packet) Read(p []byte) (n int, err error) {
+	var addr net.Addr
+	if conn.timeout > 0 {
+		conn.conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	}
+	for {
+		n, addr, err = conn.conn.ReadFrom(p)
+		if err != nil {
+			return 0, err
+		}
+		if conn.allow == nil || conn.allow(addr) {
+			break
+		}
+		if conn.dropped != nil {
+			conn.dropped(addr)
+		}
 	}
 
 	conn.addrMux.Lock()
@@ -33,16 +128,34 @@ func (conn *udp) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
-func (conn *udp) Write(b []byte) (int, error) {
+func (conn *packet) Write(b []byte) (int, error) {
+	if err := checkDatagram(b, conn.max); err != nil {
+		return 0, err
+	}
+
 	conn.addrMux.RLock()
 	defer conn.addrMux.RUnlock()
-	return conn.conn.WriteToUDP(b, conn.addr)
+	return conn.conn.WriteTo(b, conn.addr)
 }
 
-func (conn *udp) Close() error {
+func (conn *packet) Close() error {
 	return conn.conn.Close()
 }
 
+func (d *datagram) Write(b []byte) (int, error) {
+	if err := checkDatagram(b, d.max); err != nil {
+		return 0, err
+	}
+	return d.ReadWriteCloser.Write(b)
+}
+
+func checkDatagram(b []byte, max int) error {
+	if max > 0 && len(b) > max {
+		return fmt.Errorf("%w：%d 超过了 %d", ErrMessageTooLarge, len(b), max)
+	}
+	return nil
+}
+
 // NewUDPTransport 创建 UDP 传输层
 //
 // UDP 作为服务端是无状态的，在客户端发送一次请求之后，才能发送信息给客户端，
@@ -55,9 +168,31 @@ func (conn *udp) Close() error {
 // [net.DialUDP] 返回的则是有状态的连接。
 // timeout 指定了 udp 在无法读取数据时的超时时间。
 func NewUDPTransport(header bool, conn *net.UDPConn, connected bool, timeout time.Duration) Transport {
-	rw := newSocketStream(conn, timeout)
-	if !connected {
-		rw = &udp{conn: conn, timeout: timeout}
+	return NewUDPTransportWithOptions(header, conn, connected, timeout, nil)
+}
+
+// NewUDPTransportWithOptions 创建 UDP 传输层
+//
+// 与 [NewUDPTransport] 相同，但是可以通过 opt 指定更多的设置，opt 为空表示采用默认值。
+// [UDPOptions.Allow] 和 [UDPOptions.Dropped] 仅在 connected 为 false 时有效。
+func NewUDPTransportWithOptions(header bool, conn *net.UDPConn, connected bool, timeout time.Duration, opt *UDPOptions) Transport {
+	max := maxDatagramSize
+	if opt != nil && opt.MaxSize > 0 {
+		max = opt.MaxSize
+	}
+
+	var rw io.ReadWriteCloser
+	if connected {
+		rw = &datagram{ReadWriteCloser: newSocketStream(conn, timeout, 0), max: max}
+	} else {
+		p := &packet{conn: conn, timeout: timeout, max: max}
+		if opt != nil && opt.Allow != nil {
+			p.allow = func(addr net.Addr) bool { return opt.Allow(addr.(*net.UDPAddr)) }
+		}
+		if opt != nil && opt.Dropped != nil {
+			p.dropped = func(addr net.Addr) { opt.Dropped(addr.(*net.UDPAddr)) }
+		}
+		rw = p
 	}
 	return NewStreamTransport(header, rw, rw, func() error { return rw.Close() })
 }
@@ -68,6 +203,14 @@ func NewUDPTransport(header bool, conn *net.UDPConn, connected bool, timeout tim
 // 其中的 conn 参数由 [net.ListenUDP] 创建，而 connected 统一为 false。
 // timeout 指定了 udp 在无法读取数据时的超时时间。
 func NewUDPServerTransport(header bool, addr string, timeout time.Duration) (Transport, error) {
+	return NewUDPServerTransportWithOptions(header, addr, timeout, nil)
+}
+
+// NewUDPServerTransportWithOptions 声明用于服务的 UDP Transport 接口
+//
+// 与 [NewUDPServerTransport] 相同，但是可以通过 opt 对数据报的来源进行验证，
+// opt 为空表示不作任何限制。
+func NewUDPServerTransportWithOptions(header bool, addr string, timeout time.Duration, opt *UDPOptions) (Transport, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
@@ -78,7 +221,7 @@ func NewUDPServerTransport(header bool, addr string, timeout time.Duration) (Tra
 		return nil, err
 	}
 
-	return NewUDPTransport(header, c, false, timeout), nil
+	return NewUDPTransportWithOptions(header, c, false, timeout, opt), nil
 }
 
 // NewUDPClientTransport 声明用于客户的 UDP Transport 接口
@@ -7,6 +7,9 @@ package jsonrpc
 import (
 	"context"
 	"errors"
+	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -77,3 +80,91 @@ func TestNewUDPClientTransport(t *testing.T) {
 	tp, err = NewUDPClientTransport(true, ":8989", "", time.Second)
 	a.NotError(err).NotNil(tp)
 }
+
+func TestUDPAllowlist(t *testing.T) {
+	a := assert.New(t, false)
+
+	allow, err := UDPAllowlist("192.168.1.0/24", "10.0.0.1", "::1")
+	a.NotError(err).NotNil(allow)
+	a.True(allow(&net.UDPAddr{IP: net.ParseIP("192.168.1.20")})).
+		True(allow(&net.UDPAddr{IP: net.ParseIP("10.0.0.1")})).
+		True(allow(&net.UDPAddr{IP: net.ParseIP("::1")})).
+		False(allow(&net.UDPAddr{IP: net.ParseIP("10.0.0.2")})).
+		False(allow(&net.UDPAddr{IP: net.ParseIP("192.168.2.1")}))
+
+	allow, err = UDPAllowlist("192.168.1.0/33")
+	a.Error(err).Nil(allow)
+}
+
+func TestNewUDPServerTransportWithOptions(t *testing.T) {
+	a := assert.New(t, false)
+
+	var dropped []*net.UDPAddr
+	deny := func(*net.UDPAddr) bool { return false }
+	tr, err := NewUDPServerTransportWithOptions(false, "127.0.0.1:0", 500*time.Millisecond, &UDPOptions{
+		Allow:   deny,
+		Dropped: func(addr *net.UDPAddr) { dropped = append(dropped, addr) },
+	})
+	a.NotError(err).NotNil(tr)
+	addr := tr.(*streamTransport).out.(*packet).conn.LocalAddr().String()
+
+	c, err := net.Dial("udp", addr)
+	a.NotError(err)
+	_, err = c.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"f1"}`))
+	a.NotError(err)
+
+	// 被丢弃，直到超时。
+	a.ErrorIs(tr.Read(&body{}), os.ErrDeadlineExceeded).
+		Length(dropped, 1).
+		Equal(dropped[0].String(), c.LocalAddr().String())
+	a.NotError(tr.Close()).NotError(c.Close())
+
+	// 允许的地址
+	allow, err := UDPAllowlist("127.0.0.1")
+	a.NotError(err)
+	tr, err = NewUDPServerTransportWithOptions(false, "127.0.0.1:0", time.Second, &UDPOptions{Allow: allow})
+	a.NotError(err).NotNil(tr)
+	addr = tr.(*streamTransport).out.(*packet).conn.LocalAddr().String()
+
+	c, err = net.Dial("udp", addr)
+	a.NotError(err)
+	_, err = c.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"f1"}`))
+	a.NotError(err)
+	b := &body{}
+	a.NotError(tr.Read(b)).Equal(b.Method, "f1")
+	a.NotError(tr.Close()).NotError(c.Close())
+
+	// opt 为空
+	tr, err = NewUDPServerTransportWithOptions(false, "127.0.0.1:0", time.Second, nil)
+	a.NotError(err).NotNil(tr).NotError(tr.Close())
+}
+
+func TestUDP_MaxSize(t *testing.T) {
+	a := assert.New(t, false)
+
+	srvT, err := NewUDPServerTransportWithOptions(false, "127.0.0.1:0", time.Second, &UDPOptions{MaxSize: 100})
+	a.NotError(err).NotNil(srvT)
+	defer srvT.Close()
+	addr := srvT.(*streamTransport).out.(*packet).conn.LocalAddr().(*net.UDPAddr)
+
+	c, err := net.DialUDP("udp", nil, addr)
+	a.NotError(err)
+	clientT := NewUDPTransportWithOptions(false, c, true, time.Second, &UDPOptions{MaxSize: 100})
+	defer clientT.Close()
+
+	large := &body{Version: Version, Method: strings.Repeat("m", 100)}
+	a.ErrorIs(clientT.Write(large), ErrMessageTooLarge)
+
+	// 未超过大小的可以正常收发
+	a.NotError(clientT.Write(&body{Version: Version, ID: NewNumberID(1), Method: "f1"}))
+	req := &body{}
+	a.NotError(srvT.Read(req)).Equal(req.Method, "f1")
+	a.ErrorIs(srvT.Write(large), ErrMessageTooLarge)
+	a.NotError(srvT.Write(&body{Version: Version, ID: NewNumberID(1)}))
+	resp := &body{}
+	a.NotError(clientT.Read(resp)).Equal(resp.ID.Number(), 1)
+
+	// 默认值
+	a.ErrorIs(checkDatagram(make([]byte, maxDatagramSize+1), maxDatagramSize), ErrMessageTooLarge).
+		NotError(checkDatagram(make([]byte, maxDatagramSize), maxDatagramSize))
+}
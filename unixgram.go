@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// NewUnixgramTransport 创建基于 unixgram 的传输层
+//
+// 适用于本机进程之间以数据报而不是数据流的方式通讯，
+// 每个数据报即为一条完整的消息，其行为与 [NewUDPTransport] 相同：
+// 作为服务端时，返回数据会发送给最后一次读取的数据报的来源地址。
+//
+// 由于未绑定地址的 unixgram 无法接收数据，作为客户端时，conn 必须绑定了本地地址，
+// 否则服务端无法返回数据。
+//
+// header、connected 和 timeout 的含义与 [NewUDPTransport] 相同。
+// 数据报的大小由系统限制，超过时写入操作会返回系统的错误。
+func NewUnixgramTransport(header bool, conn *net.UnixConn, connected bool, timeout time.Duration) Transport {
+	var rw io.ReadWriteCloser
+	if connected {
+		rw = newSocketStream(conn, timeout, 0)
+	} else {
+		rw = &packet{conn: conn, timeout: timeout}
+	}
+	return NewStreamTransport(header, rw, rw, func() error { return rw.Close() })
+}
+
+// NewUnixgramServerTransport 声明用于服务的 unixgram Transport 接口
+//
+// 这是对 [NewUnixgramTransport] 的二次封装，
+// addr 为监听的文件路径，由 [net.ListenUnixgram] 创建连接，connected 统一为 false。
+func NewUnixgramServerTransport(header bool, addr string, timeout time.Duration) (Transport, error) {
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUnixgramTransport(header, c, false, timeout), nil
+}
+
+// NewUnixgramClientTransport 声明用于客户端的 unixgram Transport 接口
+//
+// 这是对 [NewUnixgramTransport] 的二次封装，
+// 由 [net.DialUnix] 创建连接，connected 统一为 true。
+//
+// raddr 为服务端的文件路径；laddr 为本地绑定的文件路径，用于接收服务端返回的数据，
+// 如果只发送通知，可以为空。
+func NewUnixgramClientTransport(header bool, raddr, laddr string, timeout time.Duration) (Transport, error) {
+	var local *net.UnixAddr
+	if laddr != "" {
+		local = &net.UnixAddr{Name: laddr, Net: "unixgram"}
+	}
+
+	conn, err := net.DialUnix("unixgram", local, &net.UnixAddr{Name: raddr, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUnixgramTransport(header, conn, true, timeout), nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows && !plan9 && !js
+
+package jsonrpc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestUnixgram(t *testing.T) {
+	a := assert.New(t, false)
+	server := initServer(a)
+	dir := t.TempDir()
+	srvAddr := filepath.Join(dir, "srv.sock")
+
+	srvT, err := NewUnixgramServerTransport(true, srvAddr, time.Second)
+	a.NotError(err).NotNil(srvT)
+	srv := server.NewConn(srvT, nil)
+
+	clientT, err := NewUnixgramClientTransport(true, srvAddr, filepath.Join(dir, "client.sock"), time.Second)
+	a.NotError(err).NotNil(clientT)
+	client := server.NewConn(clientT, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		srv.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		client.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	done := make(chan struct{}, 1)
+	a.NotError(client.Send("f1", &inType{Age: 11, Last: "l"}, func(result *outType) error {
+		a.Equal(result.Age, 11).Equal(result.Name, "l")
+		done <- struct{}{}
+		return nil
+	}))
+	<-done
+
+	cancel()
+	<-exit
+	<-exit
+
+	// 地址不存在
+	_, err = NewUnixgramClientTransport(true, filepath.Join(dir, "not-exists.sock"), "", time.Second)
+	a.Error(err)
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import "encoding/json"
+
+// UnroutedHandler 指定处理无法路由的数据的函数
+//
+// 无法路由的数据是指那些可以被解析为 JSON，但既不是有效的请求，
+// 也无法与已发送的请求相关联的返回数据，比如不符合规范的数据或是重复的返回数据等。
+// 默认情况下，这些数据只会被输出到日志，指定 h 之后，则交由 h 处理，
+// 网关等可以借此转发或是分析这些数据。
+// raw 为数据的原始内容，err 为无法路由的原因。
+//
+// 对于无效的请求，依然会向对方返回相应的错误信息。
+// 指定 h 之后需要保留所有数据的原始内容，会产生额外的内存复制。
+// 多次调用会相互覆盖。
+func (s *Server) UnroutedHandler(h func(raw json.RawMessage, err error)) { s.unrouted = h }
+
+// 是否需要保留原始数据
+func (s *Server) keepRaw() bool { return s.raw != nil || s.unrouted != nil }
+
+// 将无法路由的数据交由 UnroutedHandler 处理，如果未指定，则返回 false。
+func (s *Server) handleUnrouted(req *body, err error) bool {
+	if s.unrouted == nil || req == nil || req.raw == nil {
+		return false
+	}
+	s.unrouted(req.raw, err)
+	return true
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_UnroutedHandler(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	var raw string
+	var reason error
+	srv.UnroutedHandler(func(r json.RawMessage, err error) {
+		raw = string(r)
+		reason = err
+	})
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+
+	// 无效的请求
+	in.WriteString(`{"foo":1}`)
+	req, err := srv.read(conn.transport)
+	a.NotError(err).Nil(req).
+		Equal(raw, `{"foo":1}`).
+		NotNil(reason).
+		Contains(out.String(), "-32600")
+
+	// 无法解码为 body
+	raw, reason = "", nil
+	in.WriteString(`"1,2"`)
+	req, err = srv.read(conn.transport)
+	a.NotError(err).Nil(req).
+		Equal(raw, `"1,2"`).
+		NotNil(reason)
+
+	// 批量请求中无法解码的元素
+	raw, reason = "", nil
+	in.WriteString(`[1]`)
+	req, err = srv.read(conn.transport)
+	a.NotError(err).NotNil(req)
+	conn.serve(req, 0)
+	a.Equal(raw, `1`).NotNil(reason)
+
+	// 无法关联的返回数据
+	raw, reason = "", nil
+	in.WriteString(`{"jsonrpc":"2.0","id":"not-exists","result":1}`)
+	req, err = srv.read(conn.transport)
+	a.NotError(err).NotNil(req)
+	conn.serve(req, 0)
+	a.Equal(raw, `{"jsonrpc":"2.0","id":"not-exists","result":1}`).
+		Contains(reason.Error(), "not-exists")
+
+	// 缺少 id 的返回数据
+	for _, stats := range []bool{false, true} {
+		conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+		if stats {
+			conn.CollectStats(false)
+		}
+		raw, reason = "", nil
+		in.WriteString(`{"jsonrpc":"2.0","result":1}`)
+		req, err = srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		a.NotPanic(func() { conn.serve(req, 0) })
+		a.Equal(raw, `{"jsonrpc":"2.0","result":1}`).NotNil(reason)
+	}
+
+	// 正常的请求
+	raw, reason = "", nil
+	in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"f1","params":{}}`)
+	req, err = srv.read(conn.transport)
+	a.NotError(err).NotNil(req)
+	conn.serve(req, 0)
+	a.Empty(raw).Nil(reason)
+}
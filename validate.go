@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Validator 验证参数的接口
+//
+// 服务函数的 params 如果实现了此接口，会在调用服务函数之前调用 Validate 进行验证。
+type Validator interface {
+	Validate() error
+}
+
+// FieldError 单个字段的验证错误
+type FieldError struct {
+	// 字段名
+	Field string `json:"field"`
+
+	// 错误信息
+	Message string `json:"message"`
+}
+
+// FieldErrors 字段验证错误的集合
+//
+// 验证函数返回此类型的错误时，各个字段的错误信息会作为 [Error.Data] 返回给对方。
+type FieldErrors []*FieldError
+
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Field+": "+err.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// RegisterValidator 注册验证参数的函数
+//
+// f 会在调用服务函数之前对 params 进行验证，可以用于集成基于 struct tag 的验证库，
+// 比如 github.com/go-playground/validator 的 Validate.Struct 方法，
+// 如果需要返回字段级别的错误信息，可以将其错误转换为 [FieldErrors] 类型。
+// 如果 params 同时实现了 [Validator] 接口，则先调用 f。
+//
+// 验证失败时返回 [CodeInvalidParams] 错误，如果 f 返回的是 *[Error]，则原样返回。
+//
+// NOTE: 如果多次调用，仅最后次启作用。
+func (s *Server) RegisterValidator(f func(params interface{}) error) { s.validator = f }
+
+// 对参数 v 进行验证
+func validate(f func(interface{}) error, v interface{}) error {
+	if f != nil {
+		if err := f(v); err != nil {
+			return newValidationError(err)
+		}
+	}
+
+	if val, ok := v.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			return newValidationError(err)
+		}
+	}
+
+	return nil
+}
+
+func newValidationError(err error) *Error {
+	var fields FieldErrors
+	if errors.As(err, &fields) {
+		return NewErrorWithData(CodeInvalidParams, err.Error(), fields)
+	}
+	return NewErrorWithError(CodeInvalidParams, err)
+}
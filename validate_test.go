@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+var _ error = FieldErrors{}
+
+type validType struct {
+	Age int `json:"age"`
+}
+
+func (v *validType) Validate() error {
+	if v.Age < 0 {
+		return FieldErrors{{Field: "age", Message: "不能小于 0"}}
+	}
+	if v.Age > 200 {
+		return errors.New("too old")
+	}
+	return nil
+}
+
+func TestServer_RegisterValidator(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+	a.True(srv.Register("valid", func(notify bool, in, out *validType) error {
+		out.Age = in.Age
+		return nil
+	}))
+
+	call := func(method string, in interface{}) *body {
+		out := new(bytes.Buffer)
+		req, err := srv.newRequest(false, method, in)
+		a.NotError(err)
+		a.NotError(srv.response(NewStreamTransport(false, new(bytes.Buffer), out, nil), req))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	resp := call("valid", &validType{Age: 1})
+	a.Nil(resp.Error)
+
+	// Validator 接口
+	resp = call("valid", &validType{Age: -1})
+	a.Equal(resp.Error.Code, CodeInvalidParams).
+		Equal(resp.Error.Message, "age: 不能小于 0").
+		Equal(resp.Error.Data, []interface{}{map[string]interface{}{"field": "age", "message": "不能小于 0"}})
+
+	resp = call("valid", &validType{Age: 201})
+	a.Equal(resp.Error.Code, CodeInvalidParams).
+		Equal(resp.Error.Message, "too old").
+		Nil(resp.Error.Data)
+
+	// RegisterValidator
+	srv.RegisterValidator(func(v interface{}) error {
+		if in, ok := v.(*inType); ok && in.Age == 0 {
+			return fmt.Errorf("包装的错误：%w", FieldErrors{{Field: "Age", Message: "required"}})
+		}
+		if in, ok := v.(*validType); ok && in.Age == 500 {
+			return NewError(-32010, "custom")
+		}
+		return nil
+	})
+
+	resp = call("f1", &inType{Age: 0})
+	a.Equal(resp.Error.Code, CodeInvalidParams).
+		Equal(resp.Error.Data, []interface{}{map[string]interface{}{"field": "Age", "message": "required"}})
+
+	resp = call("f1", &inType{Age: 1})
+	a.Nil(resp.Error)
+
+	resp = call("valid", &validType{Age: 500})
+	a.Equal(resp.Error.Code, -32010)
+
+	// 两者同时存在
+	resp = call("valid", &validType{Age: -1})
+	a.Equal(resp.Error.Code, CodeInvalidParams)
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+type valuesKey struct{}
+
+// Values 与连接相关的键值对
+//
+// 可用于保存会话数据、身份信息或是限流器等与连接生命周期一致的数据，
+// 而不需要在外部维护以连接为键名的全局对象。
+// 可以并发访问，在 [Conn.Serve] 退出时会被清空。
+func (conn *Conn) Values() *sync.Map { return &conn.values }
+
+// ConnValues 返回 ctx 对应连接的 [Conn.Values]
+//
+// ctx 为回调函数或是服务函数的 context.Context 参数，如果不是由 [Conn] 传递的，则返回 nil。
+func ConnValues(ctx context.Context) *sync.Map {
+	if v, ok := ctx.Value(valuesKey{}).(*sync.Map); ok {
+		return v
+	}
+	return nil
+}
+
+func (conn *Conn) clearValues() {
+	conn.values.Range(func(k, _ interface{}) bool {
+		conn.values.Delete(k)
+		return true
+	})
+}
+
+// 返回 [Conn.Serve] 的 ctx 参数，未调用 [Conn.Serve] 时返回 context.Background。
+func (conn *Conn) context() context.Context {
+	if c, ok := conn.ctx.Load().(serveContext); ok {
+		return c.ctx
+	}
+	return context.Background()
+}
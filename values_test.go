@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestConn_Values(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	a.Nil(ConnValues(context.Background()))
+
+	c1, c2 := net.Pipe()
+	conn := srv.NewConn(NewSocketTransport(false, c1, 0), nil)
+	peer := srv.NewConn(NewSocketTransport(false, c2, 0), nil)
+	conn.Values().Store("user", "u1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{}, 2)
+	go func() {
+		conn.Serve(ctx)
+		exit <- struct{}{}
+	}()
+	go func() {
+		peer.Serve(ctx)
+		exit <- struct{}{}
+	}()
+
+	// 回调函数中可以访问
+	var user atomic.Value
+	a.NotError(conn.Send("f1", &inType{Age: 1}, func(ctx context.Context, out *outType) error {
+		v, _ := ConnValues(ctx).Load("user")
+		user.Store(v)
+		return nil
+	}))
+	for user.Load() == nil {
+		runtime.Gosched()
+	}
+	a.Equal(user.Load(), "u1")
+
+	// Serve 退出之后被清空
+	cancel()
+	c1.Close()
+	c2.Close()
+	<-exit
+	<-exit
+	_, found := conn.Values().Load("user")
+	a.False(found)
+}
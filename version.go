@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionSeparator 服务名与版本号之间的分隔符
+//
+// 指定了版本的服务，其完整的服务名为 method@version，比如 user.get@2。
+const VersionSeparator = "@"
+
+// 请求中指定服务版本的扩展字段名
+const versionField = "version"
+
+// RegisterVersion 注册服务 method 的 version 版本
+//
+// 注册之后，可以通过以下方式调用指定版本的服务：
+//   - 以 method@version 作为服务名，比如 user.get@2；
+//   - 在 [Server.KeepExtensions] 为 true 时，通过扩展字段 version 指定版本号；
+//
+// 未指定版本时，调用的是通过 [Registry.Register] 等方法注册的同名服务，
+// 如果不存在同名的服务，则调用版本号最大的服务。
+//
+// f 和 opts 与 [Registry.RegisterWith] 相同，version 必须大于 0，否则会 panic。
+// 如果该版本已经存在，则返回 false。
+func (r *Registry) RegisterVersion(method string, version int, f interface{}, opts ...MethodOption) bool {
+	if version <= 0 {
+		panic(fmt.Sprintf("无效的版本号 %d", version))
+	}
+
+	name := versionedName(method, version)
+	if r.Exists(name) {
+		return false
+	}
+
+	h := newHandler(f)
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return r.update(func(t *table) bool {
+		if t.exists(name) {
+			return false
+		}
+		t.servers[name] = h
+
+		versions := append(make([]int, 0, len(t.versions[method])+1), t.versions[method]...)
+		versions = append(versions, version)
+		sort.Ints(versions)
+		t.versions[method] = versions
+		return true
+	})
+}
+
+// Versions 返回服务 method 所有已注册的版本号
+//
+// 返回值按从小到大排序，不存在时返回空值。
+func (r *Registry) Versions(method string) []int {
+	versions := r.load().versions[method]
+	if len(versions) == 0 {
+		return nil
+	}
+	return append(make([]int, 0, len(versions)), versions...)
+}
+
+// RegisterVersion 注册服务 method 的 version 版本
+//
+// 具体说明可参考 [Registry.RegisterVersion]。
+func (s *Server) RegisterVersion(method string, version int, f interface{}, opts ...MethodOption) bool {
+	return s.methods().RegisterVersion(method, version, f, opts...)
+}
+
+// Versions 返回服务 method 所有已注册的版本号
+//
+// 具体说明可参考 [Registry.Versions]。
+func (s *Server) Versions(method string) []int { return s.methods().Versions(method) }
+
+// WithVersion 请求服务的指定版本
+//
+// 会以 method@version 的形式作为请求的服务名，具体可参考 [Registry.RegisterVersion]。
+func WithVersion(version int) CallOption {
+	return func(o *callOptions) { o.version = version }
+}
+
+func versionedName(method string, version int) string {
+	return method + VersionSeparator + strconv.Itoa(version)
+}
+
+// 返回请求实际调用的服务名
+//
+// 如果通过扩展字段指定了版本，则返回带版本号的服务名。
+func requestMethod(req *body) string {
+	v, found := req.extensions[versionField]
+	if !found || strings.Contains(req.Method, VersionSeparator) {
+		return req.Method
+	}
+
+	version, err := strconv.Atoi(strings.Trim(string(v), `"`))
+	if err != nil || version <= 0 {
+		return req.Method
+	}
+	return versionedName(req.Method, version)
+}
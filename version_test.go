@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestRegistry_RegisterVersion(t *testing.T) {
+	a := assert.New(t, false)
+	r := NewRegistry()
+
+	f := func(notify bool, in, out *int) error { return nil }
+	a.Panic(func() { r.RegisterVersion("m", 0, f) })
+
+	a.True(r.RegisterVersion("m", 2, f)).
+		True(r.RegisterVersion("m", 1, f)).
+		False(r.RegisterVersion("m", 2, f)).
+		True(r.Exists("m@1")).
+		False(r.Exists("m"))
+	a.Equal(r.Versions("m"), []int{1, 2}).
+		Nil(r.Versions("not-exists")).
+		Equal(r.Methods(), []string{"m@1", "m@2"})
+
+	// 未指定版本时采用最新的版本
+	h, _ := r.lookup("m")
+	h2, _ := r.lookup("m@2")
+	a.NotNil(h).True(h == h2)
+
+	// 同名的服务优先
+	a.True(r.Register("m", f))
+	h, _ = r.lookup("m")
+	a.True(h != h2)
+}
+
+func TestServer_RegisterVersion(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	for v := 1; v <= 2; v++ {
+		version := v
+		a.True(srv.RegisterVersion("user.get", version, func(notify bool, in, out *int) error {
+			*out = version
+			return nil
+		}))
+	}
+	a.Equal(srv.Versions("user.get"), []int{1, 2})
+
+	call := func(data string) *body {
+		in := bytes.NewBufferString(data)
+		out := new(bytes.Buffer)
+		transport := NewStreamTransport(false, in, out, nil)
+		req, err := srv.read(transport)
+		a.NotError(err).NotNil(req)
+		a.NotError(srv.response(transport, req))
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0}`).Result), "2").
+		Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get@1","params":0}`).Result), "1").
+		Equal(call(`{"jsonrpc":"2.0","id":"1","method":"user.get@3","params":0}`).Error.Code, CodeMethodNotFound)
+
+	// 未启用扩展字段时，忽略 version。
+	a.Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0,"version":1}`).Result), "2")
+
+	srv.KeepExtensions(true)
+	a.Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0,"version":1}`).Result), "1").
+		Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0,"version":"1"}`).Result), "1").
+		Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0,"version":"x"}`).Result), "2").
+		Equal(string(*call(`{"jsonrpc":"2.0","id":"1","method":"user.get@2","params":0,"version":1}`).Result), "2").
+		Equal(call(`{"jsonrpc":"2.0","id":"1","method":"user.get","params":0,"version":5}`).Error.Code, CodeMethodNotFound)
+}
+
+func TestWithVersion(t *testing.T) {
+	a := assert.New(t, false)
+
+	req := &body{Method: "m"}
+	newCallOptions([]CallOption{WithVersion(2)}).apply(context.Background(), req, systemClock{})
+	a.Equal(req.Method, "m@2")
+
+	req = &body{Method: "m"}
+	newCallOptions([]CallOption{WithVersion(0)}).apply(context.Background(), req, systemClock{})
+	a.Equal(req.Method, "m")
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import "net/http"
+
+// Peer 请求方的信息
+type Peer struct {
+	// 对方的地址，与 [Incident.Peer] 相同。
+	Addr string
+
+	// 对方的身份信息
+	//
+	// 比如租户或是 API key 等，由 [Conn.Identify] 或 [HTTPConn.Identify] 指定，
+	// 未指定时为 nil。
+	Identity interface{}
+}
+
+// Visibility 指定服务的可见性
+//
+// f 在查找服务之前调用，method 为请求的服务名，
+// 如果返回 false，则向对方返回与服务不存在相同的 [CodeMethodNotFound] 错误。
+// 可用于多租户的场景下，根据对方的身份只公开部分服务。
+//
+// f 为空表示所有服务都可见。多次调用会相互覆盖。
+func (s *Server) Visibility(f func(p Peer, method string) bool) { s.visible = f }
+
+// Identify 指定对方的身份信息
+//
+// 一般在完成身份验证之后调用，之后的请求都会以 v 作为 [Peer.Identity] 的值。
+func (conn *Conn) Identify(v interface{}) { conn.identity.Store(&identity{v: v}) }
+
+// Identify 指定从请求中获取对方身份信息的方法
+//
+// f 的返回值将作为 [Peer.Identity] 的值，比如根据报头中的 API key 返回对应的租户。
+//
+// NOTE: 需要在处理请求之前调用。
+func (h *HTTPConn) Identify(f func(*http.Request) interface{}) { h.identify = f }
+
+// 包装身份信息，atomic.Value 要求每次存储的类型相同。
+type identity struct {
+	v interface{}
+}
+
+// 请求 req 是否可见
+func (s *Server) isVisible(t Transport, req *body) bool {
+	return s.visible == nil || s.visible(Peer{Addr: peerOf(t), Identity: req.identity}, req.Method)
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2020-2024 caixw
+//
+// SPDX-License-Identifier: MIT
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/issue9/assert/v4"
+)
+
+func TestServer_Visibility(t *testing.T) {
+	a := assert.New(t, false)
+	srv := initServer(a)
+
+	var peer Peer
+	srv.Visibility(func(p Peer, method string) bool {
+		peer = p
+		return p.Identity == "admin" || !strings.HasPrefix(method, "admin.")
+	})
+	a.True(srv.Register("admin.f1", func(notify bool, in *inType, out *outType) error { return nil }))
+
+	in := new(bytes.Buffer)
+	out := new(bytes.Buffer)
+	conn := srv.NewConn(NewStreamTransport(false, in, out, nil), nil)
+	call := func(method string) *body {
+		out.Reset()
+		in.WriteString(`{"jsonrpc":"2.0","id":"1","method":"` + method + `","params":{}}`)
+		req, err := srv.read(conn.transport)
+		a.NotError(err).NotNil(req)
+		conn.serve(req, 0)
+
+		resp := &body{}
+		a.NotError(json.Unmarshal(out.Bytes(), resp))
+		return resp
+	}
+
+	a.Equal(call("admin.f1").Error.Code, CodeMethodNotFound).
+		Nil(peer.Identity)
+	a.Nil(call("f1").Error)
+
+	conn.Identify("admin")
+	a.Nil(call("admin.f1").Error).
+		Equal(peer.Identity, "admin")
+
+	srv.Visibility(nil)
+	conn.Identify(nil)
+	a.Nil(call("admin.f1").Error)
+}
+
+func TestHTTPConn_Identify(t *testing.T) {
+	a := assert.New(t, false)
+	s := initServer(a)
+	a.True(s.Register("admin.f1", func(notify bool, in *inType, out *outType) error { return nil }))
+	s.Visibility(func(p Peer, method string) bool {
+		return p.Identity == "admin" || !strings.HasPrefix(method, "admin.")
+	})
+
+	conn := s.NewHTTPConn("", nil)
+	conn.Identify(func(r *http.Request) interface{} {
+		if r.Header.Get("X-Api-Key") == "key" {
+			return "admin"
+		}
+		return nil
+	})
+	srv := httptest.NewServer(conn)
+	defer srv.Close()
+
+	call := func(key string) *body {
+		r, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"admin.f1","params":{}}`))
+		a.NotError(err)
+		r.Header.Set("X-Api-Key", key)
+		resp, err := http.DefaultClient.Do(r)
+		a.NotError(err)
+		defer resp.Body.Close()
+
+		b := &body{}
+		a.NotError(json.NewDecoder(resp.Body).Decode(b))
+		return b
+	}
+
+	a.Equal(call("").Error.Code, CodeMethodNotFound)
+	a.Nil(call("key").Error)
+}
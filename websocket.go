@@ -5,13 +5,15 @@
 package jsonrpc
 
 import (
+	"encoding/json"
 	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
 type websocketTransport struct {
-	conn *websocket.Conn
+	conn      *websocket.Conn
+	threshold int
 
 	inMux  sync.Mutex
 	outMux sync.Mutex
@@ -22,6 +24,16 @@ func NewWebsocketTransport(conn *websocket.Conn) Transport {
 	return &websocketTransport{conn: conn}
 }
 
+// NewWebsocketTransportWithCompression 声明支持按消息压缩的 websocket Transport 实例
+//
+// 长度达到 threshold 的消息才会被压缩，较小的消息则不压缩，以节省 CPU。
+// 压缩依赖于 websocket 的 permessage-deflate 扩展，
+// 需要在 [websocket.Upgrader] 和 [websocket.Dialer] 中启用 EnableCompression，
+// 否则不会有任何效果。读取时的解压由 websocket 包自动完成。
+func NewWebsocketTransportWithCompression(conn *websocket.Conn, threshold int) Transport {
+	return &websocketTransport{conn: conn, threshold: threshold}
+}
+
 func (s *websocketTransport) Read(v interface{}) error {
 	s.inMux.Lock()
 	defer s.inMux.Unlock()
@@ -30,12 +42,26 @@ func (s *websocketTransport) Read(v interface{}) error {
 }
 
 func (s *websocketTransport) Write(v interface{}) error {
+	if s.threshold <= 0 {
+		s.outMux.Lock()
+		defer s.outMux.Unlock()
+		return s.conn.WriteJSON(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
 	s.outMux.Lock()
 	defer s.outMux.Unlock()
 
-	return s.conn.WriteJSON(v)
+	s.conn.EnableWriteCompression(len(data) >= s.threshold)
+	return s.conn.WriteMessage(websocket.TextMessage, data)
 }
 
+func (s *websocketTransport) Peer() string { return s.conn.RemoteAddr().String() }
+
 func (s *websocketTransport) Close() error {
 	return s.conn.Close()
 }
@@ -60,3 +60,30 @@ func TestNewWebsocketTransport(t *testing.T) {
 
 	cancel()
 }
+
+func TestNewWebsocketTransportWithCompression(t *testing.T) {
+	a := assert.New(t, false)
+
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		a.NotError(err).NotNil(conn)
+		defer conn.Close()
+
+		t := NewWebsocketTransportWithCompression(conn, 100)
+		a.NotError(t.Write(&body{Version: Version, Method: "m"}))
+		a.NotError(t.Write(&body{Version: Version, Method: strings.Repeat("m", 200)}))
+	}))
+	defer srv.Close()
+
+	dialer := &websocket.Dialer{EnableCompression: true}
+	conn, _, err := dialer.Dial(strings.Replace(srv.URL, "http", "ws", 1), nil)
+	a.NotError(err)
+	defer conn.Close()
+
+	client := NewWebsocketTransport(conn)
+	req := &body{}
+	a.NotError(client.Read(req)).Equal(req.Method, "m")
+	req = &body{}
+	a.NotError(client.Read(req)).Equal(req.Method, strings.Repeat("m", 200))
+}